@@ -0,0 +1,130 @@
+// Command migrate copies the recent actions, along with the cursor of the
+// scheduler, from one store backend to another, e.g, from a local sqlite
+// database to a production MongoDB. It only relies on the CodeforcesStore
+// interface, hence it works between any two backends.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/mongodb"
+	"github.com/variety-jones/cfrss/pkg/store/postgres"
+	"github.com/variety-jones/cfrss/pkg/store/redis"
+	"github.com/variety-jones/cfrss/pkg/store/sqlite"
+)
+
+const (
+	kDefaultBatchSize      = 1000
+	kDefaultDatabaseName   = "cfrss-local"
+	kDefaultCollectionName = "recent_actions"
+	kDefaultRedisKeyPrefix = "cfrss:"
+
+	kDefaultShutdownTimeoutSeconds = 10
+)
+
+func main() {
+	var fromBackend, fromUrl, toBackend, toUrl string
+	var databaseName, collectionName, redisKeyPrefix string
+	var batchSize, since int64
+	flag.StringVar(&fromBackend, "from", "",
+		"The backend to read the actions from, one of mongo, sqlite, "+
+			"postgres and redis")
+	flag.StringVar(&fromUrl, "from-url", "",
+		"The URL of the source store, or the path of the sqlite database")
+	flag.StringVar(&toBackend, "to", "",
+		"The backend to write the actions to, one of mongo, sqlite, "+
+			"postgres and redis")
+	flag.StringVar(&toUrl, "to-url", "",
+		"The URL of the destination store, or the path of the sqlite database")
+	flag.StringVar(&databaseName, "database-name", kDefaultDatabaseName,
+		"The name of the MongoDB database of either store")
+	flag.StringVar(&collectionName, "collection-name", kDefaultCollectionName,
+		"The MongoDB collection of the recent actions of either store")
+	flag.StringVar(&redisKeyPrefix, "redis-key-prefix", kDefaultRedisKeyPrefix,
+		"The prefix of the redis keys of either store")
+	flag.Int64Var(&batchSize, "batch-size", kDefaultBatchSize,
+		"The number of actions copied at once")
+	flag.Int64Var(&since, "since", 0,
+		"The unix timestamp from which the actions are copied")
+
+	// Parse all the flags.
+	flag.Parse()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+
+	if batchSize <= 0 {
+		zap.S().Fatal("batch-size should be positive")
+	}
+
+	src, err := openStore(fromBackend, fromUrl, databaseName, collectionName,
+		redisKeyPrefix)
+	if err != nil {
+		zap.S().Fatalf("Could not open the source store with error [%+v]",
+			err)
+	}
+	dst, err := openStore(toBackend, toUrl, databaseName, collectionName,
+		redisKeyPrefix)
+	if err != nil {
+		closeStore(src)
+		zap.S().Fatalf("Could not open the destination store with "+
+			"error [%+v]", err)
+	}
+
+	// The migration is interrupted on a termination signal, and can be
+	// resumed by running it again since the stores skip the duplicates.
+	ctx, stop := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = migrate(ctx, src, dst, since, batchSize)
+	closeStore(src)
+	closeStore(dst)
+	if err != nil {
+		zap.S().Errorf("Migration failed with error [%+v]", err)
+		logger.Sync()
+		os.Exit(1)
+	}
+}
+
+// openStore connects to the store of the given backend.
+func openStore(backend, url, databaseName, collectionName,
+	redisKeyPrefix string) (store.CodeforcesStore, error) {
+	switch backend {
+	case "mongo":
+		return mongodb.NewMongoStore(url, databaseName, 0,
+			mongodb.WithCollectionName(collectionName))
+	case "sqlite":
+		return sqlite.NewSQLiteStore(url)
+	case "postgres":
+		return postgres.NewPostgresStore(url)
+	case "redis":
+		return redis.NewRedisStore(url, redisKeyPrefix)
+	default:
+		return nil, errors.Errorf("unknown store backend %s", backend)
+	}
+}
+
+// closeStore disconnects from the store.
+func closeStore(cfStore store.CodeforcesStore) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		kDefaultShutdownTimeoutSeconds*time.Second)
+	defer cancel()
+	if err := cfStore.Close(shutdownCtx); err != nil {
+		zap.S().Errorf("Could not close the store with error [%+v]", err)
+	}
+}
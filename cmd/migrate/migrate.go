@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+// migrate copies the actions that happened at or after since from src to
+// dst, batchSize actions at a time, followed by the cursor. The actions are
+// streamed from src oldest first, hence only a single batch is ever held in
+// memory.
+//
+// The users and their subscriptions are not copied, since the interface
+// can't list them.
+func migrate(ctx context.Context, src, dst store.CodeforcesStore,
+	since, batchSize int64) error {
+	total, err := src.CountRecentActions(ctx)
+	if err != nil {
+		return errors.Errorf("counting of the source actions failed "+
+			"with error [%v]", err)
+	}
+	zap.S().Infof("Migrating up to %d actions since timestamp %d...",
+		total, since)
+
+	// Cancelling the stream releases it if the migration fails midway.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, errs := src.StreamRecentActions(ctx, since)
+
+	var copied int64
+	batch := make([]models.RecentAction, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := dst.AddRecentActions(ctx, batch); err != nil {
+			return errors.Errorf("insertion of %d actions failed after %d "+
+				"with error [%v]", len(batch), copied, err)
+		}
+		copied += int64(len(batch))
+		zap.S().Infof("Copied %d/%d actions, till timestamp %d", copied,
+			total, batch[len(batch)-1].TimeSeconds)
+		batch = make([]models.RecentAction, 0, batchSize)
+		return nil
+	}
+	for action := range stream {
+		batch = append(batch, action)
+		if int64(len(batch)) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := <-errs; err != nil {
+		return errors.Errorf("streaming of the source actions failed "+
+			"with error [%v]", err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// The cursor is copied last, so that it never runs ahead of the copied
+	// actions.
+	cursor, err := src.LoadCursor(ctx)
+	if err != nil {
+		return errors.Errorf("loading of the source cursor failed "+
+			"with error [%v]", err)
+	}
+	if cursor > 0 {
+		if err := dst.SaveCursor(ctx, cursor); err != nil {
+			return errors.Errorf("saving of the cursor failed with error [%v]",
+				err)
+		}
+	}
+	zap.S().Infof("Migrated %d actions and the cursor %d", copied, cursor)
+	return nil
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+)
+
+// Config is the structured configuration loaded from the file passed with
+// -config. Each field mirrors a flag, and the keys missing from the file are
+// left to the flags, so that a file only needs the settings that differ.
+type Config struct {
+	Environment string `yaml:"environment"`
+	LogLevel    string `yaml:"logLevel"`
+	ServerAddr  string `yaml:"serverAddr"`
+
+	// DebugEndpoints serves the internal state of the scheduler, which is
+	// opt-in since it is served on the public listener.
+	DebugEndpoints bool `yaml:"debugEndpoints"`
+
+	HTTP      HTTPConfig      `yaml:"http"`
+	Store     StoreConfig     `yaml:"store"`
+	Mongo     MongoConfig     `yaml:"mongo"`
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+	CFAPI     CFAPIConfig     `yaml:"cfapi"`
+	Feed      FeedConfig      `yaml:"feed"`
+
+	// keys are the dotted paths of the keys set in the file, which tell an
+	// explicit zero apart from a missing key.
+	keys map[string]bool
+}
+
+// HTTPConfig bounds the requests to the web server, and lists the origins
+// allowed to read the JSON API.
+type HTTPConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	CORSOrigins       []string      `yaml:"corsOrigins"`
+	RateLimit         float64       `yaml:"rateLimit"`
+	RateLimitBurst    int           `yaml:"rateLimitBurst"`
+	TrustedProxies    []string      `yaml:"trustedProxies"`
+}
+
+// StoreConfig selects the database backing the store.
+type StoreConfig struct {
+	Backend        string `yaml:"backend"`
+	SQLitePath     string `yaml:"sqlitePath"`
+	PostgresUrl    string `yaml:"postgresUrl"`
+	RedisUrl       string `yaml:"redisUrl"`
+	RedisKeyPrefix string `yaml:"redisKeyPrefix"`
+	RetentionDays  int    `yaml:"retentionDays"`
+}
+
+// MongoConfig configures the MongoDB store.
+type MongoConfig struct {
+	Addr            string        `yaml:"addr"`
+	DatabaseName    string        `yaml:"databaseName"`
+	Collection      string        `yaml:"collection"`
+	InsertBatchSize int           `yaml:"insertBatchSize"`
+	ConnectAttempts int           `yaml:"connectAttempts"`
+	ConnectDelay    time.Duration `yaml:"connectDelay"`
+}
+
+// SchedulerConfig configures the polling of Codeforces.
+type SchedulerConfig struct {
+	Enabled              bool          `yaml:"enabled"`
+	SelfCheck            bool          `yaml:"selfCheck"`
+	CooldownMinutes      int           `yaml:"cooldownMinutes"`
+	CooldownJitter       float64       `yaml:"cooldownJitter"`
+	CycleTimeout         time.Duration `yaml:"cycleTimeout"`
+	BatchSize            int           `yaml:"batchSize"`
+	AdaptiveBatchSize    bool          `yaml:"adaptiveBatchSize"`
+	OldestFirst          bool          `yaml:"oldestFirst"`
+	HydrationConcurrency int           `yaml:"hydrationConcurrency"`
+	FutureTolerance      time.Duration `yaml:"futureTolerance"`
+	PollBlogEntries      []int         `yaml:"pollBlogEntries"`
+	PollCooldown         time.Duration `yaml:"pollCooldown"`
+}
+
+// CFAPIConfig holds the optional credentials of the Codeforces API, and how
+// the client identifies itself.
+type CFAPIConfig struct {
+	Key       string `yaml:"key"`
+	Secret    string `yaml:"secret"`
+	UserAgent string `yaml:"userAgent"`
+	Contact   string `yaml:"contact"`
+	Proxy     string `yaml:"proxy"`
+
+	BreakerThreshold int           `yaml:"breakerThreshold"`
+	BreakerCooldown  time.Duration `yaml:"breakerCooldown"`
+	CacheTTL         time.Duration `yaml:"cacheTTL"`
+}
+
+// FeedConfig configures the feeds served by the web server.
+type FeedConfig struct {
+	Window        time.Duration `yaml:"window"`
+	MaxItems      int64         `yaml:"maxItems"`
+	Handles       []string      `yaml:"handles"`
+	WebSubHubs    []string      `yaml:"webSubHubs"`
+	PublicUrl     string        `yaml:"publicUrl"`
+	AuthorRatings bool          `yaml:"authorRatings"`
+
+	MinRating      int  `yaml:"minRating"`
+	IncludeUnrated bool `yaml:"includeUnrated"`
+
+	Title       string        `yaml:"title"`
+	Description string        `yaml:"description"`
+	SiteUrl     string        `yaml:"siteUrl"`
+	Language    string        `yaml:"language"`
+	TTL         time.Duration `yaml:"ttl"`
+
+	Content       string `yaml:"content"`
+	SummaryLength int    `yaml:"summaryLength"`
+	Sanitize      string `yaml:"sanitize"`
+	Republish     string `yaml:"republish"`
+
+	MinContentLength int `yaml:"minContentLength"`
+}
+
+// loadConfig reads and validates the YAML config in the file. Unknown keys
+// are rejected, so that a typo doesn't silently fall back to a default.
+func loadConfig(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("could not open the config %s with "+
+			"error [%v]", path, err)
+	}
+
+	config := new(Config)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, errors.Errorf("could not parse the config %s with "+
+			"error [%v]", path, err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, errors.Errorf("could not parse the config %s with "+
+			"error [%v]", path, err)
+	}
+	config.keys = make(map[string]bool)
+	collectKeys(&root, "", config.keys)
+	if err := config.validate(); err != nil {
+		return nil, errors.Errorf("invalid config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// validate returns an error describing the first invalid value.
+func (config *Config) validate() error {
+	switch config.LogLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return errors.Errorf("logLevel should be one of debug, info, warn "+
+			"and error, got %s", config.LogLevel)
+	}
+	switch config.Store.Backend {
+	case "", "mongo", "sqlite", "postgres", "redis":
+	default:
+		return errors.Errorf("store.backend should be one of mongo, sqlite, "+
+			"postgres and redis, got %s", config.Store.Backend)
+	}
+	switch config.Feed.Content {
+	case "", "full", "summary":
+	default:
+		return errors.Errorf("feed.content should be one of full and "+
+			"summary, got %s", config.Feed.Content)
+	}
+	switch config.Feed.Republish {
+	case "", "original", "updated":
+	default:
+		return errors.Errorf("feed.republish should be one of original and "+
+			"updated, got %s", config.Feed.Republish)
+	}
+	if config.Feed.Language != "" &&
+		!feed.IsSupportedLocale(config.Feed.Language) {
+		return errors.Errorf("feed.language should be one of en and ru, "+
+			"got %s", config.Feed.Language)
+	}
+	switch config.Feed.Sanitize {
+	case "", "ugc", "strict":
+	default:
+		return errors.Errorf("feed.sanitize should be one of ugc and "+
+			"strict, got %s", config.Feed.Sanitize)
+	}
+	if _, err := parseTrustedProxies(strings.Join(config.HTTP.TrustedProxies,
+		",")); err != nil {
+		return errors.Errorf("http.trustedProxies is invalid with error [%v]",
+			err)
+	}
+
+	switch {
+	case config.HTTP.ReadHeaderTimeout < 0 || config.HTTP.ReadTimeout < 0 ||
+		config.HTTP.WriteTimeout < 0 || config.HTTP.IdleTimeout < 0:
+		return errors.New("the http timeouts should not be negative")
+	case config.HTTP.RateLimit < 0:
+		return errors.New("http.rateLimit should not be negative")
+	case config.HTTP.RateLimitBurst < 0:
+		return errors.New("http.rateLimitBurst should not be negative")
+	case config.Store.RetentionDays < 0:
+		return errors.New("store.retentionDays should not be negative")
+	case config.Mongo.InsertBatchSize < 0:
+		return errors.New("mongo.insertBatchSize should not be negative")
+	case config.Mongo.ConnectAttempts < 0:
+		return errors.New("mongo.connectAttempts should not be negative")
+	case config.Mongo.ConnectDelay < 0:
+		return errors.New("mongo.connectDelay should not be negative")
+	case config.Scheduler.CooldownMinutes < 0:
+		return errors.New("scheduler.cooldownMinutes should not be negative")
+	case config.Scheduler.CooldownJitter < 0 ||
+		config.Scheduler.CooldownJitter >= 1:
+		return errors.New("scheduler.cooldownJitter should be in [0, 1)")
+	case config.Scheduler.CycleTimeout < 0:
+		return errors.New("scheduler.cycleTimeout should not be negative")
+	case config.Scheduler.BatchSize < 0 ||
+		config.Scheduler.BatchSize > kDefaultMaxAdaptiveBatchSize:
+		return errors.Errorf("scheduler.batchSize should be at most %d",
+			kDefaultMaxAdaptiveBatchSize)
+	case config.Scheduler.FutureTolerance < 0:
+		return errors.New("scheduler.futureTolerance should not be negative")
+	case config.Scheduler.HydrationConcurrency < 0:
+		return errors.New(
+			"scheduler.hydrationConcurrency should not be negative")
+	case config.Scheduler.PollCooldown < 0:
+		return errors.New("scheduler.pollCooldown should not be negative")
+	case config.CFAPI.BreakerThreshold < 0:
+		return errors.New("cfapi.breakerThreshold should not be negative")
+	case config.CFAPI.BreakerCooldown < 0:
+		return errors.New("cfapi.breakerCooldown should not be negative")
+	case config.CFAPI.CacheTTL < 0:
+		return errors.New("cfapi.cacheTTL should not be negative")
+	case (config.CFAPI.Key == "") != (config.CFAPI.Secret == ""):
+		return errors.New("cfapi.key and cfapi.secret should be set together")
+	case config.Feed.Window < 0:
+		return errors.New("feed.window should not be negative")
+	case config.isSet("feed.maxItems") && config.Feed.MaxItems <= 0:
+		return errors.New("feed.maxItems should be positive")
+	case config.Feed.MinRating < 0:
+		return errors.New("feed.minRating should not be negative")
+	case config.Feed.TTL < 0:
+		return errors.New("feed.ttl should not be negative")
+	case config.Feed.SummaryLength < 0:
+		return errors.New("feed.summaryLength should not be negative")
+	case config.Feed.MinContentLength < 0:
+		return errors.New("feed.minContentLength should not be negative")
+	case len(config.Feed.WebSubHubs) > 0 && config.Feed.PublicUrl == "":
+		return errors.New("feed.publicUrl is required to publish to " +
+			"feed.webSubHubs")
+	}
+	return nil
+}
+
+// flagValues returns the values of the config keyed by the names of their
+// flags, leaving out the keys missing from the file, so that an explicit
+// zero, e.g, false or 0, still overrides a non-zero default.
+func (config *Config) flagValues() map[string]string {
+	values := make(map[string]string)
+	set := func(name, key, value string) {
+		if config.isSet(key) {
+			values[name] = value
+		}
+	}
+	setInt := func(name, key string, value int64) {
+		set(name, key, strconv.FormatInt(value, 10))
+	}
+	setFloat := func(name, key string, value float64) {
+		set(name, key, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	setBool := func(name, key string, value bool) {
+		set(name, key, strconv.FormatBool(value))
+	}
+	setDuration := func(name, key string, value time.Duration) {
+		set(name, key, value.String())
+	}
+	setList := func(name, key string, value []string) {
+		set(name, key, strings.Join(value, ","))
+	}
+
+	set("environment", "environment", config.Environment)
+	set("log-level", "logLevel", config.LogLevel)
+	set("serverAddr", "serverAddr", config.ServerAddr)
+	setBool("debug-endpoints", "debugEndpoints", config.DebugEndpoints)
+	setDuration("http-read-header-timeout", "http.readHeaderTimeout",
+		config.HTTP.ReadHeaderTimeout)
+	setDuration("http-read-timeout", "http.readTimeout",
+		config.HTTP.ReadTimeout)
+	setDuration("http-write-timeout", "http.writeTimeout",
+		config.HTTP.WriteTimeout)
+	setDuration("http-idle-timeout", "http.idleTimeout",
+		config.HTTP.IdleTimeout)
+	setList("cors-origins", "http.corsOrigins", config.HTTP.CORSOrigins)
+	setFloat("rate-limit", "http.rateLimit", config.HTTP.RateLimit)
+	setInt("rate-limit-burst", "http.rateLimitBurst",
+		int64(config.HTTP.RateLimitBurst))
+	setList("trusted-proxies", "http.trustedProxies",
+		config.HTTP.TrustedProxies)
+
+	set("store", "store.backend", config.Store.Backend)
+	set("sqlite-path", "store.sqlitePath", config.Store.SQLitePath)
+	set("postgres-url", "store.postgresUrl", config.Store.PostgresUrl)
+	set("redis-url", "store.redisUrl", config.Store.RedisUrl)
+	set("redis-key-prefix", "store.redisKeyPrefix",
+		config.Store.RedisKeyPrefix)
+	setInt("retention-days", "store.retentionDays",
+		int64(config.Store.RetentionDays))
+
+	set("mongo-addr", "mongo.addr", config.Mongo.Addr)
+	set("database-name", "mongo.databaseName", config.Mongo.DatabaseName)
+	set("mongo-collection", "mongo.collection", config.Mongo.Collection)
+	setInt("mongo-insert-batch-size", "mongo.insertBatchSize",
+		int64(config.Mongo.InsertBatchSize))
+	setInt("mongo-connect-attempts", "mongo.connectAttempts",
+		int64(config.Mongo.ConnectAttempts))
+	setDuration("mongo-connect-delay", "mongo.connectDelay",
+		config.Mongo.ConnectDelay)
+
+	setBool("enable-cf-scheduler", "scheduler.enabled",
+		config.Scheduler.Enabled)
+	setBool("selfcheck", "scheduler.selfCheck", config.Scheduler.SelfCheck)
+	setInt("cooldown-minutes", "scheduler.cooldownMinutes",
+		int64(config.Scheduler.CooldownMinutes))
+	setFloat("cooldown-jitter", "scheduler.cooldownJitter",
+		config.Scheduler.CooldownJitter)
+	setDuration("cycle-timeout", "scheduler.cycleTimeout",
+		config.Scheduler.CycleTimeout)
+	setInt("cf-batch-size", "scheduler.batchSize",
+		int64(config.Scheduler.BatchSize))
+	setBool("adaptive-batch-size", "scheduler.adaptiveBatchSize",
+		config.Scheduler.AdaptiveBatchSize)
+	setBool("oldest-first", "scheduler.oldestFirst",
+		config.Scheduler.OldestFirst)
+	setInt("hydration-concurrency", "scheduler.hydrationConcurrency",
+		int64(config.Scheduler.HydrationConcurrency))
+	setDuration("future-tolerance", "scheduler.futureTolerance",
+		config.Scheduler.FutureTolerance)
+	var pollBlogEntries []string
+	for _, id := range config.Scheduler.PollBlogEntries {
+		pollBlogEntries = append(pollBlogEntries, strconv.Itoa(id))
+	}
+	setList("poll-blog-entries", "scheduler.pollBlogEntries",
+		pollBlogEntries)
+	setDuration("poll-cooldown", "scheduler.pollCooldown",
+		config.Scheduler.PollCooldown)
+
+	set("cf-api-key", "cfapi.key", config.CFAPI.Key)
+	set("cf-api-secret", "cfapi.secret", config.CFAPI.Secret)
+	set("cf-user-agent", "cfapi.userAgent", config.CFAPI.UserAgent)
+	set("cf-contact", "cfapi.contact", config.CFAPI.Contact)
+	set("cf-proxy", "cfapi.proxy", config.CFAPI.Proxy)
+	setInt("cf-breaker-threshold", "cfapi.breakerThreshold",
+		int64(config.CFAPI.BreakerThreshold))
+	setDuration("cf-breaker-cooldown", "cfapi.breakerCooldown",
+		config.CFAPI.BreakerCooldown)
+	setDuration("cf-cache-ttl", "cfapi.cacheTTL", config.CFAPI.CacheTTL)
+
+	setDuration("feed-window", "feed.window", config.Feed.Window)
+	setInt("feed-max-items", "feed.maxItems", config.Feed.MaxItems)
+	setList("handles", "feed.handles", config.Feed.Handles)
+	setList("websub-hub", "feed.webSubHubs", config.Feed.WebSubHubs)
+	set("public-url", "feed.publicUrl", config.Feed.PublicUrl)
+	setBool("author-ratings", "feed.authorRatings", config.Feed.AuthorRatings)
+	setInt("min-rating", "feed.minRating", int64(config.Feed.MinRating))
+	setBool("include-unrated", "feed.includeUnrated",
+		config.Feed.IncludeUnrated)
+	set("feed-title", "feed.title", config.Feed.Title)
+	set("feed-description", "feed.description", config.Feed.Description)
+	set("feed-site-url", "feed.siteUrl", config.Feed.SiteUrl)
+	set("feed-language", "feed.language", config.Feed.Language)
+	setDuration("feed-ttl", "feed.ttl", config.Feed.TTL)
+	set("feed-content", "feed.content", config.Feed.Content)
+	setInt("feed-summary-length", "feed.summaryLength",
+		int64(config.Feed.SummaryLength))
+	set("feed-sanitize", "feed.sanitize", config.Feed.Sanitize)
+	set("feed-republish", "feed.republish", config.Feed.Republish)
+	setInt("feed-min-content-length", "feed.minContentLength",
+		int64(config.Feed.MinContentLength))
+	return values
+}
+
+// isSet reports whether the key, e.g, feed.maxItems, is set in the file the
+// config was loaded from.
+func (config *Config) isSet(key string) bool {
+	return config.keys[key]
+}
+
+// collectKeys records the dotted paths of the keys of the YAML node, e.g,
+// feed and feed.maxItems.
+func collectKeys(node *yaml.Node, prefix string, keys map[string]bool) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectKeys(child, prefix, keys)
+		}
+	case yaml.MappingNode:
+		for ind := 0; ind+1 < len(node.Content); ind += 2 {
+			key := prefix + node.Content[ind].Value
+			keys[key] = true
+			collectKeys(node.Content[ind+1], key+".", keys)
+		}
+	}
+}
+
+// applyConfig sets the flags from the config, except the ones in explicit,
+// i.e, the ones set on the command line or by the environment, which take
+// precedence over the file.
+func applyConfig(flags *flag.FlagSet, config *Config,
+	explicit map[string]bool) error {
+	for name, value := range config.flagValues() {
+		if explicit[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return errors.Errorf("invalid value %q of %s with error [%v]",
+				value, name, err)
+		}
+	}
+	return nil
+}
+
+// markAliases marks the aliases of the explicit flags as explicit too, i.e,
+// the flags bound to the same variable, e.g, http-addr and serverAddr, so that
+// the config doesn't override a flag through its alias.
+func markAliases(flags *flag.FlagSet, explicit map[string]bool) {
+	variables := make(map[uintptr]bool)
+	flags.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			variables[flagVariable(f)] = true
+		}
+	})
+	flags.VisitAll(func(f *flag.Flag) {
+		if variable := flagVariable(f); variable != 0 && variables[variable] {
+			explicit[f.Name] = true
+		}
+	})
+}
+
+// flagVariable returns the address of the variable the flag is bound to, or
+// 0 if its value isn't a pointer, e.g, for flag.Func.
+func flagVariable(f *flag.Flag) uintptr {
+	value := reflect.ValueOf(f.Value)
+	if value.Kind() != reflect.Ptr {
+		return 0
+	}
+	return value.Pointer()
+}
+
+// parseFlags parses the arguments into the flags, which take precedence over
+// their environment variables, which take precedence over the config file of
+// the config flag, if any, which takes precedence over the defaults.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	explicit, err := setDefaultsFromEnv(flags)
+	if err != nil {
+		return err
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	markAliases(flags, explicit)
+
+	configFile := flags.Lookup("config")
+	if configFile == nil || configFile.Value.String() == "" {
+		return nil
+	}
+	config, err := loadConfig(configFile.Value.String())
+	if err != nil {
+		return err
+	}
+	return applyConfig(flags, config, explicit)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	DescribeTable("should take the flags over the environment over the "+
+		"config over the defaults",
+		func(args []string, env, config, expected string) {
+			flags := flag.NewFlagSet("web", flag.ContinueOnError)
+			flags.String("config", "", "")
+			mongoAddr := flags.String("mongo-addr", "default", "")
+
+			if env != "" {
+				Expect(os.Setenv("CFRSS_MONGO_ADDR", env)).Should(Succeed())
+				DeferCleanup(os.Unsetenv, "CFRSS_MONGO_ADDR")
+			}
+			if config != "" {
+				dir, err := os.MkdirTemp("", "cfrss-config")
+				Expect(err).Should(BeNil())
+				DeferCleanup(os.RemoveAll, dir)
+				path := filepath.Join(dir, "config.yaml")
+				Expect(os.WriteFile(path,
+					[]byte("mongo:\n  addr: "+config+"\n"), 0o600)).
+					Should(Succeed())
+				args = append(args, "-config", path)
+			}
+
+			Expect(parseFlags(flags, args)).Should(Succeed())
+			Expect(*mongoAddr).Should(Equal(expected))
+		},
+		Entry("default", nil, "", "", "default"),
+		Entry("config", nil, "", "config", "config"),
+		Entry("environment", nil, "env", "config", "env"),
+		Entry("flag", []string{"-mongo-addr", "flag"}, "env", "config",
+			"flag"),
+		Entry("flag without environment", []string{"-mongo-addr", "flag"},
+			"", "config", "flag"),
+	)
+
+	// writeConfig writes the config to a temporary file, and returns its path.
+	writeConfig := func(config string) string {
+		dir, err := os.MkdirTemp("", "cfrss-config")
+		Expect(err).Should(BeNil())
+		DeferCleanup(os.RemoveAll, dir)
+		path := filepath.Join(dir, "config.yaml")
+		Expect(os.WriteFile(path, []byte(config), 0o600)).Should(Succeed())
+		return path
+	}
+
+	It("should take an alias flag over the config", func() {
+		flags := flag.NewFlagSet("web", flag.ContinueOnError)
+		flags.String("config", "", "")
+		var serverAddr string
+		flags.StringVar(&serverAddr, "serverAddr", ":8000", "")
+		flags.StringVar(&serverAddr, "http-addr", ":8000", "")
+
+		path := writeConfig("serverAddr: :9000\n")
+		Expect(parseFlags(flags, []string{"-http-addr", ":8080",
+			"-config", path})).Should(Succeed())
+		Expect(serverAddr).Should(Equal(":8080"))
+	})
+
+	It("should apply the explicit zeros of the config", func() {
+		flags := flag.NewFlagSet("web", flag.ContinueOnError)
+		flags.String("config", "", "")
+		enabled := flags.Bool("enable-cf-scheduler", true, "")
+		cooldown := flags.Int("cooldown-minutes", 5, "")
+		batchSize := flags.Int("cf-batch-size", 100, "")
+
+		path := writeConfig("scheduler:\n  enabled: false\n" +
+			"  cooldownMinutes: 0\n")
+		Expect(parseFlags(flags, []string{"-config", path})).Should(Succeed())
+		Expect(*enabled).Should(BeFalse())
+		Expect(*cooldown).Should(BeZero())
+		Expect(*batchSize).Should(Equal(100))
+	})
+
+	It("should reject an explicit zero feed max items", func() {
+		path := writeConfig("feed:\n  maxItems: 0\n")
+		_, err := loadConfig(path)
+		Expect(err).Should(MatchError(ContainSubstring("feed.maxItems")))
+	})
+
+	It("should reject an invalid environment variable", func() {
+		flags := flag.NewFlagSet("web", flag.ContinueOnError)
+		flags.Int("cooldown-minutes", 1, "")
+		Expect(os.Setenv("CFRSS_COOLDOWN_MINUTES", "soon")).Should(Succeed())
+		DeferCleanup(os.Unsetenv, "CFRSS_COOLDOWN_MINUTES")
+
+		Expect(parseFlags(flags, nil)).Should(MatchError(
+			ContainSubstring("CFRSS_COOLDOWN_MINUTES")))
+	})
+
+	DescribeTable("should validate the config",
+		func(update func(config *Config), expected string) {
+			config := new(Config)
+			update(config)
+			err := config.validate()
+			if expected == "" {
+				Expect(err).Should(BeNil())
+				return
+			}
+			Expect(err).Should(MatchError(ContainSubstring(expected)))
+		},
+		Entry("empty", func(config *Config) {}, ""),
+		Entry("log level", func(config *Config) {
+			config.LogLevel = "verbose"
+		}, "logLevel"),
+		Entry("store backend", func(config *Config) {
+			config.Store.Backend = "mysql"
+		}, "store.backend"),
+		Entry("feed content", func(config *Config) {
+			config.Feed.Content = "excerpt"
+		}, "feed.content"),
+		Entry("feed language", func(config *Config) {
+			config.Feed.Language = "fr"
+		}, "feed.language"),
+		Entry("trusted proxies", func(config *Config) {
+			config.HTTP.TrustedProxies = []string{"10.0.0.0/33"}
+		}, "http.trustedProxies"),
+		Entry("http timeouts", func(config *Config) {
+			config.HTTP.IdleTimeout = -time.Second
+		}, "http timeouts"),
+		Entry("cooldown jitter", func(config *Config) {
+			config.Scheduler.CooldownJitter = 1
+		}, "scheduler.cooldownJitter"),
+		Entry("batch size", func(config *Config) {
+			config.Scheduler.BatchSize = kDefaultMaxAdaptiveBatchSize + 1
+		}, "scheduler.batchSize"),
+		Entry("api credentials", func(config *Config) {
+			config.CFAPI.Key = "key"
+		}, "cfapi.key and cfapi.secret"),
+		Entry("cache ttl", func(config *Config) {
+			config.CFAPI.CacheTTL = -time.Second
+		}, "cfapi.cacheTTL"),
+		Entry("negative feed max items", func(config *Config) {
+			config.keys = map[string]bool{"feed.maxItems": true}
+			config.Feed.MaxItems = -1
+		}, "feed.maxItems"),
+		Entry("zero feed max items", func(config *Config) {
+			config.keys = map[string]bool{"feed.maxItems": true}
+		}, "feed.maxItems"),
+		Entry("positive feed max items", func(config *Config) {
+			config.keys = map[string]bool{"feed.maxItems": true}
+			config.Feed.MaxItems = 50
+		}, ""),
+		Entry("websub without public url", func(config *Config) {
+			config.Feed.WebSubHubs = []string{"https://hub.example.com"}
+		}, "feed.publicUrl"),
+		Entry("websub with public url", func(config *Config) {
+			config.Feed.WebSubHubs = []string{"https://hub.example.com"}
+			config.Feed.PublicUrl = "https://cfrss.example.com"
+		}, ""),
+	)
+
+	It("should reject the unknown keys", func() {
+		dir, err := os.MkdirTemp("", "cfrss-config")
+		Expect(err).Should(BeNil())
+		DeferCleanup(os.RemoveAll, dir)
+		path := filepath.Join(dir, "config.yaml")
+		Expect(os.WriteFile(path, []byte("mongo:\n  adr: localhost\n"),
+			0o600)).Should(Succeed())
+
+		_, err = loadConfig(path)
+		Expect(err).Should(MatchError(ContainSubstring("adr")))
+	})
+})
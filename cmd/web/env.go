@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// kEnvPrefix is the prefix of the environment variables that set the
+// defaults of the flags, e.g, CFRSS_MONGO_ADDR for mongo-addr.
+const kEnvPrefix = "CFRSS_"
+
+// setDefaultsFromEnv sets each flag from its environment variable, if it is
+// set, and returns the names of the flags that were set. It should be called
+// before parsing the flags, so that the flags take precedence over the
+// environment, which takes precedence over the built-in defaults.
+func setDefaultsFromEnv(flags *flag.FlagSet) (map[string]bool, error) {
+	set := make(map[string]bool)
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = errors.Errorf("invalid value %q of %s with error [%v]",
+				value, name, setErr)
+			return
+		}
+		set[f.Name] = true
+	})
+	return set, err
+}
+
+// envName returns the environment variable of the flag, e.g, CFRSS_MONGO_ADDR
+// for mongo-addr, and CFRSS_SERVER_ADDR for serverAddr.
+func envName(flagName string) string {
+	var name strings.Builder
+	name.WriteString(kEnvPrefix)
+	for ind, r := range flagName {
+		switch {
+		case r == '-':
+			name.WriteRune('_')
+		case unicode.IsUpper(r) && ind > 0:
+			name.WriteRune('_')
+			name.WriteRune(r)
+		default:
+			name.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return name.String()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+// exportActions writes the actions that happened at or after since to the
+// file as newline-delimited JSON, oldest first, and returns their number.
+// The actions are streamed from the store, so that the export takes constant
+// memory however large the store is.
+func exportActions(ctx context.Context, cfStore store.CodeforcesStore,
+	path string, since int64) (exported int64, err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, errors.Errorf("could not create %s with error [%v]",
+			path, err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	// Cancelling the stream releases it if the export fails midway.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	actions, errs := cfStore.StreamRecentActions(ctx, since)
+	for action := range actions {
+		if err := encoder.Encode(action); err != nil {
+			return exported, errors.Errorf("could not write to %s "+
+				"with error [%v]", path, err)
+		}
+		exported++
+	}
+	if err := <-errs; err != nil {
+		return exported, errors.Errorf("streaming of actions failed "+
+			"with error [%v]", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return exported, errors.Errorf("could not write to %s with error [%v]",
+			path, err)
+	}
+	if err := file.Close(); err != nil {
+		return exported, errors.Errorf("could not close %s with error [%v]",
+			path, err)
+	}
+	return exported, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+// kImportChunkSize is the number of actions inserted to the store at once
+// while importing a dump, which bounds the memory used by large dumps.
+const kImportChunkSize = 1000
+
+// importActions loads the recent actions in the file to the store, either
+// from a JSON array or from newline-delimited JSON as written by
+// exportActions, and returns the number of actions inserted, and the number
+// skipped since they were already in the store. The stores skip the
+// duplicates, so importing the same file again is harmless.
+func importActions(ctx context.Context, cfStore store.CodeforcesStore,
+	path string) (inserted, skipped int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, errors.Errorf("could not open %s with error [%v]",
+			path, err)
+	}
+	defer file.Close()
+
+	// The actions are decoded one at a time, so that the whole dump is never
+	// held in memory.
+	reader := bufio.NewReader(file)
+	decoder := json.NewDecoder(reader)
+	if isJSONArray(reader) {
+		if _, err := decoder.Token(); err != nil {
+			return 0, 0, errors.Errorf("could not read %s with error [%v]",
+				path, err)
+		}
+	}
+
+	chunk := make([]models.RecentAction, 0, kImportChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		count, err := cfStore.AddRecentActions(ctx, chunk)
+		if err != nil {
+			return errors.Errorf("insertion of %d actions failed with "+
+				"error [%v]", len(chunk), err)
+		}
+
+		inserted += count
+		skipped += int64(len(chunk)) - count
+		chunk = chunk[:0]
+		return nil
+	}
+
+	for decoder.More() {
+		var action models.RecentAction
+		if err := decoder.Decode(&action); err != nil {
+			return inserted, skipped, errors.Errorf("could not decode the "+
+				"action #%d of %s with error [%v]", inserted+skipped+
+				int64(len(chunk))+1, path, err)
+		}
+		chunk = append(chunk, action)
+		if len(chunk) == kImportChunkSize {
+			if err := flush(); err != nil {
+				return inserted, skipped, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return inserted, skipped, err
+	}
+	return inserted, skipped, nil
+}
+
+// isJSONArray reports whether the first non-space byte of the reader opens a
+// JSON array, without consuming it.
+func isJSONArray(reader *bufio.Reader) bool {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return false
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			return b[0] == '['
+		}
+		reader.Discard(1)
+	}
+}
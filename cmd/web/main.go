@@ -1,17 +1,34 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
-	"sync"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/variety-jones/cfrss/pkg/web"
 	"go.uber.org/zap"
 
 	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
 	"github.com/variety-jones/cfrss/pkg/scheduler"
+	"github.com/variety-jones/cfrss/pkg/store"
 	"github.com/variety-jones/cfrss/pkg/store/mongodb"
+	"github.com/variety-jones/cfrss/pkg/store/postgres"
+	"github.com/variety-jones/cfrss/pkg/store/redis"
+	"github.com/variety-jones/cfrss/pkg/store/sqlite"
+	"github.com/variety-jones/cfrss/pkg/websub"
 )
 
 const (
@@ -19,79 +36,734 @@ const (
 	kDefaultCoolDownMinutes = 5
 	kDefaultBatchSize       = 100
 	kDefaultDatabaseName    = "cfrss-local"
+	kDefaultMongoCollection = "recent_actions"
 	kDefaultMongoAddr       = "mongodb://localhost:27017"
 	kDefaultServerAddr      = ":5000"
+	kDefaultRetentionDays   = 0
+	kDefaultStoreBackend    = "mongo"
+	kDefaultSQLitePath      = "cfrss.db"
+	kDefaultPostgresUrl     = "postgres://localhost:5432/cfrss"
+	kDefaultRedisUrl        = "redis://localhost:6379/0"
+	kDefaultRedisKeyPrefix  = "cfrss:"
+	kDefaultFeedWindow      = 24 * time.Hour
+	kDefaultFeedMaxItems    = 100
+	kDefaultFeedContent     = "full"
+	kDefaultFeedSanitize    = "ugc"
+	kDefaultFeedRepublish   = "original"
 
 	kDefaultCodeforcesTimeoutMinutes = 2
+	kDefaultShutdownTimeoutSeconds   = 10
+	kDefaultWebSubTimeoutSeconds     = 10
+	kDefaultWebSubQueueSize          = 16
+	kDefaultMongoInsertBatchSize     = 1000
+	kDefaultMongoConnectAttempts     = 5
+	kDefaultMongoConnectDelay        = 2 * time.Second
+	kDefaultMinAdaptiveBatchSize     = 10
+	kDefaultMaxAdaptiveBatchSize     = 100
+	kDefaultBreakerThreshold         = 5
+	kDefaultBreakerCooldown          = 5 * time.Minute
+	kDefaultFeedSummaryLength        = 300
+	kDefaultFeedMinContentLength     = 0
+	kDefaultHydrationConcurrency     = 0
+	kDefaultRateLimitBurst           = 20
+	kSelfCheckTimeout                = 30 * time.Second
+	kDefaultFutureTolerance          = 10 * time.Minute
+	kDefaultPollCooldown             = 5 * time.Minute
+)
+
+// The build is injected at link time, e.g,
+// go build -ldflags "-X main.version=v1.0.0 -X main.gitCommit=$(git rev-parse HEAD)"
+var (
+	version   = "dev"
+	gitCommit = "unknown"
 )
 
 func main() {
 	// Define the customizable flags.
-	var serverAddr, mongoAddr, databaseName, environment string
-	var coolDownInMinutes, batchSize int
-	var enableCodeforcesScheduler bool
+	var serverAddr, mongoAddr, databaseName, environment, logLevel string
+	var mongoCollection string
+	var cfApiKey, cfApiSecret, cfUserAgent, cfContact, cfProxy string
+	var storeBackend, sqlitePath, postgresUrl string
+	var redisUrl, redisKeyPrefix string
+	var pollBlogEntries string
+	var pollCooldown time.Duration
+	var handles, webSubHubs, publicUrl, importFile, exportFile string
+	var corsOrigins, trustedProxies string
+	var rateLimit float64
+	var rateLimitBurst int
+	var configFile string
+	var feedTitle, feedDescription, feedSiteUrl, feedLanguage string
+	var feedContent, feedSanitize, feedRepublish string
+	var feedTTL time.Duration
+	var feedSummaryLength, feedMinContentLength int
+	var exportSince, pruneBefore, resetCursor int64
+	var feedWindow, cycleTimeout, futureTolerance time.Duration
+	var httpTimeouts web.HTTPTimeouts
+	var feedMaxItems int64
+	var coolDownInMinutes, batchSize, retentionDays, mongoInsertBatchSize int
+	var mongoConnectAttempts int
+	var mongoConnectDelay, breakerCooldown, cacheTTL time.Duration
+	var breakerThreshold, hydrationConcurrency int
+	var cooldownJitter float64
+	var enableCodeforcesScheduler, runOnce, dryRun, authorRatings bool
+	var adaptiveBatchSize, oldestFirst, includeUnrated, selfCheck bool
+	var debugEndpoints bool
+	var minRating int
+	flag.StringVar(&configFile, "config", "",
+		"A YAML config file, whose values are overridden by the flags")
 	flag.StringVar(&serverAddr, "serverAddr", kDefaultServerAddr,
 		"The address on which to run the web server")
+	flag.StringVar(&serverAddr, "http-addr", kDefaultServerAddr,
+		"Alias of serverAddr, the address which also serves /feed.xml")
+	defaultHTTPTimeouts := web.DefaultHTTPTimeouts()
+	flag.DurationVar(&httpTimeouts.ReadHeader, "http-read-header-timeout",
+		defaultHTTPTimeouts.ReadHeader,
+		"The deadline of the reading of the headers of a request, 0 disables it")
+	flag.DurationVar(&httpTimeouts.Read, "http-read-timeout",
+		defaultHTTPTimeouts.Read,
+		"The deadline of the reading of a whole request, 0 disables it")
+	flag.DurationVar(&httpTimeouts.Write, "http-write-timeout",
+		defaultHTTPTimeouts.Write,
+		"The deadline of the response to a request, 0 disables it")
+	flag.DurationVar(&httpTimeouts.Idle, "http-idle-timeout",
+		defaultHTTPTimeouts.Idle,
+		"How long an idle kept-alive connection is kept open, 0 disables it")
+	flag.StringVar(&corsOrigins, "cors-origins", "",
+		"Comma-separated origins allowed to read the JSON API from a "+
+			"browser, leave empty to disable CORS")
+	flag.Float64Var(&rateLimit, "rate-limit", 0,
+		"The requests per second that each client IP may send to the feeds "+
+			"and the JSON API, 0 disables the rate limit")
+	flag.IntVar(&rateLimitBurst, "rate-limit-burst", kDefaultRateLimitBurst,
+		"The requests that each client IP may send at once beyond rate-limit")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "",
+		"Comma-separated CIDR ranges, e.g, 10.0.0.0/8, of the reverse "+
+			"proxies whose X-Forwarded-For header identifies the clients")
+	flag.StringVar(&logLevel, "log-level", "",
+		"One of debug, info, warn and error, which overrides the level of "+
+			"the environment")
 	flag.StringVar(&environment, "environment", kDefaultEnvironment,
 		"The current environment: dev/prod")
+	flag.BoolVar(&debugEndpoints, "debug-endpoints", false,
+		"Serve the internal state of the scheduler at /debug/scheduler")
+	flag.StringVar(&storeBackend, "store", kDefaultStoreBackend,
+		"The database backing the store: mongo/sqlite/postgres/redis")
+	flag.StringVar(&sqlitePath, "sqlite-path", kDefaultSQLitePath,
+		"The path of the SQLite database, used when store is sqlite")
+	flag.StringVar(&postgresUrl, "postgres-url", kDefaultPostgresUrl,
+		"The URL of the Postgres database, used when store is postgres")
+	flag.StringVar(&redisUrl, "redis-url", kDefaultRedisUrl,
+		"The URL of the Redis server, used when store is redis")
+	flag.StringVar(&redisKeyPrefix, "redis-key-prefix", kDefaultRedisKeyPrefix,
+		"The prefix of all the Redis keys, so that feeds can share a server")
 	flag.StringVar(&mongoAddr, "mongo-addr", kDefaultMongoAddr,
 		"mongoDB address")
 	flag.StringVar(&databaseName, "database-name", kDefaultDatabaseName,
 		"The name of the MongoDB database")
+	flag.StringVar(&mongoCollection, "mongo-collection",
+		kDefaultMongoCollection,
+		"The MongoDB collection of the recent actions, so that several "+
+			"instances can share a database")
+	flag.IntVar(&mongoInsertBatchSize, "mongo-insert-batch-size",
+		kDefaultMongoInsertBatchSize,
+		"The maximum number of actions inserted to MongoDB by a single command")
+	flag.IntVar(&mongoConnectAttempts, "mongo-connect-attempts",
+		kDefaultMongoConnectAttempts,
+		"The number of attempts to connect to MongoDB at startup")
+	flag.DurationVar(&mongoConnectDelay, "mongo-connect-delay",
+		kDefaultMongoConnectDelay,
+		"The delay before retrying to connect to MongoDB, doubled on each retry")
+	flag.IntVar(&retentionDays, "retention-days", kDefaultRetentionDays,
+		"The number of days to retain recent actions for, 0 retains forever")
 	flag.IntVar(&coolDownInMinutes, "cooldown-minutes", kDefaultCoolDownMinutes,
 		"The cooldown (in minutes) for contacting Codeforces API")
+	flag.Float64Var(&cooldownJitter, "cooldown-jitter", 0,
+		"The fraction by which the cooldown is randomly shifted, e.g, 0.1")
+	flag.DurationVar(&cycleTimeout, "cycle-timeout", 0,
+		"The deadline of the fetch and persist of each cycle, 0 uses the cooldown")
 	flag.IntVar(&batchSize, "cf-batch-size", kDefaultBatchSize,
 		"The number of recent actions to query on each API call")
+	flag.BoolVar(&adaptiveBatchSize, "adaptive-batch-size", false,
+		"If set to true, cf-batch-size is adjusted to the ratio of new "+
+			"actions in the recent cycles")
+	flag.BoolVar(&oldestFirst, "oldest-first", false,
+		"If set to true, the new actions of each cycle are persisted "+
+			"oldest first")
+	flag.DurationVar(&futureTolerance, "future-tolerance",
+		kDefaultFutureTolerance,
+		"How far ahead of the clock the fetched actions may be dated, the "+
+			"others are dropped, 0 disables the check")
+	flag.IntVar(&hydrationConcurrency, "hydration-concurrency",
+		kDefaultHydrationConcurrency,
+		"The number of blog entries whose content is fetched at once, 0 "+
+			"disables the hydration")
+	flag.StringVar(&pollBlogEntries, "poll-blog-entries", "",
+		"Comma-separated ids of the blog entries whose comments are also "+
+			"polled by the scheduler, e.g, of an announcement")
+	flag.DurationVar(&pollCooldown, "poll-cooldown", kDefaultPollCooldown,
+		"The cooldown of the polling of each of poll-blog-entries")
+	flag.StringVar(&cfApiKey, "cf-api-key", "",
+		"The Codeforces API key, leave empty for unauthenticated calls")
+	flag.StringVar(&cfApiSecret, "cf-api-secret", "",
+		"The Codeforces API secret paired with cf-api-key")
+	flag.StringVar(&cfUserAgent, "cf-user-agent", "",
+		"The User-Agent sent to the Codeforces API, leave empty for "+
+			"cfrss/<version>")
+	flag.StringVar(&cfContact, "cf-contact", "",
+		"The contact of the operator appended to the User-Agent, e.g, "+
+			"mailto:ops@example.com")
+	flag.StringVar(&cfProxy, "cf-proxy", "",
+		"The HTTP proxy of the calls to Codeforces, leave empty for "+
+			"HTTP_PROXY/HTTPS_PROXY")
+	flag.IntVar(&breakerThreshold, "cf-breaker-threshold",
+		kDefaultBreakerThreshold,
+		"The consecutive failed CF calls after which the calls are "+
+			"short-circuited, 0 disables the circuit breaker")
+	flag.DurationVar(&breakerCooldown, "cf-breaker-cooldown",
+		kDefaultBreakerCooldown,
+		"How long the CF calls are short-circuited before trying again")
+	flag.DurationVar(&cacheTTL, "cf-cache-ttl", 0,
+		"How long the recent actions fetched from CF are reused, 0 "+
+			"disables the cache")
+	flag.StringVar(&handles, "handles", "",
+		"Comma-separated handles whose feeds are listed in /feeds.opml")
+	flag.StringVar(&webSubHubs, "websub-hub", "",
+		"Comma-separated WebSub hubs notified when new actions are persisted")
+	flag.StringVar(&publicUrl, "public-url", "",
+		"The URL at which readers reach this server, e.g, https://cfrss.example.com")
+	flag.DurationVar(&feedWindow, "feed-window", kDefaultFeedWindow,
+		"How far back in time the feeds look for actions, e.g, 24h")
+	flag.Int64Var(&feedMaxItems, "feed-max-items", kDefaultFeedMaxItems,
+		"The maximum number of items in a feed")
+	flag.StringVar(&feedTitle, "feed-title", "",
+		"The title of the feeds, leave empty for the default")
+	flag.StringVar(&feedDescription, "feed-description", "",
+		"The description of the feeds, leave empty for the default")
+	flag.StringVar(&feedSiteUrl, "feed-site-url", "",
+		"The website the feeds link to, leave empty for Codeforces")
+	flag.StringVar(&feedLanguage, "feed-language", "",
+		"The default language of the feeds, en or ru, overridden by lang")
+	flag.DurationVar(&feedTTL, "feed-ttl", 0,
+		"How long readers can cache the feeds, e.g, 15m, 0 to omit it")
+	flag.StringVar(&feedContent, "feed-content", kDefaultFeedContent,
+		"How much of the content the items carry, one of full and summary")
+	flag.StringVar(&feedSanitize, "feed-sanitize", kDefaultFeedSanitize,
+		"The policy stripping the unsafe HTML from the content of the "+
+			"items, one of ugc and strict")
+	flag.StringVar(&feedRepublish, "feed-republish", kDefaultFeedRepublish,
+		"Which time the items of the edited actions carry, one of original "+
+			"and updated, which brings them back to the top of the feeds")
+	flag.IntVar(&feedSummaryLength, "feed-summary-length",
+		kDefaultFeedSummaryLength,
+		"The number of characters after which the summaries are cut")
+	flag.IntVar(&feedMinContentLength, "feed-min-content-length",
+		kDefaultFeedMinContentLength,
+		"The items with less characters of text are dropped, e.g, the "+
+			"empty ones, unless it is zero")
 	flag.BoolVar(&enableCodeforcesScheduler, "enable-cf-scheduler", false,
 		"If set to true, DB is updated periodically with data from CF")
+	flag.BoolVar(&runOnce, "once", false,
+		"If set to true, DB is updated once with data from CF and the "+
+			"process exits without starting the web server")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"If set to true, the actions fetched from CF are logged instead of "+
+			"being persisted")
+	flag.BoolVar(&selfCheck, "selfcheck", false,
+		"If set to true, the startup fails unless a single action can be "+
+			"fetched from CF")
+	flag.StringVar(&importFile, "import", "",
+		"A JSON array of recent actions to load to the store, after which "+
+			"the process exits")
+	flag.StringVar(&exportFile, "export", "",
+		"The file to which the actions are written as newline-delimited "+
+			"JSON, after which the process exits")
+	flag.Int64Var(&exportSince, "since", 0,
+		"The unix timestamp from which the actions are exported")
+	flag.Int64Var(&resetCursor, "reset-cursor", 0,
+		"The unix timestamp to which the cursor of the scheduler is moved "+
+			"back, so that the next cycles re-process the later actions, "+
+			"after which the process exits")
+	flag.Int64Var(&pruneBefore, "prune-before", 0,
+		"The unix timestamp before which the actions are deleted from the "+
+			"store, after which the process exits")
+	flag.BoolVar(&authorRatings, "author-ratings", false,
+		"If set to true, the authors in the feeds are colored by their CF "+
+			"rating")
+	flag.IntVar(&minRating, "min-rating", 0,
+		"The minimum CF rating of the authors in the feeds, 0 keeps everyone")
+	flag.BoolVar(&includeUnrated, "include-unrated", false,
+		"If set to true, min-rating keeps the unrated and unknown authors")
 
-	// Parse all the flags.
-	flag.Parse()
+	// Parse all the flags, which override the environment variables, which
+	// in turn override the config file.
+	if err := parseFlags(flag.CommandLine, os.Args[1:]); err != nil {
+		log.Fatalln(err)
+	}
 
 	// Create the zap logger and replace the global logger.
-	var logger *zap.Logger
-	var loggerError error
-	if environment == kDefaultEnvironment {
-		if logger, loggerError = zap.NewDevelopment(); loggerError != nil {
-			log.Fatalln(loggerError)
-		}
-	} else {
-		if logger, loggerError = zap.NewProduction(); loggerError != nil {
-			log.Fatalln(loggerError)
-		}
+	logger, err := newLogger(environment, logLevel)
+	if err != nil {
+		log.Fatalln(err)
 	}
 	defer logger.Sync()
 	zap.ReplaceGlobals(logger)
 
+	if feedLanguage != "" && !feed.IsSupportedLocale(feedLanguage) {
+		zap.S().Fatalf("feed-language should be one of en and ru, got %s",
+			feedLanguage)
+	}
+	contentMode, err := parseContentMode(feedContent)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	sanitizePolicy, err := parseSanitizePolicy(feedSanitize)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	republishPolicy, err := parseRepublishPolicy(feedRepublish)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	proxyRanges, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	if feedMaxItems <= 0 {
+		zap.S().Fatalf("feed-max-items should be positive, got %d",
+			feedMaxItems)
+	}
+	if cooldownJitter < 0 || cooldownJitter >= 1 {
+		zap.S().Fatalf("cooldown-jitter should be in [0, 1), got %v",
+			cooldownJitter)
+	}
+	if rateLimit > 0 && rateLimitBurst < 1 {
+		zap.S().Fatal("rate-limit-burst should be at least 1, otherwise " +
+			"all the requests are rejected")
+	}
+
 	// Create the codeforces client to make API calls.
+	cfOpts := []cfapi.Option{
+		cfapi.WithCredentials(cfApiKey, cfApiSecret),
+		cfapi.WithContact(cfContact),
+		cfapi.WithCircuitBreaker(breakerThreshold, breakerCooldown),
+		cfapi.WithCacheTTL(cacheTTL),
+		cfapi.WithMetrics(cfapi.NewMetrics(prometheus.DefaultRegisterer)),
+	}
+	if cfUserAgent == "" {
+		cfUserAgent = "cfrss/" + version
+	}
+	cfOpts = append(cfOpts, cfapi.WithUserAgent(cfUserAgent))
+	if cfProxy != "" {
+		proxyUrl, err := url.Parse(cfProxy)
+		if err != nil {
+			zap.S().Fatalf("Invalid cf-proxy %s with error [%v]", cfProxy,
+				err)
+		}
+		cfOpts = append(cfOpts, cfapi.WithProxy(proxyUrl))
+	}
 	cfClient := cfapi.NewCodeforcesClient(
-		time.Duration(kDefaultCodeforcesTimeoutMinutes) * time.Minute)
+		time.Duration(kDefaultCodeforcesTimeoutMinutes)*time.Minute,
+		cfOpts...)
+	if selfCheck {
+		if err := checkCodeforces(cfClient); err != nil {
+			zap.S().Fatalf("Self-check failed with error [%+v]", err)
+		}
+	}
 
-	// Create the cfStore to persist data to MongoDB.
-	// Also, query the last recorded timestamp.
-	cfStore, err := mongodb.NewMongoStore(mongoAddr, databaseName)
+	// Create the cfStore to persist data to the chosen database.
+	var cfStore store.CodeforcesStore
+	switch storeBackend {
+	case "mongo":
+		cfStore, err = mongodb.NewMongoStore(mongoAddr, databaseName,
+			time.Duration(retentionDays)*24*time.Hour,
+			mongodb.WithInsertBatchSize(mongoInsertBatchSize),
+			mongodb.WithConnectRetries(mongoConnectAttempts,
+				mongoConnectDelay),
+			mongodb.WithCollectionName(mongoCollection))
+	case "sqlite":
+		cfStore, err = sqlite.NewSQLiteStore(sqlitePath)
+	case "postgres":
+		cfStore, err = postgres.NewPostgresStore(postgresUrl)
+	case "redis":
+		cfStore, err = redis.NewRedisStore(redisUrl, redisKeyPrefix)
+	default:
+		zap.S().Fatalf("Unknown store backend %s", storeBackend)
+	}
 	if err != nil {
 		zap.S().Fatal(err)
 	}
 
+	// The context is cancelled when the process receives a termination
+	// signal, e.g, when kubernetes evicts the pod.
+	ctx, stop := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if importFile != "" {
+		inserted, skipped, err := importActions(ctx, cfStore, importFile)
+		closeStore(cfStore)
+		zap.S().Infof("Imported %d actions from %s, skipped %d duplicates",
+			inserted, importFile, skipped)
+		if err != nil {
+			zap.S().Errorf("Failed to import %s with error [%+v]",
+				importFile, err)
+			logger.Sync()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if exportFile != "" {
+		exported, err := exportActions(ctx, cfStore, exportFile, exportSince)
+		closeStore(cfStore)
+		zap.S().Infof("Exported %d actions to %s", exported, exportFile)
+		if err != nil {
+			zap.S().Errorf("Failed to export to %s with error [%+v]",
+				exportFile, err)
+			logger.Sync()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if resetCursor > 0 {
+		err := moveCursor(ctx, cfStore, resetCursor)
+		closeStore(cfStore)
+		if err != nil {
+			zap.S().Errorf("Failed to reset the cursor to %d with error [%+v]",
+				resetCursor, err)
+			logger.Sync()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if pruneBefore > 0 {
+		deleted, err := cfStore.DeleteActionsBefore(ctx, pruneBefore)
+		closeStore(cfStore)
+		if err != nil {
+			zap.S().Errorf("Failed to delete the actions before %d with "+
+				"error [%+v]", pruneBefore, err)
+			logger.Sync()
+			os.Exit(1)
+		}
+		zap.S().Infof("Deleted %d actions before %d", deleted, pruneBefore)
+		return
+	}
+
+	schedulerOpts := []scheduler.Option{
+		scheduler.WithFutureTolerance(futureTolerance),
+	}
+	if dryRun {
+		schedulerOpts = append(schedulerOpts, scheduler.WithDryRun())
+	}
+	if adaptiveBatchSize {
+		schedulerOpts = append(schedulerOpts, scheduler.WithAdaptiveBatchSize(
+			kDefaultMinAdaptiveBatchSize, kDefaultMaxAdaptiveBatchSize))
+	}
+	if oldestFirst {
+		schedulerOpts = append(schedulerOpts, scheduler.WithOldestFirst())
+	}
+	if hydrationConcurrency > 0 {
+		schedulerOpts = append(schedulerOpts,
+			scheduler.WithHydration(hydrationConcurrency))
+	}
+	if pollBlogEntries != "" {
+		if pollCooldown <= 0 {
+			zap.S().Fatal("poll-cooldown should be positive")
+		}
+		var pollers []scheduler.PollerConfig
+		for _, rawId := range splitList(pollBlogEntries) {
+			blogEntryId, err := strconv.Atoi(rawId)
+			if err != nil || blogEntryId <= 0 {
+				zap.S().Fatalf("poll-blog-entries should list blog entry "+
+					"ids, got %s", rawId)
+			}
+			pollers = append(pollers, scheduler.BlogEntryPoller(cfClient,
+				blogEntryId, pollCooldown))
+		}
+		schedulerOpts = append(schedulerOpts, scheduler.WithPollers(pollers...))
+	}
+
+	// Notify the WebSub hubs whenever new actions are persisted.
+	var webSubHubList []string
+	var publishQueue *websub.Queue
+	feedUrl := strings.TrimSuffix(publicUrl, "/") + web.FeedPath
+	if webSubHubs != "" {
+		if publicUrl == "" {
+			zap.S().Fatal("public-url is required to publish to WebSub hubs")
+		}
+		webSubHubList = splitList(webSubHubs)
+		publisher := websub.NewPublisher(webSubHubList,
+			kDefaultWebSubTimeoutSeconds*time.Second)
+		publish := func(ctx context.Context, _ []models.RecentAction) error {
+			return publisher.Publish(ctx, feedUrl)
+		}
+		if !runOnce {
+			// Publish in the background, so that slow hubs don't hold up
+			// the cycles of the scheduler.
+			publishQueue = websub.NewQueue(publisher, kDefaultWebSubQueueSize)
+			publish = func(context.Context, []models.RecentAction) error {
+				publishQueue.Enqueue(feedUrl)
+				return nil
+			}
+		}
+		schedulerOpts = append(schedulerOpts,
+			scheduler.WithOnNewActions(publish))
+	}
+
+	if runOnce {
+		// The cooldown is irrelevant since the loop is never started.
+		sch := scheduler.NewScheduler(cfClient, cfStore, batchSize, 0,
+			schedulerOpts...)
+		err := sch.RunOnce(ctx)
+		closeStore(cfStore)
+		if err != nil {
+			zap.S().Errorf("Failed to sync with codeforces with error [%+v]",
+				err)
+			logger.Sync()
+			os.Exit(1)
+		}
+		return
+	}
+
+	webOpts := []web.Option{
+		web.WithFeedWindow(feedWindow),
+		web.WithFeedMaxItems(feedMaxItems),
+		web.WithHandleLookup(cfClient),
+		web.WithBuildInfo(web.BuildInfo{
+			Version:   version,
+			GitCommit: gitCommit,
+			GoVersion: runtime.Version(),
+		}),
+		web.WithFeedOptions(
+			feed.WithTitle(feedTitle),
+			feed.WithDescription(feedDescription),
+			feed.WithSiteLink(feedSiteUrl),
+			feed.WithLocale(feedLanguage),
+			feed.WithTTL(feedTTL),
+			feed.WithContentMode(contentMode),
+			feed.WithSummaryLength(feedSummaryLength),
+			feed.WithSanitizePolicy(sanitizePolicy),
+			feed.WithRepublishPolicy(republishPolicy),
+			feed.WithMinContentLength(feedMinContentLength),
+		),
+	}
+	if publicUrl != "" {
+		webOpts = append(webOpts, web.WithPublicURL(publicUrl))
+	}
+	if handles != "" {
+		webOpts = append(webOpts, web.WithHandles(splitList(handles)))
+	}
+	if corsOrigins != "" {
+		webOpts = append(webOpts, web.WithCORS(splitList(corsOrigins)))
+	}
+	if rateLimit > 0 {
+		webOpts = append(webOpts, web.WithRateLimit(rateLimit, rateLimitBurst))
+	}
+	if len(proxyRanges) > 0 {
+		webOpts = append(webOpts, web.WithTrustedProxies(proxyRanges))
+	}
+	if len(webSubHubList) > 0 {
+		webOpts = append(webOpts, web.WithWebSub(webSubHubList, feedUrl))
+	}
+	if authorRatings {
+		webOpts = append(webOpts, web.WithAuthorRatings(cfClient))
+	}
+	if minRating > 0 {
+		webOpts = append(webOpts, web.WithMinRating(cfClient, minRating,
+			includeUnrated))
+	}
+	if debugEndpoints {
+		webOpts = append(webOpts, web.WithDebug())
+	}
+
+	schedulerDone := make(chan struct{})
 	if enableCodeforcesScheduler {
+		if cycleTimeout > 0 {
+			schedulerOpts = append(schedulerOpts,
+				scheduler.WithCycleTimeout(cycleTimeout))
+		}
+
 		// Create the scheduler to contact CF and persist the result to MongoDB.
 		sch := scheduler.NewScheduler(cfClient, cfStore, batchSize,
-			time.Duration(coolDownInMinutes)*time.Minute)
+			time.Duration(coolDownInMinutes)*time.Minute,
+			append(schedulerOpts,
+				scheduler.WithJitter(cooldownJitter),
+				scheduler.WithMetrics(
+					scheduler.NewMetrics(prometheus.DefaultRegisterer)))...)
+
+		webOpts = append(webOpts, web.WithScheduler(sch))
+
+		if publishQueue != nil {
+			go publishQueue.Run(ctx)
+		}
 
 		// Start the scheduler in a new goroutine.
-		go sch.Start()
+		go func() {
+			sch.Start(ctx)
+			close(schedulerDone)
+		}()
+	} else {
+		close(schedulerDone)
 	}
 
+	webServer := web.CreateWebServer(cfStore, append(webOpts,
+		web.WithHTTPTimeouts(httpTimeouts))...)
 	go func() {
-		if err := web.CreateWebServer(cfStore).
-			ListenAndServe(serverAddr); err != nil {
+		if err := webServer.ListenAndServe(serverAddr); err != nil {
 			zap.S().Fatal(err)
 		}
 	}()
 
-	// Wait forever.
-	var wg sync.WaitGroup
-	wg.Add(1)
-	wg.Wait()
+	// Wait for the termination signal, and let the in-flight requests and
+	// the current cycle of the scheduler finish before disconnecting from
+	// the store.
+	<-ctx.Done()
+	zap.S().Info("Received termination signal, shutting down...")
+	shutdownServer(webServer)
+	<-schedulerDone
+	closeStore(cfStore)
+}
+
+// shutdownServer drains the in-flight requests of the web server.
+func shutdownServer(webServer *web.Server) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		kDefaultShutdownTimeoutSeconds*time.Second)
+	defer cancel()
+	if err := webServer.Shutdown(shutdownCtx); err != nil {
+		zap.S().Errorf("Could not drain the requests with error [%+v]", err)
+	}
+}
+
+// newLogger creates the zap logger of the environment, i.e, the development
+// logger in dev and the production logger otherwise. A non-empty level
+// overrides the level of the environment, e.g, to debug in production.
+func newLogger(environment, level string) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	if environment == kDefaultEnvironment {
+		config = zap.NewDevelopmentConfig()
+	}
+
+	switch level {
+	case "":
+	case "debug", "info", "warn", "error":
+		atomicLevel, err := zap.ParseAtomicLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		config.Level = atomicLevel
+	default:
+		return nil, errors.Errorf("log-level should be one of debug, info, "+
+			"warn and error, got %s", level)
+	}
+	return config.Build()
+}
+
+// parseRepublishPolicy returns the feed republish policy named by the flag.
+func parseRepublishPolicy(republish string) (feed.RepublishPolicy, error) {
+	switch republish {
+	case "original":
+		return feed.RepublishOriginal, nil
+	case "updated":
+		return feed.RepublishUpdated, nil
+	default:
+		return 0, errors.Errorf("feed-republish should be one of original "+
+			"and updated, got %s", republish)
+	}
+}
+
+// parseContentMode returns the feed content mode named by the flag.
+func parseContentMode(content string) (feed.ContentMode, error) {
+	switch content {
+	case "full":
+		return feed.ContentModeFull, nil
+	case "summary":
+		return feed.ContentModeSummary, nil
+	default:
+		return 0, errors.Errorf("feed-content should be one of full and "+
+			"summary, got %s", content)
+	}
+}
+
+// parseSanitizePolicy returns the feed sanitization policy named by the flag.
+func parseSanitizePolicy(policy string) (*feed.SanitizePolicy, error) {
+	switch policy {
+	case "ugc":
+		return feed.UGCPolicy(), nil
+	case "strict":
+		return feed.StrictPolicy(), nil
+	default:
+		return nil, errors.Errorf("feed-sanitize should be one of ugc and "+
+			"strict, got %s", policy)
+	}
+}
+
+// parseTrustedProxies returns the CIDR ranges listed by the flag.
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var ranges []*net.IPNet
+	for _, cidr := range splitList(list) {
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Errorf("trusted-proxies should list CIDR "+
+				"ranges, got %s", cidr)
+		}
+		ranges = append(ranges, ipRange)
+	}
+	return ranges, nil
+}
+
+// checkCodeforces fetches a single recent action from Codeforces, so that a
+// misconfiguration, e.g, of the proxy, fails the startup instead of the first
+// cycle.
+func checkCodeforces(cfClient cfapi.CodeforcesAPI) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kSelfCheckTimeout)
+	defer cancel()
+
+	if _, err := cfClient.RecentActions(ctx, 1); err != nil {
+		return errors.Errorf("could not reach codeforces with error [%v]", err)
+	}
+	zap.S().Info("Self-check of the connection to Codeforces passed")
+	return nil
+}
+
+// moveCursor saves the cursor of the scheduler at the timestamp, warning
+// about the actions that the next cycles will process again.
+func moveCursor(ctx context.Context, cfStore store.CodeforcesStore,
+	timestamp int64) error {
+	previous, err := cfStore.LoadCursor(ctx)
+	if err != nil {
+		return errors.Errorf("could not load the cursor with error [%v]", err)
+	}
+	zap.S().Warnf("Moving the cursor from %d to %d. The next cycles will "+
+		"process again, and upsert, all the actions listed by "+
+		"Codeforces since then, which may be many", previous, timestamp)
+
+	if err := cfStore.SaveCursor(ctx, timestamp); err != nil {
+		return errors.Errorf("could not save the cursor with error [%v]", err)
+	}
+	zap.S().Infof("Reset the cursor to %d", timestamp)
+	return nil
+}
+
+// closeStore disconnects from the store.
+func closeStore(cfStore store.CodeforcesStore) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		kDefaultShutdownTimeoutSeconds*time.Second)
+	defer cancel()
+	if err := cfStore.Close(shutdownCtx); err != nil {
+		zap.S().Errorf("Could not close the store with error [%+v]", err)
+	}
+}
+
+// splitList splits a comma-separated flag into its trimmed values.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+	return values
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi/mock"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/memory"
+)
+
+// cursorStore fails the loading or the saving of the cursor of the embedded
+// store when its errors are set.
+type cursorStore struct {
+	store.CodeforcesStore
+	loadErr, saveErr error
+}
+
+func (s *cursorStore) LoadCursor(ctx context.Context) (int64, error) {
+	if s.loadErr != nil {
+		return 0, s.loadErr
+	}
+	return s.CodeforcesStore.LoadCursor(ctx)
+}
+
+func (s *cursorStore) SaveCursor(ctx context.Context, timestamp int64) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	return s.CodeforcesStore.SaveCursor(ctx, timestamp)
+}
+
+var _ = Describe("Main", func() {
+	DescribeTable("should move the cursor",
+		func(cfStore *cursorStore, timestamp, expected int64, failure string) {
+			ctx := context.Background()
+			Expect(cfStore.CodeforcesStore.SaveCursor(ctx, 100)).
+				Should(Succeed())
+
+			err := moveCursor(ctx, cfStore, timestamp)
+			if failure != "" {
+				Expect(err).Should(MatchError(ContainSubstring(failure)))
+			} else {
+				Expect(err).Should(BeNil())
+			}
+			Expect(cfStore.CodeforcesStore.LoadCursor(ctx)).
+				Should(Equal(expected))
+		},
+		Entry("back", &cursorStore{CodeforcesStore: memory.NewMemoryStore()},
+			int64(50), int64(50), ""),
+		Entry("forward",
+			&cursorStore{CodeforcesStore: memory.NewMemoryStore()},
+			int64(200), int64(200), ""),
+		Entry("to the start",
+			&cursorStore{CodeforcesStore: memory.NewMemoryStore()},
+			int64(0), int64(0), ""),
+		Entry("unless the cursor can't be loaded", &cursorStore{
+			CodeforcesStore: memory.NewMemoryStore(),
+			loadErr:         errors.New("load failed"),
+		}, int64(50), int64(100), "could not load the cursor"),
+		Entry("unless the cursor can't be saved", &cursorStore{
+			CodeforcesStore: memory.NewMemoryStore(),
+			saveErr:         errors.New("save failed"),
+		}, int64(50), int64(100), "could not save the cursor"),
+	)
+
+	DescribeTable("should check the connection to Codeforces",
+		func(responses []mock.Response, failure string) {
+			cfClient := new(mock.CodeforcesClient)
+			cfClient.Push(responses...)
+
+			err := checkCodeforces(cfClient)
+			if failure != "" {
+				Expect(err).Should(MatchError(ContainSubstring(failure)))
+			} else {
+				Expect(err).Should(BeNil())
+			}
+			Expect(cfClient.Calls()).Should(Equal(1))
+		},
+		Entry("reachable", []mock.Response{{
+			Actions: []models.RecentAction{{TimeSeconds: 100}},
+		}}, ""),
+		Entry("without any recent action", []mock.Response{{}}, ""),
+		Entry("unreachable", []mock.Response{{
+			Err: errors.New("proxyconnect tcp: connection refused"),
+		}}, "connection refused"),
+		Entry("without a response", nil, "could not reach codeforces"),
+	)
+})
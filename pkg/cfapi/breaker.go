@@ -0,0 +1,116 @@
+package cfapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned without calling Codeforces while the circuit
+// breaker is open, i.e, after too many consecutive failures.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker stops calling Codeforces after threshold consecutive
+// failures. Once cooldown has passed, a single trial call is let through:
+// its success closes the circuit, and its failure opens it again.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mutex               sync.Mutex
+	consecutiveFailures int
+	openedAt            time.Time
+
+	// trialInFlight is set while the trial call of the half-open circuit is
+	// in progress, which short-circuits the concurrent calls.
+	trialInFlight bool
+
+	now func() time.Time
+}
+
+// allow returns ErrCircuitOpen if the call should not be made.
+func (breaker *circuitBreaker) allow() error {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.consecutiveFailures < breaker.threshold {
+		return nil
+	}
+	if breaker.trialInFlight ||
+		breaker.now().Sub(breaker.openedAt) < breaker.cooldown {
+		return ErrCircuitOpen
+	}
+	breaker.trialInFlight = true
+	zap.S().Infof("Circuit breaker is half-open, trying Codeforces again")
+	return nil
+}
+
+// succeed records the success of an allowed call, which closes the circuit.
+func (breaker *circuitBreaker) succeed() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.trialInFlight = false
+	if breaker.consecutiveFailures >= breaker.threshold {
+		zap.S().Infof("Circuit breaker is closed again")
+	}
+	breaker.consecutiveFailures = 0
+}
+
+// fail records the failure of an allowed call, which opens the circuit once
+// the threshold is reached.
+func (breaker *circuitBreaker) fail() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.trialInFlight = false
+	breaker.consecutiveFailures++
+	if breaker.consecutiveFailures >= breaker.threshold {
+		breaker.openedAt = breaker.now()
+		zap.S().Warnf("Circuit breaker opened after %d consecutive "+
+			"failures, short-circuiting the calls for %v",
+			breaker.consecutiveFailures, breaker.cooldown)
+	}
+}
+
+// release ends an allowed call that tells nothing about the health of
+// Codeforces, e.g, a cancelled one, leaving the circuit as is.
+func (breaker *circuitBreaker) release() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.trialInFlight = false
+}
+
+// isOutage reports whether the error of a call suggests that Codeforces is
+// unavailable, i.e, a transport error or a 5xx, as opposed to the call being
+// invalid, throttled or cancelled. The call limit is enforced per client, so
+// it doesn't mean that Codeforces is down.
+func isOutage(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// newCircuitBreaker returns a circuit breaker, or nil if the threshold is
+// non-positive, which disables it.
+func newCircuitBreaker(threshold int,
+	cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
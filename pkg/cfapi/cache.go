@@ -0,0 +1,80 @@
+package cfapi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// recentActionsCache is a short lived in-memory cache of the recent actions,
+// keyed by maxCount. Codeforces sends neither an ETag nor a Last-Modified
+// header, so the responses can't be revalidated and simply expire after ttl.
+type recentActionsCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[int]recentActionsCacheEntry
+}
+
+type recentActionsCacheEntry struct {
+	actions   []models.RecentAction
+	fetchedAt time.Time
+}
+
+// get returns the cached actions for maxCount, if they have not expired.
+func (cache *recentActionsCache) get(maxCount int) (
+	[]models.RecentAction, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[maxCount]
+	if !ok || time.Since(entry.fetchedAt) >= cache.ttl {
+		return nil, false
+	}
+
+	// Callers are free to modify the returned actions.
+	return cloneActions(entry.actions), true
+}
+
+// put caches the actions fetched for maxCount.
+func (cache *recentActionsCache) put(maxCount int,
+	actions []models.RecentAction) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries[maxCount] = recentActionsCacheEntry{
+		actions:   cloneActions(actions),
+		fetchedAt: time.Now(),
+	}
+}
+
+// cloneActions deep copies the actions, so that the cached ones are never
+// shared with the callers, who may modify the blog entries or the comments.
+func cloneActions(actions []models.RecentAction) []models.RecentAction {
+	clones := make([]models.RecentAction, len(actions))
+	for ind, action := range actions {
+		if action.BlogEntry != nil {
+			blogEntry := *action.BlogEntry
+			blogEntry.Tags = append([]string(nil), blogEntry.Tags...)
+			action.BlogEntry = &blogEntry
+		}
+		if action.Comment != nil {
+			comment := *action.Comment
+			action.Comment = &comment
+		}
+		clones[ind] = action
+	}
+	return clones
+}
+
+// newRecentActionsCache returns a cache with the given ttl, or nil if the ttl
+// is non-positive, which disables caching.
+func newRecentActionsCache(ttl time.Duration) *recentActionsCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &recentActionsCache{
+		ttl:     ttl,
+		entries: make(map[int]recentActionsCacheEntry),
+	}
+}
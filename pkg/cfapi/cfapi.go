@@ -2,96 +2,432 @@
 package cfapi
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
 	"github.com/variety-jones/cfrss/pkg/models"
 )
 
 const (
-	baseUrl               = "https://codeforces.com/api"
-	recentActionsEndpoint = "/recentActions"
+	kDefaultBaseUrl           = "https://codeforces.com/api"
+	recentActionsEndpoint     = "/recentActions"
+	blogEntryCommentsEndpoint = "/blogEntry.comments"
+	userInfoEndpoint          = "/user.info"
+	blogEntryViewEndpoint     = "/blogEntry.view"
+	contestListEndpoint       = "/contest.list"
+	userStatusEndpoint        = "/user.status"
 
 	kStatusOK = "OK"
+
+	// kDefaultUserAgent identifies the client to Codeforces.
+	kDefaultUserAgent = "cfrss/dev"
+
+	// kMaxRecentActionsCount is the maximum maxCount accepted by the
+	// recentActions endpoint.
+	kMaxRecentActionsCount = 100
+
+	// kDefaultCallInterval is the minimum time between two consecutive calls,
+	// as enforced by Codeforces.
+	kDefaultCallInterval = 2 * time.Second
+
+	// kCallLimitComment is the prefix of the comment returned by Codeforces
+	// when the client is making too many requests.
+	kCallLimitComment = "Call limit exceeded"
 )
 
 // CodeforcesAPI contains all the methods of the Codeforces API.
 type CodeforcesAPI interface {
-	RecentActions(maxCount int) ([]models.RecentAction, error)
+	RecentActions(ctx context.Context, maxCount int) (
+		[]models.RecentAction, error)
+
+	BlogEntryComments(ctx context.Context, blogEntryId int) (
+		[]models.Comment, error)
+
+	UserInfo(ctx context.Context, handles []string) (
+		[]models.CodeforcesUser, error)
+
+	BlogEntryView(ctx context.Context, blogEntryId int) (
+		models.BlogEntry, error)
+
+	ContestList(ctx context.Context, gym bool) ([]models.Contest, error)
+
+	UserStatus(ctx context.Context, handle string, from, count int) (
+		[]models.Submission, error)
 }
 
 // CodeforcesClient implements the Codeforces interface.
 type codeforcesClient struct {
-	client http.Client
+	client      http.Client
+	transport   *http.Transport
+	baseUrl     string
+	retryPolicy RetryPolicy
+
+	// credentials are nil for unauthenticated calls.
+	credentials *Credentials
+
+	// cache is nil when the recent actions are not cached.
+	cache *recentActionsCache
+
+	// breaker is nil when there is no circuit breaker.
+	breaker *circuitBreaker
+
+	// limiter is shared by all the methods, since Codeforces limits the
+	// number of calls per source rather than per endpoint.
+	limiter *rate.Limiter
+
+	// userAgent is sent with every call, followed by the contact of the
+	// operator, if any.
+	userAgent string
+	contact   string
+
+	// metrics are nil when no metrics are updated.
+	metrics *Metrics
 }
 
 // RecentActions fetches a list of recent blogs/comments from Codeforces.
-func (cf *codeforcesClient) RecentActions(maxCount int) (
+// A maxCount above the maximum accepted by Codeforces is clamped.
+func (cf *codeforcesClient) RecentActions(ctx context.Context, maxCount int) (
 	[]models.RecentAction, error) {
+	if maxCount <= 0 {
+		return nil, errors.Errorf("maxCount should be positive, got %d",
+			maxCount)
+	}
+	if maxCount > kMaxRecentActionsCount {
+		zap.S().Warnf("Clamping maxCount %d to the maximum of %d",
+			maxCount, kMaxRecentActionsCount)
+		maxCount = kMaxRecentActionsCount
+	}
+
+	if cf.cache != nil {
+		if actions, ok := cf.cache.get(maxCount); ok {
+			zap.S().Debugf("Serving RecentActions for %d from the cache",
+				maxCount)
+			return actions, nil
+		}
+	}
 	zap.S().Info("Executing RecentActions API...")
 
+	query := url.Values{}
+	query.Add("maxCount", fmt.Sprint(maxCount))
+
+	var actions []models.RecentAction
+	if err := cf.get(ctx, recentActionsEndpoint, query, &actions); err != nil {
+		return nil, err
+	}
+	if cf.cache != nil {
+		cf.cache.put(maxCount, actions)
+	}
+	return actions, nil
+}
+
+// BlogEntryComments fetches all the comments of a blog entry from Codeforces.
+func (cf *codeforcesClient) BlogEntryComments(ctx context.Context,
+	blogEntryId int) ([]models.Comment, error) {
+	zap.S().Infof("Executing BlogEntryComments API for blog %d...",
+		blogEntryId)
+
+	query := url.Values{}
+	query.Add("blogEntryId", fmt.Sprint(blogEntryId))
+
+	var comments []models.Comment
+	if err := cf.get(ctx, blogEntryCommentsEndpoint, query,
+		&comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// UserInfo fetches the profiles of the given handles from Codeforces.
+// If any of the handles does not exist, Codeforces fails the whole call and
+// a NotFoundError is returned, whose comment names the missing handle.
+func (cf *codeforcesClient) UserInfo(ctx context.Context, handles []string) (
+	[]models.CodeforcesUser, error) {
+	if len(handles) == 0 {
+		return nil, nil
+	}
+	zap.S().Infof("Executing UserInfo API for %d handles...", len(handles))
+
+	query := url.Values{}
+	query.Add("handles", strings.Join(handles, ";"))
+
+	var users []models.CodeforcesUser
+	if err := cf.get(ctx, userInfoEndpoint, query, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// BlogEntryView fetches a blog entry from Codeforces, including its complete
+// content which is missing from the recent actions.
+func (cf *codeforcesClient) BlogEntryView(ctx context.Context,
+	blogEntryId int) (models.BlogEntry, error) {
+	zap.S().Infof("Executing BlogEntryView API for blog %d...", blogEntryId)
+
+	query := url.Values{}
+	query.Add("blogEntryId", fmt.Sprint(blogEntryId))
+
+	var blogEntry models.BlogEntry
+	if err := cf.get(ctx, blogEntryViewEndpoint, query,
+		&blogEntry); err != nil {
+		return models.BlogEntry{}, err
+	}
+	return blogEntry, nil
+}
+
+// ContestList fetches all the contests from Codeforces, or all the gym
+// contests if gym is set. The upcoming contests have the BEFORE phase.
+func (cf *codeforcesClient) ContestList(ctx context.Context, gym bool) (
+	[]models.Contest, error) {
+	zap.S().Infof("Executing ContestList API with gym %v...", gym)
+
+	query := url.Values{}
+	query.Add("gym", fmt.Sprint(gym))
+
+	var contests []models.Contest
+	if err := cf.get(ctx, contestListEndpoint, query, &contests); err != nil {
+		return nil, err
+	}
+	return contests, nil
+}
+
+// UserStatus fetches count submissions of the handle from Codeforces, newest
+// first, starting from the from-th one, which is 1-based.
+func (cf *codeforcesClient) UserStatus(ctx context.Context, handle string,
+	from, count int) ([]models.Submission, error) {
+	if from <= 0 || count <= 0 {
+		return nil, errors.Errorf("from and count should be positive, "+
+			"got %d and %d", from, count)
+	}
+	zap.S().Infof("Executing UserStatus API for %s...", handle)
+
+	query := url.Values{}
+	query.Add("handle", handle)
+	query.Add("from", fmt.Sprint(from))
+	query.Add("count", fmt.Sprint(count))
+
+	var submissions []models.Submission
+	if err := cf.get(ctx, userStatusEndpoint, query,
+		&submissions); err != nil {
+		return nil, err
+	}
+	return submissions, nil
+}
+
+// get calls the given endpoint and unmarshals the result into the result
+// argument, retrying transient failures according to the retry policy.
+func (cf *codeforcesClient) get(ctx context.Context, endpoint string,
+	query url.Values, result interface{}) error {
+	if cf.breaker == nil {
+		return cf.getWithRetries(ctx, endpoint, query, result)
+	}
+	if err := cf.breaker.allow(); err != nil {
+		return err
+	}
+
+	err := cf.getWithRetries(ctx, endpoint, query, result)
+	switch {
+	case err == nil:
+		cf.breaker.succeed()
+	case isOutage(ctx, err):
+		cf.breaker.fail()
+	default:
+		cf.breaker.release()
+	}
+	return err
+}
+
+// getWithRetries is the implementation of get, without the circuit breaker.
+func (cf *codeforcesClient) getWithRetries(ctx context.Context,
+	endpoint string, query url.Values, result interface{}) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = cf.getOnce(ctx, endpoint, query, result)
+
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) ||
+			attempt >= cf.retryPolicy.MaxAttempts {
+			break
+		}
+
+		delay := cf.retryPolicy.delay(attempt)
+		zap.S().Warnf("Attempt %d of %s failed with error [%v], "+
+			"retrying in %v", attempt, endpoint, err, delay)
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("retry of %s was cancelled with error [%v]",
+				endpoint, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+
+	var retryable *retryableError
+	if errors.As(err, &retryable) {
+		return retryable.err
+	}
+	return err
+}
+
+// getOnce makes a single call to the given endpoint. Errors that are worth
+// retrying are wrapped in a retryableError.
+func (cf *codeforcesClient) getOnce(ctx context.Context, endpoint string,
+	query url.Values, result interface{}) error {
+	// Block till the rate limiter allows another call.
+	if err := cf.limiter.Wait(ctx); err != nil {
+		return errors.Errorf("rate limiter for %s failed with error [%v]",
+			endpoint, err)
+	}
+
 	// Create the HTTP request and add query parameters.
-	url := baseUrl + recentActionsEndpoint
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	requestUrl := cf.baseUrl + endpoint
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl,
+		nil)
 	if err != nil {
-		zap.S().Debugf("URL: %s", url)
-		return nil, errors.Errorf("could not create request for "+
-			"/recentActions api with error [%v]", err)
+		zap.S().Debugf("URL: %s", requestUrl)
+		return errors.Errorf("could not create request for "+
+			"%s api with error [%v]", endpoint, err)
+	}
+	if cf.credentials != nil {
+		// The signature contains the current time, so every attempt is
+		// signed afresh.
+		query = signQuery(*cf.credentials, strings.TrimPrefix(endpoint, "/"),
+			query, time.Now(), newRandPrefix())
 	}
-	query := req.URL.Query()
-	query.Add("maxCount", fmt.Sprint(maxCount))
 	req.URL.RawQuery = query.Encode()
 
+	// Setting the header explicitly disables the transparent decompression
+	// of the transport, so the body is decompressed below.
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", cf.userAgentHeader())
+
 	// Make the HTTP call.
 	resp, err := cf.client.Do(req)
 	if err != nil {
 		zap.S().Debugf("request: %+v", req)
-		return nil, errors.Errorf("http call to /recentActions failed "+
-			"with error [%v]", err)
+		return &retryableError{errors.Errorf("http call to %s failed "+
+			"with error [%v]", endpoint, err)}
 	}
 	defer resp.Body.Close()
 
 	// Read the response body.
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		zap.S().Debugf("response: %+v", resp)
-		return nil, errors.Errorf("could not read response of /recentActions "+
-			"with error [%v]", err)
+	reader := io.Reader(resp.Body)
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return &retryableError{errors.Errorf("could not decompress "+
+				"response of %s with error [%v]", endpoint, err)}
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
 	}
-
-	// Unmarshal the response.
+	// The response is decoded as it is read, straight into the result, since
+	// some of them, e.g, the list of all the gym contests, span megabytes.
+	body := &recordingReader{reader: reader}
 	wrapper := struct {
 		Status  string
 		Comment string
-		Result  []models.RecentAction
-	}{}
-	if err := json.Unmarshal(body, &wrapper); err != nil {
-		zap.S().Debugf("body: %s", string(body))
-		return nil, errors.Errorf("could not unmarshal /recentActions response "+
-			"with error [%v]", err)
+		Result  interface{}
+	}{Result: result}
+	if err := json.NewDecoder(body).Decode(&wrapper); err != nil {
+		if body.err != nil {
+			zap.S().Debugf("response: %+v", resp)
+			return &retryableError{errors.Errorf("could not read response "+
+				"of %s with error [%v]", endpoint, body.err)}
+		}
+		err = errors.Errorf("could not unmarshal %s response "+
+			"with error [%v]", endpoint, err)
+		// Gateways return HTML pages when Codeforces is down.
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &retryableError{err}
+		}
+		return err
 	}
 
 	// Check for internal server errors from Codeforces.
 	if wrapper.Status != kStatusOK {
-		zap.S().Debugf("response body: %s", string(body))
-		return nil, errors.Errorf("codeforces returned an internal error "+
-			"with comment [%s]", wrapper.Comment)
+		zap.S().Debugf("response status: %s", wrapper.Status)
+		err := newAPIError(endpoint, resp.StatusCode, wrapper.Comment)
+		var callLimitErr *CallLimitError
+		if errors.As(err, &callLimitErr) {
+			// Rate limiting explains why the feed stops updating, hence it
+			// is logged regardless of the retries.
+			zap.S().Warnf("Codeforces rate limited the call to %s "+
+				"with comment [%s]", endpoint, wrapper.Comment)
+			if cf.metrics != nil {
+				cf.metrics.rateLimited.Inc()
+			}
+			return &retryableError{err}
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &retryableError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// userAgentHeader returns the User-Agent, e.g,
+// "cfrss/dev (+mailto:ops@example.com)".
+func (cf *codeforcesClient) userAgentHeader() string {
+	if cf.contact == "" {
+		return cf.userAgent
 	}
-	return wrapper.Result, nil
+	return fmt.Sprintf("%s (+%s)", cf.userAgent, cf.contact)
+}
+
+// recordingReader records the error of the underlying reader, so that a
+// failed read is told apart from a malformed response.
+type recordingReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// newLimiter returns a rate limiter that allows one call per interval.
+// A non-positive interval disables rate limiting.
+func newLimiter(interval time.Duration) *rate.Limiter {
+	if interval <= 0 {
+		return rate.NewLimiter(rate.Inf, 1)
+	}
+	return rate.NewLimiter(rate.Every(interval), 1)
 }
 
 // NewCodeforcesClient returns a concrete implementation of the
 // CodeforcesAPI
-func NewCodeforcesClient(timeOut time.Duration) CodeforcesAPI {
+func NewCodeforcesClient(timeOut time.Duration,
+	opts ...Option) CodeforcesAPI {
 	cf := new(codeforcesClient)
+	// The transport is owned by the client, so that the options can
+	// configure it without affecting the other HTTP clients of the process.
+	cf.transport = http.DefaultTransport.(*http.Transport).Clone()
 	cf.client = http.Client{
-		Timeout: timeOut,
+		Timeout:   timeOut,
+		Transport: cf.transport,
+	}
+	cf.baseUrl = kDefaultBaseUrl
+	cf.retryPolicy = DefaultRetryPolicy()
+	cf.limiter = newLimiter(kDefaultCallInterval)
+	cf.userAgent = kDefaultUserAgent
+
+	for _, opt := range opts {
+		opt(cf)
 	}
 
 	return cf
@@ -0,0 +1,714 @@
+package cfapi_test
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("CodeforcesClient", func() {
+	ctx := context.Background()
+
+	// newFakeServer serves the same canned response to every request.
+	newFakeServer := func(status int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+				w.Write([]byte(body))
+			}))
+	}
+
+	newClient := func(server *httptest.Server) cfapi.CodeforcesAPI {
+		return cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.URL),
+			cfapi.WithCallInterval(0),
+			cfapi.WithRetryPolicy(cfapi.RetryPolicy{MaxAttempts: 1}))
+	}
+
+	It("should parse the recent actions", func() {
+		server := newFakeServer(http.StatusOK, `{"status":"OK","result":[
+			{"timeSeconds":1660000000,
+			 "blogEntry":{"id":101,"title":"Round"},
+			 "comment":{"id":7,"commentatorHandle":"tourist"}}]}`)
+		defer server.Close()
+
+		actions, err := newClient(server).RecentActions(ctx, 10)
+		Expect(err).Should(BeNil())
+		Expect(actions).Should(HaveLen(1))
+		Expect(actions[0].TimeSeconds).Should(Equal(int64(1660000000)))
+		Expect(actions[0].BlogEntry.Id).Should(Equal(101))
+		Expect(actions[0].Comment.CommentatorHandle).Should(Equal("tourist"))
+	})
+
+	It("should parse the contests", func() {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).Should(Equal("/contest.list"))
+				Expect(r.URL.Query().Get("gym")).Should(Equal("false"))
+				w.Write([]byte(`{"status":"OK","result":[
+					{"id":1900,"name":"Codeforces Round 900","type":"CF",
+					 "phase":"BEFORE","frozen":false,"durationSeconds":7200,
+					 "startTimeSeconds":1700000000,
+					 "relativeTimeSeconds":-3600}]}`))
+			}))
+		defer server.Close()
+
+		contests, err := newClient(server).ContestList(ctx, false)
+		Expect(err).Should(BeNil())
+		Expect(contests).Should(Equal([]models.Contest{{
+			Id:               1900,
+			Name:             "Codeforces Round 900",
+			Type:             "CF",
+			Phase:            "BEFORE",
+			StartTimeSeconds: 1700000000,
+			DurationSeconds:  7200,
+		}}))
+	})
+
+	It("should parse the submissions", func() {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).Should(Equal("/user.status"))
+				Expect(r.URL.Query().Get("handle")).Should(Equal("tourist"))
+				Expect(r.URL.Query().Get("from")).Should(Equal("1"))
+				Expect(r.URL.Query().Get("count")).Should(Equal("5"))
+				w.Write([]byte(`{"status":"OK","result":[
+					{"id":230000000,"contestId":1900,
+					 "creationTimeSeconds":1700000100,
+					 "problem":{"contestId":1900,"index":"A",
+					  "name":"Cover in Water","rating":800,"tags":["greedy"]},
+					 "programmingLanguage":"GNU C++17","verdict":"OK"}]}`))
+			}))
+		defer server.Close()
+
+		submissions, err := newClient(server).UserStatus(ctx, "tourist", 1, 5)
+		Expect(err).Should(BeNil())
+		Expect(submissions).Should(Equal([]models.Submission{{
+			Id:                  230000000,
+			ContestId:           1900,
+			CreationTimeSeconds: 1700000100,
+			Problem: models.Problem{
+				ContestId: 1900,
+				Index:     "A",
+				Name:      "Cover in Water",
+				Rating:    800,
+			},
+			Verdict:             "OK",
+			ProgrammingLanguage: "GNU C++17",
+		}}))
+
+		_, err = newClient(server).UserStatus(ctx, "tourist", 0, 5)
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("should parse the comments of a blog entry", func() {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).Should(Equal("/blogEntry.comments"))
+				Expect(r.URL.Query().Get("blogEntryId")).Should(Equal("101"))
+				w.Write([]byte(`{"status":"OK","result":[
+					{"id":7,"creationTimeSeconds":1660000000,
+					 "commentatorHandle":"tourist","locale":"en",
+					 "text":"Nice problems","parentCommentId":5,
+					 "rating":12}]}`))
+			}))
+		defer server.Close()
+
+		comments, err := newClient(server).BlogEntryComments(ctx, 101)
+		Expect(err).Should(BeNil())
+		Expect(comments).Should(Equal([]models.Comment{{
+			Id:                  7,
+			CreationTimeSeconds: 1660000000,
+			CommentatorHandle:   "tourist",
+			Locale:              "en",
+			Text:                "Nice problems",
+			ParentCommentId:     5,
+			Rating:              12,
+		}}))
+
+		failedServer := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"blogEntryId: Blog entry not found"}`)
+		defer failedServer.Close()
+		_, err = newClient(failedServer).BlogEntryComments(ctx, 101)
+		Expect(err).Should(MatchError(ContainSubstring("not found")))
+
+		malformedServer := newFakeServer(http.StatusOK,
+			`{"status":"OK","result":{"id":7}}`)
+		defer malformedServer.Close()
+		_, err = newClient(malformedServer).BlogEntryComments(ctx, 101)
+		Expect(err).Should(MatchError(ContainSubstring("unmarshal")))
+	})
+
+	It("should parse the profiles of the users", func() {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).Should(Equal("/user.info"))
+				Expect(r.URL.Query().Get("handles")).
+					Should(Equal("tourist;Petr"))
+				w.Write([]byte(`{"status":"OK","result":[
+					{"handle":"tourist","rating":3800,"maxRating":3979,
+					 "rank":"legendary grandmaster",
+					 "maxRank":"legendary grandmaster"},
+					{"handle":"Petr","rating":2900}]}`))
+			}))
+		defer server.Close()
+
+		users, err := newClient(server).UserInfo(ctx,
+			[]string{"tourist", "Petr"})
+		Expect(err).Should(BeNil())
+		Expect(users).Should(Equal([]models.CodeforcesUser{
+			{
+				Handle:    "tourist",
+				Rating:    3800,
+				MaxRating: 3979,
+				Rank:      "legendary grandmaster",
+				MaxRank:   "legendary grandmaster",
+			},
+			{Handle: "Petr", Rating: 2900},
+		}))
+
+		failedServer := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"handles: Field should not be empty"}`)
+		defer failedServer.Close()
+		_, err = newClient(failedServer).UserInfo(ctx, []string{"tourist"})
+		Expect(err).Should(MatchError(ContainSubstring("should not be empty")))
+
+		malformedServer := newFakeServer(http.StatusOK,
+			`{"status":"OK","result":[{"handle":7}]}`)
+		defer malformedServer.Close()
+		_, err = newClient(malformedServer).UserInfo(ctx, []string{"tourist"})
+		Expect(err).Should(MatchError(ContainSubstring("unmarshal")))
+	})
+
+	It("should parse a blog entry", func() {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).Should(Equal("/blogEntry.view"))
+				Expect(r.URL.Query().Get("blogEntryId")).Should(Equal("101"))
+				w.Write([]byte(`{"status":"OK","result":
+					{"id":101,"originalLocale":"en",
+					 "creationTimeSeconds":1660000000,
+					 "authorHandle":"MikeMirzayanov","title":"Round",
+					 "content":"<p>Welcome</p>","locale":"en",
+					 "modificationTimeSeconds":1660000100,
+					 "allowViewHistory":true,"tags":["round"],
+					 "rating":42}}`))
+			}))
+		defer server.Close()
+
+		blogEntry, err := newClient(server).BlogEntryView(ctx, 101)
+		Expect(err).Should(BeNil())
+		Expect(blogEntry).Should(Equal(models.BlogEntry{
+			Id:                      101,
+			OriginalLocale:          "en",
+			CreationTimeSeconds:     1660000000,
+			AuthorHandle:            "MikeMirzayanov",
+			Title:                   "Round",
+			Content:                 "<p>Welcome</p>",
+			Locale:                  "en",
+			ModificationTimeSeconds: 1660000100,
+			AllowViewHistory:        true,
+			Tags:                    []string{"round"},
+			Rating:                  42,
+		}))
+
+		failedServer := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"blogEntryId: Blog entry not found"}`)
+		defer failedServer.Close()
+		_, err = newClient(failedServer).BlogEntryView(ctx, 101)
+		Expect(err).Should(MatchError(ContainSubstring("not found")))
+
+		malformedServer := newFakeServer(http.StatusOK,
+			`{"status":"OK","result":[{"id":101}]}`)
+		defer malformedServer.Close()
+		_, err = newClient(malformedServer).BlogEntryView(ctx, 101)
+		Expect(err).Should(MatchError(ContainSubstring("unmarshal")))
+	})
+
+	It("should fail on a truncated response", func() {
+		server := newFakeServer(http.StatusOK,
+			`{"status":"OK","result":[{"id":1900,"name":"Round`)
+		defer server.Close()
+
+		_, err := newClient(server).ContestList(ctx, true)
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("should identify itself with the User-Agent", func() {
+		var userAgents []string
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				userAgents = append(userAgents, r.UserAgent())
+				w.Write([]byte(`{"status":"OK","result":[]}`))
+			}))
+		defer server.Close()
+
+		_, err := newClient(server).RecentActions(ctx, 10)
+		Expect(err).Should(BeNil())
+
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.URL),
+			cfapi.WithCallInterval(0),
+			cfapi.WithUserAgent("cfrss/1.2.0"),
+			cfapi.WithContact("mailto:ops@example.com"))
+		_, err = client.RecentActions(ctx, 10)
+		Expect(err).Should(BeNil())
+
+		Expect(userAgents).Should(Equal([]string{
+			"cfrss/dev",
+			"cfrss/1.2.0 (+mailto:ops@example.com)",
+		}))
+	})
+
+	It("should send the calls through the proxy", func() {
+		proxyUrl, err := url.Parse("http://proxy.example.com:3128")
+		Expect(err).Should(BeNil())
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithProxy(proxyUrl),
+			cfapi.WithMaxConns(4, 2))
+
+		transport := cfapi.Transport(client)
+		Expect(transport.Proxy).ShouldNot(BeNil())
+		req, _ := http.NewRequest(http.MethodGet,
+			"https://codeforces.com/api/recentActions", nil)
+		Expect(transport.Proxy(req)).Should(Equal(proxyUrl))
+		Expect(transport.MaxConnsPerHost).Should(Equal(4))
+		Expect(transport.MaxIdleConnsPerHost).Should(Equal(2))
+
+		// The proxy of the environment is honored by default.
+		Expect(cfapi.Transport(cfapi.NewCodeforcesClient(time.Second)).Proxy).
+			ShouldNot(BeNil())
+	})
+
+	It("should decompress a gzip-encoded response", func() {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Get("Accept-Encoding")).Should(Equal("gzip"))
+
+				w.Header().Set("Content-Encoding", "gzip")
+				gzipWriter := gzip.NewWriter(w)
+				gzipWriter.Write([]byte(`{"status":"OK","result":[
+					{"timeSeconds":1660000000,"blogEntry":{"id":101}}]}`))
+				gzipWriter.Close()
+			}))
+		defer server.Close()
+
+		actions, err := newClient(server).RecentActions(ctx, 10)
+		Expect(err).Should(BeNil())
+		Expect(actions).Should(HaveLen(1))
+		Expect(actions[0].BlogEntry.Id).Should(Equal(101))
+	})
+
+	It("should serve rapid identical calls from the cache", func() {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Write([]byte(`{"status":"OK","result":[
+					{"timeSeconds":1660000000,"blogEntry":{"id":101}}]}`))
+			}))
+		defer server.Close()
+
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.URL),
+			cfapi.WithCallInterval(0),
+			cfapi.WithCacheTTL(time.Minute))
+
+		for cnt := 0; cnt < 2; cnt++ {
+			actions, err := client.RecentActions(ctx, 10)
+			Expect(err).Should(BeNil())
+			Expect(actions).Should(HaveLen(1))
+		}
+		Expect(calls).Should(Equal(1))
+
+		// A different maxCount is a different request.
+		_, err := client.RecentActions(ctx, 20)
+		Expect(err).Should(BeNil())
+		Expect(calls).Should(Equal(2))
+	})
+
+	It("should not share the cached actions with the callers", func() {
+		server := newFakeServer(http.StatusOK, `{"status":"OK","result":[
+			{"timeSeconds":1660000000,"blogEntry":{"id":101,
+			"title":"Round 1","tags":["dp"]},"comment":{"id":5,"text":"Hi"}}]}`)
+		defer server.Close()
+
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.URL),
+			cfapi.WithCallInterval(0),
+			cfapi.WithCacheTTL(time.Minute))
+
+		actions, err := client.RecentActions(ctx, 10)
+		Expect(err).Should(BeNil())
+		actions[0].BlogEntry.Title = "Modified"
+		actions[0].BlogEntry.Tags[0] = "greedy"
+		actions[0].Comment.Text = "Modified"
+
+		for cnt := 0; cnt < 2; cnt++ {
+			actions, err = client.RecentActions(ctx, 10)
+			Expect(err).Should(BeNil())
+			Expect(actions[0].BlogEntry.Title).Should(Equal("Round 1"))
+			Expect(actions[0].BlogEntry.Tags).Should(Equal([]string{"dp"}))
+			Expect(actions[0].Comment.Text).Should(Equal("Hi"))
+			actions[0].BlogEntry.Title = "Modified"
+		}
+	})
+
+	It("should reject a non-positive maxCount without a call", func() {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				calls++
+			}))
+		defer server.Close()
+
+		for _, maxCount := range []int{0, -1} {
+			_, err := newClient(server).RecentActions(ctx, maxCount)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("positive"))
+		}
+		Expect(calls).Should(BeZero())
+	})
+
+	It("should clamp a maxCount above the maximum", func() {
+		var maxCount string
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				maxCount = r.URL.Query().Get("maxCount")
+				w.Write([]byte(`{"status":"OK","result":[]}`))
+			}))
+		defer server.Close()
+
+		_, err := newClient(server).RecentActions(ctx, 500)
+		Expect(err).Should(BeNil())
+		Expect(maxCount).Should(Equal("100"))
+	})
+
+	It("should surface the comment of a failed status", func() {
+		server := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"maxCount: Field should be valid"}`)
+		defer server.Close()
+
+		_, err := newClient(server).RecentActions(ctx, 10)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("maxCount"))
+	})
+
+	It("should classify the failures by their comment", func() {
+		server := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"maxCount: Field should be valid"}`)
+		defer server.Close()
+
+		_, err := newClient(server).RecentActions(ctx, 10)
+		var apiErr *cfapi.APIError
+		Expect(errors.As(err, &apiErr)).Should(BeTrue())
+		Expect(apiErr.StatusCode).Should(Equal(http.StatusBadRequest))
+		Expect(apiErr.Comment).Should(Equal("maxCount: Field should be valid"))
+		Expect(errors.Is(err, &cfapi.CallLimitError{})).Should(BeFalse())
+		Expect(errors.Is(err, &cfapi.NotFoundError{})).Should(BeFalse())
+
+		limitServer := newFakeServer(http.StatusServiceUnavailable,
+			`{"status":"FAILED","comment":"Call limit exceeded"}`)
+		defer limitServer.Close()
+
+		_, err = newClient(limitServer).RecentActions(ctx, 10)
+		Expect(errors.Is(err, &cfapi.CallLimitError{})).Should(BeTrue())
+		Expect(errors.As(err, &apiErr)).Should(BeTrue())
+		Expect(apiErr.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+
+		notFoundServer := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"handles: User with handle x not found"}`)
+		defer notFoundServer.Close()
+
+		_, err = newClient(notFoundServer).UserInfo(ctx, []string{"x"})
+		var notFoundErr *cfapi.NotFoundError
+		Expect(errors.As(err, &notFoundErr)).Should(BeTrue())
+		Expect(notFoundErr.Endpoint).Should(Equal("/user.info"))
+	})
+
+	It("should count the rate limited calls, including the retried ones",
+		func() {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					if atomic.AddInt32(&calls, 1) == 1 {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						w.Write([]byte(
+							`{"status":"FAILED","comment":"Call limit exceeded"}`))
+						return
+					}
+					w.Write([]byte(`{"status":"OK","result":[]}`))
+				}))
+			defer server.Close()
+
+			metrics := cfapi.NewMetrics(nil)
+			client := cfapi.NewCodeforcesClient(time.Second,
+				cfapi.WithBaseURL(server.URL),
+				cfapi.WithCallInterval(0),
+				cfapi.WithRetryPolicy(cfapi.RetryPolicy{MaxAttempts: 2}),
+				cfapi.WithMetrics(metrics))
+
+			_, err := client.RecentActions(ctx, 10)
+			Expect(err).Should(BeNil())
+			Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(2)))
+			Expect(cfapi.RateLimited(metrics)).Should(Equal(1.0))
+		})
+
+	Describe("rate limiting", func() {
+		It("should space the calls by the interval", func() {
+			var times []time.Time
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					times = append(times, time.Now())
+					w.Write([]byte(`{"status":"OK","result":[]}`))
+				}))
+			defer server.Close()
+
+			client := cfapi.NewCodeforcesClient(time.Second,
+				cfapi.WithBaseURL(server.URL),
+				cfapi.WithCallInterval(100*time.Millisecond))
+			for ind := 0; ind < 3; ind++ {
+				_, err := client.BlogEntryComments(ctx, ind)
+				Expect(err).Should(BeNil())
+			}
+
+			Expect(times).Should(HaveLen(3))
+			for ind := 1; ind < len(times); ind++ {
+				Expect(times[ind].Sub(times[ind-1])).Should(
+					BeNumerically(">=", 90*time.Millisecond))
+			}
+		})
+
+		It("should return promptly once the context is cancelled", func() {
+			server := newFakeServer(http.StatusOK,
+				`{"status":"OK","result":[]}`)
+			defer server.Close()
+
+			client := cfapi.NewCodeforcesClient(time.Second,
+				cfapi.WithBaseURL(server.URL),
+				cfapi.WithCallInterval(time.Hour))
+			_, err := client.BlogEntryComments(ctx, 1)
+			Expect(err).Should(BeNil())
+
+			cancelCtx, cancel := context.WithCancel(ctx)
+			time.AfterFunc(50*time.Millisecond, cancel)
+			start := time.Now()
+			_, err = client.BlogEntryComments(cancelCtx, 1)
+			Expect(err).Should(HaveOccurred())
+			Expect(time.Since(start)).Should(
+				BeNumerically("<", time.Second))
+		})
+	})
+
+	Describe("retries", func() {
+		// newScriptedServer answers the calls with the handlers in turn, and
+		// successfully past them.
+		newScriptedServer := func(calls *int32,
+			handlers ...http.HandlerFunc) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					ind := int(atomic.AddInt32(calls, 1)) - 1
+					if ind < len(handlers) {
+						handlers[ind](w, r)
+						return
+					}
+					w.Write([]byte(`{"status":"OK","result":[]}`))
+				}))
+		}
+		respond := func(status int, body string) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+				w.Write([]byte(body))
+			}
+		}
+		newRetryingClient := func(server *httptest.Server,
+			baseDelay time.Duration) cfapi.CodeforcesAPI {
+			return cfapi.NewCodeforcesClient(time.Second,
+				cfapi.WithBaseURL(server.URL),
+				cfapi.WithCallInterval(0),
+				cfapi.WithRetryPolicy(cfapi.RetryPolicy{
+					MaxAttempts: 3,
+					BaseDelay:   baseDelay,
+				}))
+		}
+
+		It("should retry the transport errors and the server errors",
+			func() {
+				var calls int32
+				server := newScriptedServer(&calls,
+					// The connection is dropped without a response.
+					func(w http.ResponseWriter, r *http.Request) {
+						conn, _, err := w.(http.Hijacker).Hijack()
+						Expect(err).Should(BeNil())
+						conn.Close()
+					},
+					respond(http.StatusBadGateway, "<html>down</html>"))
+				defer server.Close()
+
+				_, err := newRetryingClient(server, time.Millisecond).
+					RecentActions(ctx, 10)
+				Expect(err).Should(BeNil())
+				Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(3)))
+			})
+
+		It("should back off on the call limit", func() {
+			var calls int32
+			server := newScriptedServer(&calls, respond(
+				http.StatusServiceUnavailable,
+				`{"status":"FAILED","comment":"Call limit exceeded"}`))
+			defer server.Close()
+
+			start := time.Now()
+			_, err := newRetryingClient(server, 100*time.Millisecond).
+				RecentActions(ctx, 10)
+			Expect(err).Should(BeNil())
+			Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(2)))
+			Expect(time.Since(start)).Should(
+				BeNumerically(">=", 100*time.Millisecond))
+		})
+
+		It("should not retry a malformed successful response", func() {
+			var calls int32
+			server := newScriptedServer(&calls,
+				respond(http.StatusOK, `{"status":"OK","result":[`))
+			defer server.Close()
+
+			_, err := newRetryingClient(server, time.Millisecond).
+				RecentActions(ctx, 10)
+			Expect(err).Should(HaveOccurred())
+			Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(1)))
+		})
+
+		It("should give up after the maximum attempts", func() {
+			var calls int32
+			down := respond(http.StatusBadGateway, "<html>down</html>")
+			server := newScriptedServer(&calls, down, down, down, down)
+			defer server.Close()
+
+			_, err := newRetryingClient(server, time.Millisecond).
+				RecentActions(ctx, 10)
+			Expect(err).Should(HaveOccurred())
+			Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(3)))
+		})
+	})
+
+	It("should short-circuit the calls while Codeforces is down", func() {
+		// The handler runs on the goroutines of the server.
+		var calls, healthy int32
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				if atomic.LoadInt32(&healthy) == 0 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.Write([]byte(`{"status":"OK","result":[]}`))
+			}))
+		defer server.Close()
+
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.URL),
+			cfapi.WithCallInterval(0),
+			cfapi.WithRetryPolicy(cfapi.RetryPolicy{MaxAttempts: 1}),
+			cfapi.WithCircuitBreaker(2, 50*time.Millisecond))
+
+		for ind := 0; ind < 2; ind++ {
+			_, err := client.RecentActions(ctx, 10)
+			Expect(err).Should(HaveOccurred())
+			Expect(errors.Is(err, cfapi.ErrCircuitOpen)).Should(BeFalse())
+		}
+		_, err := client.RecentActions(ctx, 10)
+		Expect(errors.Is(err, cfapi.ErrCircuitOpen)).Should(BeTrue())
+		Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(2)))
+
+		// A failed trial call opens the circuit again.
+		time.Sleep(60 * time.Millisecond)
+		_, err = client.RecentActions(ctx, 10)
+		Expect(errors.Is(err, cfapi.ErrCircuitOpen)).Should(BeFalse())
+		_, err = client.RecentActions(ctx, 10)
+		Expect(errors.Is(err, cfapi.ErrCircuitOpen)).Should(BeTrue())
+		Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(3)))
+
+		// A successful trial call closes it.
+		atomic.StoreInt32(&healthy, 1)
+		time.Sleep(60 * time.Millisecond)
+		_, err = client.RecentActions(ctx, 10)
+		Expect(err).Should(BeNil())
+		_, err = client.RecentActions(ctx, 10)
+		Expect(err).Should(BeNil())
+		Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(5)))
+	})
+
+	It("should not open the circuit on invalid calls", func() {
+		server := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"handles: User with handle x not found"}`)
+		defer server.Close()
+
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.URL),
+			cfapi.WithCallInterval(0),
+			cfapi.WithCircuitBreaker(1, time.Minute))
+		for ind := 0; ind < 3; ind++ {
+			_, err := client.UserInfo(ctx, []string{"x"})
+			Expect(errors.Is(err, &cfapi.NotFoundError{})).Should(BeTrue())
+		}
+	})
+
+	It("should not open the circuit on the call limit", func() {
+		server := newFakeServer(http.StatusBadRequest,
+			`{"status":"FAILED","comment":"Call limit exceeded"}`)
+		defer server.Close()
+
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.URL),
+			cfapi.WithCallInterval(0),
+			cfapi.WithRetryPolicy(cfapi.RetryPolicy{MaxAttempts: 1}),
+			cfapi.WithCircuitBreaker(1, time.Minute))
+		for ind := 0; ind < 3; ind++ {
+			_, err := client.RecentActions(ctx, 10)
+			Expect(errors.Is(err, &cfapi.CallLimitError{})).Should(BeTrue())
+		}
+	})
+
+	It("should fail on a malformed response", func() {
+		server := newFakeServer(http.StatusBadGateway, "<html>down</html>")
+		defer server.Close()
+
+		_, err := newClient(server).RecentActions(ctx, 10)
+		Expect(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("SignQuery", func() {
+	It("should sign the sorted parameters with the secret", func() {
+		query := url.Values{}
+		query.Add("contestId", "566")
+
+		signed := cfapi.SignQuery(
+			cfapi.Credentials{ApiKey: "xxx", Secret: "yyy"},
+			"contest.hacks", query, time.Unix(1433851226, 0), "123456")
+
+		hash := sha512.Sum512([]byte(
+			"123456/contest.hacks?apiKey=xxx&contestId=566&time=1433851226#yyy"))
+		Expect(signed.Get("apiKey")).Should(Equal("xxx"))
+		Expect(signed.Get("time")).Should(Equal("1433851226"))
+		Expect(signed.Get("apiSig")).Should(
+			Equal("123456" + hex.EncodeToString(hash[:])))
+
+		// The original query is left untouched.
+		Expect(query).Should(HaveLen(1))
+	})
+})
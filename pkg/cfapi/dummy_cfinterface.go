@@ -1,6 +1,7 @@
 package cfapi
 
 import (
+	"context"
 	"sync"
 
 	"github.com/variety-jones/cfrss/pkg/models"
@@ -14,7 +15,8 @@ type dummyCodeforcesClient struct {
 	goldenDataset []models.RecentAction
 }
 
-func (client *dummyCodeforcesClient) RecentActions(maxCount int) (
+func (client *dummyCodeforcesClient) RecentActions(ctx context.Context,
+	maxCount int) (
 	[]models.RecentAction, error) {
 	client.mutex.Lock()
 	defer client.mutex.Unlock()
@@ -39,6 +41,35 @@ func (client *dummyCodeforcesClient) RecentActions(maxCount int) (
 	return res, nil
 }
 
+func (client *dummyCodeforcesClient) BlogEntryComments(ctx context.Context,
+	blogEntryId int) ([]models.Comment, error) {
+	return nil, nil
+}
+
+func (client *dummyCodeforcesClient) UserInfo(ctx context.Context,
+	handles []string) ([]models.CodeforcesUser, error) {
+	var users []models.CodeforcesUser
+	for _, handle := range handles {
+		users = append(users, models.CodeforcesUser{Handle: handle})
+	}
+	return users, nil
+}
+
+func (client *dummyCodeforcesClient) BlogEntryView(ctx context.Context,
+	blogEntryId int) (models.BlogEntry, error) {
+	return models.BlogEntry{Id: blogEntryId}, nil
+}
+
+func (client *dummyCodeforcesClient) ContestList(ctx context.Context,
+	gym bool) ([]models.Contest, error) {
+	return nil, nil
+}
+
+func (client *dummyCodeforcesClient) UserStatus(ctx context.Context,
+	handle string, from, count int) ([]models.Submission, error) {
+	return nil, nil
+}
+
 func NewDummyCodeforcesClient() CodeforcesAPI {
 	client := new(dummyCodeforcesClient)
 	return client
@@ -0,0 +1,75 @@
+package cfapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// kNotFoundComment is the suffix of the comments returned by Codeforces when
+// the requested handle, blog entry, etc, does not exist.
+const kNotFoundComment = "not found"
+
+// APIError is returned when Codeforces answers a call with a status other
+// than OK. Comment is the explanation provided by Codeforces.
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Comment    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("codeforces failed the call to %s with status %d "+
+		"and comment [%s]", e.Endpoint, e.StatusCode, e.Comment)
+}
+
+// CallLimitError is returned when Codeforces rejects a call because the
+// client exceeded the call limit. The call is worth attempting again after
+// backing off.
+type CallLimitError struct {
+	APIError
+}
+
+// Unwrap exposes the underlying APIError to errors.As.
+func (e *CallLimitError) Unwrap() error {
+	return &e.APIError
+}
+
+// Is makes errors.Is(err, &CallLimitError{}) match any call limit error.
+func (e *CallLimitError) Is(target error) bool {
+	_, ok := target.(*CallLimitError)
+	return ok
+}
+
+// NotFoundError is returned when the requested resource, e.g, a handle or a
+// blog entry, does not exist.
+type NotFoundError struct {
+	APIError
+}
+
+// Unwrap exposes the underlying APIError to errors.As.
+func (e *NotFoundError) Unwrap() error {
+	return &e.APIError
+}
+
+// Is makes errors.Is(err, &NotFoundError{}) match any not found error.
+func (e *NotFoundError) Is(target error) bool {
+	_, ok := target.(*NotFoundError)
+	return ok
+}
+
+// newAPIError classifies the failure reported by Codeforces by its comment.
+func newAPIError(endpoint string, statusCode int, comment string) error {
+	apiErr := APIError{
+		Endpoint:   endpoint,
+		StatusCode: statusCode,
+		Comment:    comment,
+	}
+	switch {
+	case strings.HasPrefix(comment, kCallLimitComment):
+		return &CallLimitError{apiErr}
+	case strings.HasSuffix(comment, kNotFoundComment):
+		return &NotFoundError{apiErr}
+	default:
+		return &apiErr
+	}
+}
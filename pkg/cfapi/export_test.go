@@ -0,0 +1,20 @@
+package cfapi
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// SignQuery exposes the request signing to the tests.
+var SignQuery = signQuery
+
+// Transport exposes the transport of the client to the tests.
+func Transport(client CodeforcesAPI) *http.Transport {
+	return client.(*codeforcesClient).transport
+}
+
+// RateLimited exposes the value of the rate limited calls counter to tests.
+func RateLimited(metrics *Metrics) float64 {
+	return testutil.ToFloat64(metrics.rateLimited)
+}
@@ -0,0 +1,36 @@
+package cfapi
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	kMetricsNamespace = "cf"
+	kMetricsSubsystem = "api"
+)
+
+// Metrics is the set of prometheus metrics updated by the client on each
+// call to Codeforces, including the ones retried.
+type Metrics struct {
+	rateLimited prometheus.Counter
+}
+
+// NewMetrics creates the client metrics and registers them with the
+// registerer. If the registerer is nil, the metrics are updated but never
+// exported, which is handy in tests.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "rate_limited_total",
+			Help: "Number of calls to the Codeforces API rejected since " +
+				"the call limit was exceeded, including the retried ones.",
+		}),
+	}
+
+	if reg != nil {
+		reg.MustRegister(m.rateLimited)
+	}
+	return m
+}
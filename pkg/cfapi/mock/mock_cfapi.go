@@ -0,0 +1,257 @@
+// Package mock contains a programmable implementation of the CodeforcesAPI,
+// which lets tests script the responses of Codeforces.
+package mock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// ErrNoResponse is returned when all the scripted responses are consumed.
+var ErrNoResponse = errors.New("no scripted response left")
+
+// Response is a single scripted result of a call to the API.
+type Response struct {
+	Actions []models.RecentAction
+	Err     error
+}
+
+// CodeforcesClient implements the CodeforcesAPI by popping the next scripted
+// response on each call.
+type CodeforcesClient struct {
+	mutex     sync.Mutex
+	responses []Response
+	calls     int
+
+	// comments maps a blog entry id to the comments returned for it.
+	comments map[int][]models.Comment
+
+	// users maps a handle to the profile returned for it.
+	users map[string]models.CodeforcesUser
+
+	// blogEntries maps a blog entry id to the entry returned for it.
+	blogEntries map[int]models.BlogEntry
+
+	// submissions maps a handle to its submissions, newest first.
+	submissions map[string][]models.Submission
+
+	// contests and gymContests are returned by ContestList.
+	contests    []models.Contest
+	gymContests []models.Contest
+}
+
+// Push appends the responses to the queue of scripted responses.
+func (client *CodeforcesClient) Push(responses ...Response) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.responses = append(client.responses, responses...)
+}
+
+// Calls returns the number of calls made to the API so far.
+func (client *CodeforcesClient) Calls() int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.calls
+}
+
+func (client *CodeforcesClient) RecentActions(ctx context.Context,
+	maxCount int) ([]models.RecentAction, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(client.responses) == 0 {
+		return nil, ErrNoResponse
+	}
+
+	res := client.responses[0]
+	client.responses = client.responses[1:]
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	// Codeforces never returns more than maxCount actions.
+	actions := res.Actions
+	if len(actions) > maxCount {
+		actions = actions[:maxCount]
+	}
+	return actions, nil
+}
+
+// SetComments sets the comments returned for the given blog entry.
+func (client *CodeforcesClient) SetComments(blogEntryId int,
+	comments []models.Comment) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.comments[blogEntryId] = comments
+}
+
+func (client *CodeforcesClient) BlogEntryComments(ctx context.Context,
+	blogEntryId int) ([]models.Comment, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	comments, ok := client.comments[blogEntryId]
+	if !ok {
+		return nil, ErrNoResponse
+	}
+	return comments, nil
+}
+
+// SetUsers sets the profiles returned for their handles.
+func (client *CodeforcesClient) SetUsers(users ...models.CodeforcesUser) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	for _, user := range users {
+		client.users[user.Handle] = user
+	}
+}
+
+func (client *CodeforcesClient) UserInfo(ctx context.Context,
+	handles []string) ([]models.CodeforcesUser, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Just like Codeforces, fail the whole call for a single unknown handle.
+	var users []models.CodeforcesUser
+	for _, handle := range handles {
+		user, ok := client.users[handle]
+		if !ok {
+			return nil, &cfapi.NotFoundError{APIError: cfapi.APIError{
+				Endpoint:   "user.info",
+				StatusCode: http.StatusBadRequest,
+				Comment: fmt.Sprintf("handles: User with handle %s "+
+					"not found", handle),
+			}}
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// SetBlogEntries sets the blog entries returned for their ids.
+func (client *CodeforcesClient) SetBlogEntries(
+	blogEntries ...models.BlogEntry) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	for _, blogEntry := range blogEntries {
+		client.blogEntries[blogEntry.Id] = blogEntry
+	}
+}
+
+func (client *CodeforcesClient) BlogEntryView(ctx context.Context,
+	blogEntryId int) (models.BlogEntry, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.calls++
+	if err := ctx.Err(); err != nil {
+		return models.BlogEntry{}, err
+	}
+	blogEntry, ok := client.blogEntries[blogEntryId]
+	if !ok {
+		return models.BlogEntry{}, ErrNoResponse
+	}
+	return blogEntry, nil
+}
+
+// SetContests sets the contests, or the gym contests, returned by
+// ContestList.
+func (client *CodeforcesClient) SetContests(gym bool,
+	contests ...models.Contest) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if gym {
+		client.gymContests = contests
+	} else {
+		client.contests = contests
+	}
+}
+
+func (client *CodeforcesClient) ContestList(ctx context.Context,
+	gym bool) ([]models.Contest, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if gym {
+		return client.gymContests, nil
+	}
+	return client.contests, nil
+}
+
+// SetSubmissions sets the submissions of the handle, newest first.
+func (client *CodeforcesClient) SetSubmissions(handle string,
+	submissions ...models.Submission) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.submissions[handle] = submissions
+}
+
+func (client *CodeforcesClient) UserStatus(ctx context.Context,
+	handle string, from, count int) ([]models.Submission, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	submissions, ok := client.submissions[handle]
+	if !ok {
+		return nil, errors.Errorf("handle: User with handle %s not found",
+			handle)
+	}
+
+	// Just like Codeforces, from is 1-based.
+	start := from - 1
+	if start > len(submissions) {
+		start = len(submissions)
+	}
+	end := start + count
+	if end > len(submissions) {
+		end = len(submissions)
+	}
+	return submissions[start:end], nil
+}
+
+// NewCodeforcesClient creates a mock client with the given responses queued.
+func NewCodeforcesClient(responses ...Response) *CodeforcesClient {
+	client := new(CodeforcesClient)
+	client.comments = make(map[int][]models.Comment)
+	client.users = make(map[string]models.CodeforcesUser)
+	client.blogEntries = make(map[int]models.BlogEntry)
+	client.submissions = make(map[string][]models.Submission)
+	client.Push(responses...)
+
+	return client
+}
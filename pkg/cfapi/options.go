@@ -0,0 +1,118 @@
+package cfapi
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Option customizes the Codeforces client created by NewCodeforcesClient.
+type Option func(cf *codeforcesClient)
+
+// WithRetryPolicy overrides the policy used to retry transient failures.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(cf *codeforcesClient) {
+		cf.retryPolicy = policy
+	}
+}
+
+// WithCallInterval overrides the minimum time between two consecutive calls
+// to Codeforces. A non-positive interval disables rate limiting.
+func WithCallInterval(interval time.Duration) Option {
+	return func(cf *codeforcesClient) {
+		cf.limiter = newLimiter(interval)
+	}
+}
+
+// WithBaseURL overrides the base URL of the Codeforces API, e.g, to point the
+// client to a fake server in tests.
+func WithBaseURL(baseUrl string) Option {
+	return func(cf *codeforcesClient) {
+		cf.baseUrl = strings.TrimSuffix(baseUrl, "/")
+	}
+}
+
+// WithCredentials makes the client sign every call with the given API key and
+// secret. Authenticated calls are subject to higher rate limits.
+func WithCredentials(apiKey, secret string) Option {
+	return func(cf *codeforcesClient) {
+		if apiKey == "" || secret == "" {
+			cf.credentials = nil
+			return
+		}
+		cf.credentials = &Credentials{ApiKey: apiKey, Secret: secret}
+	}
+}
+
+// WithCacheTTL caches the recent actions for the given duration, so that
+// identical calls within it don't reach Codeforces. A non-positive ttl, which
+// is the default, disables caching.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(cf *codeforcesClient) {
+		cf.cache = newRecentActionsCache(ttl)
+	}
+}
+
+// WithUserAgent overrides the User-Agent sent with every call, which is
+// cfrss/dev by default, e.g, to include the version of the release.
+func WithUserAgent(userAgent string) Option {
+	return func(cf *codeforcesClient) {
+		cf.userAgent = userAgent
+	}
+}
+
+// WithContact appends the contact of the operator to the User-Agent, e.g, an
+// email address or a URL, so that Codeforces can reach out about abuse
+// instead of banning the client.
+func WithContact(contact string) Option {
+	return func(cf *codeforcesClient) {
+		cf.contact = contact
+	}
+}
+
+// WithProxy sends every call through the given HTTP proxy. By default, the
+// proxy is taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables.
+func WithProxy(proxyUrl *url.URL) Option {
+	return func(cf *codeforcesClient) {
+		cf.transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+}
+
+// WithTLSConfig overrides the TLS configuration of the connections, e.g, to
+// trust the certificate of a proxy intercepting TLS.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(cf *codeforcesClient) {
+		cf.transport.TLSClientConfig = config
+	}
+}
+
+// WithMaxConns limits the number of connections to Codeforces, and the number
+// of idle connections kept alive. A zero value means no limit.
+func WithMaxConns(maxConns, maxIdleConns int) Option {
+	return func(cf *codeforcesClient) {
+		cf.transport.MaxConnsPerHost = maxConns
+		cf.transport.MaxIdleConnsPerHost = maxIdleConns
+	}
+}
+
+// WithCircuitBreaker short-circuits the calls with ErrCircuitOpen for the
+// cooldown after threshold consecutive failed calls, counted after the
+// retries. Only the transport errors and the 5xx count, e.g, invalid
+// arguments and the call limit don't. By default, there is no circuit
+// breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(cf *codeforcesClient) {
+		cf.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// WithMetrics updates the given metrics on each call. By default, or if the
+// metrics are nil, no metrics are updated.
+func WithMetrics(metrics *Metrics) Option {
+	return func(cf *codeforcesClient) {
+		cf.metrics = metrics
+	}
+}
@@ -0,0 +1,67 @@
+package cfapi
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	kDefaultMaxAttempts = 3
+	kDefaultBaseDelay   = 2 * time.Second
+	kDefaultMaxDelay    = 30 * time.Second
+	kDefaultJitter      = 0.2
+)
+
+// RetryPolicy controls how transient Codeforces failures are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// A value less than or equal to one disables retries.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It doubles on each
+	// subsequent retry till it reaches MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is the fraction by which each delay is randomly shifted in
+	// either direction, e.g, 0.2 means ±20%.
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is provided.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: kDefaultMaxAttempts,
+		BaseDelay:   kDefaultBaseDelay,
+		MaxDelay:    kDefaultMaxDelay,
+		Jitter:      kDefaultJitter,
+	}
+}
+
+// delay returns the amount of time to wait before the given retry, where
+// the first retry is numbered one.
+func (policy RetryPolicy) delay(retry int) time.Duration {
+	d := policy.BaseDelay
+	for ind := 1; ind < retry && d < policy.MaxDelay; ind++ {
+		d *= 2
+	}
+	if policy.MaxDelay > 0 && d > policy.MaxDelay {
+		d = policy.MaxDelay
+	}
+
+	if policy.Jitter > 0 {
+		shift := (2*rand.Float64() - 1) * policy.Jitter
+		d = time.Duration(float64(d) * (1 + shift))
+	}
+	return d
+}
+
+// retryableError marks an error as transient, i.e, the same call might
+// succeed if it is attempted again.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
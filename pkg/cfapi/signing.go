@@ -0,0 +1,61 @@
+package cfapi
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	kRandLength   = 6
+	kRandAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+)
+
+// Credentials are the API key and secret generated from the settings page of
+// a Codeforces account.
+type Credentials struct {
+	ApiKey string
+	Secret string
+}
+
+// signQuery returns a copy of the query with the apiKey, time and apiSig
+// parameters added, as described in https://codeforces.com/apiHelp.
+// The signature is the sha512 of "rand/methodName?sortedParams#secret",
+// where the parameters are sorted by key and then by value.
+func signQuery(creds Credentials, methodName string, query url.Values,
+	now time.Time, randPrefix string) url.Values {
+	signed := url.Values{}
+	for key, values := range query {
+		signed[key] = append([]string(nil), values...)
+	}
+	signed.Set("apiKey", creds.ApiKey)
+	signed.Set("time", fmt.Sprint(now.Unix()))
+
+	var params []string
+	for key, values := range signed {
+		for _, value := range values {
+			params = append(params, key+"="+value)
+		}
+	}
+	sort.Strings(params)
+
+	plain := fmt.Sprintf("%s/%s?%s#%s", randPrefix, methodName,
+		strings.Join(params, "&"), creds.Secret)
+	hash := sha512.Sum512([]byte(plain))
+	signed.Set("apiSig", randPrefix+hex.EncodeToString(hash[:]))
+	return signed
+}
+
+// newRandPrefix returns the random prefix of the signature.
+func newRandPrefix() string {
+	prefix := make([]byte, kRandLength)
+	for i := range prefix {
+		prefix[i] = kRandAlphabet[rand.Intn(len(kRandAlphabet))]
+	}
+	return string(prefix)
+}
@@ -0,0 +1,102 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	kAtomNamespace = "http://www.w3.org/2005/Atom"
+)
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Id       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Id        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Author    atomAuthor  `xml:"author"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// BuildAtom renders the recent actions as an Atom 1.0 document.
+// The entries appear in the same order as the actions, and the feed is
+// considered to be updated at the time of the newest action.
+func BuildAtom(actions []models.RecentAction, opts ...Option) (
+	[]byte, error) {
+	o := newOptions(opts)
+	doc := atomFeed{
+		Xmlns:    kAtomNamespace,
+		Id:       o.siteUrl,
+		Title:    o.title,
+		Subtitle: o.description,
+		Links:    []atomLink{{Href: o.siteUrl, Rel: "alternate"}},
+	}
+	doc.Links = append(doc.Links, o.links()...)
+
+	// An empty feed still needs an <updated> element, so fall back to the
+	// epoch to keep the output deterministic.
+	updated := time.Unix(0, 0).UTC()
+	for _, e := range newEntries(actions, opts) {
+		if e.updated.After(updated) {
+			updated = e.updated
+		}
+		entry := atomEntry{
+			Id:        e.link,
+			Title:     e.title,
+			Updated:   e.updated.Format(time.RFC3339),
+			Published: e.published.Format(time.RFC3339),
+			Author:    atomAuthor{Name: e.author},
+			Link:      atomLink{Href: e.link, Rel: "alternate"},
+			Content:   atomContent{Type: "html", Value: e.content},
+		}
+		for _, tag := range e.tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	doc.Updated = updated.Format(time.RFC3339)
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errors.Errorf("could not marshal atom feed "+
+			"with error [%v]", err)
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
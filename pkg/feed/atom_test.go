@@ -0,0 +1,89 @@
+package feed_test
+
+import (
+	"encoding/xml"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("Atom", func() {
+	type atomDoc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			Id     string `xml:"id"`
+			Author struct {
+				Name string `xml:"name"`
+			} `xml:"author"`
+			Content struct {
+				Type  string `xml:"type,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"content"`
+		} `xml:"entry"`
+	}
+
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000100,
+			BlogEntry: &models.BlogEntry{
+				Id:    101,
+				Title: "<p>Codeforces Round #1</p>",
+			},
+			Comment: &models.Comment{
+				Id:                7,
+				CommentatorHandle: "tourist",
+				Text:              "<p>Nice problems</p>",
+			},
+		},
+		{
+			TimeSeconds: 1660000300,
+			BlogEntry: &models.BlogEntry{
+				Id:           102,
+				Title:        "<p>Editorial</p>",
+				AuthorHandle: "MikeMirzayanov",
+				Content:      "<b>Solutions</b>",
+			},
+		},
+		{
+			TimeSeconds: 1660000200,
+			BlogEntry: &models.BlogEntry{
+				Id:    103,
+				Title: "<p>Announcement</p>",
+			},
+		},
+	}
+
+	It("should produce a parseable document updated at the newest action",
+		func() {
+			out, err := feed.BuildAtom(actions)
+			Expect(err).Should(BeNil())
+
+			var doc atomDoc
+			Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+			Expect(doc.Updated).Should(Equal(
+				time.Unix(1660000300, 0).UTC().Format(time.RFC3339)))
+
+			Expect(doc.Entries).Should(HaveLen(3))
+			Expect(doc.Entries[0].Id).Should(Equal(
+				"https://codeforces.com/blog/entry/101?#comment-7"))
+			Expect(doc.Entries[0].Author.Name).Should(Equal("tourist"))
+			Expect(doc.Entries[1].Author.Name).Should(Equal("MikeMirzayanov"))
+			Expect(doc.Entries[1].Content.Type).Should(Equal("html"))
+			Expect(doc.Entries[1].Content.Value).Should(
+				Equal("<b>Solutions</b>"))
+		})
+
+	It("should produce a valid document for an empty list", func() {
+		out, err := feed.BuildAtom(nil)
+		Expect(err).Should(BeNil())
+
+		var doc atomDoc
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Entries).Should(BeEmpty())
+	})
+})
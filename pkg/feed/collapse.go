@@ -0,0 +1,46 @@
+package feed
+
+import (
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// CollapseByBlog groups the actions by their blog entry and keeps only the
+// most recent action of each group, so that a blog entry and the comments on
+// it appear once in the feed. The representatives keep the relative order of
+// the groups' first appearance. Actions without a blog entry are dropped.
+func CollapseByBlog(actions []models.RecentAction) []models.RecentAction {
+	collapsed, _ := collapseByBlog(actions)
+	return collapsed
+}
+
+// collapseByBlog is CollapseByBlog, which also returns the number of comments
+// folded into each representative, keyed by the blog entry id.
+func collapseByBlog(actions []models.RecentAction) (
+	[]models.RecentAction, map[int]int) {
+	var collapsed []models.RecentAction
+	position := make(map[int]int)
+	folded := make(map[int]int)
+	for _, action := range actions {
+		if action.Kind() == models.ActionKindUnknown {
+			continue
+		}
+
+		blogId := action.BlogEntry.Id
+		idx, ok := position[blogId]
+		if !ok {
+			position[blogId] = len(collapsed)
+			collapsed = append(collapsed, action)
+			continue
+		}
+
+		// The action which is not kept is folded into the representative.
+		dropped := action
+		if action.TimeSeconds > collapsed[idx].TimeSeconds {
+			dropped, collapsed[idx] = collapsed[idx], action
+		}
+		if dropped.Kind() == models.ActionKindComment {
+			folded[blogId]++
+		}
+	}
+	return collapsed, folded
+}
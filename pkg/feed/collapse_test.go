@@ -0,0 +1,64 @@
+package feed_test
+
+import (
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("CollapseByBlog", func() {
+	blog := &models.BlogEntry{Id: 101, Title: "Round"}
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000300,
+			BlogEntry:   blog,
+			Comment:     &models.Comment{Id: 8, CommentatorHandle: "Petr"},
+		},
+		{
+			TimeSeconds: 1660000200,
+			BlogEntry:   &models.BlogEntry{Id: 102, Title: "Editorial"},
+		},
+		{
+			TimeSeconds: 1660000100,
+			BlogEntry:   blog,
+			Comment:     &models.Comment{Id: 7, CommentatorHandle: "tourist"},
+		},
+		{
+			TimeSeconds: 1660000000,
+			BlogEntry:   blog,
+		},
+	}
+
+	It("should keep the most recent action of each blog", func() {
+		collapsed := feed.CollapseByBlog(actions)
+
+		Expect(collapsed).Should(HaveLen(2))
+		Expect(collapsed[0].Comment.Id).Should(Equal(8))
+		Expect(collapsed[1].BlogEntry.Id).Should(Equal(102))
+	})
+
+	It("should render raw actions unless collapsing is requested", func() {
+		type rssDoc struct {
+			Items []struct {
+				Title string `xml:"title"`
+			} `xml:"channel>item"`
+		}
+
+		var raw, collapsed rssDoc
+		out, err := feed.BuildRSS(actions)
+		Expect(err).Should(BeNil())
+		Expect(xml.Unmarshal(out, &raw)).Should(Succeed())
+		Expect(raw.Items).Should(HaveLen(4))
+
+		out, err = feed.BuildRSS(actions, feed.WithCollapseByBlog())
+		Expect(err).Should(BeNil())
+		Expect(xml.Unmarshal(out, &collapsed)).Should(Succeed())
+		Expect(collapsed.Items).Should(HaveLen(2))
+		Expect(collapsed.Items[0].Title).Should(
+			Equal("Petr commented on Round (+1 more comment)"))
+	})
+})
@@ -0,0 +1,65 @@
+package feed_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("MinContentLength", func() {
+	newComment := func(commentId int, text string) models.RecentAction {
+		return models.RecentAction{
+			TimeSeconds: 1660000000,
+			BlogEntry:   &models.BlogEntry{Id: 101, Title: "Round #1"},
+			Comment:     &models.Comment{Id: commentId, Text: text},
+		}
+	}
+
+	actions := []models.RecentAction{
+		newComment(1, ""),
+		newComment(2, " \n\t "),
+		newComment(3, "<p> &nbsp; </p>"),
+		newComment(4, "<p>+1</p>"),
+		newComment(5, "<p>Nice problems</p>"),
+		newComment(6, "<p>Задачи</p>"),
+	}
+
+	countItems := func(opts ...feed.Option) int {
+		out, err := feed.BuildRSS(actions, opts...)
+		Expect(err).Should(BeNil())
+		return strings.Count(string(out), "<item>")
+	}
+
+	It("should keep all the actions by default", func() {
+		Expect(countItems()).Should(Equal(6))
+		Expect(countItems(feed.WithMinContentLength(0))).Should(Equal(6))
+	})
+
+	It("should drop the empty and whitespace-only actions", func() {
+		Expect(countItems(feed.WithMinContentLength(1))).Should(Equal(3))
+	})
+
+	It("should drop the actions shorter than the minimum", func() {
+		out, err := feed.BuildRSS(actions, feed.WithMinContentLength(6))
+		Expect(err).Should(BeNil())
+		Expect(strings.Count(string(out), "<item>")).Should(Equal(2))
+		Expect(string(out)).ShouldNot(ContainSubstring("+1"))
+
+		// The characters are counted, rather than the bytes.
+		out, err = feed.BuildRSS(actions, feed.WithMinContentLength(7))
+		Expect(err).Should(BeNil())
+		Expect(strings.Count(string(out), "<item>")).Should(Equal(1))
+		Expect(string(out)).ShouldNot(ContainSubstring("Задачи"))
+	})
+
+	It("should filter the short actions out before the feed is built",
+		func() {
+			Expect(feed.Filter(actions, feed.WithMinContentLength(6))).
+				Should(Equal([]models.RecentAction{actions[4], actions[5]}))
+			Expect(feed.Filter(actions)).Should(Equal(actions))
+		})
+})
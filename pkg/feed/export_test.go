@@ -0,0 +1,7 @@
+package feed
+
+// TruncateHTML exposes the truncation of the summaries to tests.
+var TruncateHTML = truncateHTML
+
+// Sanitize exposes the sanitization of the content to tests.
+var Sanitize = (*SanitizePolicy).sanitize
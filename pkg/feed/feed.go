@@ -0,0 +1,188 @@
+// Package feed renders recent actions from Codeforces into syndication
+// formats that can be consumed by feed readers.
+package feed
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	kCodeforcesUrl = "https://codeforces.com"
+
+	kFeedTitle       = "Codeforces Recent Actions"
+	kFeedDescription = "Recent blog entries and comments on Codeforces"
+)
+
+// htmlTagRegex matches any HTML tag, and is used to convert the HTML titles
+// returned by Codeforces to plain text.
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// entry is the format agnostic representation of a single feed item.
+type entry struct {
+	link    string
+	title   string
+	author  string
+	content string
+	locale  string
+
+	// published is the time of the original action, and updated the time of
+	// the item under the RepublishPolicy, which is the same unless the
+	// action was edited and the edits are republished.
+	published time.Time
+	updated   time.Time
+
+	// tags are the tags of the blog entry, e.g, editorial, which readers can
+	// filter the items by.
+	tags []string
+}
+
+// newEntry converts a recent action to a feed entry, dated under the policy.
+// It returns false if the action does not reference any blog entry.
+func newEntry(action models.RecentAction, policy RepublishPolicy) (entry,
+	bool) {
+	kind := action.Kind()
+	if kind == models.ActionKindUnknown {
+		return entry{}, false
+	}
+
+	blogTitle := plainText(action.BlogEntry.Title)
+	e := entry{
+		link:      action.PermalinkURL(),
+		locale:    action.Locale(),
+		published: originalTime(action),
+		updated:   policy.updatedTime(action),
+		tags:      blogTags(action.BlogEntry),
+	}
+	if kind == models.ActionKindComment {
+		e.title = fmt.Sprintf("%s commented on %s",
+			action.Comment.CommentatorHandle, blogTitle)
+		e.content = action.Comment.Text
+	} else {
+		e.title = blogTitle
+		e.content = action.BlogEntry.Content
+	}
+	e.author = action.Author()
+
+	return e, true
+}
+
+// Filter returns the actions that the feeds built with the options render,
+// preserving their order, i.e, without the ones dropped by WithMinRating or
+// by WithMinContentLength. It lets the callers fetch more actions to fill a
+// feed.
+func Filter(actions []models.RecentAction,
+	opts ...Option) []models.RecentAction {
+	return newOptions(opts).filter(actions)
+}
+
+// filter implements Filter.
+func (o options) filter(actions []models.RecentAction) []models.RecentAction {
+	if o.minRating != nil {
+		actions = o.minRating.filter(actions)
+	}
+	if o.minContentLength <= 0 {
+		return actions
+	}
+
+	kept := make([]models.RecentAction, 0, len(actions))
+	for _, action := range actions {
+		if !o.tooShort(action) {
+			kept = append(kept, action)
+		}
+	}
+	if dropped := len(actions) - len(kept); dropped > 0 {
+		zap.S().Debugw("Dropped the actions shorter than the minimum",
+			zap.Int("dropped", dropped),
+			zap.Int("minContentLength", o.minContentLength))
+	}
+	return kept
+}
+
+// tooShort tells whether the sanitized content of the action has less
+// characters of text than minContentLength.
+func (o options) tooShort(action models.RecentAction) bool {
+	e, ok := newEntry(action, o.republishPolicy)
+	return ok &&
+		contentLength(o.sanitizePolicy.sanitize(e.content)) < o.minContentLength
+}
+
+// newEntries converts all the actions that can be rendered to feed entries,
+// preserving their order.
+func newEntries(actions []models.RecentAction, opts []Option) []entry {
+	o := newOptions(opts)
+	actions = o.filter(actions)
+
+	var folded map[int]int
+	if o.collapseByBlog {
+		actions, folded = collapseByBlog(actions)
+	}
+
+	var entries []entry
+	for _, action := range actions {
+		e, ok := newEntry(action, o.republishPolicy)
+		if !ok {
+			continue
+		}
+		if count := folded[action.BlogEntry.Id]; count == 1 {
+			e.title += " (+1 more comment)"
+		} else if count > 1 {
+			e.title = fmt.Sprintf("%s (+%d more comments)", e.title, count)
+		}
+		// The content is user generated, hence it is sanitized before the
+		// markup of cfrss is added to it.
+		e.content = o.sanitizePolicy.sanitize(e.content)
+		if o.contentMode == ContentModeSummary {
+			e.content = summarize(e.content, e.link, o.summaryLength)
+		}
+		if rating, ok := o.authorRatings[strings.ToLower(e.author)]; ok {
+			e.content = coloredHandle(e.author, rating) + e.content
+		}
+		if o.locale != "" && e.locale != "" && e.locale != o.locale {
+			e.title = fmt.Sprintf("[%s] %s", e.locale, e.title)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// contentLength returns the number of characters of text in the HTML content,
+// without the surrounding whitespace.
+func contentLength(content string) int {
+	return utf8.RuneCountInString(plainText(content))
+}
+
+// blogTags returns the non blank tags of the blog entry, trimmed, or nil if
+// it has none.
+func blogTags(blogEntry *models.BlogEntry) []string {
+	var tags []string
+	for _, tag := range blogEntry.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// coloredHandle renders the handle in the color of its rating, as a paragraph
+// preceding the content of an item.
+func coloredHandle(handle string, rating int) string {
+	color := models.RatingColor(rating)
+	return fmt.Sprintf(`<p><span class="user-%s" style="color: %s">%s</span>`+
+		`</p>`, color, color, html.EscapeString(handle))
+}
+
+// plainText strips the HTML tags from the input and unescapes the entities,
+// so that the result can be safely escaped again by the XML encoder.
+func plainText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(
+		htmlTagRegex.ReplaceAllString(s, "")))
+}
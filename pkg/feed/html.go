@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"bytes"
+	"html/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// htmlTemplate renders a single entry as a standalone page. The content is
+// rendered as plain text, since the HTML returned by Codeforces is not
+// trusted on this origin.
+var htmlTemplate = template.Must(template.New("action").Parse(`<!DOCTYPE html>
+<html{{if .Lang}} lang="{{.Lang}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{if .FeedUrl}}<link rel="alternate" type="application/rss+xml" title="{{.Title}}" href="{{.FeedUrl}}">
+{{end}}</head>
+<body>
+<article>
+<h1><a href="{{.Link}}">{{.Title}}</a></h1>
+<p>By {{.Author}} on <time datetime="{{.Published.Format "2006-01-02T15:04:05Z07:00"}}">{{.Published.Format "Jan 2, 2006 15:04 MST"}}</time></p>
+<p>{{.Content}}</p>
+</article>
+</body>
+</html>
+`))
+
+// htmlPage is the data of htmlTemplate.
+type htmlPage struct {
+	Title     string
+	Link      string
+	Author    string
+	Content   string
+	Published time.Time
+
+	// FeedUrl is the URL of the one-item feed of the action, if any.
+	FeedUrl string
+
+	// Lang is the locale of the page, if any.
+	Lang string
+}
+
+// BuildHTML renders a single action as an HTML page linking to Codeforces,
+// e.g, for permalinks. The page advertises feedUrl as its feed, unless it is
+// empty. The options are the ones of the feeds, so that the page renders the
+// action just like its item, but the action is never filtered out.
+func BuildHTML(action models.RecentAction, feedUrl string,
+	opts ...Option) ([]byte, error) {
+	entries := newEntries([]models.RecentAction{action},
+		append(append([]Option(nil), opts...), WithMinContentLength(0)))
+	if len(entries) == 0 {
+		return nil, errors.Errorf("could not render an action " +
+			"without a blog entry")
+	}
+	e := entries[0]
+
+	var out bytes.Buffer
+	if err := htmlTemplate.Execute(&out, htmlPage{
+		Title:     e.title,
+		Link:      e.link,
+		Author:    e.author,
+		Content:   plainText(e.content),
+		Published: e.published,
+		FeedUrl:   feedUrl,
+		Lang:      newOptions(opts).locale,
+	}); err != nil {
+		return nil, errors.Errorf("could not render html page "+
+			"with error [%v]", err)
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,49 @@
+package feed_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("HTML", func() {
+	It("should render a single action as an escaped page", func() {
+		out, err := feed.BuildHTML(models.RecentAction{
+			TimeSeconds: 1660000000,
+			BlogEntry:   &models.BlogEntry{Id: 101, Title: "<p>Round 900</p>"},
+			Comment: &models.Comment{
+				Id:                7,
+				CommentatorHandle: "tourist",
+				Text:              "<script>alert(1)</script>Nice",
+			},
+		}, "/action/101-7/feed.xml")
+		Expect(err).Should(BeNil())
+
+		page := string(out)
+		Expect(page).Should(ContainSubstring("tourist commented on Round 900"))
+		Expect(page).Should(ContainSubstring(
+			`href="https://codeforces.com/blog/entry/101?#comment-7"`))
+		Expect(page).Should(ContainSubstring(`href="/action/101-7/feed.xml"`))
+		Expect(page).ShouldNot(ContainSubstring("<script>"))
+	})
+
+	It("should render the action with the options of the feeds", func() {
+		out, err := feed.BuildHTML(models.RecentAction{
+			TimeSeconds: 1660000000,
+			BlogEntry: &models.BlogEntry{Id: 101, Title: "Round 900",
+				Locale: "en"},
+		}, "", feed.WithLocale("ru"), feed.WithMinContentLength(1000))
+		Expect(err).Should(BeNil())
+
+		page := string(out)
+		Expect(page).Should(ContainSubstring(`<html lang="ru">`))
+		Expect(page).Should(ContainSubstring("[en]"))
+	})
+
+	It("should fail on an action without a blog entry", func() {
+		_, err := feed.BuildHTML(models.RecentAction{}, "")
+		Expect(err).Should(HaveOccurred())
+	})
+})
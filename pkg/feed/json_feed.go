@@ -0,0 +1,87 @@
+package feed
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	kJSONFeedVersion = "https://jsonfeed.org/version/1.1"
+)
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageUrl string         `json:"home_page_url"`
+	FeedUrl     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	Id            string           `json:"id"`
+	Url           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHtml   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// BuildJSONFeed renders the recent actions as a JSON Feed 1.1 document.
+// Unlike the XML feeds, the items are always sorted newest first.
+func BuildJSONFeed(actions []models.RecentAction, opts ...Option) (
+	[]byte, error) {
+	entries := newEntries(actions, opts)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].updated.After(entries[j].updated)
+	})
+
+	o := newOptions(opts)
+	doc := jsonFeed{
+		Version:     kJSONFeedVersion,
+		Title:       o.title,
+		HomePageUrl: o.siteUrl,
+		FeedUrl:     o.selfUrl,
+		Language:    o.locale,
+		Description: o.description,
+		// Items is a required field, so it should never be encoded as null.
+		Items: []jsonFeedItem{},
+	}
+	for _, e := range entries {
+		item := jsonFeedItem{
+			Id:            e.link,
+			Url:           e.link,
+			Title:         e.title,
+			ContentHtml:   e.content,
+			DatePublished: e.published.Format(time.RFC3339),
+			Tags:          e.tags,
+		}
+		if e.updated.After(e.published) {
+			item.DateModified = e.updated.Format(time.RFC3339)
+		}
+		if e.author != "" {
+			item.Authors = []jsonFeedAuthor{{Name: e.author}}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errors.Errorf("could not marshal json feed "+
+			"with error [%v]", err)
+	}
+
+	return out, nil
+}
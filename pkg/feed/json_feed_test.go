@@ -0,0 +1,75 @@
+package feed_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("JSONFeed", func() {
+	type jsonFeedDoc struct {
+		Version string `json:"version"`
+		Title   string `json:"title"`
+		Items   []struct {
+			Id            string `json:"id"`
+			Url           string `json:"url"`
+			DatePublished string `json:"date_published"`
+			ContentHtml   string `json:"content_html"`
+		} `json:"items"`
+	}
+
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000100,
+			BlogEntry:   &models.BlogEntry{Id: 101, Title: "First"},
+		},
+		{
+			TimeSeconds: 1660000300,
+			BlogEntry:   &models.BlogEntry{Id: 102, Title: "Third"},
+		},
+		{
+			TimeSeconds: 1660000200,
+			BlogEntry:   &models.BlogEntry{Id: 103, Title: "Second"},
+			Comment: &models.Comment{
+				Id:   9,
+				Text: "<p>comment</p>",
+			},
+		},
+	}
+
+	It("should round trip with items sorted newest first", func() {
+		out, err := feed.BuildJSONFeed(actions)
+		Expect(err).Should(BeNil())
+
+		var doc jsonFeedDoc
+		Expect(json.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Version).Should(Equal("https://jsonfeed.org/version/1.1"))
+
+		Expect(doc.Items).Should(HaveLen(3))
+		Expect(doc.Items[0].Url).Should(
+			Equal("https://codeforces.com/blog/entry/102"))
+		Expect(doc.Items[1].Url).Should(
+			Equal("https://codeforces.com/blog/entry/103?#comment-9"))
+		Expect(doc.Items[1].ContentHtml).Should(Equal("<p>comment</p>"))
+		Expect(doc.Items[2].Url).Should(
+			Equal("https://codeforces.com/blog/entry/101"))
+
+		for ind, ts := range []int64{1660000300, 1660000200, 1660000100} {
+			published, err := time.Parse(time.RFC3339,
+				doc.Items[ind].DatePublished)
+			Expect(err).Should(BeNil())
+			Expect(published.Unix()).Should(Equal(ts))
+		}
+	})
+
+	It("should encode an empty list as an empty array", func() {
+		out, err := feed.BuildJSONFeed(nil)
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(`"items": []`))
+	})
+})
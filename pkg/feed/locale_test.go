@@ -0,0 +1,61 @@
+package feed_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("Locale", func() {
+	type jsonFeedDoc struct {
+		Language string `json:"language"`
+		Items    []struct {
+			Title string `json:"title"`
+		} `json:"items"`
+	}
+
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000200,
+			BlogEntry: &models.BlogEntry{
+				Id:             101,
+				Title:          "Раунд",
+				OriginalLocale: "ru",
+			},
+		},
+		{
+			TimeSeconds: 1660000100,
+			BlogEntry: &models.BlogEntry{
+				Id:     102,
+				Title:  "Editorial",
+				Locale: "en",
+			},
+		},
+	}
+
+	It("should fall back to a ru-only blog when en is requested", func() {
+		out, err := feed.BuildJSONFeed(actions, feed.WithLocale("en"))
+		Expect(err).Should(BeNil())
+
+		var doc jsonFeedDoc
+		Expect(json.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Language).Should(Equal("en"))
+		Expect(doc.Items).Should(HaveLen(2))
+		Expect(doc.Items[0].Title).Should(Equal("[ru] Раунд"))
+		Expect(doc.Items[1].Title).Should(Equal("Editorial"))
+	})
+
+	It("should not note the locale unless one is requested", func() {
+		out, err := feed.BuildJSONFeed(actions)
+		Expect(err).Should(BeNil())
+
+		var doc jsonFeedDoc
+		Expect(json.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Language).Should(BeEmpty())
+		Expect(doc.Items[0].Title).Should(Equal("Раунд"))
+	})
+})
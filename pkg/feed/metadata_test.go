@@ -0,0 +1,90 @@
+package feed_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+)
+
+var _ = Describe("Metadata", func() {
+	opts := []feed.Option{
+		feed.WithTitle("My Codeforces"),
+		feed.WithDescription("The blogs I follow"),
+		feed.WithSiteLink("https://cfrss.example.com"),
+		feed.WithSelfLink("https://cfrss.example.com/feed.xml"),
+		feed.WithLocale("en"),
+		feed.WithTTL(90 * time.Second),
+	}
+
+	It("should describe the rss channel", func() {
+		out, err := feed.BuildRSS(nil, opts...)
+		Expect(err).Should(BeNil())
+
+		var doc struct {
+			Channel struct {
+				Title       string `xml:"title"`
+				Description string `xml:"description"`
+				Language    string `xml:"language"`
+				TTL         int    `xml:"ttl"`
+			} `xml:"channel"`
+		}
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Channel.Title).Should(Equal("My Codeforces"))
+		Expect(doc.Channel.Description).Should(Equal("The blogs I follow"))
+		Expect(doc.Channel.Language).Should(Equal("en"))
+		Expect(doc.Channel.TTL).Should(Equal(2))
+		Expect(string(out)).Should(ContainSubstring(
+			"<link>https://cfrss.example.com</link>"))
+		Expect(string(out)).Should(ContainSubstring(
+			`<atom:link href="https://cfrss.example.com/feed.xml" rel="self">`))
+	})
+
+	It("should describe the atom feed", func() {
+		out, err := feed.BuildAtom(nil, opts...)
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			"<title>My Codeforces</title>"))
+		Expect(string(out)).Should(ContainSubstring(
+			"<subtitle>The blogs I follow</subtitle>"))
+		Expect(string(out)).Should(ContainSubstring(
+			`<link href="https://cfrss.example.com/feed.xml" rel="self">`))
+	})
+
+	It("should describe the json feed", func() {
+		out, err := feed.BuildJSONFeed(nil, opts...)
+		Expect(err).Should(BeNil())
+
+		var doc map[string]interface{}
+		Expect(json.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc["title"]).Should(Equal("My Codeforces"))
+		Expect(doc["home_page_url"]).Should(Equal("https://cfrss.example.com"))
+		Expect(doc["feed_url"]).Should(Equal(
+			"https://cfrss.example.com/feed.xml"))
+	})
+
+	It("should link the adjacent pages of a paged feed", func() {
+		out, err := feed.BuildAtom(nil, feed.WithPaging(
+			"/feed.atom?page=1", "", "/feed.atom?page=2"))
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			`<link href="/feed.atom?page=1" rel="first">`))
+		Expect(string(out)).Should(ContainSubstring(
+			`<link href="/feed.atom?page=2" rel="next">`))
+		Expect(string(out)).ShouldNot(ContainSubstring(`rel="previous"`))
+	})
+
+	It("should fall back to the defaults", func() {
+		out, err := feed.BuildRSS(nil, feed.WithTitle(""))
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			"<title>Codeforces Recent Actions</title>"))
+		Expect(string(out)).Should(ContainSubstring(
+			"<link>https://codeforces.com</link>"))
+		Expect(string(out)).ShouldNot(ContainSubstring("<ttl>"))
+	})
+})
@@ -0,0 +1,58 @@
+package feed
+
+import (
+	"encoding/xml"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	kOPMLVersion = "2.0"
+	kOPMLTitle   = "Codeforces feeds"
+)
+
+type opml struct {
+	XMLName xml.Name    `xml:"opml"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"head>title"`
+	Body    []opmlEntry `xml:"body>outline"`
+}
+
+type opmlEntry struct {
+	Type   string `xml:"type,attr"`
+	Text   string `xml:"text,attr"`
+	Title  string `xml:"title,attr"`
+	XMLUrl string `xml:"xmlUrl,attr"`
+}
+
+// Subscription is a feed listed in an OPML document.
+type Subscription struct {
+	Title string
+	Url   string
+}
+
+// BuildOPML renders the subscriptions as an OPML 2.0 document, which lets
+// readers import all of them at once.
+func BuildOPML(subscriptions []Subscription) ([]byte, error) {
+	doc := opml{
+		Version: kOPMLVersion,
+		Title:   kOPMLTitle,
+	}
+	for _, sub := range subscriptions {
+		// The text attribute is mandatory, and readers display it.
+		doc.Body = append(doc.Body, opmlEntry{
+			Type:   "rss",
+			Text:   sub.Title,
+			Title:  sub.Title,
+			XMLUrl: sub.Url,
+		})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errors.Errorf("could not marshal opml "+
+			"with error [%v]", err)
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,37 @@
+package feed_test
+
+import (
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+)
+
+var _ = Describe("OPML", func() {
+	It("should list every subscription as an rss outline", func() {
+		out, err := feed.BuildOPML([]feed.Subscription{
+			{Title: "All", Url: "http://localhost/feed.xml"},
+			{Title: "tourist", Url: "http://localhost/u/tourist/feed.xml"},
+		})
+		Expect(err).Should(BeNil())
+
+		var doc struct {
+			XMLName  xml.Name `xml:"opml"`
+			Version  string   `xml:"version,attr"`
+			Outlines []struct {
+				Type   string `xml:"type,attr"`
+				Text   string `xml:"text,attr"`
+				XMLUrl string `xml:"xmlUrl,attr"`
+			} `xml:"body>outline"`
+		}
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Version).Should(Equal("2.0"))
+		Expect(doc.Outlines).Should(HaveLen(2))
+		Expect(doc.Outlines[1].Type).Should(Equal("rss"))
+		Expect(doc.Outlines[1].Text).Should(Equal("tourist"))
+		Expect(doc.Outlines[1].XMLUrl).
+			Should(Equal("http://localhost/u/tourist/feed.xml"))
+	})
+})
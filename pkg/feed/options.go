@@ -0,0 +1,264 @@
+package feed
+
+import "time"
+
+// Option customizes how the recent actions are rendered into a feed.
+type Option func(opts *options)
+
+type options struct {
+	collapseByBlog bool
+	locale         string
+
+	// authorRatings maps the lower-cased handles of the authors to their
+	// ratings.
+	authorRatings map[string]int
+
+	// minRating is nil unless the actions are filtered by rating.
+	minRating *minRatingFilter
+
+	// minContentLength drops the items with less characters of text, unless
+	// it is non-positive.
+	minContentLength int
+
+	// hubs are advertised to WebSub subscribers, along with selfUrl, the
+	// canonical URL of the feed.
+	hubs    []string
+	selfUrl string
+
+	// title, description and siteUrl describe the channel, which is the
+	// Codeforces recent actions by default. ttl tells the readers how long
+	// they can cache the feed, it is omitted if zero.
+	title       string
+	description string
+	siteUrl     string
+	ttl         time.Duration
+
+	// contentMode and summaryLength tell how much of the content the items
+	// carry.
+	contentMode   ContentMode
+	summaryLength int
+
+	// republishPolicy tells whether the edited actions are dated by their
+	// latest edit.
+	republishPolicy RepublishPolicy
+
+	// sanitizePolicy strips the unsafe HTML from the content.
+	sanitizePolicy *SanitizePolicy
+
+	// firstPage, previousPage and nextPage link the pages of a paged feed,
+	// they are omitted if empty.
+	firstPage    string
+	previousPage string
+	nextPage     string
+}
+
+// WithCollapseByBlog renders a single item per blog entry, see
+// CollapseByBlog. The title of the item tells how many comments were folded
+// into it.
+func WithCollapseByBlog() Option {
+	return func(opts *options) {
+		opts.collapseByBlog = true
+	}
+}
+
+// WithLocale declares the language of the feed, one of the locales of
+// Codeforces, see IsSupportedLocale. Codeforces publishes most content in a
+// single language, so actions written in another locale are still rendered,
+// with the locale prefixed to their title to note the fallback.
+func WithLocale(locale string) Option {
+	return func(opts *options) {
+		opts.locale = locale
+	}
+}
+
+// IsSupportedLocale tells whether Codeforces publishes content in the locale,
+// i.e, whether it is en or ru.
+func IsSupportedLocale(locale string) bool {
+	return locale == "en" || locale == "ru"
+}
+
+// WithWebSub advertises the WebSub hubs that are notified when the feed
+// changes, along with the canonical URL of the feed which the hubs know it
+// by.
+func WithWebSub(hubs []string, selfUrl string) Option {
+	return func(opts *options) {
+		opts.hubs = hubs
+		opts.selfUrl = selfUrl
+	}
+}
+
+// WithTitle overrides the title of the feed. An empty title keeps the
+// default.
+func WithTitle(title string) Option {
+	return func(opts *options) {
+		if title != "" {
+			opts.title = title
+		}
+	}
+}
+
+// WithDescription overrides the description of the feed. An empty
+// description keeps the default.
+func WithDescription(description string) Option {
+	return func(opts *options) {
+		if description != "" {
+			opts.description = description
+		}
+	}
+}
+
+// WithSiteLink overrides the website the feed links to, e.g, the frontend of
+// the deployment. An empty link keeps Codeforces.
+func WithSiteLink(siteUrl string) Option {
+	return func(opts *options) {
+		if siteUrl != "" {
+			opts.siteUrl = siteUrl
+		}
+	}
+}
+
+// WithSelfLink declares the canonical URL of the feed, so that readers can
+// find it again, e.g, after a redirect.
+func WithSelfLink(selfUrl string) Option {
+	return func(opts *options) {
+		opts.selfUrl = selfUrl
+	}
+}
+
+// WithTTL tells the readers how long they can cache the feed before fetching
+// it again. Only RSS supports it, with a granularity of minutes.
+func WithTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.ttl = ttl
+	}
+}
+
+// WithContentMode tells how much of the content the items carry. The
+// summaries are cut after 300 characters of text by default, see
+// WithSummaryLength.
+func WithContentMode(mode ContentMode) Option {
+	return func(opts *options) {
+		opts.contentMode = mode
+	}
+}
+
+// WithRepublishPolicy tells which time the items of the edited actions carry,
+// i.e, the <pubDate> of RSS, the <updated> of Atom and the date_modified of
+// JSON Feed. The Atom and JSON Feed items are published at the time of the
+// original action regardless. The default is RepublishOriginal.
+func WithRepublishPolicy(policy RepublishPolicy) Option {
+	return func(opts *options) {
+		opts.republishPolicy = policy
+	}
+}
+
+// WithSummaryLength overrides the number of characters of text after which
+// the summaries are cut. A non-positive length keeps the default.
+func WithSummaryLength(length int) Option {
+	return func(opts *options) {
+		if length > 0 {
+			opts.summaryLength = length
+		}
+	}
+}
+
+// WithSanitizePolicy overrides the policy stripping the unsafe HTML from the
+// content, which is UGCPolicy by default. A nil policy keeps the default.
+func WithSanitizePolicy(policy *SanitizePolicy) Option {
+	return func(opts *options) {
+		if policy != nil {
+			opts.sanitizePolicy = policy
+		}
+	}
+}
+
+// WithMinContentLength drops the items whose content has less than length
+// characters of text, ignoring the markup and the surrounding whitespace, e.g,
+// the blog entries created but not written yet. A non-positive length keeps
+// all of them, which is the default.
+func WithMinContentLength(length int) Option {
+	return func(opts *options) {
+		opts.minContentLength = length
+	}
+}
+
+// WithPaging links the feed to the first, the previous, i.e, newer, and the
+// next, i.e, older, pages of a paged feed, as in RFC 5005. The empty links are
+// omitted, e.g, the next one on the last page.
+func WithPaging(first, previous, next string) Option {
+	return func(opts *options) {
+		opts.firstPage = first
+		opts.previousPage = previous
+		opts.nextPage = next
+	}
+}
+
+// WithAuthorRatings prefixes the content of each item with the handle of its
+// author, colored by rating like on Codeforces, e.g, with
+// <span class="user-blue" style="color: blue">. The ratings are keyed by the
+// lower-cased handles, and the authors missing from them are left as is.
+func WithAuthorRatings(ratings map[string]int) Option {
+	return func(opts *options) {
+		opts.authorRatings = ratings
+	}
+}
+
+// WithMinRating drops the actions whose authors are rated below minRating.
+// The ratings are keyed by the lower-cased handles. The authors that are
+// unrated, or missing from the ratings, e.g, when they could not be fetched,
+// are kept if includeUnrated is set, and dropped otherwise.
+func WithMinRating(minRating int, ratings map[string]int,
+	includeUnrated bool) Option {
+	return func(opts *options) {
+		opts.minRating = &minRatingFilter{
+			minRating:      minRating,
+			ratings:        ratings,
+			includeUnrated: includeUnrated,
+		}
+	}
+}
+
+// links returns the links to the hubs, to the feed itself and to the adjacent
+// pages, or nil if none is configured.
+func (opts options) links() []atomLink {
+	var links []atomLink
+	for _, hub := range opts.hubs {
+		links = append(links, atomLink{Href: hub, Rel: "hub"})
+	}
+	if opts.selfUrl != "" {
+		links = append(links, atomLink{Href: opts.selfUrl, Rel: "self"})
+	}
+	for _, link := range []atomLink{
+		{Href: opts.firstPage, Rel: "first"},
+		{Href: opts.previousPage, Rel: "previous"},
+		{Href: opts.nextPage, Rel: "next"},
+	} {
+		if link.Href != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// ttlMinutes returns the ttl rounded up to whole minutes.
+func (opts options) ttlMinutes() int {
+	if opts.ttl <= 0 {
+		return 0
+	}
+	return int((opts.ttl + time.Minute - 1) / time.Minute)
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		title:       kFeedTitle,
+		description: kFeedDescription,
+		siteUrl:     kCodeforcesUrl,
+
+		summaryLength:  kDefaultSummaryLength,
+		sanitizePolicy: ugcPolicy,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,36 @@
+package feed
+
+import (
+	"strings"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// minRatingFilter keeps the actions of the authors rated at least minRating,
+// see WithMinRating.
+type minRatingFilter struct {
+	minRating      int
+	ratings        map[string]int
+	includeUnrated bool
+}
+
+// filter returns the actions whose authors pass the filter, preserving their
+// order.
+func (f *minRatingFilter) filter(
+	actions []models.RecentAction) []models.RecentAction {
+	var res []models.RecentAction
+	for _, action := range actions {
+		// Codeforces reports a zero rating for the unrated users.
+		rating, ok := f.ratings[strings.ToLower(action.Author())]
+		if !ok || rating == 0 {
+			if f.includeUnrated {
+				res = append(res, action)
+			}
+			continue
+		}
+		if rating >= f.minRating {
+			res = append(res, action)
+		}
+	}
+	return res
+}
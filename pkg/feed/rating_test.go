@@ -0,0 +1,81 @@
+package feed_test
+
+import (
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("AuthorRatings", func() {
+	type rssDoc struct {
+		Items []struct {
+			Description string `xml:"description"`
+		} `xml:"channel>item"`
+	}
+
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000200,
+			BlogEntry:   &models.BlogEntry{Id: 101, Title: "Round"},
+			Comment: &models.Comment{
+				Id:                7,
+				CommentatorHandle: "Tourist",
+				Text:              "Nice",
+			},
+		},
+		{
+			TimeSeconds: 1660000100,
+			BlogEntry: &models.BlogEntry{
+				Id:           102,
+				Title:        "Editorial",
+				AuthorHandle: "newcomer",
+				Content:      "Solutions",
+			},
+		},
+	}
+
+	It("should color the handles of the rated authors", func() {
+		out, err := feed.BuildRSS(actions, feed.WithAuthorRatings(
+			map[string]int{"tourist": 3800}))
+		Expect(err).Should(BeNil())
+
+		var doc rssDoc
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Items).Should(HaveLen(2))
+		Expect(doc.Items[0].Description).Should(Equal(
+			`<p><span class="user-red" style="color: red">Tourist</span></p>` +
+				"Nice"))
+		Expect(doc.Items[1].Description).Should(Equal("Solutions"))
+	})
+
+	It("should drop the authors rated below the minimum", func() {
+		ratings := map[string]int{"tourist": 3800}
+
+		out, err := feed.BuildRSS(actions,
+			feed.WithMinRating(2400, ratings, false))
+		Expect(err).Should(BeNil())
+		var doc rssDoc
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Items).Should(HaveLen(1))
+		Expect(doc.Items[0].Description).Should(Equal("Nice"))
+
+		out, err = feed.BuildRSS(actions,
+			feed.WithMinRating(2400, ratings, true))
+		Expect(err).Should(BeNil())
+		doc = rssDoc{}
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Items).Should(HaveLen(2))
+
+		out, err = feed.BuildRSS(actions, feed.WithMinRating(4000,
+			ratings, true))
+		Expect(err).Should(BeNil())
+		doc = rssDoc{}
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Items).Should(HaveLen(1))
+		Expect(doc.Items[0].Description).Should(Equal("Solutions"))
+	})
+})
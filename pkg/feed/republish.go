@@ -0,0 +1,44 @@
+package feed
+
+import (
+	"time"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// RepublishPolicy tells which time the items of the edited actions carry,
+// hence whether the readers that sort by date see them again.
+type RepublishPolicy int
+
+const (
+	// RepublishOriginal dates the items by the original action, i.e, the
+	// creation time of a comment, so that the edits don't churn the feed.
+	// It is the default.
+	RepublishOriginal RepublishPolicy = iota
+	// RepublishUpdated dates the items by the latest edit of the action, see
+	// RecentAction.EditTimeSeconds, which brings the edited ones back to the
+	// top of the feed.
+	RepublishUpdated
+)
+
+// originalTime returns the time of the original action. Codeforces bumps the
+// activity time of a comment when it is edited, but not its creation time,
+// while the edits of a blog entry only bump its modification time.
+func originalTime(action models.RecentAction) time.Time {
+	timestamp := action.TimeSeconds
+	if action.Kind() == models.ActionKindComment &&
+		action.Comment.CreationTimeSeconds > 0 &&
+		action.Comment.CreationTimeSeconds < timestamp {
+		timestamp = action.Comment.CreationTimeSeconds
+	}
+	return time.Unix(timestamp, 0).UTC()
+}
+
+// updatedTime returns the time the item carries under the policy.
+func (policy RepublishPolicy) updatedTime(
+	action models.RecentAction) time.Time {
+	if policy == RepublishUpdated {
+		return time.Unix(action.EditTimeSeconds(), 0).UTC()
+	}
+	return originalTime(action)
+}
@@ -0,0 +1,110 @@
+package feed_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("RepublishPolicy", func() {
+	// The comment was created at 1660000000 and edited at 1660000300, and
+	// the blog entry was modified at 1660000400.
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000300,
+			BlogEntry:   &models.BlogEntry{Id: 101, Title: "Round #1"},
+			Comment: &models.Comment{
+				Id:                  7,
+				CreationTimeSeconds: 1660000000,
+				Text:                "Edited",
+			},
+		},
+		{
+			TimeSeconds: 1660000200,
+			BlogEntry: &models.BlogEntry{
+				Id:                      102,
+				Title:                   "Round #2",
+				ModificationTimeSeconds: 1660000400,
+			},
+		},
+	}
+
+	rssDates := func(opts ...feed.Option) []string {
+		out, err := feed.BuildRSS(actions, opts...)
+		Expect(err).Should(BeNil())
+
+		var doc struct {
+			Items []struct {
+				PubDate string `xml:"pubDate"`
+			} `xml:"channel>item"`
+		}
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		var dates []string
+		for _, item := range doc.Items {
+			dates = append(dates, item.PubDate)
+		}
+		return dates
+	}
+
+	It("should date the edited rss items by the original action", func() {
+		Expect(rssDates()).Should(Equal([]string{
+			"Mon, 08 Aug 2022 23:06:40 +0000",
+			"Mon, 08 Aug 2022 23:10:00 +0000",
+		}))
+	})
+
+	It("should date the edited rss items by their latest edit", func() {
+		Expect(rssDates(feed.WithRepublishPolicy(feed.RepublishUpdated))).
+			Should(Equal([]string{
+				"Mon, 08 Aug 2022 23:11:40 +0000",
+				"Mon, 08 Aug 2022 23:13:20 +0000",
+			}))
+	})
+
+	It("should keep the atom entries published at the original time", func() {
+		out, err := feed.BuildAtom(actions)
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			"<updated>2022-08-08T23:06:40Z</updated>"))
+		Expect(string(out)).ShouldNot(ContainSubstring("23:11:40"))
+
+		out, err = feed.BuildAtom(actions,
+			feed.WithRepublishPolicy(feed.RepublishUpdated))
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			"<updated>2022-08-08T23:11:40Z</updated>"))
+		Expect(string(out)).Should(ContainSubstring(
+			"<published>2022-08-08T23:06:40Z</published>"))
+		// The feed is updated at the time of the latest edit.
+		Expect(string(out)).Should(ContainSubstring(
+			"<updated>2022-08-08T23:13:20Z</updated>"))
+	})
+
+	It("should report the edits of the json feed items", func() {
+		out, err := feed.BuildJSONFeed(actions,
+			feed.WithRepublishPolicy(feed.RepublishUpdated))
+		Expect(err).Should(BeNil())
+
+		var doc struct {
+			Items []map[string]interface{} `json:"items"`
+		}
+		Expect(json.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Items).Should(HaveLen(2))
+		// The items are sorted by their latest edit.
+		Expect(doc.Items[0]).Should(HaveKeyWithValue("id",
+			"https://codeforces.com/blog/entry/102"))
+		Expect(doc.Items[0]).Should(HaveKeyWithValue("date_published",
+			"2022-08-08T23:10:00Z"))
+		Expect(doc.Items[0]).Should(HaveKeyWithValue("date_modified",
+			"2022-08-08T23:13:20Z"))
+
+		out, err = feed.BuildJSONFeed(actions)
+		Expect(err).Should(BeNil())
+		Expect(string(out)).ShouldNot(ContainSubstring("date_modified"))
+	})
+})
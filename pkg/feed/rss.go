@@ -0,0 +1,101 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	kRSSVersion = "2.0"
+)
+
+type rss struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+
+	// XmlnsAtom declares the namespace of the atom links, which RSS lacks an
+	// equivalent for.
+	XmlnsAtom string     `xml:"xmlns:atom,attr,omitempty"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	Language      string     `xml:"language,omitempty"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	TTL           int        `xml:"ttl,omitempty"`
+	AtomLinks     []atomLink `xml:"atom:link"`
+	Items         []rssItem  `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description,omitempty"`
+	PubDate     string   `xml:"pubDate"`
+	Guid        rssGuid  `xml:"guid"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// BuildRSS renders the recent actions as an RSS 2.0 document.
+// The items appear in the same order as the actions.
+func BuildRSS(actions []models.RecentAction, opts ...Option) (
+	[]byte, error) {
+	o := newOptions(opts)
+	doc := rss{
+		Version: kRSSVersion,
+		Channel: rssChannel{
+			Title:       o.title,
+			Link:        o.siteUrl,
+			Description: o.description,
+			Language:    o.locale,
+			TTL:         o.ttlMinutes(),
+			AtomLinks:   o.links(),
+		},
+	}
+	if len(doc.Channel.AtomLinks) > 0 {
+		doc.XmlnsAtom = kAtomNamespace
+	}
+
+	var lastBuild time.Time
+	for _, e := range newEntries(actions, opts) {
+		if e.updated.After(lastBuild) {
+			lastBuild = e.updated
+		}
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.title,
+			Link:        e.link,
+			Description: e.content,
+			PubDate:     e.updated.Format(time.RFC1123Z),
+			// The permalink of a blog/comment never changes, hence it is
+			// stable across runs.
+			Guid: rssGuid{
+				IsPermaLink: true,
+				Value:       e.link,
+			},
+			Categories: e.tags,
+		})
+	}
+	if !lastBuild.IsZero() {
+		doc.Channel.LastBuildDate = lastBuild.Format(time.RFC1123Z)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errors.Errorf("could not marshal rss feed "+
+			"with error [%v]", err)
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,96 @@
+package feed_test
+
+import (
+	"encoding/xml"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("RSS", func() {
+	type rssDoc struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel struct {
+			Title         string `xml:"title"`
+			Link          string `xml:"link"`
+			Description   string `xml:"description"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				Description string `xml:"description"`
+				PubDate     string `xml:"pubDate"`
+				Guid        struct {
+					IsPermaLink string `xml:"isPermaLink,attr"`
+					Value       string `xml:",chardata"`
+				} `xml:"guid"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000100,
+			BlogEntry:   &models.BlogEntry{Id: 101, Title: "Round #1"},
+			Comment: &models.Comment{
+				Id:                7,
+				CommentatorHandle: "tourist",
+				Text:              "Nice problems",
+			},
+		},
+		{
+			TimeSeconds: 1660000300,
+			BlogEntry: &models.BlogEntry{
+				Id:           102,
+				Title:        "Editorial",
+				AuthorHandle: "MikeMirzayanov",
+				Content:      "Solutions",
+			},
+		},
+	}
+
+	It("should render the channel and an item per action", func() {
+		out, err := feed.BuildRSS(actions,
+			feed.WithTitle("cfrss"),
+			feed.WithSiteLink("https://cfrss.example.com"),
+			feed.WithDescription("Recent actions"))
+		Expect(err).Should(BeNil())
+
+		var doc rssDoc
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Version).Should(Equal("2.0"))
+		Expect(doc.Channel.Title).Should(Equal("cfrss"))
+		Expect(doc.Channel.Link).Should(Equal("https://cfrss.example.com"))
+		Expect(doc.Channel.Description).Should(Equal("Recent actions"))
+
+		// The items keep the order of the actions, and the channel is dated
+		// by the newest of them.
+		Expect(doc.Channel.Items).Should(HaveLen(2))
+		lastBuild, err := time.Parse(time.RFC1123Z,
+			doc.Channel.LastBuildDate)
+		Expect(err).Should(BeNil())
+		Expect(lastBuild.Unix()).Should(Equal(int64(1660000300)))
+
+		for ind, item := range doc.Channel.Items {
+			Expect(item.Link).Should(Equal(actions[ind].PermalinkURL()))
+			Expect(item.Guid.IsPermaLink).Should(Equal("true"))
+			Expect(item.Guid.Value).Should(Equal(item.Link))
+
+			pubDate, err := time.Parse(time.RFC1123Z, item.PubDate)
+			Expect(err).Should(BeNil())
+			Expect(pubDate.Unix()).Should(Equal(actions[ind].TimeSeconds))
+		}
+		Expect(doc.Channel.Items[0].Title).Should(ContainSubstring("tourist"))
+		Expect(doc.Channel.Items[0].Title).Should(ContainSubstring("Round #1"))
+		Expect(doc.Channel.Items[0].Description).
+			Should(ContainSubstring("Nice problems"))
+		Expect(doc.Channel.Items[1].Title).Should(ContainSubstring("Editorial"))
+		Expect(doc.Channel.Items[1].Description).
+			Should(ContainSubstring("Solutions"))
+	})
+})
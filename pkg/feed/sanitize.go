@@ -0,0 +1,180 @@
+package feed
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	htmltoken "golang.org/x/net/html"
+)
+
+// SanitizePolicy lists the elements kept in the content of the items, along
+// with their attributes. The other elements are stripped, keeping their text,
+// except for the ones whose content is never meant to be read, e.g, <script>,
+// which are dropped altogether.
+type SanitizePolicy struct {
+	elements map[string]map[string]bool
+}
+
+// droppedElements are stripped along with their content.
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"embed": true, "noscript": true, "template": true, "textarea": true,
+	"select": true, "svg": true, "math": true, "title": true, "head": true,
+}
+
+// urlAttributes hold URLs, which are kept only for the safe schemes. The
+// ones not allowed by UGCPolicy are listed for the custom policies.
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "cite": true, "action": true,
+	"formaction": true, "poster": true, "background": true,
+	"longdesc": true, "data": true, "manifest": true, "icon": true,
+}
+
+// safeSchemes are the URL schemes that can't run code in the reader. Relative
+// URLs have no scheme.
+var safeSchemes = map[string]bool{
+	"": true, "http": true, "https": true, "mailto": true,
+}
+
+// ugcPolicy is the default policy, shared by all the feeds since policies
+// are never modified after their creation.
+var ugcPolicy = UGCPolicy()
+
+// NewSanitizePolicy creates a policy keeping the given elements, each with
+// the given attributes, e.g, {"a": {"href"}, "p": nil}. The URLs are kept only
+// for the http, https and mailto schemes.
+func NewSanitizePolicy(elements map[string][]string) *SanitizePolicy {
+	policy := &SanitizePolicy{elements: make(map[string]map[string]bool)}
+	for element, attributes := range elements {
+		allowed := make(map[string]bool)
+		for _, attribute := range attributes {
+			allowed[attribute] = true
+		}
+		policy.elements[element] = allowed
+	}
+	return policy
+}
+
+// UGCPolicy keeps the formatting of user generated content, i.e, text,
+// links, images, lists, tables and code, which is the default.
+func UGCPolicy() *SanitizePolicy {
+	elements := map[string][]string{
+		"a":          {"href", "title"},
+		"img":        {"src", "alt", "title", "width", "height"},
+		"abbr":       {"title"},
+		"blockquote": {"cite"},
+		"q":          {"cite"},
+		"ol":         {"start"},
+		"th":         {"colspan", "rowspan"},
+		"td":         {"colspan", "rowspan"},
+	}
+	for _, element := range []string{"p", "br", "hr", "div", "span",
+		"center", "b", "i", "u", "s", "em", "strong", "del", "ins", "sub",
+		"sup", "small", "mark", "code", "kbd", "samp", "var", "pre", "h1",
+		"h2", "h3", "h4", "h5", "h6", "ul", "li", "dl", "dt", "dd", "table",
+		"caption", "thead", "tbody", "tfoot", "tr"} {
+		elements[element] = nil
+	}
+	return NewSanitizePolicy(elements)
+}
+
+// StrictPolicy strips every element, keeping the text only.
+func StrictPolicy() *SanitizePolicy {
+	return NewSanitizePolicy(nil)
+}
+
+// sanitize strips the elements and attributes the policy doesn't allow, and
+// balances the tags, so that the result is well-formed even if the input
+// isn't.
+func (policy *SanitizePolicy) sanitize(s string) string {
+	tokenizer := htmltoken.NewTokenizer(strings.NewReader(s))
+	var out strings.Builder
+	var open []string
+	dropDepth := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == htmltoken.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case htmltoken.TextToken:
+			if dropDepth == 0 {
+				out.WriteString(html.EscapeString(token.Data))
+			}
+		case htmltoken.StartTagToken, htmltoken.SelfClosingTagToken:
+			if droppedElements[token.Data] {
+				if tokenType == htmltoken.StartTagToken {
+					dropDepth++
+				}
+				continue
+			}
+			allowed, ok := policy.elements[token.Data]
+			if dropDepth > 0 || !ok {
+				continue
+			}
+			out.WriteString(policy.startTag(token, allowed))
+			if voidElements[token.Data] {
+				continue
+			}
+			if tokenType == htmltoken.SelfClosingTagToken {
+				out.WriteString("</" + token.Data + ">")
+				continue
+			}
+			open = append(open, token.Data)
+		case htmltoken.EndTagToken:
+			if droppedElements[token.Data] {
+				if dropDepth > 0 {
+					dropDepth--
+				}
+				continue
+			}
+			if dropDepth > 0 {
+				continue
+			}
+			// The elements left open within the closed one are closed
+			// first, and the end tags without a start tag are dropped.
+			for ind := len(open) - 1; ind >= 0; ind-- {
+				if open[ind] != token.Data {
+					continue
+				}
+				for len(open) > ind {
+					out.WriteString("</" + open[len(open)-1] + ">")
+					open = open[:len(open)-1]
+				}
+				break
+			}
+		}
+	}
+	for ind := len(open) - 1; ind >= 0; ind-- {
+		out.WriteString("</" + open[ind] + ">")
+	}
+	return out.String()
+}
+
+// startTag renders the start tag of the element with its allowed attributes.
+func (policy *SanitizePolicy) startTag(token htmltoken.Token,
+	allowed map[string]bool) string {
+	var tag strings.Builder
+	tag.WriteString("<" + token.Data)
+	for _, attr := range token.Attr {
+		if attr.Namespace != "" || !allowed[attr.Key] {
+			continue
+		}
+		if urlAttributes[attr.Key] && !isSafeURL(attr.Val) {
+			continue
+		}
+		tag.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) +
+			`"`)
+	}
+	tag.WriteString(">")
+	return tag.String()
+}
+
+// isSafeURL returns true if the URL can't run code in the reader, e.g, it
+// returns false for javascript: URLs.
+func isSafeURL(rawUrl string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(rawUrl))
+	return err == nil && safeSchemes[parsed.Scheme]
+}
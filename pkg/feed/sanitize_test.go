@@ -0,0 +1,131 @@
+package feed_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("Sanitize", func() {
+	DescribeTable("should keep the safe subset of the html",
+		func(in, expected string) {
+			Expect(feed.Sanitize(feed.UGCPolicy(), in)).Should(Equal(expected))
+		},
+		Entry("script", `<p>Hi<script>alert("xss")</script></p>`,
+			"<p>Hi</p>"),
+		Entry("event handlers", `<img src="/a.png" onerror="alert(1)">`,
+			`<img src="/a.png">`),
+		Entry("javascript urls", `<a href=" JavaScript:alert(1)">x</a>`,
+			"<a>x</a>"),
+		Entry("encoded javascript urls",
+			`<a href="&#106;avascript:alert(1)">x</a>`, "<a>x</a>"),
+		Entry("safe urls", `<a href="https://codeforces.com/blog/entry/1" `+
+			`title="blog">x</a>`,
+			`<a href="https://codeforces.com/blog/entry/1" title="blog">x</a>`),
+		Entry("unknown elements", "<p><blink>Hi</blink> there</p>",
+			"<p>Hi there</p>"),
+		Entry("nested dropped elements",
+			"<object><object>a</object>b</object>c", "c"),
+		Entry("styles", `<span style="color: red">Hi</span>`, "<span>Hi</span>"),
+		Entry("unclosed elements", "<p><b>Hi", "<p><b>Hi</b></p>"),
+		Entry("stray end tags", "Hi</b></p>", "Hi"),
+		Entry("misnested elements", "<b><i>Hi</b></i>", "<b><i>Hi</i></b>"),
+		Entry("self-closing elements", "a<br/>b<span/>c",
+			"a<br>b<span></span>c"),
+		Entry("comments", "a<!-- <script>x</script> -->b", "ab"),
+		Entry("text", "1 < 2 & 3 > 2", "1 &lt; 2 &amp; 3 &gt; 2"),
+		Entry("javascript urls with whitespace",
+			"<a href=\"java\tscript:alert(1)\">x</a>", "<a>x</a>"),
+		Entry("javascript urls with encoded whitespace",
+			`<a href="java&#x09;script:alert(1)">x</a>`, "<a>x</a>"),
+		Entry("javascript urls with encoded newlines",
+			`<a href="jav&#x0A;ascript:alert(1)">x</a>`, "<a>x</a>"),
+		Entry("javascript urls with leading control characters",
+			`<a href="&#x01;javascript:alert(1)">x</a>`, "<a>x</a>"),
+		Entry("javascript urls with an encoded colon",
+			`<a href="javascript&colon;alert(1)">x</a>`, "<a>x</a>"),
+		Entry("hex encoded javascript urls",
+			`<a href="&#x6A;&#x61;vascript:alert(1)">x</a>`, "<a>x</a>"),
+		Entry("vbscript urls", `<a href="vbscript:msgbox(1)">x</a>`,
+			"<a>x</a>"),
+		Entry("data urls",
+			`<img src="data:image/svg+xml;base64,PHN2Zz48L3N2Zz4=">`,
+			"<img>"),
+		Entry("data urls in links",
+			`<a href="data:text/html,<script>alert(1)</script>">x</a>`,
+			"<a>x</a>"),
+		Entry("srcset", `<img src="/a.png" srcset="javascript:alert(1) 2x">`,
+			`<img src="/a.png">`),
+		Entry("style attributes",
+			`<p style="background:url(javascript:alert(1))">Hi</p>`,
+			"<p>Hi</p>"),
+		Entry("style elements",
+			`<style>body{background:url(javascript:alert(1))}</style>Hi`,
+			"Hi"),
+		Entry("svg", `<svg onload="alert(1)"><script>alert(1)</script>`+
+			`<a xlink:href="javascript:alert(1)">x</a></svg>Hi`, "Hi"),
+		Entry("self-closing svg", `<svg/onload=alert(1)>`, ""),
+		Entry("mathml", `<math><maction actiontype="statusline" `+
+			`xlink:href="javascript:alert(1)">x</maction></math>Hi`, "Hi"),
+		Entry("uppercase elements", `<SCRIPT>alert(1)</SCRIPT>Hi`, "Hi"),
+		Entry("split elements", `<scr<script>ipt>alert(1)</script>`,
+			"ipt&gt;alert(1)"),
+		Entry("raw text elements", `<xmp><img src=x onerror=alert(1)></xmp>`,
+			"&lt;img src=x onerror=alert(1)&gt;"),
+		Entry("quotes in attributes",
+			`<a title='"><script>alert(1)</script>'>x</a>`,
+			`<a title="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;">x</a>`),
+		Entry("forms", `<form action="javascript:alert(1)">`+
+			`<button formaction="javascript:alert(1)">x</button></form>`, "x"),
+		Entry("meta refresh",
+			`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">Hi`,
+			"Hi"),
+	)
+
+	It("should check the urls of the custom policies", func() {
+		policy := feed.NewSanitizePolicy(map[string][]string{
+			"form":  {"action"},
+			"video": {"poster"},
+		})
+		Expect(feed.Sanitize(policy,
+			`<form action="javascript:alert(1)">`+
+				`<video poster="javascript:alert(1)"></video></form>`)).
+			Should(Equal("<form><video></video></form>"))
+		Expect(feed.Sanitize(policy, `<form action="/search"></form>`)).
+			Should(Equal(`<form action="/search"></form>`))
+	})
+
+	It("should strip every element with the strict policy", func() {
+		Expect(feed.Sanitize(feed.StrictPolicy(),
+			`<p><a href="https://codeforces.com">Hi</a></p>`)).
+			Should(Equal("Hi"))
+	})
+
+	It("should strip the script payloads from the feeds", func() {
+		actions := []models.RecentAction{{
+			TimeSeconds: 1660000000,
+			BlogEntry: &models.BlogEntry{
+				Id:      101,
+				Title:   "Round 1",
+				Content: `<p>Hi</p><script>alert("xss")</script>`,
+			},
+		}}
+		for _, build := range []func([]models.RecentAction,
+			...feed.Option) ([]byte, error){
+			feed.BuildRSS, feed.BuildAtom, feed.BuildJSONFeed} {
+			out, err := build(actions)
+			Expect(err).Should(BeNil())
+			Expect(string(out)).ShouldNot(ContainSubstring("script&gt;"))
+			Expect(string(out)).ShouldNot(ContainSubstring("script>"))
+			Expect(string(out)).ShouldNot(ContainSubstring("alert"))
+		}
+
+		out, err := feed.BuildRSS(actions,
+			feed.WithSanitizePolicy(feed.StrictPolicy()))
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			"<description>Hi</description>"))
+	})
+})
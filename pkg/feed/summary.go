@@ -0,0 +1,97 @@
+package feed
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	htmltoken "golang.org/x/net/html"
+)
+
+// ContentMode tells how much of the content of an action an item carries.
+type ContentMode int
+
+const (
+	// ContentModeFull embeds the whole content, which is the default.
+	ContentModeFull ContentMode = iota
+	// ContentModeSummary cuts the content after a number of characters, and
+	// links to the action for the rest.
+	ContentModeSummary
+)
+
+const (
+	kDefaultSummaryLength = 300
+	kEllipsis             = "…"
+)
+
+// voidElements never have an end tag, hence they are never left open.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// summarize cuts the content after maxChars characters of text, and links to
+// the rest. The content is returned as is if it is short enough.
+func summarize(content, link string, maxChars int) string {
+	truncated, ok := truncateHTML(content, maxChars)
+	if !ok {
+		return content
+	}
+	return truncated + fmt.Sprintf(`<p><a href="%s">Read more</a></p>`,
+		html.EscapeString(link))
+}
+
+// truncateHTML cuts the html after maxChars characters of text, followed by an
+// ellipsis, and closes the elements left open. Only the text is counted, an
+// entity being a single character, and neither the tags nor the entities are
+// ever cut. It returns false, along with the html as is, if it has at most
+// maxChars characters of text.
+func truncateHTML(s string, maxChars int) (string, bool) {
+	tokenizer := htmltoken.NewTokenizer(strings.NewReader(s))
+	var out strings.Builder
+	var open []string
+	chars := 0
+	for {
+		switch tokenizer.Next() {
+		case htmltoken.ErrorToken:
+			// The whole input fits, be it because of EOF or of malformed
+			// html that can't be tokenized further.
+			return s, false
+		case htmltoken.TextToken:
+			text := string(tokenizer.Text())
+			length := utf8.RuneCountInString(text)
+			if chars+length <= maxChars {
+				chars += length
+				out.Write(tokenizer.Raw())
+				continue
+			}
+			kept := []rune(text)[:maxChars-chars]
+			out.WriteString(html.EscapeString(
+				strings.TrimRight(string(kept), " \t\r\n")))
+			out.WriteString(kEllipsis)
+			for ind := len(open) - 1; ind >= 0; ind-- {
+				out.WriteString("</" + open[ind] + ">")
+			}
+			return out.String(), true
+		case htmltoken.StartTagToken:
+			out.Write(tokenizer.Raw())
+			name, _ := tokenizer.TagName()
+			if !voidElements[string(name)] {
+				open = append(open, string(name))
+			}
+		case htmltoken.EndTagToken:
+			out.Write(tokenizer.Raw())
+			name, _ := tokenizer.TagName()
+			for ind := len(open) - 1; ind >= 0; ind-- {
+				if open[ind] == string(name) {
+					open = open[:ind]
+					break
+				}
+			}
+		default:
+			out.Write(tokenizer.Raw())
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package feed_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("TruncateHTML", func() {
+	DescribeTable("should cut the text without breaking the html",
+		func(in string, maxChars int, expected string, cut bool) {
+			out, ok := feed.TruncateHTML(in, maxChars)
+			Expect(ok).Should(Equal(cut))
+			Expect(out).Should(Equal(expected))
+		},
+		Entry("short text", "<p>Hello</p>", 5, "<p>Hello</p>", false),
+		Entry("plain text", "Hello world", 5, "Hello…", true),
+		Entry("open elements", "<p><b>Hello world</b></p>", 7,
+			"<p><b>Hello w…</b></p>", true),
+		Entry("tags are not counted",
+			`<a href="https://codeforces.com">ab</a>cd`, 3,
+			`<a href="https://codeforces.com">ab</a>c…`, true),
+		Entry("boundary between elements", "<p>Hello</p><p>world</p>", 5,
+			"<p>Hello</p><p>…</p>", true),
+		Entry("entities are not cut", "<p>a &amp; b</p>", 3,
+			"<p>a &amp;…</p>", true),
+		Entry("void elements", "<p>a<br>b<img src=x>cd</p>", 3,
+			"<p>a<br>b<img src=x>c…</p>", true),
+		Entry("multi-byte characters", "<p>привет</p>", 2,
+			"<p>пр…</p>", true),
+		Entry("trailing whitespace", "<p>Hello world</p>", 6,
+			"<p>Hello…</p>", true),
+		Entry("empty content", "", 10, "", false),
+	)
+})
+
+var _ = Describe("ContentMode", func() {
+	actions := []models.RecentAction{{
+		TimeSeconds: 1660000000,
+		BlogEntry: &models.BlogEntry{
+			Id:      101,
+			Title:   "Round 1",
+			Content: "<p>The problems of the round are great</p>",
+		},
+	}}
+
+	It("should summarize the content with a link to the rest", func() {
+		out, err := feed.BuildRSS(actions,
+			feed.WithContentMode(feed.ContentModeSummary),
+			feed.WithSummaryLength(12))
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			"&lt;p&gt;The problems…&lt;/p&gt;&lt;p&gt;&lt;a " +
+				"href=&#34;https://codeforces.com/blog/entry/101&#34;&gt;" +
+				"Read more&lt;/a&gt;&lt;/p&gt;"))
+	})
+
+	It("should embed the full content by default", func() {
+		out, err := feed.BuildRSS(actions)
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring("are great"))
+		Expect(string(out)).ShouldNot(ContainSubstring("Read more"))
+	})
+})
@@ -0,0 +1,67 @@
+package feed_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("Tags", func() {
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000100,
+			BlogEntry: &models.BlogEntry{
+				Id:    101,
+				Title: "Editorial of Round #1",
+				Tags:  []string{"editorial", " ", "div2"},
+			},
+		},
+		{
+			TimeSeconds: 1660000000,
+			BlogEntry:   &models.BlogEntry{Id: 102, Title: "Untagged"},
+		},
+	}
+
+	It("should categorize the rss items", func() {
+		out, err := feed.BuildRSS(actions)
+		Expect(err).Should(BeNil())
+
+		var doc struct {
+			Items []struct {
+				Categories []string `xml:"category"`
+			} `xml:"channel>item"`
+		}
+		Expect(xml.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Items).Should(HaveLen(2))
+		Expect(doc.Items[0].Categories).Should(Equal(
+			[]string{"editorial", "div2"}))
+		Expect(doc.Items[1].Categories).Should(BeEmpty())
+	})
+
+	It("should categorize the atom entries", func() {
+		out, err := feed.BuildAtom(actions)
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			`<category term="editorial"></category>`))
+		Expect(string(out)).Should(ContainSubstring(
+			`<category term="div2"></category>`))
+	})
+
+	It("should tag the json feed items", func() {
+		out, err := feed.BuildJSONFeed(actions)
+		Expect(err).Should(BeNil())
+
+		var doc struct {
+			Items []map[string]interface{} `json:"items"`
+		}
+		Expect(json.Unmarshal(out, &doc)).Should(Succeed())
+		Expect(doc.Items[0]["tags"]).Should(Equal(
+			[]interface{}{"editorial", "div2"}))
+		Expect(doc.Items[1]).ShouldNot(HaveKey("tags"))
+	})
+})
@@ -0,0 +1,37 @@
+package feed_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+)
+
+var _ = Describe("WebSub", func() {
+	hubs := []string{"https://pubsubhubbub.appspot.com/"}
+	selfUrl := "https://cfrss.example.com/feed.xml"
+
+	It("should advertise the hub in the rss feed", func() {
+		out, err := feed.BuildRSS(nil, feed.WithWebSub(hubs, selfUrl))
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			`xmlns:atom="http://www.w3.org/2005/Atom"`))
+		Expect(string(out)).Should(ContainSubstring(
+			`<atom:link href="https://pubsubhubbub.appspot.com/" rel="hub">`))
+		Expect(string(out)).Should(ContainSubstring(
+			`<atom:link href="https://cfrss.example.com/feed.xml" rel="self">`))
+	})
+
+	It("should advertise the hub in the atom feed", func() {
+		out, err := feed.BuildAtom(nil, feed.WithWebSub(hubs, selfUrl))
+		Expect(err).Should(BeNil())
+		Expect(string(out)).Should(ContainSubstring(
+			`<link href="https://pubsubhubbub.appspot.com/" rel="hub">`))
+	})
+
+	It("should not advertise anything without a hub", func() {
+		out, err := feed.BuildRSS(nil)
+		Expect(err).Should(BeNil())
+		Expect(string(out)).ShouldNot(ContainSubstring("atom"))
+	})
+})
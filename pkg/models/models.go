@@ -34,6 +34,48 @@ type RecentAction struct {
 	Comment     *Comment   `bson:"comment,omitempty" json:"comment,omitempty"`
 }
 
+// CodeforcesUser represents the public profile of a user on Codeforces.
+// It is not to be confused with User, which is a user of this application.
+type CodeforcesUser struct {
+	Handle     string `bson:"handle" json:"handle"`
+	Rating     int    `bson:"rating" json:"rating"`
+	MaxRating  int    `bson:"maxRating" json:"maxRating"`
+	Rank       string `bson:"rank" json:"rank"`
+	MaxRank    string `bson:"maxRank" json:"maxRank"`
+	Avatar     string `bson:"avatar" json:"avatar"`
+	TitlePhoto string `bson:"titlePhoto" json:"titlePhoto"`
+}
+
+// Contest represents a contest, or a gym contest, on Codeforces.
+type Contest struct {
+	Id               int    `bson:"id" json:"id"`
+	Name             string `bson:"name" json:"name"`
+	Type             string `bson:"type" json:"type"`
+	Phase            string `bson:"phase" json:"phase"`
+	StartTimeSeconds int64  `bson:"startTimeSeconds" json:"startTimeSeconds"`
+	DurationSeconds  int64  `bson:"durationSeconds" json:"durationSeconds"`
+}
+
+// Problem represents a problem on Codeforces, identified by its contest and
+// index, e.g, 1900 and A.
+type Problem struct {
+	ContestId int    `bson:"contestId" json:"contestId"`
+	Index     string `bson:"index" json:"index"`
+	Name      string `bson:"name" json:"name"`
+	Rating    int    `bson:"rating" json:"rating"`
+}
+
+// Submission represents a submission to a problem on Codeforces. The verdict
+// of an accepted submission is OK.
+type Submission struct {
+	Id                  int     `bson:"id" json:"id"`
+	ContestId           int     `bson:"contestId" json:"contestId"`
+	CreationTimeSeconds int64   `bson:"creationTimeSeconds" json:"creationTimeSeconds"`
+	Problem             Problem `bson:"problem" json:"problem"`
+	Verdict             string  `bson:"verdict" json:"verdict"`
+	ProgrammingLanguage string  `bson:"programmingLanguage" json:"programmingLanguage"`
+}
+
 // User contains all the details of a user.
 type User struct {
 	Uuid             string `bson:"uuid" json:"uuid"`
@@ -0,0 +1,33 @@
+package models
+
+// ratingColor is the color of the handles rated at least minRating.
+type ratingColor struct {
+	minRating int
+	color     string
+}
+
+// ratingColors are the colors of the Codeforces ranks, from the highest to
+// the lowest rating.
+var ratingColors = []ratingColor{
+	{minRating: 2400, color: "red"},
+	{minRating: 2100, color: "orange"},
+	{minRating: 1900, color: "violet"},
+	{minRating: 1600, color: "blue"},
+	{minRating: 1400, color: "cyan"},
+	{minRating: 1200, color: "green"},
+}
+
+// RatingColor returns the name of the color in which Codeforces renders the
+// handles with the given rating, e.g, "blue" for experts. Unrated users, whose
+// rating is zero, are "black".
+func RatingColor(rating int) string {
+	if rating == 0 {
+		return "black"
+	}
+	for _, rc := range ratingColors {
+		if rating >= rc.minRating {
+			return rc.color
+		}
+	}
+	return "gray"
+}
@@ -0,0 +1,30 @@
+package models_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("RatingColor", func() {
+	It("should map the ratings to the colors of the ranks", func() {
+		for rating, color := range map[int]string{
+			0:    "black",
+			800:  "gray",
+			1199: "gray",
+			1200: "green",
+			1400: "cyan",
+			1600: "blue",
+			1899: "blue",
+			1900: "violet",
+			2100: "orange",
+			2399: "orange",
+			2400: "red",
+			3800: "red",
+		} {
+			Expect(models.RatingColor(rating)).Should(Equal(color),
+				"rating %d", rating)
+		}
+	})
+})
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	kCodeforcesUrl      = "https://codeforces.com"
+	kBlogEntryUrlPrefix = kCodeforcesUrl + "/blog/entry/"
+	kCommentUrlInfix    = "?#comment-"
+	kBlogEntryUrlFmt    = kBlogEntryUrlPrefix + "%d"
+	kCommentUrlFmt      = kBlogEntryUrlFmt + kCommentUrlInfix + "%d"
+)
+
+// kActionIdSeparator separates the blog entry id from the comment id in the
+// id of an action, e.g, "101-7".
+const kActionIdSeparator = "-"
+
+// ActionKind tells whether a recent action is a blog entry or a comment.
+type ActionKind int
+
+const (
+	// ActionKindUnknown is the kind of actions without a blog entry, which
+	// Codeforces never returns but a malformed document might contain.
+	ActionKindUnknown ActionKind = iota
+	ActionKindBlogEntry
+	ActionKindComment
+)
+
+// String returns a human readable name of the kind.
+func (kind ActionKind) String() string {
+	switch kind {
+	case ActionKindBlogEntry:
+		return "blogEntry"
+	case ActionKindComment:
+		return "comment"
+	default:
+		return "unknown"
+	}
+}
+
+// Kind returns the kind of the action. Codeforces attaches the blog entry to
+// comments as well, so an action is a comment iff it contains one.
+func (action RecentAction) Kind() ActionKind {
+	switch {
+	case action.BlogEntry == nil:
+		return ActionKindUnknown
+	case action.Comment != nil:
+		return ActionKindComment
+	default:
+		return ActionKindBlogEntry
+	}
+}
+
+// PermalinkURL returns the URL of the blog entry or the comment on
+// Codeforces, or an empty string if the kind of the action is unknown.
+func (action RecentAction) PermalinkURL() string {
+	switch action.Kind() {
+	case ActionKindBlogEntry:
+		return fmt.Sprintf(kBlogEntryUrlFmt, action.BlogEntry.Id)
+	case ActionKindComment:
+		return fmt.Sprintf(kCommentUrlFmt, action.BlogEntry.Id,
+			action.Comment.Id)
+	default:
+		return ""
+	}
+}
+
+// Locale returns the locale in which the content of the action is written,
+// e.g, "en" or "ru". It is empty if Codeforces did not report one.
+func (action RecentAction) Locale() string {
+	switch action.Kind() {
+	case ActionKindComment:
+		return action.Comment.Locale
+	case ActionKindBlogEntry:
+		if action.BlogEntry.Locale != "" {
+			return action.BlogEntry.Locale
+		}
+		return action.BlogEntry.OriginalLocale
+	default:
+		return ""
+	}
+}
+
+// Author returns the handle of the commentator, or that of the blog author
+// if the action is not a comment. It is empty if the kind is unknown.
+func (action RecentAction) Author() string {
+	switch action.Kind() {
+	case ActionKindComment:
+		return action.Comment.CommentatorHandle
+	case ActionKindBlogEntry:
+		return action.BlogEntry.AuthorHandle
+	default:
+		return ""
+	}
+}
+
+// ContainsText reports whether the blog title, the blog content or the
+// comment text contains the query, ignoring the case.
+func (action RecentAction) ContainsText(query string) bool {
+	query = strings.ToLower(query)
+	var texts []string
+	if action.BlogEntry != nil {
+		texts = append(texts, action.BlogEntry.Title, action.BlogEntry.Content)
+	}
+	if action.Comment != nil {
+		texts = append(texts, action.Comment.Text)
+	}
+	for _, text := range texts {
+		if strings.Contains(strings.ToLower(text), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// Id uniquely identifies the action by its blog entry and comment, e.g,
+// "101-7". The comment id is zero for blog entries, e.g, "101-0". It is safe
+// to use in URLs.
+func (action RecentAction) Id() string {
+	var blogEntryId, commentId int
+	if action.BlogEntry != nil {
+		blogEntryId = action.BlogEntry.Id
+	}
+	if action.Comment != nil {
+		commentId = action.Comment.Id
+	}
+	return fmt.Sprintf("%d%s%d", blogEntryId, kActionIdSeparator, commentId)
+}
+
+// EditTimeSeconds returns the time of the latest revision of the action, i.e,
+// the later of its activity time, which Codeforces bumps when the action is
+// edited, and of the modification time of its blog entry. The stores replace
+// their copy of an action with one of a later edit time.
+func (action RecentAction) EditTimeSeconds() int64 {
+	editTime := action.TimeSeconds
+	if action.BlogEntry != nil &&
+		action.BlogEntry.ModificationTimeSeconds > editTime {
+		editTime = action.BlogEntry.ModificationTimeSeconds
+	}
+	return editTime
+}
+
+// OriginalTimeSeconds returns the activity time of the first revision of the
+// action, which the edits don't bump, unlike TimeSeconds. That is the creation
+// time of a comment, if known, since Codeforces bumps the activity time of the
+// edited comments only, and the activity time otherwise.
+func (action RecentAction) OriginalTimeSeconds() int64 {
+	if action.Comment != nil && action.Comment.CreationTimeSeconds > 0 &&
+		action.Comment.CreationTimeSeconds < action.TimeSeconds {
+		return action.Comment.CreationTimeSeconds
+	}
+	return action.TimeSeconds
+}
+
+// ContentHash returns a hex encoded digest of the content of the action, i.e,
+// the title, content and tags of its blog entry and the text of its comment.
+// It ignores the times and the ratings, hence two revisions of an action have
+// the same hash iff their content is the same.
+func (action RecentAction) ContentHash() string {
+	hash := sha256.New()
+	// Each field is prefixed with its length, so that the content can't leak
+	// from one field to the next without changing the hash.
+	write := func(field string) {
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	if action.BlogEntry != nil {
+		write(action.BlogEntry.Title)
+		write(action.BlogEntry.Content)
+		fmt.Fprintf(hash, "%d:", len(action.BlogEntry.Tags))
+		for _, tag := range action.BlogEntry.Tags {
+			write(tag)
+		}
+	}
+	if action.Comment != nil {
+		write(action.Comment.Text)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ParseActionId returns the blog entry and comment ids of an id returned by
+// RecentAction.Id.
+func ParseActionId(id string) (blogEntryId, commentId int, err error) {
+	parts := strings.Split(id, kActionIdSeparator)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("action id %q should be of the form "+
+			"<blogEntryId>-<commentId>", id)
+	}
+	if blogEntryId, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, fmt.Errorf("invalid blog entry id in action id %q", id)
+	}
+	if commentId, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, fmt.Errorf("invalid comment id in action id %q", id)
+	}
+	return blogEntryId, commentId, nil
+}
+
+// ParsePermalinkURL returns the id, as returned by RecentAction.Id, of the
+// action whose permalink is the URL returned by RecentAction.PermalinkURL,
+// which the feeds use as the guids of their items.
+func ParsePermalinkURL(link string) (string, error) {
+	if !strings.HasPrefix(link, kBlogEntryUrlPrefix) {
+		return "", fmt.Errorf("%q is not the permalink of an action", link)
+	}
+	rawBlogEntryId, rawCommentId, isComment := strings.Cut(
+		strings.TrimPrefix(link, kBlogEntryUrlPrefix), kCommentUrlInfix)
+	if !isComment {
+		rawCommentId = "0"
+	}
+	id := rawBlogEntryId + kActionIdSeparator + rawCommentId
+	if _, _, err := ParseActionId(id); err != nil {
+		return "", fmt.Errorf("invalid permalink %q", link)
+	}
+	return id, nil
+}
@@ -0,0 +1,160 @@
+package models_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("RecentAction", func() {
+	It("should link a blog entry to its page", func() {
+		action := models.RecentAction{
+			BlogEntry: &models.BlogEntry{Id: 101},
+		}
+
+		Expect(action.Kind()).Should(Equal(models.ActionKindBlogEntry))
+		Expect(action.PermalinkURL()).Should(
+			Equal("https://codeforces.com/blog/entry/101"))
+	})
+
+	It("should link a comment to its anchor on the blog entry", func() {
+		action := models.RecentAction{
+			BlogEntry: &models.BlogEntry{Id: 101},
+			Comment:   &models.Comment{Id: 7},
+		}
+
+		Expect(action.Kind()).Should(Equal(models.ActionKindComment))
+		Expect(action.PermalinkURL()).Should(
+			Equal("https://codeforces.com/blog/entry/101?#comment-7"))
+	})
+
+	It("should not link an action without a blog entry", func() {
+		action := models.RecentAction{Comment: &models.Comment{Id: 7}}
+
+		Expect(action.Kind()).Should(Equal(models.ActionKindUnknown))
+		Expect(action.PermalinkURL()).Should(BeEmpty())
+	})
+
+	It("should search the titles and texts ignoring the case", func() {
+		action := models.RecentAction{
+			BlogEntry: &models.BlogEntry{Title: "Codeforces Round #900"},
+			Comment:   &models.Comment{Text: "Problem D was about segment trees"},
+		}
+
+		Expect(action.ContainsText("round #900")).Should(BeTrue())
+		Expect(action.ContainsText("SEGMENT tree")).Should(BeTrue())
+		Expect(action.ContainsText("treap")).Should(BeFalse())
+	})
+
+	It("should date an action by its latest edit", func() {
+		action := models.RecentAction{
+			TimeSeconds: 100,
+			BlogEntry:   &models.BlogEntry{Id: 101},
+		}
+		Expect(action.EditTimeSeconds()).Should(Equal(int64(100)))
+
+		action.BlogEntry.ModificationTimeSeconds = 150
+		Expect(action.EditTimeSeconds()).Should(Equal(int64(150)))
+
+		Expect(models.RecentAction{TimeSeconds: 100}.EditTimeSeconds()).
+			Should(Equal(int64(100)))
+	})
+
+	It("should date an action by its first revision", func() {
+		action := models.RecentAction{
+			TimeSeconds: 100,
+			BlogEntry:   &models.BlogEntry{Id: 101, CreationTimeSeconds: 50},
+		}
+		Expect(action.OriginalTimeSeconds()).Should(Equal(int64(100)))
+
+		action.Comment = &models.Comment{Id: 7}
+		Expect(action.OriginalTimeSeconds()).Should(Equal(int64(100)))
+
+		// An edit bumps the activity time of a comment past its creation.
+		action.Comment.CreationTimeSeconds = 80
+		Expect(action.OriginalTimeSeconds()).Should(Equal(int64(80)))
+	})
+
+	It("should hash the content of an action only", func() {
+		newAction := func() models.RecentAction {
+			return models.RecentAction{
+				TimeSeconds: 100,
+				BlogEntry: &models.BlogEntry{
+					Id:    101,
+					Title: "Codeforces Round #900",
+					Tags:  []string{"editorial"},
+				},
+				Comment: &models.Comment{Id: 7, Text: "Nice problems"},
+			}
+		}
+		hash := newAction().ContentHash()
+		Expect(hash).Should(HaveLen(64))
+
+		// The times and the ratings are not part of the content.
+		identical := newAction()
+		identical.TimeSeconds = 200
+		identical.BlogEntry.ModificationTimeSeconds = 150
+		identical.Comment.Rating = 10
+		Expect(identical.ContentHash()).Should(Equal(hash))
+
+		edited := newAction()
+		edited.Comment.Text = "Nice problems, thanks"
+		Expect(edited.ContentHash()).ShouldNot(Equal(hash))
+
+		edited = newAction()
+		edited.BlogEntry.Tags = append(edited.BlogEntry.Tags, "div2")
+		Expect(edited.ContentHash()).ShouldNot(Equal(hash))
+
+		// The content can't move from one field to the next unnoticed.
+		moved := newAction()
+		moved.BlogEntry.Title = "Codeforces Round"
+		moved.BlogEntry.Content = " #900"
+		Expect(moved.ContentHash()).ShouldNot(Equal(hash))
+	})
+
+	It("should round trip the id of an action", func() {
+		comment := models.RecentAction{
+			BlogEntry: &models.BlogEntry{Id: 101},
+			Comment:   &models.Comment{Id: 7},
+		}
+		Expect(comment.Id()).Should(Equal("101-7"))
+
+		blogEntryId, commentId, err := models.ParseActionId(comment.Id())
+		Expect(err).Should(BeNil())
+		Expect(blogEntryId).Should(Equal(101))
+		Expect(commentId).Should(Equal(7))
+
+		blogEntry := models.RecentAction{BlogEntry: &models.BlogEntry{Id: 101}}
+		Expect(blogEntry.Id()).Should(Equal("101-0"))
+
+		for _, id := range []string{"", "101", "101-x", "a-7", "1-2-3"} {
+			_, _, err := models.ParseActionId(id)
+			Expect(err).Should(HaveOccurred())
+		}
+	})
+
+	It("should parse the permalinks of the actions", func() {
+		comment := models.RecentAction{
+			BlogEntry: &models.BlogEntry{Id: 101},
+			Comment:   &models.Comment{Id: 7},
+		}
+		id, err := models.ParsePermalinkURL(comment.PermalinkURL())
+		Expect(err).Should(BeNil())
+		Expect(id).Should(Equal("101-7"))
+
+		blogEntry := models.RecentAction{BlogEntry: &models.BlogEntry{Id: 101}}
+		id, err = models.ParsePermalinkURL(blogEntry.PermalinkURL())
+		Expect(err).Should(BeNil())
+		Expect(id).Should(Equal("101-0"))
+
+		for _, link := range []string{
+			"", "101-7", "https://example.com/blog/entry/101",
+			"https://codeforces.com/blog/entry/x",
+			"https://codeforces.com/blog/entry/101?#comment-x",
+		} {
+			_, err := models.ParsePermalinkURL(link)
+			Expect(err).Should(HaveOccurred())
+		}
+	})
+})
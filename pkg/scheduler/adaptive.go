@@ -0,0 +1,71 @@
+package scheduler
+
+import "go.uber.org/zap"
+
+const (
+	// kAdaptiveWindow is the number of recent cycles whose fill ratio is
+	// considered before adjusting the batch size.
+	kAdaptiveWindow = 3
+
+	// The batch size grows when more than kAdaptiveGrowRatio of the fetched
+	// actions are new, since the older ones were likely pushed out of the
+	// window, and shrinks when fewer than kAdaptiveShrinkRatio are.
+	kAdaptiveGrowRatio   = 0.9
+	kAdaptiveShrinkRatio = 0.25
+)
+
+// adaptiveBatchSize adjusts the batch size within bounds, based on the ratio
+// of new to fetched actions in the recent cycles.
+type adaptiveBatchSize struct {
+	minBatchSize int
+	maxBatchSize int
+
+	// fetched and fresh are the number of fetched and new actions in each of
+	// the cycles since the last adjustment.
+	fetched []int
+	fresh   []int
+}
+
+// next records a cycle and returns the batch size of the next one. The size
+// is only adjusted once a full window of cycles is recorded, after which the
+// window starts over, so that the effect of an adjustment is observed before
+// the next one.
+func (adaptive *adaptiveBatchSize) next(batchSize, fetched, fresh int) int {
+	adaptive.fetched = append(adaptive.fetched, fetched)
+	adaptive.fresh = append(adaptive.fresh, fresh)
+	if len(adaptive.fetched) < kAdaptiveWindow {
+		return batchSize
+	}
+
+	var totalFetched, totalFresh int
+	for ind := range adaptive.fetched {
+		totalFetched += adaptive.fetched[ind]
+		totalFresh += adaptive.fresh[ind]
+	}
+	adaptive.fetched, adaptive.fresh = nil, nil
+	if totalFetched == 0 {
+		return batchSize
+	}
+
+	next := batchSize
+	ratio := float64(totalFresh) / float64(totalFetched)
+	switch {
+	case ratio > kAdaptiveGrowRatio:
+		next = batchSize * 2
+	case ratio < kAdaptiveShrinkRatio:
+		next = batchSize / 2
+	}
+	if next > adaptive.maxBatchSize {
+		next = adaptive.maxBatchSize
+	}
+	if next < adaptive.minBatchSize {
+		next = adaptive.minBatchSize
+	}
+	if next != batchSize {
+		zap.S().Infow("Adjusting the batch size to the ratio of the "+
+			"recently fetched actions that were new",
+			zap.Int("previousBatchSize", batchSize),
+			zap.Int("batchSize", next), zap.Float64("newRatio", ratio))
+	}
+	return next
+}
@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// SleepDuration exposes the computed cooldown of the scheduler to tests.
+func SleepDuration(sch CodeforcesSchedulerInterface) time.Duration {
+	return sch.(*CodeforcesScheduler).sleepDuration()
+}
+
+// BatchSize exposes the current batch size of the scheduler to tests.
+func BatchSize(sch CodeforcesSchedulerInterface) int {
+	scheduler := sch.(*CodeforcesScheduler)
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	return scheduler.batchSize
+}
+
+// ActionsInserted exposes the value of the inserted actions counter to tests.
+func ActionsInserted(metrics *Metrics) float64 {
+	return testutil.ToFloat64(metrics.actionsInserted)
+}
+
+// ActionsDuplicated exposes the value of the duplicated actions counter to
+// tests.
+func ActionsDuplicated(metrics *Metrics) float64 {
+	return testutil.ToFloat64(metrics.actionsDuplicated)
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// kMaxHydratedBlogEntries bounds the number of blog entries cached by the
+// hydrator. The cache is cleared once it is full, which is simpler than an
+// eviction policy, and only costs a few extra calls.
+const kMaxHydratedBlogEntries = 1000
+
+// hydrationError aggregates the failures of the blog entries that could not
+// be hydrated, keyed by their id.
+type hydrationError map[int]error
+
+func (errs hydrationError) Error() string {
+	ids := make([]int, 0, len(errs))
+	for id := range errs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("blog entry %d: %v", id, errs[id]))
+	}
+	return fmt.Sprintf("could not hydrate %d blog entries [%s]", len(errs),
+		strings.Join(msgs, "; "))
+}
+
+// hydrator replaces the blog entries of the actions on blog entries, which
+// Codeforces returns without their content, with the full ones from
+// BlogEntryView. The comments already carry their text, and the blog entries
+// they refer to are left as is, so that the content is not copied to each of
+// them.
+// At most concurrency calls are in flight at once, and they all wait on the
+// rate limiter of the client, hence the hydration never trips the call limit
+// but spends the budget shared with the rest of the scheduler.
+type hydrator struct {
+	cfClient    cfapi.CodeforcesAPI
+	concurrency int
+
+	// cache holds the hydrated blog entries by id, which stay valid till the
+	// blog entry is modified again. The mutex guards it.
+	mutex sync.Mutex
+	cache map[int]models.BlogEntry
+}
+
+func newHydrator(cfClient cfapi.CodeforcesAPI, concurrency int) *hydrator {
+	return &hydrator{
+		cfClient:    cfClient,
+		concurrency: concurrency,
+		cache:       make(map[int]models.BlogEntry),
+	}
+}
+
+// cached returns the hydrated copy of the blog entry, unless it is missing or
+// stale.
+func (h *hydrator) cached(blogEntry *models.BlogEntry) (models.BlogEntry,
+	bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	full, ok := h.cache[blogEntry.Id]
+	if !ok || full.ModificationTimeSeconds < blogEntry.ModificationTimeSeconds {
+		return models.BlogEntry{}, false
+	}
+	return full, true
+}
+
+// remember caches the hydrated blog entry.
+func (h *hydrator) remember(full models.BlogEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.cache) >= kMaxHydratedBlogEntries {
+		h.cache = make(map[int]models.BlogEntry)
+	}
+	h.cache[full.Id] = full
+}
+
+// hydrate returns a copy of the actions whose blog entries are replaced by the
+// full ones, each of them being fetched at most once. The actions whose blog
+// entry could not be fetched are returned as is, and the failures are
+// aggregated in the returned hydrationError, so that a single failure doesn't
+// hold up the whole batch.
+func (h *hydrator) hydrate(ctx context.Context,
+	actions []models.RecentAction) ([]models.RecentAction, error) {
+	full := make(map[int]models.BlogEntry)
+	var pending []int
+	for _, action := range actions {
+		if action.Kind() != models.ActionKindBlogEntry {
+			continue
+		}
+		id := action.BlogEntry.Id
+		if _, ok := full[id]; ok {
+			continue
+		}
+		if blogEntry, ok := h.cached(action.BlogEntry); ok {
+			full[id] = blogEntry
+			continue
+		}
+		// A placeholder marks the blog entry as pending, so that it is only
+		// fetched once.
+		full[id] = models.BlogEntry{}
+		pending = append(pending, id)
+	}
+
+	var mutex sync.Mutex
+	errs := make(hydrationError)
+	ids := make(chan int)
+	var wg sync.WaitGroup
+	workers := h.concurrency
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				blogEntry, err := h.cfClient.BlogEntryView(ctx, id)
+
+				mutex.Lock()
+				if err != nil {
+					errs[id] = err
+					delete(full, id)
+				} else {
+					full[id] = blogEntry
+				}
+				mutex.Unlock()
+
+				if err == nil {
+					h.remember(blogEntry)
+				}
+			}
+		}()
+	}
+	for _, id := range pending {
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+
+	res := make([]models.RecentAction, len(actions))
+	for ind, action := range actions {
+		res[ind] = action
+		if action.Kind() != models.ActionKindBlogEntry {
+			continue
+		}
+		if blogEntry, ok := full[action.BlogEntry.Id]; ok {
+			res[ind].BlogEntry = &blogEntry
+		}
+	}
+	zap.S().Infow("Hydrated the blog entries", zap.Int("hydrated", len(full)),
+		zap.Int("fetched", len(pending)-len(errs)),
+		zap.Int("failed", len(errs)))
+
+	if len(errs) > 0 {
+		return res, errs
+	}
+	return res, nil
+}
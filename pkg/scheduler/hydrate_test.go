@@ -0,0 +1,158 @@
+package scheduler_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi/mock"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/scheduler"
+	"github.com/variety-jones/cfrss/pkg/store/memory"
+)
+
+// slowBlogClient serves the blog entries of the mock after a delay, and
+// records the maximum number of calls in flight.
+type slowBlogClient struct {
+	*mock.CodeforcesClient
+
+	views, inFlight, maxInFlight int32
+}
+
+func (client *slowBlogClient) BlogEntryView(ctx context.Context,
+	blogEntryId int) (models.BlogEntry, error) {
+	atomic.AddInt32(&client.views, 1)
+	current := atomic.AddInt32(&client.inFlight, 1)
+	defer atomic.AddInt32(&client.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&client.maxInFlight)
+		if current <= max || atomic.CompareAndSwapInt32(&client.maxInFlight,
+			max, current) {
+			break
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	return client.CodeforcesClient.BlogEntryView(ctx, blogEntryId)
+}
+
+var _ = Describe("Hydration", func() {
+	newBlogEntry := func(ts int64, id int) models.RecentAction {
+		return models.RecentAction{
+			TimeSeconds: ts,
+			BlogEntry:   &models.BlogEntry{Id: id, AuthorHandle: "tourist"},
+		}
+	}
+	ctx := context.Background()
+
+	It("should hydrate the blog entries with bounded concurrency", func() {
+		cfStore := memory.NewMemoryStore()
+		cfClient := &slowBlogClient{CodeforcesClient: mock.NewCodeforcesClient()}
+
+		var actions []models.RecentAction
+		for id := 1; id <= 10; id++ {
+			actions = append(actions, newBlogEntry(int64(100-id), id))
+			cfClient.SetBlogEntries(models.BlogEntry{
+				Id:           id,
+				AuthorHandle: "tourist",
+				Content:      "<p>Full content</p>",
+			})
+		}
+		// The comments carry their text, hence their blog entry is not
+		// hydrated.
+		actions = append(actions, models.RecentAction{
+			TimeSeconds: 100,
+			BlogEntry:   &models.BlogEntry{Id: 1},
+			Comment:     &models.Comment{Id: 1, Text: "Nice"},
+		})
+		cfClient.Push(mock.Response{Actions: actions},
+			mock.Response{Actions: actions})
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithHydration(3))
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(atomic.LoadInt32(&cfClient.views)).Should(Equal(int32(10)))
+		Expect(atomic.LoadInt32(&cfClient.maxInFlight)).Should(
+			And(BeNumerically(">", 1), BeNumerically("<=", 3)))
+
+		blogEntry, err := cfStore.GetRecentAction(ctx, "5-0")
+		Expect(err).Should(BeNil())
+		Expect(blogEntry.BlogEntry.Content).Should(Equal("<p>Full content</p>"))
+		comment, err := cfStore.GetRecentAction(ctx, "1-1")
+		Expect(err).Should(BeNil())
+		Expect(comment.BlogEntry.Content).Should(BeEmpty())
+	})
+
+	It("should persist the blog entries that could not be hydrated", func() {
+		cfStore := memory.NewMemoryStore()
+		cfClient := &slowBlogClient{CodeforcesClient: mock.NewCodeforcesClient()}
+		cfClient.SetBlogEntries(models.BlogEntry{Id: 1, Content: "Full"})
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newBlogEntry(20, 2), newBlogEntry(10, 1),
+		}})
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithHydration(2))
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Stats(ctx).LastInsertedTimestamp).Should(Equal(int64(20)))
+
+		hydrated, err := cfStore.GetRecentAction(ctx, "1-0")
+		Expect(err).Should(BeNil())
+		Expect(hydrated.BlogEntry.Content).Should(Equal("Full"))
+		missing, err := cfStore.GetRecentAction(ctx, "2-0")
+		Expect(err).Should(BeNil())
+		Expect(missing.BlogEntry.AuthorHandle).Should(Equal("tourist"))
+		Expect(missing.BlogEntry.Content).Should(BeEmpty())
+	})
+
+	It("should only fetch the blog entries modified since", func() {
+		cfStore := memory.NewMemoryStore()
+		cfClient := &slowBlogClient{CodeforcesClient: mock.NewCodeforcesClient()}
+		cfClient.SetBlogEntries(models.BlogEntry{Id: 1, Content: "Full"})
+
+		edited := newBlogEntry(30, 1)
+		edited.BlogEntry.ModificationTimeSeconds = 30
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{newBlogEntry(10, 1)}},
+			mock.Response{Actions: []models.RecentAction{newBlogEntry(20, 1)}},
+			mock.Response{Actions: []models.RecentAction{edited}},
+		)
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithHydration(1))
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(atomic.LoadInt32(&cfClient.views)).Should(Equal(int32(1)))
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(atomic.LoadInt32(&cfClient.views)).Should(Equal(int32(2)))
+	})
+
+	It("should not hydrate by default", func() {
+		cfClient := &slowBlogClient{CodeforcesClient: mock.NewCodeforcesClient()}
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newBlogEntry(10, 1),
+		}})
+
+		sch := scheduler.NewScheduler(cfClient, memory.NewMemoryStore(), 100,
+			time.Second)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(atomic.LoadInt32(&cfClient.views)).Should(BeZero())
+	})
+
+	It("should not hydrate on a dry run", func() {
+		cfClient := &slowBlogClient{CodeforcesClient: mock.NewCodeforcesClient()}
+		cfClient.SetBlogEntries(models.BlogEntry{Id: 1, Content: "Full"})
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newBlogEntry(10, 1),
+		}})
+
+		sch := scheduler.NewScheduler(cfClient, memory.NewMemoryStore(), 100,
+			time.Second, scheduler.WithHydration(1), scheduler.WithDryRun())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(atomic.LoadInt32(&cfClient.views)).Should(BeZero())
+	})
+})
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	kMetricsNamespace = "cfrss"
+	kMetricsSubsystem = "scheduler"
+)
+
+// Metrics is the set of prometheus metrics updated by the scheduler on each
+// cycle.
+type Metrics struct {
+	apiCalls              prometheus.Counter
+	apiErrors             prometheus.Counter
+	actionsInserted       prometheus.Counter
+	actionsSkipped        prometheus.Counter
+	actionsDuplicated     prometheus.Counter
+	insertLatency         prometheus.Histogram
+	lastInsertedTimestamp prometheus.Gauge
+}
+
+// NewMetrics creates the scheduler metrics and registers them with the
+// registerer. If the registerer is nil, the metrics are updated but never
+// exported, which is handy in tests.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		apiCalls: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "api_calls_total",
+			Help:      "Number of calls made to the Codeforces API.",
+		}),
+		apiErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "api_errors_total",
+			Help:      "Number of calls to the Codeforces API that failed.",
+		}),
+		actionsInserted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "actions_inserted_total",
+			Help:      "Number of recent actions persisted to the store.",
+		}),
+		actionsSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "actions_skipped_total",
+			Help: "Number of fetched recent actions skipped since they " +
+				"were already persisted.",
+		}),
+		actionsDuplicated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "actions_duplicated_total",
+			Help: "Number of new recent actions the store already had, " +
+				"e.g, persisted by another instance, or only edited.",
+		}),
+		insertLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "insert_latency_seconds",
+			Help:      "Time taken to persist a batch of recent actions.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		lastInsertedTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: kMetricsNamespace,
+			Subsystem: kMetricsSubsystem,
+			Name:      "last_inserted_timestamp_seconds",
+			Help:      "Activity time of the newest persisted recent action.",
+		}),
+	}
+
+	if reg != nil {
+		reg.MustRegister(m.apiCalls, m.apiErrors, m.actionsInserted,
+			m.actionsSkipped, m.actionsDuplicated, m.insertLatency,
+			m.lastInsertedTimestamp)
+	}
+	return m
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Option customizes the scheduler created by NewScheduler.
+type Option func(sch *CodeforcesScheduler)
+
+// WithJitter shifts each cooldown randomly by up to the given fraction in
+// either direction, e.g, 0.1 sleeps anywhere between 90% and 110% of the
+// cooldown. It prevents multiple instances from polling in sync. Fractions
+// outside [0, 1) are ignored, since they could make the cooldown negative.
+func WithJitter(fraction float64) Option {
+	return func(sch *CodeforcesScheduler) {
+		if fraction < 0 || fraction >= 1 {
+			zap.S().Errorw("Ignoring an invalid jitter",
+				zap.Float64("fraction", fraction))
+			return
+		}
+		sch.jitterFraction = fraction
+	}
+}
+
+// WithRandom overrides the source of randomness used for jitter. It should
+// return a number in [0, 1), just like rand.Float64.
+func WithRandom(random func() float64) Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.random = random
+	}
+}
+
+// WithMaxCooldown caps the cooldown, which is doubled after each consecutive
+// failed cycle and reset after a successful one. By default, it is capped at
+// eight times the cooldown. A cap below the cooldown disables the backoff.
+func WithMaxCooldown(maxCooldown time.Duration) Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.maxCooldown = maxCooldown
+	}
+}
+
+// WithCycleTimeout bounds the combined fetch and persist time of each cycle,
+// independently of the timeout of the Codeforces client, so that a slow store
+// can't stall the loop. A cycle that exceeds it is abandoned, and the next one
+// starts after the usual cooldown. By default, the timeout is the cooldown,
+// and a non-positive timeout disables it.
+func WithCycleTimeout(timeout time.Duration) Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.cycleTimeout = timeout
+	}
+}
+
+// WithDryRun fetches and filters the actions as usual, but only logs the
+// ones that would be inserted. Neither the store nor the cursor is updated,
+// hence every cycle reports the actions since the last persisted one.
+func WithDryRun() Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.dryRun = true
+	}
+}
+
+// WithFutureTolerance overrides how far ahead of the clock the actions may be
+// dated. The actions dated further ahead, e.g, because of bad data or of a
+// skewed clock, are dropped with a warning instead of moving the cursor past
+// all the actions till then. A non-positive tolerance disables the check.
+func WithFutureTolerance(tolerance time.Duration) Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.futureTolerance = tolerance
+	}
+}
+
+// WithOldestFirst sorts the new actions of each cycle oldest first before
+// they are inserted and passed to the hook, instead of newest first as
+// Codeforces lists them, e.g, for a hook that publishes them in order.
+func WithOldestFirst() Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.oldestFirst = true
+	}
+}
+
+// WithAdaptiveBatchSize adjusts the batch size between the bounds, starting
+// from the one given to NewScheduler. It doubles when nearly all the actions
+// fetched in the recent cycles were new, which suggests that some were missed
+// between the cycles, and halves when few of them were. By default, the batch
+// size is fixed.
+func WithAdaptiveBatchSize(minBatchSize, maxBatchSize int) Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.adaptive = &adaptiveBatchSize{
+			minBatchSize: minBatchSize,
+			maxBatchSize: maxBatchSize,
+		}
+	}
+}
+
+// WithMetrics sets the metrics updated by the scheduler on each cycle. By
+// default, or if the metrics are nil, the metrics aren't registered anywhere.
+func WithMetrics(metrics *Metrics) Option {
+	return func(sch *CodeforcesScheduler) {
+		if metrics == nil {
+			return
+		}
+		sch.metrics = metrics
+	}
+}
+
+// WithOnNewActions registers a hook invoked after each successful insertion,
+// with only the newly inserted actions. The hook runs within the cycle, hence
+// a slow hook delays the subsequent cycles. It is also invoked by the
+// additional pollers, possibly concurrently.
+func WithOnNewActions(hook NewActionsHook) Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.onNewActions = hook
+	}
+}
+
+// WithPollers polls the given endpoints concurrently with the recent actions,
+// each on its own cooldown and with its own cursor. The pollers without a
+// fetch function or a positive cooldown are skipped with an error, since they
+// would poll in a busy loop.
+func WithPollers(configs ...PollerConfig) Option {
+	return func(sch *CodeforcesScheduler) {
+		for _, config := range configs {
+			if config.Fetch == nil || config.Cooldown <= 0 {
+				zap.S().Errorw("Skipping an invalid poller",
+					zap.String("poller", config.Name),
+					zap.Duration("cooldown", config.Cooldown))
+				continue
+			}
+			sch.pollers = append(sch.pollers, &poller{PollerConfig: config})
+		}
+	}
+}
+
+// WithHydration fetches the full content of the new blog entries before they
+// are persisted, with at most concurrency calls in flight. The calls are rate
+// limited by the client, like all the others. The blog entries that could not
+// be fetched are persisted without their content. A non-positive concurrency
+// disables the hydration, which is the default.
+func WithHydration(concurrency int) Option {
+	return func(sch *CodeforcesScheduler) {
+		sch.hydrationConcurrency = concurrency
+	}
+}
@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// FetchFunc fetches a batch of actions from Codeforces, e.g, the blog entries
+// of a specific user converted to recent actions.
+type FetchFunc func(ctx context.Context) ([]models.RecentAction, error)
+
+// PollerConfig describes an additional endpoint polled by the scheduler,
+// next to the recent actions.
+type PollerConfig struct {
+	// Name identifies the poller in the logs.
+	Name string
+
+	Fetch    FetchFunc
+	Cooldown time.Duration
+}
+
+// BlogEntryPoller returns the config of a poller fetching all the comments of
+// the blog entry, e.g, of an announcement, on its own cooldown, so that the
+// comments missed by the recent actions during a busy contest are caught up.
+func BlogEntryPoller(cfClient cfapi.CodeforcesAPI, blogEntryId int,
+	cooldown time.Duration) PollerConfig {
+	return PollerConfig{
+		Name:     fmt.Sprintf("blogEntry/%d", blogEntryId),
+		Cooldown: cooldown,
+		Fetch: func(ctx context.Context) ([]models.RecentAction, error) {
+			blogEntry, err := cfClient.BlogEntryView(ctx, blogEntryId)
+			if err != nil {
+				return nil, err
+			}
+			comments, err := cfClient.BlogEntryComments(ctx, blogEntryId)
+			if err != nil {
+				return nil, err
+			}
+
+			// The comments are dated by their creation, just like the recent
+			// actions of the comments that were never edited.
+			actions := make([]models.RecentAction, 0, len(comments))
+			for ind := range comments {
+				entry := blogEntry
+				actions = append(actions, models.RecentAction{
+					TimeSeconds: comments[ind].CreationTimeSeconds,
+					BlogEntry:   &entry,
+					Comment:     &comments[ind],
+				})
+			}
+			return actions, nil
+		},
+	}
+}
+
+// poller polls a single endpoint on its own cooldown. The actions it fetches
+// are persisted to the same store as the recent actions.
+type poller struct {
+	PollerConfig
+
+	// lastInsertedTimestamp is the cursor of the poller. It is only accessed
+	// by the goroutine running the poller, and starts from zero since the
+	// store skips the duplicates anyway. boundaryIds are the ids of the
+	// actions seen at the cursor, see filterNewActions.
+	lastInsertedTimestamp int64
+	boundaryIds           map[string]bool
+}
+
+// filterNewActions returns the actions that happened at or after the cursor,
+// in their order in actions, along with the cursor after inserting them.
+//
+// The cycles overlap at the cursor, since more actions may happen within the
+// same second after a cycle. The actions at the cursor whose ids are in
+// boundaryIds were seen by the previous cycle and are dropped. The ids of the
+// actions at the returned cursor are returned for the next cycle. When
+// boundaryIds is empty, e.g, after a restart, the store skips the duplicates.
+func filterNewActions(actions []models.RecentAction, cursor int64,
+	boundaryIds map[string]bool) ([]models.RecentAction, int64,
+	map[string]bool) {
+	maxTimestampAfterInsertion := cursor
+	for _, action := range actions {
+		if action.TimeSeconds > maxTimestampAfterInsertion {
+			maxTimestampAfterInsertion = action.TimeSeconds
+		}
+	}
+
+	nextBoundaryIds := make(map[string]bool)
+	if maxTimestampAfterInsertion == cursor {
+		for id := range boundaryIds {
+			nextBoundaryIds[id] = true
+		}
+	}
+
+	var newActions []models.RecentAction
+	for _, action := range actions {
+		now := action.TimeSeconds
+		if now < cursor {
+			continue
+		}
+		id := action.Id()
+		if now == maxTimestampAfterInsertion {
+			nextBoundaryIds[id] = true
+		}
+		if now == cursor && boundaryIds[id] {
+			continue
+		}
+		newActions = append(newActions, action)
+	}
+	return newActions, maxTimestampAfterInsertion, nextBoundaryIds
+}
+
+// dropFutureActions returns the actions dated at most tolerance ahead of the
+// clock, and warns about the others, e.g, because of bad data or of a skewed
+// clock. A non-positive tolerance keeps all the actions.
+func dropFutureActions(actions []models.RecentAction,
+	tolerance time.Duration) []models.RecentAction {
+	if tolerance <= 0 {
+		return actions
+	}
+
+	limit := time.Now().Add(tolerance).Unix()
+	res := make([]models.RecentAction, 0, len(actions))
+	for _, action := range actions {
+		if action.TimeSeconds > limit {
+			zap.S().Warnw("Dropping an action dated in the future",
+				zap.String("id", action.Id()),
+				zap.Int64("timestamp", action.TimeSeconds),
+				zap.Duration("tolerance", tolerance))
+			continue
+		}
+		res = append(res, action)
+	}
+	return res
+}
+
+// sortOldestFirst returns a copy of the actions, which Codeforces lists
+// newest first, sorted by their activity time, oldest first. The actions of
+// the same second are reversed, so that they are in chronological order too.
+func sortOldestFirst(actions []models.RecentAction) []models.RecentAction {
+	res := make([]models.RecentAction, len(actions))
+	for ind, action := range actions {
+		res[len(actions)-1-ind] = action
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].TimeSeconds < res[j].TimeSeconds
+	})
+	return res
+}
+
+// logDryRun logs the actions that a dry run would have inserted.
+func logDryRun(source string, actions []models.RecentAction) {
+	zap.S().Infow("Dry run would insert the actions",
+		zap.String("source", source), zap.Int("inserted", len(actions)))
+	for _, action := range actions {
+		zap.S().Infow("Dry run would insert an action",
+			zap.String("source", source),
+			zap.Stringer("kind", action.Kind()),
+			zap.Int64("timestamp", action.TimeSeconds),
+			zap.String("link", action.PermalinkURL()))
+	}
+}
+
+// syncPoller runs a single fetch-filter-persist cycle of the poller.
+func (sch *CodeforcesScheduler) syncPoller(ctx context.Context,
+	p *poller) error {
+	actions, err := p.Fetch(ctx)
+	if errors.Is(err, cfapi.ErrCircuitOpen) {
+		zap.S().Infow("Skipping the cycle of the poller since Codeforces "+
+			"is unavailable", zap.String("poller", p.Name))
+		return nil
+	}
+	if err != nil {
+		return errors.Errorf("poller %s failed to fetch with error [%v]",
+			p.Name, err)
+	}
+
+	newActions, maxTimestampAfterInsertion, boundaryIds := filterNewActions(
+		dropFutureActions(actions, sch.futureTolerance),
+		p.lastInsertedTimestamp, p.boundaryIds)
+	if sch.oldestFirst {
+		newActions = sortOldestFirst(newActions)
+	}
+	zap.S().Infow("Fetched the actions of the poller",
+		zap.String("poller", p.Name), zap.Int("fetched", len(actions)),
+		zap.Int("new", len(newActions)))
+	if sch.dryRun {
+		logDryRun("poller "+p.Name, newActions)
+		return nil
+	}
+
+	persistCtx, cancel := persistContext(ctx)
+	defer cancel()
+	if _, err := sch.cfStore.AddRecentActions(persistCtx,
+		newActions); err != nil {
+		return errors.Errorf("poller %s failed to insert with error [%v]",
+			p.Name, err)
+	}
+	previousCursor := p.lastInsertedTimestamp
+	p.lastInsertedTimestamp = maxTimestampAfterInsertion
+	p.boundaryIds = boundaryIds
+	zap.S().Infow("Persisted the new actions of the poller",
+		zap.String("poller", p.Name), zap.Int("inserted", len(newActions)),
+		zap.Int64("previousCursor", previousCursor),
+		zap.Int64("cursor", p.lastInsertedTimestamp))
+
+	if sch.onNewActions != nil && len(newActions) > 0 {
+		if err := sch.onNewActions(ctx, newActions); err != nil {
+			zap.S().Errorw("Hook on the new actions of the poller failed",
+				zap.String("poller", p.Name),
+				zap.Int("inserted", len(newActions)), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// runPoller runs the cycles of the poller till the context is cancelled,
+// with the same guarantees as Start.
+func (sch *CodeforcesScheduler) runPoller(ctx context.Context, p *poller) {
+	for {
+		cycleCtx, cancel := context.WithTimeout(ctx, p.Cooldown)
+		if err := sch.syncPoller(cycleCtx, p); err != nil {
+			zap.S().Errorw("Poller failed", zap.String("poller", p.Name),
+				zap.Error(err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			zap.S().Infow("Stopping the poller", zap.String("poller", p.Name),
+				zap.Int64("cursor", p.lastInsertedTimestamp))
+			return
+		case <-time.After(p.Cooldown):
+		}
+	}
+}
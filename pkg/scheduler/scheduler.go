@@ -1,6 +1,8 @@
 package scheduler
 
 import (
+	"context"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -12,86 +14,499 @@ import (
 	"github.com/variety-jones/cfrss/pkg/store"
 )
 
+// errCycleSkipped is returned by sync when the cycle was skipped without
+// failing, e.g, while the circuit breaker of the client is open.
+var errCycleSkipped = errors.New("cycle skipped")
+
+const (
+	// kDefaultMaxCooldownFactor caps the backoff on consecutive failures as a
+	// multiple of the cooldown.
+	kDefaultMaxCooldownFactor = 8
+
+	// kDefaultFutureTolerance is how far ahead of the clock an action may
+	// be, unless overridden by WithFutureTolerance.
+	kDefaultFutureTolerance = 10 * time.Minute
+)
+
+// NewActionsHook is invoked with the actions inserted by a cycle, e.g, to
+// push them to a message queue. Its error is logged, but doesn't fail the
+// cycle since the actions are already persisted.
+type NewActionsHook func(ctx context.Context,
+	actions []models.RecentAction) error
+
 type CodeforcesSchedulerInterface interface {
 	// Sync makes a single API call to Codeforces and stores the result in store.
-	Sync() error
+	Sync(ctx context.Context) error
+
+	// Start runs Sync in a loop with a cooldown period, till the context is
+	// cancelled. The cycle in progress is always allowed to finish, so that
+	// the persisted actions and the cursor stay consistent.
+	Start(ctx context.Context)
+
+	// RunOnce performs exactly one fetch-filter-persist cycle of the recent
+	// actions and of each additional poller, and returns the first error,
+	// for deployments that schedule the ingestion externally, e.g, as a cron
+	// job.
+	RunOnce(ctx context.Context) error
+
+	// LastSuccessfulSync returns the time at which the last successful cycle
+	// completed, or the creation time of the scheduler if none has.
+	LastSuccessfulSync() time.Time
 
-	// Start runs Sync in an infinite loop with a cooldown period.
-	Start()
+	// Cooldown returns the base cooldown between two cycles.
+	Cooldown() time.Duration
+
+	// StaleAfter returns the longest time between two successful cycles of
+	// Start, barring failures past the maximum backoff, i.e, the maximum
+	// backoff after the jitter, plus the cycle timeout.
+	StaleAfter() time.Duration
+
+	// Stats returns a snapshot of the state of the scheduler, for
+	// troubleshooting.
+	Stats(ctx context.Context) Stats
+}
+
+// Stats is a snapshot of the state of the scheduler.
+type Stats struct {
+	LastInsertedTimestamp int64     `json:"lastInsertedTimestamp"`
+	LastSuccessfulSync    time.Time `json:"lastSuccessfulSync"`
+	ConsecutiveFailures   int       `json:"consecutiveFailures"`
+	BatchSize             int       `json:"batchSize"`
+
+	// Cooldown is the base cooldown, and CurrentCooldown is the one after
+	// backing off on the consecutive failures, before the jitter.
+	Cooldown        time.Duration `json:"cooldown"`
+	CurrentCooldown time.Duration `json:"currentCooldown"`
+
+	// StoredActions is the number of actions in the store, or -1 if they
+	// could not be counted.
+	StoredActions int64 `json:"storedActions"`
 }
 
 // CodeforcesScheduler is the scheduler that persists recent actions data to
 // Codeforces store periodically.
 type CodeforcesScheduler struct {
-	mutex                 sync.Mutex
+	// syncMutex serializes the cycles, and is held for their whole duration.
+	// mutex guards the state of the scheduler, i.e, the cursor, the batch
+	// size, the failures and the last successful sync, and is only held
+	// briefly, so that Stats doesn't wait for a cycle in progress. The state
+	// is only written by the cycles, which may read it without mutex.
+	syncMutex sync.Mutex
+	mutex     sync.Mutex
+
 	cfClient              cfapi.CodeforcesAPI
 	cfStore               store.CodeforcesStore
 	cooldown              time.Duration
 	lastInsertedTimestamp int64
 	batchSize             int
+
+	// adaptive adjusts batchSize after each cycle, unless it is nil.
+	adaptive *adaptiveBatchSize
+
+	// boundaryIds are the ids of the actions persisted at exactly
+	// lastInsertedTimestamp, see filterNewActions.
+	boundaryIds map[string]bool
+
+	// jitterFraction is the maximum fraction by which the cooldown is
+	// randomly shifted, and random is the source of that randomness.
+	jitterFraction float64
+	random         func() float64
+
+	// consecutiveFailures is the number of cycles that failed since the last
+	// successful one. The cooldown is doubled for each of them, till it
+	// reaches maxCooldown.
+	consecutiveFailures int
+	maxCooldown         time.Duration
+
+	// cycleTimeout bounds the combined fetch and persist time of a cycle of
+	// Start. It defaults to the cooldown.
+	cycleTimeout time.Duration
+
+	// dryRun skips the persistence, see WithDryRun.
+	dryRun bool
+
+	// oldestFirst sorts the new actions oldest first, see WithOldestFirst.
+	oldestFirst bool
+
+	// futureTolerance is how far ahead of the clock an action may be, see
+	// WithFutureTolerance.
+	futureTolerance time.Duration
+
+	// hydrationConcurrency is the number of blog entries hydrated at once,
+	// see WithHydration, and hydrator is nil unless it is positive.
+	hydrationConcurrency int
+	hydrator             *hydrator
+
+	metrics *Metrics
+
+	// onNewActions is nil unless a hook was registered with WithOnNewActions.
+	onNewActions NewActionsHook
+
+	// pollers are the additional endpoints polled next to the recent
+	// actions, each on its own cooldown.
+	pollers []*poller
+
+	// lastSuccessfulSync is the time at which the last successful cycle
+	// completed.
+	lastSuccessfulSync time.Time
 }
 
 // filter scans the list of recent actions and removes the one that are stale,
-// i,e, the ones that are already in the store.
+// i,e, the ones that are already in the store. The new actions keep the order
+// of Codeforces, i.e, newest first, unless oldestFirst is set. The actions
+// dated too far in the future are dropped, since they would move the cursor
+// past all the actions till then.
+//
+// The cursor only tracks the activity time, hence the edits that Codeforces
+// reports with a bumped activity time pass the filter, and replace the stored
+// copy, see AddRecentActions. The edits of an action older than the cursor
+// that don't bump its activity time, e.g, of the content of a blog entry, are
+// filtered out, and are only picked up by a later import.
 func (sch *CodeforcesScheduler) filter(actions []models.RecentAction) (
-	[]models.RecentAction, int64) {
-	maxTimestampAfterInsertion := sch.lastInsertedTimestamp
-	var newActions []models.RecentAction
+	[]models.RecentAction, int64, map[string]bool) {
+	newActions, maxTimestampAfterInsertion, boundaryIds := filterNewActions(
+		dropFutureActions(actions, sch.futureTolerance),
+		sch.lastInsertedTimestamp, sch.boundaryIds)
+	if sch.oldestFirst {
+		newActions = sortOldestFirst(newActions)
+	}
+	return newActions, maxTimestampAfterInsertion, boundaryIds
+}
+
+// warnOnGap logs a warning if the fetched actions don't reach back to the
+// cursor, since Codeforces only returns the newest batchSize actions, and the
+// ones in between were pushed out of the window by a burst of activity.
+func (sch *CodeforcesScheduler) warnOnGap(actions []models.RecentAction) {
+	if sch.lastInsertedTimestamp == 0 || len(actions) < sch.batchSize {
+		return
+	}
 	for _, action := range actions {
-		now := action.TimeSeconds
-		if now > maxTimestampAfterInsertion {
-			maxTimestampAfterInsertion = now
-		}
-		if now > sch.lastInsertedTimestamp {
-			newActions = append(newActions, action)
+		if action.TimeSeconds <= sch.lastInsertedTimestamp {
+			return
 		}
 	}
-	return newActions, maxTimestampAfterInsertion
+	zap.S().Warnw("All the fetched actions are newer than the cursor, "+
+		"some actions might have been missed",
+		zap.Int("fetched", len(actions)),
+		zap.Int64("cursor", sch.lastInsertedTimestamp))
+}
+
+func (sch *CodeforcesScheduler) Sync(ctx context.Context) error {
+	sch.syncMutex.Lock()
+	defer sch.syncMutex.Unlock()
+
+	err := sch.sync(ctx)
+	// A skipped cycle neither backs off nor counts as a success, so that the
+	// health check still reports the outage.
+	if errors.Is(err, errCycleSkipped) {
+		return nil
+	}
+
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+	if err != nil {
+		sch.consecutiveFailures++
+		return err
+	}
+	sch.consecutiveFailures = 0
+	sch.lastSuccessfulSync = time.Now()
+	return nil
+}
+
+func (sch *CodeforcesScheduler) LastSuccessfulSync() time.Time {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+
+	return sch.lastSuccessfulSync
+}
+
+// cursor returns the timestamp till which the actions were persisted.
+func (sch *CodeforcesScheduler) cursor() int64 {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+
+	return sch.lastInsertedTimestamp
+}
+
+func (sch *CodeforcesScheduler) Cooldown() time.Duration {
+	return sch.cooldown
+}
+
+func (sch *CodeforcesScheduler) StaleAfter() time.Duration {
+	sleep := sch.maxCooldown
+	if sleep < sch.cooldown {
+		sleep = sch.cooldown
+	}
+	if sch.jitterFraction > 0 {
+		sleep = time.Duration(float64(sleep) * (1 + sch.jitterFraction))
+	}
+
+	// An unbounded cycle is expected to take no longer than a cooldown.
+	cycle := sch.cycleTimeout
+	if cycle <= 0 {
+		cycle = sch.cooldown
+	}
+	return sleep + cycle
 }
 
-func (sch *CodeforcesScheduler) Sync() error {
+func (sch *CodeforcesScheduler) Stats(ctx context.Context) Stats {
+	// The store is counted before taking the mutex, so that a slow store
+	// doesn't hold up the cycles.
+	storedActions, err := sch.cfStore.CountRecentActions(ctx)
+	if err != nil {
+		zap.S().Errorw("Could not count the actions", zap.Error(err))
+		storedActions = -1
+	}
+
 	sch.mutex.Lock()
 	defer sch.mutex.Unlock()
 
-	actions, err := sch.cfClient.RecentActions(sch.batchSize)
+	return Stats{
+		LastInsertedTimestamp: sch.lastInsertedTimestamp,
+		LastSuccessfulSync:    sch.lastSuccessfulSync,
+		ConsecutiveFailures:   sch.consecutiveFailures,
+		BatchSize:             sch.batchSize,
+		Cooldown:              sch.cooldown,
+		CurrentCooldown:       sch.backoffCooldown(),
+		StoredActions:         storedActions,
+	}
+}
+
+// sync is the implementation of Sync, and it expects syncMutex to be held.
+func (sch *CodeforcesScheduler) sync(ctx context.Context) error {
+	zap.S().Infow("Starting a cycle", zap.Int("batchSize", sch.batchSize),
+		zap.Int64("cursor", sch.cursor()))
+
+	actions, err := sch.cfClient.RecentActions(ctx, sch.batchSize)
+	if errors.Is(err, cfapi.ErrCircuitOpen) {
+		zap.S().Infow("Skipping the cycle since Codeforces is unavailable")
+		return errCycleSkipped
+	}
+	sch.metrics.apiCalls.Inc()
 	if err != nil {
+		sch.metrics.apiErrors.Inc()
+		var callLimitErr *cfapi.CallLimitError
+		if errors.As(err, &callLimitErr) {
+			zap.S().Warnw("Codeforces rate limited the scheduler",
+				zap.String("comment", callLimitErr.Comment))
+		}
 		return errors.Errorf("codeforces query failed with error [%v]", err)
 	}
 
-	newActions, maxTimestampAfterInsertion := sch.filter(actions)
-	if err := sch.cfStore.AddRecentActions(newActions); err != nil {
+	sch.warnOnGap(actions)
+	newActions, maxTimestampAfterInsertion, boundaryIds := sch.filter(actions)
+	zap.S().Infow("Fetched the recent actions", zap.Int("fetched", len(actions)),
+		zap.Int("new", len(newActions)))
+	sch.metrics.actionsSkipped.Add(float64(len(actions) - len(newActions)))
+	if sch.adaptive != nil {
+		batchSize := sch.adaptive.next(sch.batchSize, len(actions),
+			len(newActions))
+		sch.mutex.Lock()
+		sch.batchSize = batchSize
+		sch.mutex.Unlock()
+	}
+
+	if sch.dryRun {
+		logDryRun("recent actions", newActions)
+		return nil
+	}
+
+	// The actions are persisted even if some of them could not be hydrated,
+	// otherwise a single missing blog entry would stall the cursor. A dry
+	// run doesn't spend the calls to Codeforces on them.
+	if sch.hydrator != nil {
+		newActions, err = sch.hydrator.hydrate(ctx, newActions)
+		if err != nil {
+			zap.S().Warnw("Persisting the actions partially hydrated",
+				zap.Error(err))
+		}
+	}
+
+	// The persisting is shielded from a shutdown, so that it is never aborted
+	// midway, but it still has the deadline of the cycle.
+	persistCtx, cancel := persistContext(ctx)
+	defer cancel()
+	insertStart := time.Now()
+	inserted, err := sch.cfStore.AddRecentActions(persistCtx, newActions)
+	if err != nil {
 		return errors.Errorf("mongo insertion failed with error [%v]", err)
 	}
+	sch.metrics.insertLatency.Observe(time.Since(insertStart).Seconds())
+	sch.metrics.actionsInserted.Add(float64(inserted))
+	sch.metrics.actionsDuplicated.Add(float64(int64(len(newActions)) -
+		inserted))
 
 	// Do an atomic swap only when insertion is successful.
+	sch.mutex.Lock()
+	previousCursor := sch.lastInsertedTimestamp
 	sch.lastInsertedTimestamp = maxTimestampAfterInsertion
-	zap.S().Infof("Persisted activities till timestamp: %d",
-		sch.lastInsertedTimestamp)
+	sch.boundaryIds = boundaryIds
+	sch.mutex.Unlock()
+	sch.metrics.lastInsertedTimestamp.Set(float64(sch.lastInsertedTimestamp))
+	zap.S().Infow("Persisted the new actions",
+		zap.Int64("inserted", inserted),
+		zap.Int64("duplicated", int64(len(newActions))-inserted),
+		zap.Int64("previousCursor", previousCursor),
+		zap.Int64("cursor", sch.lastInsertedTimestamp))
+
+	// The actions are already persisted, and the in-memory cursor is the
+	// source of truth till the next restart, so the cycle is not failed.
+	if err := sch.cfStore.SaveCursor(persistCtx,
+		sch.lastInsertedTimestamp); err != nil {
+		zap.S().Errorw("Could not save the cursor",
+			zap.Int64("cursor", sch.lastInsertedTimestamp), zap.Error(err))
+	}
+
+	if sch.onNewActions != nil && len(newActions) > 0 {
+		if err := sch.onNewActions(ctx, newActions); err != nil {
+			zap.S().Errorw("Hook on the new actions failed",
+				zap.Int("inserted", len(newActions)), zap.Error(err))
+		}
+	}
 
 	return nil
 }
 
-func (sch *CodeforcesScheduler) Start() {
+func (sch *CodeforcesScheduler) Start(ctx context.Context) {
+	// The additional pollers run concurrently, and Start returns only after
+	// all of them have finished their current cycle.
+	var wg sync.WaitGroup
+	for _, p := range sch.pollers {
+		wg.Add(1)
+		go func(p *poller) {
+			defer wg.Done()
+			sch.runPoller(ctx, p)
+		}(p)
+	}
+	defer wg.Wait()
+
 	for {
-		if err := sch.Sync(); err != nil {
-			zap.S().Errorf("Failed to sync with codeforces with error [%+v]",
-				err)
+		// A cycle should never outlive its deadline, otherwise a stuck call
+		// would stall all the subsequent cycles. A shutdown aborts the calls
+		// to Codeforces, but not the insertion, see persistContext.
+		cycleCtx, cancel := sch.cycleContext(ctx)
+		if err := sch.Sync(cycleCtx); err != nil {
+			zap.S().Errorw("Failed to sync with codeforces", zap.Error(err))
+		}
+		if errors.Is(cycleCtx.Err(), context.DeadlineExceeded) {
+			zap.S().Warnw("Cycle exceeded its deadline, moving on to the "+
+				"next one", zap.Duration("cycleTimeout", sch.cycleTimeout))
+		}
+		cancel()
+
+		sleep := sch.sleepDuration()
+		zap.S().Infow("Sleeping till the next cycle",
+			zap.Duration("sleep", sleep))
+		select {
+		case <-ctx.Done():
+			zap.S().Infow("Stopping the scheduler",
+				zap.Int64("cursor", sch.cursor()))
+			return
+		case <-time.After(sleep):
 		}
-		zap.S().Infof("Sleeping for %v", sch.cooldown)
-		time.Sleep(sch.cooldown)
 	}
 }
 
+func (sch *CodeforcesScheduler) RunOnce(ctx context.Context) error {
+	if err := sch.Sync(ctx); err != nil {
+		return errors.Errorf("single sync with codeforces failed "+
+			"with error [%v]", err)
+	}
+	for _, p := range sch.pollers {
+		if err := sch.syncPoller(ctx, p); err != nil {
+			return errors.Errorf("single sync with codeforces failed "+
+				"with error [%v]", err)
+		}
+	}
+	zap.S().Infow("Completed a single sync", zap.Int64("cursor", sch.cursor()))
+	return nil
+}
+
+// cycleContext returns the context of a single cycle of Start, derived from
+// ctx. A non-positive cycle timeout leaves the cycle unbounded.
+func (sch *CodeforcesScheduler) cycleContext(ctx context.Context) (
+	context.Context, context.CancelFunc) {
+	if sch.cycleTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, sch.cycleTimeout)
+}
+
+// persistContext returns the context of the persisting step of a cycle. It
+// is not cancelled along with ctx, so that a shutdown doesn't abort an
+// insertion midway, but it keeps the deadline of ctx, if any.
+func persistContext(ctx context.Context) (context.Context,
+	context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(context.Background(), deadline)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// sleepDuration returns the time to wait before the next cycle.
+func (sch *CodeforcesScheduler) sleepDuration() time.Duration {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+
+	sleep := sch.backoffCooldown()
+	if sch.jitterFraction <= 0 {
+		return sleep
+	}
+	shift := (2*sch.random() - 1) * sch.jitterFraction
+	return time.Duration(float64(sleep) * (1 + shift))
+}
+
+// backoffCooldown returns the cooldown after backing off exponentially on the
+// consecutive failures, and it expects the mutex to be held.
+func (sch *CodeforcesScheduler) backoffCooldown() time.Duration {
+	cooldown := sch.cooldown
+	for ind := 0; ind < sch.consecutiveFailures; ind++ {
+		if cooldown*2 > sch.maxCooldown {
+			if cooldown < sch.maxCooldown {
+				cooldown = sch.maxCooldown
+			}
+			break
+		}
+		cooldown *= 2
+	}
+	return cooldown
+}
+
 // NewScheduler creates a new instance of the scheduler.
 func NewScheduler(cfClient cfapi.CodeforcesAPI,
 	cfStore store.CodeforcesStore, batchSize int,
-	coolDown time.Duration) CodeforcesSchedulerInterface {
+	coolDown time.Duration, opts ...Option) CodeforcesSchedulerInterface {
 	sch := new(CodeforcesScheduler)
 	sch.cfClient = cfClient
 	sch.cfStore = cfStore
 	sch.cooldown = coolDown
 	sch.batchSize = batchSize
-	sch.lastInsertedTimestamp = cfStore.LastRecordedTimestampForRecentActions()
+	sch.random = rand.Float64
+	sch.maxCooldown = kDefaultMaxCooldownFactor * coolDown
+	sch.cycleTimeout = coolDown
+	sch.futureTolerance = kDefaultFutureTolerance
+	sch.metrics = NewMetrics(nil)
+	sch.lastSuccessfulSync = time.Now()
+	for _, opt := range opts {
+		opt(sch)
+	}
+	if sch.hydrationConcurrency > 0 {
+		sch.hydrator = newHydrator(cfClient, sch.hydrationConcurrency)
+	}
+	sch.lastInsertedTimestamp = loadCursor(cfStore)
 
 	return sch
 }
+
+// loadCursor returns the saved cursor of the store, falling back to the
+// latest persisted action when no cursor was saved, e.g, by an older release.
+func loadCursor(cfStore store.CodeforcesStore) int64 {
+	cursor, err := cfStore.LoadCursor(context.TODO())
+	if err != nil {
+		zap.S().Errorw("Could not load the cursor", zap.Error(err))
+	}
+	if cursor > 0 {
+		return cursor
+	}
+	return cfStore.LastRecordedTimestampForRecentActions(context.TODO())
+}
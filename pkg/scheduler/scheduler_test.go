@@ -0,0 +1,738 @@
+package scheduler_test
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/cfapi/mock"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/scheduler"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/memory"
+)
+
+var _ = Describe("Scheduler", func() {
+	newComment := func(ts int64, commentId int) models.RecentAction {
+		return models.RecentAction{
+			TimeSeconds: ts,
+			BlogEntry:   &models.BlogEntry{Id: 1},
+			Comment:     &models.Comment{Id: commentId},
+		}
+	}
+
+	var cfStore store.CodeforcesStore
+	var cfClient *mock.CodeforcesClient
+	var sch scheduler.CodeforcesSchedulerInterface
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		cfStore = memory.NewMemoryStore()
+		cfClient = mock.NewCodeforcesClient()
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second)
+	})
+
+	storedTimestamps := func() []int64 {
+		actions, err := cfStore.QueryRecentActions(ctx, 0, 0)
+		Expect(err).Should(BeNil())
+
+		var res []int64
+		for _, action := range actions {
+			res = append(res, action.TimeSeconds)
+		}
+		return res
+	}
+
+	It("should drop the actions that are already persisted", func() {
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{
+				newComment(20, 2), newComment(10, 1),
+			}},
+			mock.Response{Actions: []models.RecentAction{
+				newComment(30, 3), newComment(20, 2), newComment(10, 1),
+			}},
+		)
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{20, 10}))
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{30, 20, 10}))
+		Expect(cfClient.Calls()).Should(Equal(2))
+	})
+
+	It("should not advance the cursor when the API fails", func() {
+		cfClient.Push(
+			mock.Response{Err: errors.New("codeforces is down")},
+			mock.Response{Actions: []models.RecentAction{newComment(10, 1)}},
+		)
+
+		Expect(sch.Sync(ctx)).ShouldNot(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{10}))
+	})
+
+	It("should keep the actions that tie with the cursor", func() {
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{
+				newComment(20, 2), newComment(10, 1),
+			}},
+			// Another comment happened within the same second as the cursor.
+			mock.Response{Actions: []models.RecentAction{
+				newComment(20, 3), newComment(20, 2), newComment(10, 1),
+			}},
+		)
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{20, 20, 10}))
+	})
+
+	It("should not drop the boundary actions on a burst", func() {
+		var burst []models.RecentAction
+		for commentId := 12; commentId >= 3; commentId-- {
+			burst = append(burst, newComment(int64(20+commentId), commentId))
+		}
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{
+				newComment(20, 2), newComment(20, 1),
+			}},
+			// More than batchSize actions happened between the cycles, so
+			// the response is truncated to the newest ones.
+			mock.Response{Actions: burst},
+			mock.Response{Actions: append([]models.RecentAction{
+				newComment(32, 13),
+			}, burst...)},
+		)
+		sch = scheduler.NewScheduler(cfClient, cfStore, 4, time.Second)
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		// The actions pushed out of the window are lost, but the ones at the
+		// cursor are neither dropped nor duplicated.
+		Expect(storedTimestamps()).Should(Equal(
+			[]int64{32, 32, 31, 30, 29, 20, 20}))
+	})
+
+	It("should advance the cursor only on successful insertion", func() {
+		actions := []models.RecentAction{newComment(20, 2), newComment(10, 1)}
+		cfClient.Push(
+			mock.Response{Actions: actions},
+			mock.Response{Actions: actions},
+		)
+
+		failingStore := &flakyStore{CodeforcesStore: cfStore, failures: 1}
+		sch = scheduler.NewScheduler(cfClient, failingStore, 100, time.Second)
+
+		Expect(sch.Sync(ctx)).ShouldNot(Succeed())
+		Expect(storedTimestamps()).Should(BeEmpty())
+
+		// The same actions are retried since the cursor did not move.
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{20, 10}))
+	})
+
+	It("should run a single cycle on RunOnce", func() {
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{newComment(10, 1)}},
+			mock.Response{Err: errors.New("codeforces is down")},
+		)
+
+		Expect(sch.RunOnce(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{10}))
+		Expect(cfClient.Calls()).Should(Equal(1))
+
+		Expect(sch.RunOnce(ctx)).ShouldNot(Succeed())
+		Expect(cfClient.Calls()).Should(Equal(2))
+	})
+
+	It("should resume from the saved cursor", func() {
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newComment(60, 3), newComment(40, 2),
+		}})
+
+		// The cursor is ahead of the actions in the store, e.g, when the
+		// older actions were purged.
+		Expect(cfStore.SaveCursor(ctx, 50)).Should(Succeed())
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second)
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{60}))
+		Expect(cfStore.LoadCursor(ctx)).Should(Equal(int64(60)))
+	})
+
+	It("should pass only the new actions to the hook", func() {
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{newComment(10, 1)}},
+			mock.Response{Actions: []models.RecentAction{
+				newComment(20, 2), newComment(10, 1),
+			}},
+		)
+
+		var hooked [][]models.RecentAction
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithOnNewActions(func(ctx context.Context,
+				actions []models.RecentAction) error {
+				hooked = append(hooked, actions)
+				return errors.New("queue is down")
+			}))
+
+		// The error of the hook doesn't fail the cycle.
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(hooked).Should(HaveLen(2))
+		Expect(hooked[1]).Should(Equal([]models.RecentAction{
+			newComment(20, 2),
+		}))
+		Expect(storedTimestamps()).Should(Equal([]int64{20, 10}))
+	})
+
+	It("should order the new actions", func() {
+		// Codeforces lists the actions newest first, and the actions 3 and 2
+		// happened within the same second.
+		response := mock.Response{Actions: []models.RecentAction{
+			newComment(30, 4), newComment(20, 3), newComment(20, 2),
+			newComment(10, 1),
+		}}
+		ids := func(actions []models.RecentAction) []int {
+			var res []int
+			for _, action := range actions {
+				res = append(res, action.Comment.Id)
+			}
+			return res
+		}
+
+		var hooked []models.RecentAction
+		hook := scheduler.WithOnNewActions(func(ctx context.Context,
+			actions []models.RecentAction) error {
+			hooked = actions
+			return nil
+		})
+
+		cfClient.Push(response)
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second, hook)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(ids(hooked)).Should(Equal([]int{4, 3, 2, 1}))
+
+		cfClient.Push(response)
+		sch = scheduler.NewScheduler(cfClient, memory.NewMemoryStore(), 100,
+			time.Second, hook, scheduler.WithOldestFirst())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(ids(hooked)).Should(Equal([]int{1, 2, 3, 4}))
+		Expect(sch.Stats(ctx).LastInsertedTimestamp).Should(Equal(int64(30)))
+	})
+
+	It("should not move the cursor to the future", func() {
+		now := time.Now().Unix()
+		future := newComment(now+int64(time.Hour.Seconds()), 3)
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{
+				future, newComment(now-10, 2), newComment(now-20, 1),
+			}},
+			mock.Response{Actions: []models.RecentAction{
+				newComment(now, 4), newComment(now-10, 2),
+			}},
+		)
+
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Stats(ctx).LastInsertedTimestamp).Should(Equal(now - 10))
+		Expect(storedTimestamps()).Should(Equal([]int64{now - 10, now - 20}))
+
+		// The actions after the bogus one are still picked up.
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Stats(ctx).LastInsertedTimestamp).Should(Equal(now))
+		Expect(storedTimestamps()).Should(Equal([]int64{
+			now, now - 10, now - 20,
+		}))
+	})
+
+	It("should keep the future actions within the tolerance", func() {
+		future := time.Now().Add(time.Hour).Unix()
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newComment(future, 1),
+		}})
+
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithFutureTolerance(2*time.Hour))
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Stats(ctx).LastInsertedTimestamp).Should(Equal(future))
+	})
+
+	It("should run the additional pollers concurrently", func() {
+		fetched := make(chan struct{}, 10)
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Hour,
+			scheduler.WithPollers(scheduler.PollerConfig{
+				Name:     "blog",
+				Cooldown: time.Millisecond,
+				Fetch: func(ctx context.Context) (
+					[]models.RecentAction, error) {
+					fetched <- struct{}{}
+					return []models.RecentAction{newComment(10, 1)}, nil
+				},
+			}))
+
+		startCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			sch.Start(startCtx)
+			close(done)
+		}()
+
+		// The poller keeps polling while the recent actions sleep for an
+		// hour.
+		Eventually(fetched).Should(Receive())
+		Eventually(fetched).Should(Receive())
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(storedTimestamps()).Should(Equal([]int64{10}))
+	})
+
+	It("should poll the comments of a blog entry", func() {
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newComment(10, 1)}})
+		cfClient.SetBlogEntries(models.BlogEntry{Id: 2, Title: "Round 900"})
+		cfClient.SetComments(2, []models.Comment{
+			{Id: 5, CreationTimeSeconds: 30}, {Id: 6, CreationTimeSeconds: 20},
+		})
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithPollers(
+				scheduler.BlogEntryPoller(cfClient, 2, time.Minute)))
+
+		Expect(sch.RunOnce(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{30, 20, 10}))
+		action, err := cfStore.GetRecentAction(ctx, "2-5")
+		Expect(err).Should(BeNil())
+		Expect(action.BlogEntry.Title).Should(Equal("Round 900"))
+	})
+
+	It("should skip the pollers without a cooldown", func() {
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newComment(10, 1)}})
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithPollers(
+				scheduler.BlogEntryPoller(cfClient, 2, 0)))
+
+		// The poller would fail, since the blog entry is unknown.
+		Expect(sch.RunOnce(ctx)).Should(Succeed())
+		Expect(cfClient.Calls()).Should(Equal(1))
+	})
+
+	It("should keep the jittered cooldown within bounds", func() {
+		random := rand.New(rand.NewSource(42))
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Minute,
+			scheduler.WithJitter(0.25), scheduler.WithRandom(random.Float64))
+
+		minSleep, maxSleep := time.Hour, time.Duration(0)
+		for cnt := 0; cnt < 10000; cnt++ {
+			sleep := scheduler.SleepDuration(sch)
+			Expect(sleep).Should(BeNumerically(">=", 45*time.Second))
+			Expect(sleep).Should(BeNumerically("<=", 75*time.Second))
+			if sleep < minSleep {
+				minSleep = sleep
+			}
+			if sleep > maxSleep {
+				maxSleep = sleep
+			}
+		}
+
+		// The jitter should actually spread the cooldown in both directions.
+		Expect(minSleep).Should(BeNumerically("<", 50*time.Second))
+		Expect(maxSleep).Should(BeNumerically(">", 70*time.Second))
+	})
+
+	It("should not jitter the cooldown by default", func() {
+		Expect(scheduler.SleepDuration(sch)).Should(Equal(time.Second))
+	})
+
+	It("should ignore the jitter outside of the bounds", func() {
+		for _, fraction := range []float64{-0.5, 1, 2} {
+			sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+				scheduler.WithJitter(fraction),
+				scheduler.WithRandom(func() float64 { return 0 }))
+			Expect(scheduler.SleepDuration(sch)).Should(Equal(time.Second))
+		}
+	})
+
+	It("should back off on consecutive failures", func() {
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithMaxCooldown(5*time.Second))
+		cfClient.Push(
+			mock.Response{Err: errors.New("codeforces is down")},
+			mock.Response{Err: errors.New("codeforces is down")},
+			mock.Response{Err: errors.New("codeforces is down")},
+			mock.Response{Err: errors.New("codeforces is down")},
+			mock.Response{Actions: []models.RecentAction{newComment(10, 1)}},
+		)
+
+		for _, expected := range []time.Duration{
+			2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+		} {
+			Expect(sch.Sync(ctx)).ShouldNot(Succeed())
+			Expect(scheduler.SleepDuration(sch)).Should(Equal(expected))
+		}
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(scheduler.SleepDuration(sch)).Should(Equal(time.Second))
+	})
+
+	It("should be stale after the maximum backoff and the cycle timeout",
+		func() {
+			Expect(sch.StaleAfter()).Should(Equal(9 * time.Second))
+
+			sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+				scheduler.WithMaxCooldown(4*time.Second),
+				scheduler.WithJitter(0.5),
+				scheduler.WithCycleTimeout(3*time.Second))
+			Expect(sch.StaleAfter()).Should(Equal(9 * time.Second))
+
+			// Without a backoff or a cycle timeout, it is two cooldowns.
+			sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+				scheduler.WithMaxCooldown(0),
+				scheduler.WithCycleTimeout(0))
+			Expect(sch.StaleAfter()).Should(Equal(2 * time.Second))
+		})
+
+	It("should not adapt the batch size by default", func() {
+		for ts := int64(1); ts <= 3; ts++ {
+			cfClient.Push(mock.Response{Actions: []models.RecentAction{
+				newComment(ts, int(ts)),
+			}})
+			Expect(sch.Sync(ctx)).Should(Succeed())
+		}
+		Expect(scheduler.BatchSize(sch)).Should(Equal(100))
+	})
+
+	It("should adapt the batch size to the ratio of new actions", func() {
+		sch = scheduler.NewScheduler(cfClient, cfStore, 2, time.Second,
+			scheduler.WithAdaptiveBatchSize(1, 5))
+
+		// Each cycle fetches a full batch of entirely new actions.
+		for ts := int64(10); ts < 70; ts += 10 {
+			cfClient.Push(mock.Response{Actions: []models.RecentAction{
+				newComment(ts+1, int(ts)+1), newComment(ts, int(ts)),
+			}})
+			Expect(sch.Sync(ctx)).Should(Succeed())
+		}
+		Expect(scheduler.BatchSize(sch)).Should(Equal(5))
+
+		// Each cycle fetches nothing but already persisted actions.
+		for ind := 0; ind < 3; ind++ {
+			cfClient.Push(mock.Response{Actions: []models.RecentAction{
+				newComment(61, 61), newComment(60, 60),
+			}})
+			Expect(sch.Sync(ctx)).Should(Succeed())
+		}
+		Expect(scheduler.BatchSize(sch)).Should(Equal(2))
+	})
+
+	It("should report its state in the stats", func() {
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{
+				newComment(20, 2), newComment(10, 1),
+			}},
+			mock.Response{Err: errors.New("codeforces is down")},
+		)
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).ShouldNot(Succeed())
+
+		stats := sch.Stats(ctx)
+		Expect(stats.LastInsertedTimestamp).Should(Equal(int64(20)))
+		Expect(stats.LastSuccessfulSync).Should(
+			Equal(sch.LastSuccessfulSync()))
+		Expect(stats.ConsecutiveFailures).Should(Equal(1))
+		Expect(stats.BatchSize).Should(Equal(100))
+		Expect(stats.Cooldown).Should(Equal(time.Second))
+		Expect(stats.CurrentCooldown).Should(Equal(2 * time.Second))
+		Expect(stats.StoredActions).Should(Equal(int64(2)))
+	})
+
+	It("should wait without backing off while the circuit is open", func() {
+		cfClient.Push(
+			mock.Response{Err: cfapi.ErrCircuitOpen},
+			mock.Response{Actions: []models.RecentAction{newComment(10, 1)}},
+		)
+		lastSuccessfulSync := sch.LastSuccessfulSync()
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.LastSuccessfulSync()).Should(Equal(lastSuccessfulSync))
+		Expect(scheduler.SleepDuration(sch)).Should(Equal(time.Second))
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{10}))
+	})
+
+	It("should count the inserted actions in the injected metrics", func() {
+		metrics := scheduler.NewMetrics(nil)
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithMetrics(metrics))
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{
+				newComment(20, 2), newComment(10, 1),
+			}},
+			mock.Response{Actions: []models.RecentAction{
+				newComment(30, 3), newComment(20, 2),
+			}},
+		)
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		// The store already has one of the new actions, e.g, persisted by
+		// another instance.
+		Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+			newComment(30, 3)})).Error().Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(scheduler.ActionsInserted(metrics)).Should(Equal(2.0))
+		Expect(scheduler.ActionsDuplicated(metrics)).Should(Equal(1.0))
+	})
+
+	It("should sync without metrics", func() {
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithMetrics(nil))
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newComment(10, 1),
+		}})
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(Equal([]int64{10}))
+	})
+
+	It("should abandon a cycle that exceeds its deadline", func() {
+		slow := &slowStore{
+			CodeforcesStore: cfStore,
+			errs:            make(chan error, 1),
+		}
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newComment(10, 1),
+		}})
+		sch := scheduler.NewScheduler(cfClient, slow, 100, time.Hour,
+			scheduler.WithCycleTimeout(50*time.Millisecond))
+
+		startCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			sch.Start(startCtx)
+			close(done)
+		}()
+
+		Eventually(slow.errs).Should(Receive(Equal(context.DeadlineExceeded)))
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(storedTimestamps()).Should(BeEmpty())
+	})
+
+	It("should abort the call to codeforces on shutdown", func() {
+		blocked := &blockingClient{CodeforcesClient: cfClient,
+			called: make(chan struct{}, 1)}
+		sch := scheduler.NewScheduler(blocked, cfStore, 100, time.Hour,
+			scheduler.WithCycleTimeout(time.Hour))
+
+		startCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			sch.Start(startCtx)
+			close(done)
+		}()
+
+		Eventually(blocked.called).Should(Receive())
+		cancel()
+		Eventually(done, time.Second).Should(BeClosed())
+	})
+
+	It("should not abort the insertion on shutdown", func() {
+		gated := &gatedStore{CodeforcesStore: cfStore,
+			entered: make(chan struct{}, 1), release: make(chan struct{})}
+		cfClient.Push(mock.Response{Actions: []models.RecentAction{
+			newComment(10, 1),
+		}})
+		sch := scheduler.NewScheduler(cfClient, gated, 100, time.Hour)
+
+		startCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			sch.Start(startCtx)
+			close(done)
+		}()
+
+		Eventually(gated.entered).Should(Receive())
+		cancel()
+		close(gated.release)
+		Eventually(done).Should(BeClosed())
+		Expect(storedTimestamps()).Should(Equal([]int64{10}))
+		cursor, err := cfStore.LoadCursor(ctx)
+		Expect(err).Should(BeNil())
+		Expect(cursor).Should(Equal(int64(10)))
+	})
+
+	It("should report its stats while the cycles run", func() {
+		const cycles = 20
+		for ts := int64(1); ts <= cycles; ts++ {
+			cfClient.Push(mock.Response{Actions: []models.RecentAction{
+				newComment(ts, int(ts)),
+			}})
+		}
+		hooked := make(chan scheduler.Stats, cycles)
+		var sch scheduler.CodeforcesSchedulerInterface
+		sch = scheduler.NewScheduler(cfClient, cfStore, 100, time.Millisecond,
+			scheduler.WithMaxCooldown(time.Millisecond),
+			scheduler.WithOnNewActions(func(ctx context.Context,
+				_ []models.RecentAction) error {
+				// The hook runs within the cycle, hence it must not wait
+				// for it.
+				hooked <- sch.Stats(ctx)
+				return nil
+			}))
+
+		startCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			sch.Start(startCtx)
+			close(done)
+		}()
+
+		// The stats are read concurrently with the cycles, which the race
+		// detector checks.
+		readerDone := make(chan struct{})
+		go func() {
+			defer close(readerDone)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					sch.Stats(ctx)
+				}
+			}
+		}()
+
+		Eventually(func() int64 {
+			return sch.Stats(ctx).LastInsertedTimestamp
+		}, 5*time.Second).Should(Equal(int64(cycles)))
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Eventually(readerDone).Should(BeClosed())
+		Expect(hooked).Should(HaveLen(cycles))
+	})
+
+	It("should not wait for a cycle in progress to report its stats",
+		func() {
+			slow := &slowStore{
+				CodeforcesStore: cfStore,
+				errs:            make(chan error, 1),
+			}
+			cfClient.Push(mock.Response{Actions: []models.RecentAction{
+				newComment(10, 1),
+			}})
+			sch := scheduler.NewScheduler(cfClient, slow, 100, time.Hour)
+
+			// The store blocks the cycle till its context is done.
+			syncCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			synced := make(chan error, 1)
+			go func() {
+				synced <- sch.Sync(syncCtx)
+			}()
+			Eventually(cfClient.Calls).Should(Equal(1))
+
+			start := time.Now()
+			Expect(sch.Stats(ctx).LastInsertedTimestamp).Should(BeZero())
+			Expect(time.Since(start)).Should(
+				BeNumerically("<", 500*time.Millisecond))
+			Eventually(synced, 2*time.Second).Should(Receive(HaveOccurred()))
+		})
+
+	It("should not persist anything on a dry run", func() {
+		hooked := 0
+		sch := scheduler.NewScheduler(cfClient, cfStore, 100, time.Second,
+			scheduler.WithDryRun(),
+			scheduler.WithOnNewActions(
+				func(context.Context, []models.RecentAction) error {
+					hooked++
+					return nil
+				}))
+		cfClient.Push(
+			mock.Response{Actions: []models.RecentAction{newComment(10, 1)}},
+			mock.Response{Actions: []models.RecentAction{newComment(10, 1)}},
+		)
+
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(storedTimestamps()).Should(BeEmpty())
+		Expect(hooked).Should(BeZero())
+
+		cursor, err := cfStore.LoadCursor(ctx)
+		Expect(err).Should(BeNil())
+		Expect(cursor).Should(BeZero())
+	})
+})
+
+// flakyStore fails the first few insertions, and delegates everything else to
+// the embedded store.
+type flakyStore struct {
+	store.CodeforcesStore
+	failures int
+}
+
+func (s *flakyStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int64, error) {
+	if s.failures > 0 {
+		s.failures--
+		return 0, errors.New("insertion failed")
+	}
+	return s.CodeforcesStore.AddRecentActions(ctx, actions)
+}
+
+// slowStore blocks the insertions till their context is done, and reports the
+// error of the context.
+type slowStore struct {
+	store.CodeforcesStore
+	errs chan error
+}
+
+func (s *slowStore) AddRecentActions(ctx context.Context,
+	_ []models.RecentAction) (int64, error) {
+	<-ctx.Done()
+	s.errs <- ctx.Err()
+	return 0, ctx.Err()
+}
+
+// blockingClient blocks the calls to the recent actions till their context
+// is done, and reports each call.
+type blockingClient struct {
+	*mock.CodeforcesClient
+	called chan struct{}
+}
+
+func (client *blockingClient) RecentActions(ctx context.Context,
+	_ int) ([]models.RecentAction, error) {
+	client.called <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// gatedStore holds the insertions till release is closed, and then inserts
+// with their context, which fails if it is done.
+type gatedStore struct {
+	store.CodeforcesStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *gatedStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int64, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.CodeforcesStore.AddRecentActions(ctx, actions)
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+// Rows iterates over the results of a query, just like the rows of
+// database/sql and of pgx.
+type Rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// DecodeAction decodes an action stored as JSON, with its relative links
+// converted to absolute ones, as returned by all the stores.
+func DecodeAction(doc []byte) (models.RecentAction, error) {
+	actions := make([]models.RecentAction, 1)
+	if err := json.Unmarshal(doc, &actions[0]); err != nil {
+		return models.RecentAction{}, errors.Errorf("could not decode "+
+			"action with error [%v]", err)
+	}
+	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+	return actions[0], nil
+}
+
+// ScanAction decodes the current row, whose only column is the JSON of the
+// action.
+func ScanAction(rows Rows) (models.RecentAction, error) {
+	var doc []byte
+	if err := rows.Scan(&doc); err != nil {
+		return models.RecentAction{}, errors.Errorf("could not scan action "+
+			"with error [%v]", err)
+	}
+	return DecodeAction(doc)
+}
+
+// ScanActions decodes all the rows, whose only column is the JSON of the
+// actions. The rows are left open.
+func ScanActions(rows Rows) ([]models.RecentAction, error) {
+	var actions []models.RecentAction
+	for rows.Next() {
+		action, err := ScanAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("could not iterate recent actions "+
+			"with error [%v]", err)
+	}
+	return actions, nil
+}
+
+// SQLDirection returns the direction of ORDER BY for the sort order, for the
+// SQL stores.
+func SQLDirection(order SortOrder) string {
+	if order == SortAscending {
+		return "ASC"
+	}
+	return "DESC"
+}
@@ -0,0 +1,475 @@
+// Package memory contains an in-memory implementation of CodeforcesStore.
+// It mimics the semantics of the mongo store, and is meant to be used in tests
+// and local experiments where a live MongoDB is not available.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+// actionKey uniquely identifies a recent action, mirroring the unique index
+// of the mongo store. The comment id is zero for blog actions.
+type actionKey struct {
+	blogEntryId int
+	commentId   int
+}
+
+// Aliases of the store package, which the receivers of the methods shadow.
+var (
+	errNotFound    = store.ErrNotFound
+	sortDescending = store.SortDescending
+	sortAscending  = store.SortAscending
+
+	newActionStream = store.NewActionStream
+)
+
+// memoryStore is the in-memory implementation of CodeforcesStore.
+type memoryStore struct {
+	mutex sync.Mutex
+
+	recentActions  []models.RecentAction
+	actionKeys     map[actionKey]bool
+	uuidToUsersMap map[string]*models.User
+	cursor         int64
+}
+
+func keyOf(action models.RecentAction) actionKey {
+	var key actionKey
+	if action.BlogEntry != nil {
+		key.blogEntryId = action.BlogEntry.Id
+	}
+	if action.Comment != nil {
+		key.commentId = action.Comment.Id
+	}
+	return key
+}
+
+// sortAndLimit sorts the actions in decreasing order of activity time and
+// keeps at most limit of them. A non-positive limit means no limit.
+func sortAndLimit(actions []models.RecentAction,
+	limit int64) []models.RecentAction {
+	return sortAndPage(actions, limit, 0)
+}
+
+// sortAndPage is like sortAndLimit, but it drops the first skip actions
+// after sorting.
+func sortAndPage(actions []models.RecentAction,
+	limit, skip int64) []models.RecentAction {
+	return sortInOrder(actions, limit, skip, sortDescending)
+}
+
+// sortInOrder is like sortAndPage, but it sorts the actions in the given
+// order.
+func sortInOrder(actions []models.RecentAction, limit, skip int64,
+	order store.SortOrder) []models.RecentAction {
+	sort.SliceStable(actions, func(i, j int) bool {
+		if order == sortAscending {
+			return actions[i].TimeSeconds < actions[j].TimeSeconds
+		}
+		return actions[i].TimeSeconds > actions[j].TimeSeconds
+	})
+	if skip > 0 {
+		if skip >= int64(len(actions)) {
+			return nil
+		}
+		actions = actions[skip:]
+	}
+	if limit > 0 && int64(len(actions)) > limit {
+		actions = actions[:limit]
+	}
+	return actions
+}
+
+func (store *memoryStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Duplicates are silently skipped, just like the unique index does,
+	// unless they are a later edit of the stored action, with a different
+	// content, which they replace.
+	var inserted int64
+	for _, action := range actions {
+		key := keyOf(action)
+		if !store.actionKeys[key] {
+			store.actionKeys[key] = true
+			store.recentActions = append(store.recentActions, action)
+			inserted++
+			continue
+		}
+		for ind, stored := range store.recentActions {
+			if keyOf(stored) == key {
+				if action.EditTimeSeconds() > stored.EditTimeSeconds() &&
+					storedContentHash(action) != stored.ContentHash() {
+					store.recentActions[ind] = action
+				}
+				break
+			}
+		}
+	}
+	utils.ConvertRelativeLinksToAbsoluteLinks(store.recentActions)
+
+	return inserted, nil
+}
+
+// storedContentHash returns the content hash of the action once stored, i.e,
+// with the absolute links that the stored copies are converted to.
+func storedContentHash(action models.RecentAction) string {
+	if action.Comment != nil {
+		comment := *action.Comment
+		action.Comment = &comment
+	}
+	actions := []models.RecentAction{action}
+	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+	return actions[0].ContentHash()
+}
+
+func (store *memoryStore) QueryRecentActions(ctx context.Context,
+	startTimestamp, limit int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsPaged(ctx, startTimestamp, limit, 0)
+}
+
+func (store *memoryStore) QueryRecentActionsPaged(ctx context.Context,
+	startTimestamp, limit, skip int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsSorted(ctx, startTimestamp, limit, skip,
+		sortDescending)
+}
+
+func (store *memoryStore) QueryRecentActionsSorted(ctx context.Context,
+	startTimestamp, limit, skip int64, order store.SortOrder) (
+	[]models.RecentAction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Just like the mongo store, only the actions on comments are returned.
+	var res []models.RecentAction
+	for _, action := range store.recentActions {
+		if action.TimeSeconds >= startTimestamp &&
+			action.BlogEntry != nil && action.Comment != nil {
+			res = append(res, action)
+		}
+	}
+
+	return sortInOrder(res, limit, skip, order), nil
+}
+
+func (store *memoryStore) QueryRecentActionsBefore(ctx context.Context,
+	endTimestamp, limit int64) ([]models.RecentAction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Just like the mongo store, only the actions on comments are returned.
+	var res []models.RecentAction
+	for _, action := range store.recentActions {
+		if action.TimeSeconds <= endTimestamp &&
+			action.BlogEntry != nil && action.Comment != nil {
+			res = append(res, action)
+		}
+	}
+
+	return sortInOrder(res, limit, 0, sortDescending), nil
+}
+
+func (store *memoryStore) StreamRecentActions(ctx context.Context,
+	startTimestamp int64) (<-chan models.RecentAction, <-chan error) {
+	// The actions are already in memory, hence a snapshot of them is streamed
+	// so that the store is not locked while they are received.
+	store.mutex.Lock()
+	var actions []models.RecentAction
+	for _, action := range store.recentActions {
+		if action.TimeSeconds >= startTimestamp {
+			actions = append(actions, action)
+		}
+	}
+	store.mutex.Unlock()
+	actions = sortInOrder(actions, 0, 0, sortAscending)
+
+	return newActionStream(ctx, func(
+		send func(models.RecentAction) error) error {
+		for _, action := range actions {
+			if err := send(action); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *memoryStore) QueryRecentActionsByHandle(ctx context.Context,
+	handle string, startTimestamp, limit int64) (
+	[]models.RecentAction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var res []models.RecentAction
+	for _, action := range store.recentActions {
+		if action.TimeSeconds >= startTimestamp &&
+			strings.EqualFold(action.Author(), handle) {
+			res = append(res, action)
+		}
+	}
+
+	return sortAndLimit(res, limit), nil
+}
+
+func (store *memoryStore) GetRecentAction(ctx context.Context, id string) (
+	models.RecentAction, error) {
+	if err := ctx.Err(); err != nil {
+		return models.RecentAction{}, err
+	}
+	blogEntryId, commentId, err := models.ParseActionId(id)
+	if err != nil {
+		return models.RecentAction{}, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := actionKey{blogEntryId: blogEntryId, commentId: commentId}
+	for _, action := range store.recentActions {
+		if keyOf(action) == key {
+			return action, nil
+		}
+	}
+	return models.RecentAction{}, errNotFound
+}
+
+func (store *memoryStore) SearchRecentActions(ctx context.Context,
+	query string, limit int64) ([]models.RecentAction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var res []models.RecentAction
+	for _, action := range store.recentActions {
+		if action.ContainsText(query) {
+			res = append(res, action)
+		}
+	}
+
+	return sortAndLimit(res, limit), nil
+}
+
+func (store *memoryStore) LastRecordedTimestampForRecentActions(
+	ctx context.Context) int64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	res := int64(0)
+	for _, action := range store.recentActions {
+		if action.TimeSeconds > res {
+			res = action.TimeSeconds
+		}
+	}
+
+	return res
+}
+
+func (store *memoryStore) CountRecentActions(ctx context.Context) (
+	int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return int64(len(store.recentActions)), nil
+}
+
+func (store *memoryStore) DeleteActionsBefore(ctx context.Context,
+	timestamp int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var kept []models.RecentAction
+	for _, action := range store.recentActions {
+		if action.TimeSeconds < timestamp {
+			delete(store.actionKeys, keyOf(action))
+			continue
+		}
+		kept = append(kept, action)
+	}
+	deleted := int64(len(store.recentActions) - len(kept))
+	store.recentActions = kept
+	return deleted, nil
+}
+
+func (store *memoryStore) AddUser(
+	ctx context.Context, user *models.User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// TODO: Add condition to reject duplicate uuid.
+	store.uuidToUsersMap[user.Uuid] = user
+
+	return nil
+}
+
+func (store *memoryStore) QueryUserByUuid(
+	ctx context.Context, uuid string) (
+	*models.User, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.uuidToUsersMap[uuid]
+	if !ok {
+		return nil, fmt.Errorf("user does not exist")
+	}
+
+	return user, nil
+}
+
+func (store *memoryStore) QueryRecentActionsForUser(
+	ctx context.Context, uuid string, startTimestamp, limit int64) (
+	[]models.RecentAction, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.uuidToUsersMap[uuid]
+	if !ok {
+		return nil, fmt.Errorf("user does not exist")
+	}
+
+	var res []models.RecentAction
+	// TODO: Optimize the time complexity of search.
+	ids := user.SubscribedBlogs
+	for _, action := range store.recentActions {
+		if action.TimeSeconds >= startTimestamp && action.BlogEntry != nil &&
+			action.Comment != nil {
+			for _, id := range ids {
+				if action.BlogEntry.Id == id {
+					res = append(res, action)
+					break
+				}
+			}
+		}
+	}
+
+	return sortAndLimit(res, limit), nil
+}
+
+func (store *memoryStore) SubscribeToBlogs(
+	ctx context.Context, uuid string, ids ...int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.uuidToUsersMap[uuid]
+	if !ok {
+		return fmt.Errorf("user does not exist")
+	}
+
+	// We are operating on a pointer, hence we don't need to overwrite it in
+	// the map.
+	user.SubscribedBlogs = append(user.SubscribedBlogs, ids...)
+
+	return nil
+}
+
+func (store *memoryStore) UnsubscribeFromBlogs(
+	ctx context.Context, uuid string, ids ...int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.uuidToUsersMap[uuid]
+	if !ok {
+		return fmt.Errorf("user does not exist")
+	}
+
+	// TODO: Improve the time complexity.
+	var newBlogsList []int
+	for _, old := range user.SubscribedBlogs {
+		for _, toUnsubscribe := range ids {
+			if old != toUnsubscribe {
+				newBlogsList = append(newBlogsList, old)
+			}
+		}
+	}
+
+	// We are operating on a pointer, hence we don't need to overwrite it in
+	// the map.
+	user.SubscribedBlogs = newBlogsList
+
+	return nil
+}
+
+func (store *memoryStore) QueryCommentsFromBlog(
+	ctx context.Context, id int, startTimestamp, limit int64) (
+	[]models.Comment, error) {
+	// TODO: Implement it.
+	return nil, nil
+}
+
+func (store *memoryStore) QueryAllUniqueBlogs(
+	ctx context.Context, startTimestamp, limit int64) (
+	[]models.BlogEntry, error) {
+	// TODO: Implement it.
+	return nil, nil
+}
+
+func (store *memoryStore) SaveCursor(ctx context.Context,
+	timestamp int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.cursor = timestamp
+	return nil
+}
+
+func (store *memoryStore) LoadCursor(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.cursor, nil
+}
+
+// Ping always succeeds, since the store holds no connection, unless the
+// context is done.
+func (store *memoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close is a no-op, since the store holds no connection.
+func (store *memoryStore) Close(ctx context.Context) error {
+	return nil
+}
+
+// NewMemoryStore creates a new, empty instance of the in-memory store.
+func NewMemoryStore() store.CodeforcesStore {
+	mStore := new(memoryStore)
+	mStore.uuidToUsersMap = make(map[string]*models.User)
+	mStore.actionKeys = make(map[actionKey]bool)
+
+	return mStore
+}
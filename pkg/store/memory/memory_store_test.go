@@ -0,0 +1,208 @@
+package memory_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/memory"
+)
+
+var _ = Describe("MemoryStore", func() {
+	newComment := func(ts int64, blogId, commentId int,
+		handle string) models.RecentAction {
+		return models.RecentAction{
+			TimeSeconds: ts,
+			BlogEntry:   &models.BlogEntry{Id: blogId},
+			Comment: &models.Comment{
+				Id:                commentId,
+				CommentatorHandle: handle,
+			},
+		}
+	}
+
+	actions := []models.RecentAction{
+		newComment(10, 1, 1, "tourist"),
+		newComment(30, 1, 2, "Petr"),
+		newComment(20, 2, 3, "TOURIST"),
+		{
+			TimeSeconds: 40,
+			BlogEntry:   &models.BlogEntry{Id: 3, AuthorHandle: "tourist"},
+		},
+	}
+
+	It("should return promptly when the context is cancelled", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(MatchError(context.Canceled))
+		_, err := memoryStore.QueryRecentActions(ctx, 0, 100)
+		Expect(err).Should(MatchError(context.Canceled))
+		Expect(time.Since(start)).Should(BeNumerically("<", time.Second))
+
+		Expect(memoryStore.LastRecordedTimestampForRecentActions(
+			context.Background())).Should(BeZero())
+	})
+
+	It("should query comments newest first with a limit", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(memoryStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(Equal(int64(40)))
+
+		res, err := memoryStore.QueryRecentActions(ctx, 15, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(2))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+		Expect(res[1].TimeSeconds).Should(Equal(int64(20)))
+
+		res, err = memoryStore.QueryRecentActions(ctx, 0, 1)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+	})
+
+	It("should page through the comments", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		res, err := memoryStore.QueryRecentActionsPaged(ctx, 0, 1, 1)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(20)))
+
+		res, err = memoryStore.QueryRecentActionsPaged(ctx, 0, 1, 5)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(BeEmpty())
+	})
+
+	It("should skip duplicate actions", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		res, err := memoryStore.QueryRecentActions(ctx, 0, 0)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+	})
+
+	It("should delete the actions before a timestamp", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		deleted, err := memoryStore.DeleteActionsBefore(ctx, 30)
+		Expect(err).Should(BeNil())
+		Expect(deleted).Should(Equal(int64(2)))
+
+		res, err := memoryStore.QueryRecentActions(ctx, 0, 0)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+
+		// The deleted actions can be added again.
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		res, err = memoryStore.QueryRecentActions(ctx, 0, 0)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+	})
+
+	It("should stream all the actions oldest first", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		stream, errs := memoryStore.StreamRecentActions(ctx, 15)
+		var timestamps []int64
+		for action := range stream {
+			timestamps = append(timestamps, action.TimeSeconds)
+		}
+		Expect(<-errs).Should(BeNil())
+		Expect(timestamps).Should(Equal([]int64{20, 30, 40}))
+	})
+
+	It("should end the stream when the context is cancelled", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		stream, errs := memoryStore.StreamRecentActions(ctx, 0)
+		Eventually(stream).Should(Receive())
+		cancel()
+		Eventually(stream).Should(BeClosed())
+		Expect(<-errs).Should(MatchError(context.Canceled))
+	})
+
+	It("should match handles case-insensitively", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		res, err := memoryStore.QueryRecentActionsByHandle(ctx, "Tourist",
+			0, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(40)))
+	})
+
+	It("should sort the comments in both orders", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		res, err := memoryStore.QueryRecentActionsSorted(ctx, 0, 0, 0,
+			store.SortDescending)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+		Expect(res[2].TimeSeconds).Should(Equal(int64(10)))
+
+		res, err = memoryStore.QueryRecentActionsSorted(ctx, 15, 1, 1,
+			store.SortAscending)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+	})
+
+	It("should get a single action by its id", func() {
+		memoryStore := memory.NewMemoryStore()
+		ctx := context.Background()
+
+		Expect(memoryStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		action, err := memoryStore.GetRecentAction(ctx, "1-2")
+		Expect(err).Should(BeNil())
+		Expect(action.Comment.CommentatorHandle).Should(Equal("Petr"))
+
+		action, err = memoryStore.GetRecentAction(ctx, "3-0")
+		Expect(err).Should(BeNil())
+		Expect(action.BlogEntry.AuthorHandle).Should(Equal("tourist"))
+
+		_, err = memoryStore.GetRecentAction(ctx, "1-3")
+		Expect(err).Should(MatchError(store.ErrNotFound))
+	})
+})
@@ -0,0 +1,20 @@
+package memory_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/store/memory"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+)
+
+func TestMemory(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Memory Suite")
+}
+
+func TestMemoryStoreContract(t *testing.T) {
+	storetest.RunStoreTests(t, memory.NewMemoryStore)
+}
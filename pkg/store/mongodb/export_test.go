@@ -0,0 +1,40 @@
+package mongodb
+
+import (
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// ChunkDocuments exposes the chunking of the insertions to tests, since they
+// can't reach a live MongoDB.
+var ChunkDocuments = chunkDocuments
+
+// SplitWriteErrors exposes the handling of the partial insertion failures to
+// tests.
+var SplitWriteErrors = splitWriteErrors
+
+// UpsertModel exposes the upsert of the edited actions to tests.
+func UpsertModel(action models.RecentAction) mongo.WriteModel {
+	return upsertModel(newRecentActionDocument(action))
+}
+
+// SummarizeWrites exposes the tally of the bulk writes of the chunks of a
+// batch to tests, which stops at the first failed chunk.
+func SummarizeWrites(results []*mongo.BulkWriteResult, errs []error) (
+	duplicates, rejected int, edited int64, err error) {
+	var summary writeSummary
+	for ind, result := range results {
+		if _, err := summary.add(result, errs[ind]); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return summary.duplicates, summary.rejected, summary.edited, nil
+}
+
+// RetentionCommand exposes the update of the expiry of the retention index to
+// tests.
+var RetentionCommand = retentionCommand
+
+// HasErrorCode exposes the matching of the command errors to tests.
+var HasErrorCode = hasErrorCode
@@ -0,0 +1,299 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	kUniqueActionIndexName = "unique_action"
+	kRetentionIndexName    = "retention"
+	kTextIndexName         = "text"
+
+	// kDuplicateKeyErrorCode is the error code returned by MongoDB when an
+	// insertion violates a unique index.
+	kDuplicateKeyErrorCode = 11000
+
+	// The error codes returned by MongoDB when an index is created with the
+	// options of an existing one changed, and when a missing index, or an
+	// index of a missing collection, is dropped.
+	kIndexOptionsConflictErrorCode = 85
+	kIndexNotFoundErrorCode        = 27
+	kNamespaceNotFoundErrorCode    = 26
+)
+
+// createIndexes creates all the indexes needed by the store. It is safe to
+// call it multiple times, since MongoDB ignores identical index definitions.
+func (store *mongoStore) createIndexes(ctx context.Context) error {
+	// A recent action is uniquely identified by the blog entry and the
+	// comment. Blog actions don't have a comment, in which case the comment
+	// id is indexed as null.
+	uniqueAction := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "blogEntry.id", Value: 1},
+			{Key: "comment.id", Value: 1},
+		},
+		Options: options.Index().
+			SetName(kUniqueActionIndexName).
+			SetUnique(true),
+	}
+
+	name, err := store.recentActionsCollection.Indexes().
+		CreateOne(ctx, uniqueAction)
+	if mongo.IsDuplicateKeyError(err) {
+		// The collections written before the index existed may hold
+		// duplicates, which have to go before it can be created.
+		zap.S().Warnw("Removing the duplicate actions to create the index",
+			zap.String("index", kUniqueActionIndexName))
+		if err := store.removeDuplicateActions(ctx); err != nil {
+			return errors.Errorf("could not remove the duplicate actions "+
+				"with error [%v], keep a single document per blogEntry.id "+
+				"and comment.id manually to create index %s", err,
+				kUniqueActionIndexName)
+		}
+		name, err = store.recentActionsCollection.Indexes().
+			CreateOne(ctx, uniqueAction)
+	}
+	if err != nil {
+		return errors.Errorf("could not create index %s with error [%v]",
+			kUniqueActionIndexName, err)
+	}
+	zap.S().Infow("Ensured the presence of the index", zap.String("index", name))
+
+	// The text index backs SearchRecentActions. A collection can only have
+	// one, hence all the searchable fields share it.
+	text := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "blogEntry.title", Value: "text"},
+			{Key: "blogEntry.content", Value: "text"},
+			{Key: "comment.text", Value: "text"},
+		},
+		Options: options.Index().SetName(kTextIndexName),
+	}
+
+	name, err = store.recentActionsCollection.Indexes().CreateOne(ctx, text)
+	if err != nil {
+		// A collection created by hand may already have a text index over
+		// other fields, or by another name, which is searched instead.
+		if existing, listErr := store.textIndexName(ctx); listErr == nil &&
+			existing != "" {
+			zap.S().Warnw("Searching through the existing text index",
+				zap.String("index", existing), zap.Error(err))
+			name, err = existing, nil
+		}
+	}
+	if err != nil {
+		return errors.Errorf("could not create index %s with error [%v]",
+			kTextIndexName, err)
+	}
+	zap.S().Infow("Ensured the presence of the index", zap.String("index", name))
+
+	return store.ensureRetention(ctx)
+}
+
+// ensureRetention makes the retention index match the retention of the
+// store. MongoDB purges a document once its createdAt field is older than
+// the expiry. Without a retention, the index is dropped, and the history is
+// retained forever.
+func (store *mongoStore) ensureRetention(ctx context.Context) error {
+	if store.retention <= 0 {
+		_, err := store.recentActionsCollection.Indexes().DropOne(ctx,
+			kRetentionIndexName)
+		if hasErrorCode(err, kIndexNotFoundErrorCode,
+			kNamespaceNotFoundErrorCode) {
+			return nil
+		}
+		if err != nil {
+			return errors.Errorf("could not drop index %s with error [%v]",
+				kRetentionIndexName, err)
+		}
+		zap.S().Infow("Dropped the index, the actions are retained forever",
+			zap.String("index", kRetentionIndexName))
+		return nil
+	}
+
+	// The documents inserted before the index existed have no createdAt,
+	// which is backfilled from their activity time, otherwise they would
+	// never be purged.
+	res, err := store.recentActionsCollection.UpdateMany(ctx,
+		bson.M{"createdAt": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"createdAt": bson.M{"$toDate": bson.M{
+				"$multiply": bson.A{"$timeSeconds", 1000},
+			}},
+		}}}})
+	if err != nil {
+		return errors.Errorf("could not backfill createdAt with error [%v]",
+			err)
+	}
+	if res.ModifiedCount > 0 {
+		zap.S().Infow("Backfilled the creation dates of the actions",
+			zap.Int64("actions", res.ModifiedCount))
+	}
+
+	expireAfterSeconds := int32(store.retention.Seconds())
+	retention := mongo.IndexModel{
+		Keys: bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().
+			SetName(kRetentionIndexName).
+			SetExpireAfterSeconds(expireAfterSeconds),
+	}
+	name, err := store.recentActionsCollection.Indexes().
+		CreateOne(ctx, retention)
+	if hasErrorCode(err, kIndexOptionsConflictErrorCode) {
+		// The retention was changed, hence the expiry of the existing index
+		// is updated in place.
+		name = kRetentionIndexName
+		err = store.recentActionsCollection.Database().RunCommand(ctx,
+			retentionCommand(store.recentActionsCollectionName,
+				expireAfterSeconds)).Err()
+	}
+	if err != nil {
+		return errors.Errorf("could not create index %s with error [%v]",
+			kRetentionIndexName, err)
+	}
+	zap.S().Infow("Ensured the presence of the index",
+		zap.String("index", name), zap.Duration("expiry", store.retention))
+
+	return nil
+}
+
+// retentionCommand returns the command updating the expiry of the retention
+// index of the collection.
+func retentionCommand(collectionName string, expireAfterSeconds int32) bson.D {
+	return bson.D{
+		{Key: "collMod", Value: collectionName},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: kRetentionIndexName},
+			{Key: "expireAfterSeconds", Value: expireAfterSeconds},
+		}},
+	}
+}
+
+// textIndexName returns the name of the text index of the collection, or an
+// empty string if it has none.
+func (store *mongoStore) textIndexName(ctx context.Context) (string, error) {
+	cursor, err := store.recentActionsCollection.Indexes().List(ctx)
+	if err != nil {
+		return "", errors.Errorf("could not list the indexes with error [%v]",
+			err)
+	}
+	var indexes []struct {
+		Name string `bson:"name"`
+		Key  bson.M `bson:"key"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return "", errors.Errorf("could not parse the indexes with error [%v]",
+			err)
+	}
+	for _, index := range indexes {
+		// MongoDB keys all the text indexes by _fts.
+		if index.Key["_fts"] == "text" {
+			return index.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// hasErrorCode reports whether the error is a command error of one of the
+// codes.
+func hasErrorCode(err error, codes ...int32) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	for _, code := range codes {
+		if cmdErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDuplicateActions deletes the copies of each action but its latest
+// edit, i.e, the documents that the unique index would reject.
+func (store *mongoStore) removeDuplicateActions(ctx context.Context) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$addFields", Value: bson.M{"editTime": storedEditTime}}},
+		{{Key: "$sort", Value: bson.M{"editTime": -1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"blogEntryId": "$blogEntry.id",
+				"commentId":   "$comment.id",
+			},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cursor, err := store.recentActionsCollection.Aggregate(ctx, pipeline,
+		options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return errors.Errorf("could not find the duplicates with error [%v]",
+			err)
+	}
+	defer cursor.Close(context.Background())
+
+	// The first id of each group is its latest edit, which is kept.
+	var stale []interface{}
+	for cursor.Next(ctx) {
+		var group struct {
+			Ids []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return errors.Errorf("could not parse the duplicates "+
+				"with error [%v]", err)
+		}
+		stale = append(stale, group.Ids[1:]...)
+	}
+	if err := cursor.Err(); err != nil {
+		return errors.Errorf("could not iterate the duplicates "+
+			"with error [%v]", err)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	var removed int64
+	for _, chunk := range chunkDocuments(stale, store.insertBatchSize) {
+		res, err := store.recentActionsCollection.DeleteMany(ctx,
+			bson.M{"_id": bson.M{"$in": chunk}})
+		if err != nil {
+			return errors.Errorf("could not remove the duplicates "+
+				"with error [%v]", err)
+		}
+		removed += res.DeletedCount
+	}
+	zap.S().Warnw("Removed the duplicate actions",
+		zap.Int64("removed", removed))
+	return nil
+}
+
+// splitWriteErrors splits the errors of an unordered bulk write into the
+// number of duplicates, which are expected, and the indices of the documents
+// rejected for any other reason. It returns false if the write failed as a
+// whole, e.g, on a network or a write concern error.
+func splitWriteErrors(err error) (int, []mongo.WriteError, bool) {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil ||
+		len(bulkErr.WriteErrors) == 0 {
+		return 0, nil, false
+	}
+
+	duplicates := 0
+	var rejected []mongo.WriteError
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code == kDuplicateKeyErrorCode {
+			duplicates++
+			continue
+		}
+		rejected = append(rejected, writeErr.WriteError)
+	}
+	return duplicates, rejected, true
+}
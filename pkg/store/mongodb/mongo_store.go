@@ -2,8 +2,11 @@ package mongodb
 
 import (
 	"context"
+	"regexp"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -17,8 +20,17 @@ import (
 )
 
 const (
-	kRecentActionsCollectionName = "recent_actions"
-	kUsersCollectionName         = "users"
+	kUsersCollectionName   = "users"
+	kCursorsCollectionName = "cursors"
+)
+
+// Aliases of the store package, which the receivers of the methods shadow.
+var (
+	errNotFound    = store.ErrNotFound
+	sortDescending = store.SortDescending
+	sortAscending  = store.SortAscending
+
+	newActionStream = store.NewActionStream
 )
 
 // mongoStore is the concrete implementation of CodeforcesStore
@@ -26,36 +38,219 @@ type mongoStore struct {
 	mongoClient             *mongo.Client
 	recentActionsCollection *mongo.Collection
 	usersCollection         *mongo.Collection
+	cursorsCollection       *mongo.Collection
+
+	// recentActionsCollectionName is the name of the collection of the
+	// recent actions, which is also the id of the document holding their
+	// cursor, so that the instances sharing a database keep their own.
+	recentActionsCollectionName string
+
+	// connectAttempts and connectBaseDelay control how NewMongoStore waits
+	// for MongoDB to become available.
+	connectAttempts  int
+	connectBaseDelay time.Duration
+
+	// insertBatchSize is the maximum number of documents inserted by a
+	// single command.
+	insertBatchSize int
+
+	// retention is the duration for which the recent actions are retained.
+	// A non-positive value means forever.
+	retention time.Duration
 }
 
-func (store *mongoStore) AddRecentActions(actions []models.RecentAction) error {
+// recentActionDocument is the representation of a recent action in the
+// collection. It carries a BSON date, since TTL indexes don't work with unix
+// timestamps, and the hash of its content, which tells the edits apart from
+// the actions that merely reappear with a later time.
+type recentActionDocument struct {
+	models.RecentAction `bson:",inline"`
+	CreatedAt           time.Time `bson:"createdAt"`
+	ContentHash         string    `bson:"contentHash"`
+}
+
+func newRecentActionDocument(action models.RecentAction) recentActionDocument {
+	return recentActionDocument{
+		RecentAction: action,
+		CreatedAt:    time.Unix(action.TimeSeconds, 0).UTC(),
+		ContentHash:  action.ContentHash(),
+	}
+}
+
+func (store *mongoStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int64, error) {
 	if actions == nil {
-		return nil
+		return 0, nil
 	}
-	zap.S().Infof("Persisting a batch of %d actions to the store",
-		len(actions))
+	zap.S().Infow("Persisting a batch of actions to the store",
+		zap.Int("actions", len(actions)))
 
-	// Convert the actions into generic interface to be compatible with
-	// InsertMany call.
+	// Convert the actions into generic interface to be compatible with the
+	// chunking.
 	var docs []interface{}
 	for _, action := range actions {
-		docs = append(docs, action)
+		docs = append(docs, newRecentActionDocument(action))
+	}
+
+	// Bulk upsert all these documents, a chunk at a time to stay within the
+	// limits of a single command. An upsert only matches a stored action
+	// whose content it edits, otherwise it is rejected by the unique index
+	// as a duplicate. The writes are unordered, so that the duplicates, and the
+	// documents rejected for any other reason, don't prevent the rest of the
+	// chunk from being written. The rejected documents are logged and
+	// skipped, otherwise the cursor would never move past them.
+	opt := options.BulkWrite().SetOrdered(false)
+	var summary writeSummary
+	for _, chunk := range chunkDocuments(docs, store.insertBatchSize) {
+		writes := make([]mongo.WriteModel, 0, len(chunk))
+		for _, doc := range chunk {
+			writes = append(writes, upsertModel(doc.(recentActionDocument)))
+		}
+		rejected, err := summary.add(store.recentActionsCollection.BulkWrite(
+			ctx, writes, opt))
+		if err != nil {
+			return 0, err
+		}
+		for _, writeErr := range rejected {
+			zap.S().Errorw("Skipping a rejected action",
+				zap.Any("action", rejectedDocument(chunk, writeErr.Index)),
+				zap.Error(writeErr))
+		}
 	}
+	summary.log(len(actions))
 
-	// Bulk update all these documents.
-	_, err := store.recentActionsCollection.InsertMany(context.TODO(), docs)
-	if err != nil {
-		// TODO: Add deep printing.
-		zap.S().Debugf("actions: %+v", actions)
-		return errors.Errorf("bulk insert failed with error [%v]", err)
+	return summary.inserted, nil
+}
+
+// writeSummary tallies the outcome of the chunks of a batch of upserts.
+type writeSummary struct {
+	duplicates int
+	rejected   int
+	edited     int64
+	inserted   int64
+}
+
+// add tallies the outcome of the bulk write of a chunk, and returns the
+// errors of the documents it rejected for any other reason than being
+// duplicates. It fails if the write failed as a whole.
+func (summary *writeSummary) add(result *mongo.BulkWriteResult,
+	err error) ([]mongo.WriteError, error) {
+	// The result counts the writes of a partially failed chunk as well.
+	if result != nil {
+		summary.edited += result.ModifiedCount
+		summary.inserted += result.UpsertedCount
+	}
+	if err == nil {
+		return nil, nil
 	}
+	duplicates, rejected, ok := splitWriteErrors(err)
+	if !ok {
+		return nil, errors.Errorf("bulk upsert failed with error [%v]", err)
+	}
+	summary.duplicates += duplicates
+	summary.rejected += len(rejected)
+	return rejected, nil
+}
 
-	return nil
+// log logs the non-zero counts of the summary of a batch of actions.
+func (summary writeSummary) log(actions int) {
+	if summary.duplicates > 0 {
+		zap.S().Infow("Skipped the duplicate actions",
+			zap.Int("duplicates", summary.duplicates),
+			zap.Int("actions", actions))
+	}
+	if summary.edited > 0 {
+		zap.S().Infow("Updated the edited actions",
+			zap.Int64("edited", summary.edited), zap.Int("actions", actions))
+	}
+	if summary.rejected > 0 {
+		zap.S().Warnw("Skipped the rejected actions",
+			zap.Int("rejected", summary.rejected),
+			zap.Int("actions", actions))
+	}
 }
 
-func (store *mongoStore) QueryRecentActions(startTimestamp, limit int64) (
+// storedEditTime is the expression of the edit time of a stored action, see
+// EditTimeSeconds.
+var storedEditTime = bson.M{
+	"$max": bson.A{
+		"$timeSeconds",
+		bson.M{"$ifNull": bson.A{"$blogEntry.modificationTimeSeconds", 0}},
+	},
+}
+
+// upsertModel replaces the stored copy of the action with the document if it
+// is a later edit, see EditTimeSeconds, whose content hash differs, and
+// inserts it if there is none. Hence an action that reappears with a later
+// time but the same content is skipped, while an edit replaces the stored
+// copy along with its activity time, which resurfaces an edited comment in
+// the feeds.
+// The copies stored without a hash are always replaced by a later edit.
+// The comment id of the blog actions is matched as null, just like the unique
+// index does.
+func upsertModel(doc recentActionDocument) mongo.WriteModel {
+	var blogEntryId, commentId interface{}
+	if doc.BlogEntry != nil {
+		blogEntryId = doc.BlogEntry.Id
+	}
+	if doc.Comment != nil {
+		commentId = doc.Comment.Id
+	}
+	filter := bson.M{
+		"blogEntry.id": blogEntryId,
+		"comment.id":   commentId,
+		"contentHash":  bson.M{"$ne": doc.ContentHash},
+		"$expr": bson.M{
+			"$lt": bson.A{storedEditTime, doc.EditTimeSeconds()},
+		},
+	}
+	return mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(doc).
+		SetUpsert(true)
+}
+
+// rejectedDocument returns the document of the chunk at the index reported by
+// a write error, or nil if the index is out of range.
+func rejectedDocument(chunk []interface{}, index int) interface{} {
+	if index < 0 || index >= len(chunk) {
+		return nil
+	}
+	return chunk[index]
+}
+
+// chunkDocuments splits the documents into consecutive chunks of at most size
+// documents. A non-positive size keeps all of them in a single chunk.
+func chunkDocuments(docs []interface{}, size int) [][]interface{} {
+	if size <= 0 || len(docs) <= size {
+		return [][]interface{}{docs}
+	}
+	var chunks [][]interface{}
+	for start := 0; start < len(docs); start += size {
+		end := start + size
+		if end > len(docs) {
+			end = len(docs)
+		}
+		chunks = append(chunks, docs[start:end])
+	}
+	return chunks
+}
+
+func (store *mongoStore) QueryRecentActions(ctx context.Context,
+	startTimestamp, limit int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsPaged(ctx, startTimestamp, limit, 0)
+}
+
+func (store *mongoStore) QueryRecentActionsPaged(ctx context.Context,
+	startTimestamp, limit, skip int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsSorted(ctx, startTimestamp, limit, skip,
+		sortDescending)
+}
+
+func (store *mongoStore) QueryRecentActionsSorted(ctx context.Context,
+	startTimestamp, limit, skip int64, order store.SortOrder) (
 	[]models.RecentAction, error) {
-	zap.S().Infof("Retrieving all actions after timestamp %d", startTimestamp)
+	zap.S().Infow("Retrieving the actions",
+		zap.Int64("startTimestamp", startTimestamp), zap.Int64("limit", limit),
+		zap.Int64("skip", skip), zap.Int("order", int(order)))
 
 	filter := bson.M{
 		"timeSeconds": bson.M{
@@ -69,33 +264,252 @@ func (store *mongoStore) QueryRecentActions(startTimestamp, limit int64) (
 		},
 	}
 
-	// Sort by decreasing order of activity time and add limits.
+	// Sort by activity time in the requested order and add limits.
+	direction := -1
+	if order == sortAscending {
+		direction = 1
+	}
+	opt := options.Find().SetSort(bson.M{"timeSeconds": direction})
+	opt.SetLimit(limit)
+	opt.SetSkip(skip)
+
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
+	if err != nil {
+		zap.S().Debugw("Filter for querying recent actions",
+			zap.Any("filter", filter))
+		return nil, errors.Errorf("could not query recent actions with error [%v]",
+			err)
+	}
+
+	var actions []models.RecentAction
+	if err := cursor.All(ctx, &actions); err != nil {
+		return nil, errors.Errorf("could not parse query actions "+
+			"with error [%v]", err)
+	}
+
+	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+
+	zap.S().Infow("Retrieved a batch of actions",
+		zap.Int("actions", len(actions)))
+	return actions, nil
+}
+
+func (store *mongoStore) QueryRecentActionsBefore(ctx context.Context,
+	endTimestamp, limit int64) ([]models.RecentAction, error) {
+	zap.S().Infow("Retrieving the actions",
+		zap.Int64("endTimestamp", endTimestamp), zap.Int64("limit", limit))
+
+	filter := bson.M{
+		"timeSeconds": bson.M{
+			"$lte": endTimestamp,
+		},
+		"blogEntry": bson.M{
+			"$exists": true,
+		},
+		"comment": bson.M{
+			"$exists": true,
+		},
+	}
 	opt := options.Find().SetSort(bson.M{"timeSeconds": -1})
 	opt.SetLimit(limit)
 
-	cursor, err := store.recentActionsCollection.Find(context.TODO(), filter, opt)
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
 	if err != nil {
-		zap.S().Debugf("Filter for querying recent actions: %+v", filter)
+		zap.S().Debugw("Filter for querying recent actions",
+			zap.Any("filter", filter))
 		return nil, errors.Errorf("could not query recent actions with error [%v]",
 			err)
 	}
 
 	var actions []models.RecentAction
-	if err := cursor.All(context.TODO(), &actions); err != nil {
+	if err := cursor.All(ctx, &actions); err != nil {
+		return nil, errors.Errorf("could not parse query actions "+
+			"with error [%v]", err)
+	}
+
+	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+	return actions, nil
+}
+
+func (store *mongoStore) StreamRecentActions(ctx context.Context,
+	startTimestamp int64) (<-chan models.RecentAction, <-chan error) {
+	return newActionStream(ctx, func(
+		send func(models.RecentAction) error) error {
+		zap.S().Infow("Streaming the actions",
+			zap.Int64("startTimestamp", startTimestamp))
+
+		filter := bson.M{
+			"timeSeconds": bson.M{
+				"$gte": startTimestamp,
+			},
+		}
+		opt := options.Find().SetSort(bson.M{"timeSeconds": 1})
+
+		// The cursor fetches the documents in batches as it is iterated,
+		// hence only a single batch is ever held in memory.
+		cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
+		if err != nil {
+			return errors.Errorf("could not query recent actions "+
+				"with error [%v]", err)
+		}
+		defer cursor.Close(context.Background())
+
+		for cursor.Next(ctx) {
+			actions := make([]models.RecentAction, 1)
+			if err := cursor.Decode(&actions[0]); err != nil {
+				return errors.Errorf("could not parse action with error [%v]",
+					err)
+			}
+			utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+			if err := send(actions[0]); err != nil {
+				return err
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return errors.Errorf("could not iterate recent actions "+
+				"with error [%v]", err)
+		}
+		return nil
+	})
+}
+
+func (store *mongoStore) QueryRecentActionsByHandle(ctx context.Context,
+	handle string, startTimestamp, limit int64) ([]models.RecentAction, error) {
+	zap.S().Infow("Retrieving the actions by handle",
+		zap.String("handle", handle),
+		zap.Int64("startTimestamp", startTimestamp))
+
+	// Codeforces handles are case-insensitive, so match the whole field
+	// against an escaped, case-insensitive pattern.
+	handleRegex := primitive.Regex{
+		Pattern: "^" + regexp.QuoteMeta(handle) + "$",
+		Options: "i",
+	}
+
+	// The author of a comment is the commentator, while the author of a blog
+	// is the one who wrote it.
+	filter := bson.M{
+		"timeSeconds": bson.M{
+			"$gte": startTimestamp,
+		},
+		"$or": []bson.M{
+			{
+				"comment.commentatorHandle": handleRegex,
+			},
+			{
+				"comment": bson.M{
+					"$exists": false,
+				},
+				"blogEntry.authorHandle": handleRegex,
+			},
+		},
+	}
+
+	// Sort by decreasing order of activity time and add limits.
+	opt := options.Find().SetSort(bson.M{"timeSeconds": -1})
+	opt.SetLimit(limit)
+
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
+	if err != nil {
+		zap.S().Debugw("Filter for querying actions by handle",
+			zap.Any("filter", filter))
+		return nil, errors.Errorf("could not query recent actions by handle "+
+			"with error [%v]", err)
+	}
+
+	var actions []models.RecentAction
+	if err := cursor.All(ctx, &actions); err != nil {
+		return nil, errors.Errorf("could not parse query actions "+
+			"with error [%v]", err)
+	}
+
+	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+
+	zap.S().Infow("Retrieved a batch of actions by handle",
+		zap.String("handle", handle), zap.Int("actions", len(actions)))
+	return actions, nil
+}
+
+func (store *mongoStore) GetRecentAction(ctx context.Context, id string) (
+	models.RecentAction, error) {
+	zap.S().Infow("Retrieving the action", zap.String("id", id))
+
+	blogEntryId, commentId, err := models.ParseActionId(id)
+	if err != nil {
+		return models.RecentAction{}, err
+	}
+
+	// Blog actions don't have a comment at all, mirroring the unique index.
+	filter := bson.M{
+		"blogEntry.id": blogEntryId,
+		"comment.id":   commentId,
+	}
+	if commentId == 0 {
+		filter = bson.M{
+			"blogEntry.id": blogEntryId,
+			"comment": bson.M{
+				"$exists": false,
+			},
+		}
+	}
+
+	var action models.RecentAction
+	err = store.recentActionsCollection.FindOne(ctx, filter).Decode(&action)
+	if err == mongo.ErrNoDocuments {
+		return models.RecentAction{}, errNotFound
+	}
+	if err != nil {
+		return models.RecentAction{}, errors.Errorf("could not query action "+
+			"%s with error [%v]", id, err)
+	}
+
+	actions := []models.RecentAction{action}
+	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+	return actions[0], nil
+}
+
+// SearchRecentActions relies on the text index, hence the query is matched
+// against whole words, with stemming, rather than as a substring.
+func (store *mongoStore) SearchRecentActions(ctx context.Context,
+	query string, limit int64) ([]models.RecentAction, error) {
+	zap.S().Infow("Searching the actions", zap.String("query", query))
+
+	filter := bson.M{
+		"$text": bson.M{
+			"$search": query,
+		},
+	}
+
+	// Sort by decreasing order of activity time rather than relevance, just
+	// like the feeds.
+	opt := options.Find().SetSort(bson.M{"timeSeconds": -1})
+	opt.SetLimit(limit)
+
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
+	if err != nil {
+		zap.S().Debugw("Filter for searching actions", zap.Any("filter", filter))
+		return nil, errors.Errorf("could not search recent actions "+
+			"with error [%v]", err)
+	}
+
+	var actions []models.RecentAction
+	if err := cursor.All(ctx, &actions); err != nil {
 		return nil, errors.Errorf("could not parse query actions "+
 			"with error [%v]", err)
 	}
 
 	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
 
-	zap.S().Infof("Retrieved a batch of %d activities", len(actions))
+	zap.S().Infow("Retrieved a batch of matching actions",
+		zap.String("query", query), zap.Int("actions", len(actions)))
 	return actions, nil
 }
 
-func (store *mongoStore) QueryCommentsFromBlog(id int, startTimestamp, limit int64) (
-	[]models.Comment, error) {
-	zap.S().Infof("Retrieving comments from blog %d after timestamp %d",
-		id, startTimestamp)
+func (store *mongoStore) QueryCommentsFromBlog(ctx context.Context, id int,
+	startTimestamp, limit int64) ([]models.Comment, error) {
+	zap.S().Infow("Retrieving the comments of the blog entry",
+		zap.Int("blogEntryId", id),
+		zap.Int64("startTimestamp", startTimestamp))
 
 	// Create a filter to query all comments from a blog with timestamp greater
 	// than or equal to the given timestamp.
@@ -116,15 +530,16 @@ func (store *mongoStore) QueryCommentsFromBlog(id int, startTimestamp, limit int
 	opt.SetSort(bson.M{"timeSeconds": -1})
 	opt.SetLimit(limit)
 
-	cursor, err := store.recentActionsCollection.Find(context.TODO(), filter, opt)
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
 	if err != nil {
-		zap.S().Debugf("Filter for querying comments from blogs: %+v", filter)
+		zap.S().Debugw("Filter for querying comments from blogs",
+			zap.Any("filter", filter))
 		return nil, errors.Errorf("could not query comments with error [%v]",
 			err)
 	}
 
 	var actions []models.RecentAction
-	if err := cursor.All(context.TODO(), &actions); err != nil {
+	if err := cursor.All(ctx, &actions); err != nil {
 		return nil, errors.Errorf("could not decode actions "+
 			"with error [%v]", err)
 	}
@@ -138,18 +553,19 @@ func (store *mongoStore) QueryCommentsFromBlog(id int, startTimestamp, limit int
 			comments = append(comments, *action.Comment)
 		}
 	}
-	zap.S().Infof("Retrieved a batch of %d comments for blog %d",
-		len(comments), id)
+	zap.S().Infow("Retrieved a batch of comments of the blog entry",
+		zap.Int("blogEntryId", id), zap.Int("comments", len(comments)))
 
 	return comments, nil
 }
 
-func (store *mongoStore) QueryAllUniqueBlogs(startTimestamp, limit int64) (
-	[]models.BlogEntry, error) {
+func (store *mongoStore) QueryAllUniqueBlogs(ctx context.Context,
+	startTimestamp, limit int64) ([]models.BlogEntry, error) {
 	return nil, nil
 }
 
-func (store *mongoStore) LastRecordedTimestampForRecentActions() int64 {
+func (store *mongoStore) LastRecordedTimestampForRecentActions(
+	ctx context.Context) int64 {
 	// Create the filter to compute the maximum value of a field.
 	filter := []bson.M{{
 		"$group": bson.M{
@@ -161,22 +577,22 @@ func (store *mongoStore) LastRecordedTimestampForRecentActions() int64 {
 	}
 
 	// Make an aggregation call.
-	cursor, err := store.recentActionsCollection.Aggregate(context.TODO(),
+	cursor, err := store.recentActionsCollection.Aggregate(ctx,
 		filter)
 	if err != nil {
-		zap.S().Errorf("Querying the max recorded activity timestamp failed "+
-			"with error %v", err)
+		zap.S().Errorw("Querying the max recorded activity timestamp failed",
+			zap.Error(err))
 		return 0
 	}
 
 	// The result set should only contain one document. Decode it.
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		res := struct {
 			Max int64 `bson:"max"`
 		}{}
 		if err := cursor.Decode(&res); err != nil {
-			zap.S().Errorf("Decoding of max activity timestamp failed "+
-				"with error %v", err)
+			zap.S().Errorw("Decoding of max activity timestamp failed",
+				zap.Error(err))
 			return 0
 		}
 		return res.Max
@@ -184,30 +600,81 @@ func (store *mongoStore) LastRecordedTimestampForRecentActions() int64 {
 	return 0
 }
 
-func (store *mongoStore) AddUser(user *models.User) error {
+func (store *mongoStore) CountRecentActions(ctx context.Context) (
+	int64, error) {
+	count, err := store.recentActionsCollection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, errors.Errorf("could not count recent actions "+
+			"with error [%v]", err)
+	}
+	return count, nil
+}
+
+func (store *mongoStore) DeleteActionsBefore(ctx context.Context,
+	timestamp int64) (int64, error) {
+	res, err := store.recentActionsCollection.DeleteMany(ctx,
+		bson.M{"timeSeconds": bson.M{"$lt": timestamp}})
+	if err != nil {
+		return 0, errors.Errorf("could not delete the actions before %d "+
+			"with error [%v]", timestamp, err)
+	}
+	return res.DeletedCount, nil
+}
+
+func (store *mongoStore) SaveCursor(ctx context.Context,
+	timestamp int64) error {
+	filter := bson.M{"_id": store.recentActionsCollectionName}
+	update := bson.M{"$set": bson.M{"timestamp": timestamp}}
+	opt := options.Update().SetUpsert(true)
+	if _, err := store.cursorsCollection.UpdateOne(ctx, filter, update,
+		opt); err != nil {
+		return errors.Errorf("could not save cursor %d with error [%v]",
+			timestamp, err)
+	}
+	return nil
+}
+
+func (store *mongoStore) LoadCursor(ctx context.Context) (int64, error) {
+	filter := bson.M{"_id": store.recentActionsCollectionName}
+	res := struct {
+		Timestamp int64 `bson:"timestamp"`
+	}{}
+	err := store.cursorsCollection.FindOne(ctx, filter).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Errorf("could not load cursor with error [%v]", err)
+	}
+	return res.Timestamp, nil
+}
+
+func (store *mongoStore) AddUser(ctx context.Context,
+	user *models.User) error {
 	if user == nil {
 		return nil
 	}
-	zap.S().Infof("Adding user [username: %s, uuid: %s] to the store",
-		user.Username, user.Uuid)
+	zap.S().Infow("Adding the user to the store",
+		zap.String("username", user.Username), zap.String("uuid", user.Uuid))
 
 	if _, err := store.usersCollection.InsertOne(
-		context.TODO(), user); err != nil {
+		ctx, user); err != nil {
 		return errors.Errorf("could not insert user: %+v to the store "+
 			"with error [%v]", *user, err)
 	}
 	return nil
 }
 
-func (store *mongoStore) QueryUserByUuid(uuid string) (*models.User, error) {
-	zap.S().Infof("Querying the store for uuid %s", uuid)
+func (store *mongoStore) QueryUserByUuid(ctx context.Context, uuid string) (
+	*models.User, error) {
+	zap.S().Infow("Querying the store for the user", zap.String("uuid", uuid))
 	// Create the filter to query the user.
 	filter := bson.M{
 		"uuid": uuid,
 	}
 
 	// Query the store.
-	res := store.usersCollection.FindOne(context.TODO(), filter)
+	res := store.usersCollection.FindOne(ctx, filter)
 	if res.Err() != nil {
 		return nil, errors.Errorf("could not query user with uuid %s "+
 			"with error [%v]", uuid, res.Err())
@@ -223,12 +690,12 @@ func (store *mongoStore) QueryUserByUuid(uuid string) (*models.User, error) {
 	return user, nil
 }
 
-func (store *mongoStore) QueryRecentActionsForUser(uuid string,
-	startTimestamp, limit int64) ([]models.RecentAction, error) {
-	zap.S().Infof("Retrieving all actions for user %s after timestamp %d",
-		uuid, startTimestamp)
+func (store *mongoStore) QueryRecentActionsForUser(ctx context.Context,
+	uuid string, startTimestamp, limit int64) ([]models.RecentAction, error) {
+	zap.S().Infow("Retrieving the actions of the user",
+		zap.String("uuid", uuid), zap.Int64("startTimestamp", startTimestamp))
 
-	user, err := store.QueryUserByUuid(uuid)
+	user, err := store.QueryUserByUuid(ctx, uuid)
 	if err != nil {
 		return nil, errors.Errorf("uuid to user conversion failed with eror [%v]",
 			err)
@@ -256,29 +723,32 @@ func (store *mongoStore) QueryRecentActionsForUser(uuid string,
 	opt.SetLimit(limit)
 
 	// Query all the documents.
-	cursor, err := store.recentActionsCollection.Find(context.TODO(), filter, opt)
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
 	if err != nil {
-		zap.S().Debugf("Filter for querying recent actions: %+v", filter)
+		zap.S().Debugw("Filter for querying recent actions",
+			zap.Any("filter", filter))
 		return nil,
 			errors.Errorf("could not query recent actions with error [%v]", err)
 	}
 
 	// Unmarshal the results.
 	var actions []models.RecentAction
-	if err := cursor.All(context.TODO(), &actions); err != nil {
+	if err := cursor.All(ctx, &actions); err != nil {
 		return nil, errors.Errorf("could not parse query actions "+
 			"with error [%v]", err)
 	}
 
 	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
 
-	zap.S().Infof("Retrieved a batch of %d activities for user %s",
-		len(actions), user.Uuid)
+	zap.S().Infow("Retrieved a batch of actions of the user",
+		zap.String("uuid", user.Uuid), zap.Int("actions", len(actions)))
 	return actions, nil
 }
 
-func (store *mongoStore) SubscribeToBlogs(uuid string, ids ...int) error {
-	zap.S().Infof("User %s is subscribing to blogs %v", uuid, ids)
+func (store *mongoStore) SubscribeToBlogs(ctx context.Context, uuid string,
+	ids ...int) error {
+	zap.S().Infow("User is subscribing to blogs", zap.String("uuid", uuid),
+		zap.Ints("blogEntryIds", ids))
 
 	// Create the filters to query and update the user's data.
 	findFilter := bson.M{
@@ -292,7 +762,7 @@ func (store *mongoStore) SubscribeToBlogs(uuid string, ids ...int) error {
 		},
 	}
 
-	_, err := store.updateSingleUser(findFilter, updateFilter)
+	_, err := store.updateSingleUser(ctx, findFilter, updateFilter)
 	if err != nil {
 		return errors.Errorf("user %s could not subscribe to blogs "+
 			"with error [%v]", uuid, err)
@@ -301,8 +771,10 @@ func (store *mongoStore) SubscribeToBlogs(uuid string, ids ...int) error {
 	return nil
 }
 
-func (store *mongoStore) UnsubscribeFromBlogs(uuid string, ids ...int) error {
-	zap.S().Infof("User %s is unsubscribing from blogs %v", uuid, ids)
+func (store *mongoStore) UnsubscribeFromBlogs(ctx context.Context,
+	uuid string, ids ...int) error {
+	zap.S().Infow("User is unsubscribing from blogs",
+		zap.String("uuid", uuid), zap.Ints("blogEntryIds", ids))
 
 	// Create the filters to query and update the user's data.
 	findFilter := bson.M{
@@ -314,7 +786,7 @@ func (store *mongoStore) UnsubscribeFromBlogs(uuid string, ids ...int) error {
 		},
 	}
 
-	_, err := store.updateSingleUser(findFilter, updateFilter)
+	_, err := store.updateSingleUser(ctx, findFilter, updateFilter)
 	if err != nil {
 		return errors.Errorf("user %s could not unsubscribe from blogs "+
 			"with error [%v]", uuid, err)
@@ -327,14 +799,14 @@ func (store *mongoStore) UnsubscribeFromBlogs(uuid string, ids ...int) error {
 // the filter provided.
 //
 // It returns the document as it was before the update.
-func (store *mongoStore) updateSingleUser(findFilter, updateFilter interface{}) (
+func (store *mongoStore) updateSingleUser(ctx context.Context,
+	findFilter, updateFilter interface{}) (
 	oldUser *models.User, err error) {
-	zap.S().Infof("Updating single user using the below filters")
-	zap.S().Infof("find filter %+v", findFilter)
-	zap.S().Infof("update filter %+v", updateFilter)
+	zap.S().Infow("Updating a single user", zap.Any("findFilter", findFilter),
+		zap.Any("updateFilter", updateFilter))
 
 	// Find the user's entry and update it.
-	res := store.usersCollection.FindOneAndUpdate(context.TODO(),
+	res := store.usersCollection.FindOneAndUpdate(ctx,
 		findFilter, updateFilter)
 	if res.Err() != nil {
 		return nil, errors.Errorf("updation of single user failed "+
@@ -351,12 +823,48 @@ func (store *mongoStore) updateSingleUser(findFilter, updateFilter interface{})
 	return oldUser, nil
 }
 
-// NewMongoStore creates a new instance of the mongo store.
-func NewMongoStore(mongoURI, databaseName string) (store.CodeforcesStore, error) {
-	// For security reasons, don't log the mongoURI.
-	zap.S().Infof("Attempting to create a new mongo store. "+
-		"DatabaseName = %s", databaseName)
+// Ping checks that the primary of the underlying mongo cluster is reachable.
+func (store *mongoStore) Ping(ctx context.Context) error {
+	if err := store.mongoClient.Ping(ctx, readpref.Primary()); err != nil {
+		return errors.Errorf("could not ping primary with error [%v]", err)
+	}
+	return nil
+}
 
+// Close disconnects the underlying mongo client.
+func (store *mongoStore) Close(ctx context.Context) error {
+	zap.S().Infow("Disconnecting the mongo store")
+	if err := store.mongoClient.Disconnect(ctx); err != nil {
+		return errors.Errorf("could not disconnect mongo client "+
+			"with error [%v]", err)
+	}
+	return nil
+}
+
+// connect connects to MongoDB and pings the primary, retrying according to
+// the connect options of the store.
+func (store *mongoStore) connect(mongoURI string) (*mongo.Client, error) {
+	delay := store.connectBaseDelay
+	for attempt := 1; ; attempt++ {
+		client, err := connectOnce(mongoURI)
+		if err == nil {
+			return client, nil
+		}
+		if attempt >= store.connectAttempts {
+			return nil, errors.Errorf("could not connect to mongo after "+
+				"%d attempts with error [%v]", attempt, err)
+		}
+
+		zap.S().Warnw("Connecting to mongo failed, retrying",
+			zap.Int("attempt", attempt), zap.Duration("delay", delay),
+			zap.Error(err))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// connectOnce makes a single attempt to connect to MongoDB.
+func connectOnce(mongoURI string) (*mongo.Client, error) {
 	// Create a new client and connect to the server
 	client, err := mongo.Connect(
 		context.TODO(),
@@ -369,15 +877,50 @@ func NewMongoStore(mongoURI, databaseName string) (store.CodeforcesStore, error)
 
 	// Ping the primary
 	if err := client.Ping(context.TODO(), readpref.Primary()); err != nil {
+		client.Disconnect(context.TODO())
 		return nil, errors.Errorf("could not ping primary with error [%v]", err)
 	}
 
+	return client, nil
+}
+
+// NewMongoStore creates a new instance of the mongo store.
+// Recent actions older than the retention are purged automatically, unless the
+// retention is non-positive. If MongoDB is not available yet, the connection
+// is retried, see WithConnectRetries.
+func NewMongoStore(mongoURI, databaseName string,
+	retention time.Duration, opts ...Option) (store.CodeforcesStore, error) {
+	// For security reasons, don't log the mongoURI.
 	mStore := new(mongoStore)
+	mStore.retention = retention
+	mStore.recentActionsCollectionName = kDefaultRecentActionsCollectionName
+	mStore.insertBatchSize = kDefaultInsertBatchSize
+	mStore.connectAttempts = kDefaultConnectAttempts
+	mStore.connectBaseDelay = kDefaultConnectBaseDelay
+	for _, opt := range opts {
+		opt(mStore)
+	}
+	zap.S().Infow("Attempting to create a new mongo store",
+		zap.String("databaseName", databaseName),
+		zap.String("collection", mStore.recentActionsCollectionName))
+
+	client, err := mStore.connect(mongoURI)
+	if err != nil {
+		return nil, err
+	}
+
 	mStore.mongoClient = client
 	mStore.recentActionsCollection = client.Database(databaseName).
-		Collection(kRecentActionsCollectionName)
+		Collection(mStore.recentActionsCollectionName)
 	mStore.usersCollection = client.Database(databaseName).
 		Collection(kUsersCollectionName)
+	mStore.cursorsCollection = client.Database(databaseName).
+		Collection(kCursorsCollectionName)
+
+	if err := mStore.createIndexes(context.TODO()); err != nil {
+		return nil, errors.Errorf("could not create indexes with error [%v]",
+			err)
+	}
 
 	return mStore, nil
 }
@@ -0,0 +1,266 @@
+package mongodb_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store/mongodb"
+)
+
+var _ = Describe("ChunkDocuments", func() {
+	newDocs := func(count int) []interface{} {
+		docs := make([]interface{}, count)
+		for ind := range docs {
+			docs[ind] = ind
+		}
+		return docs
+	}
+
+	It("should split a large batch into ordered chunks", func() {
+		docs := newDocs(2500)
+
+		chunks := mongodb.ChunkDocuments(docs, 1000)
+		Expect(chunks).Should(HaveLen(3))
+		Expect(chunks[0]).Should(HaveLen(1000))
+		Expect(chunks[1]).Should(HaveLen(1000))
+		Expect(chunks[2]).Should(HaveLen(500))
+
+		var joined []interface{}
+		for _, chunk := range chunks {
+			joined = append(joined, chunk...)
+		}
+		Expect(joined).Should(Equal(docs))
+	})
+
+	It("should keep a small batch in a single chunk", func() {
+		Expect(mongodb.ChunkDocuments(newDocs(1000), 1000)).Should(HaveLen(1))
+		Expect(mongodb.ChunkDocuments(newDocs(5), 0)).Should(HaveLen(1))
+	})
+})
+
+var _ = Describe("SplitWriteErrors", func() {
+	writeErr := func(index, code int) mongo.BulkWriteError {
+		return mongo.BulkWriteError{
+			WriteError: mongo.WriteError{Index: index, Code: code},
+		}
+	}
+
+	It("should skip the duplicates and the rejected documents", func() {
+		duplicates, rejected, ok := mongodb.SplitWriteErrors(
+			mongo.BulkWriteException{
+				WriteErrors: []mongo.BulkWriteError{
+					writeErr(0, 11000), writeErr(3, 2), writeErr(4, 11000),
+				},
+			})
+		Expect(ok).Should(BeTrue())
+		Expect(duplicates).Should(Equal(2))
+		Expect(rejected).Should(HaveLen(1))
+		Expect(rejected[0].Index).Should(Equal(3))
+	})
+
+	It("should fail the whole insertion on other errors", func() {
+		_, _, ok := mongodb.SplitWriteErrors(errors.New("connection reset"))
+		Expect(ok).Should(BeFalse())
+
+		_, _, ok = mongodb.SplitWriteErrors(mongo.BulkWriteException{
+			WriteConcernError: &mongo.WriteConcernError{Code: 64},
+			WriteErrors:       []mongo.BulkWriteError{writeErr(0, 11000)},
+		})
+		Expect(ok).Should(BeFalse())
+
+		// A bulk write exception without write errors failed as a whole.
+		_, _, ok = mongodb.SplitWriteErrors(mongo.BulkWriteException{
+			Labels: []string{"NetworkError"},
+		})
+		Expect(ok).Should(BeFalse())
+		_, _, ok = mongodb.SplitWriteErrors(nil)
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should not reject anything when all are duplicates", func() {
+		duplicates, rejected, ok := mongodb.SplitWriteErrors(
+			mongo.BulkWriteException{
+				WriteErrors: []mongo.BulkWriteError{
+					writeErr(0, 11000), writeErr(1, 11000),
+				},
+			})
+		Expect(ok).Should(BeTrue())
+		Expect(duplicates).Should(Equal(2))
+		Expect(rejected).Should(BeEmpty())
+	})
+
+	It("should find the bulk write exception in a wrapped error", func() {
+		duplicates, rejected, ok := mongodb.SplitWriteErrors(fmt.Errorf(
+			"insertion failed: %w", mongo.BulkWriteException{
+				WriteErrors: []mongo.BulkWriteError{
+					writeErr(0, 11000), writeErr(1, 121),
+				},
+			}))
+		Expect(ok).Should(BeTrue())
+		Expect(duplicates).Should(Equal(1))
+		Expect(rejected).Should(HaveLen(1))
+		Expect(rejected[0].Code).Should(Equal(121))
+	})
+})
+
+var _ = Describe("SummarizeWrites", func() {
+	writeErr := func(index, code int) mongo.BulkWriteError {
+		return mongo.BulkWriteError{
+			WriteError: mongo.WriteError{Index: index, Code: code},
+		}
+	}
+
+	It("should count the duplicates and the edits of all the chunks", func() {
+		duplicates, rejected, edited, err := mongodb.SummarizeWrites(
+			[]*mongo.BulkWriteResult{
+				{ModifiedCount: 1},
+				{ModifiedCount: 2},
+				nil,
+			},
+			[]error{
+				nil,
+				mongo.BulkWriteException{
+					WriteErrors: []mongo.BulkWriteError{
+						writeErr(0, 11000), writeErr(1, 11000),
+					},
+				},
+				mongo.BulkWriteException{
+					WriteErrors: []mongo.BulkWriteError{
+						writeErr(0, 11000), writeErr(2, 2),
+					},
+				},
+			})
+		Expect(err).Should(BeNil())
+		Expect(duplicates).Should(Equal(3))
+		Expect(rejected).Should(Equal(1))
+		Expect(edited).Should(Equal(int64(3)))
+	})
+
+	It("should fail on a chunk that failed as a whole", func() {
+		_, _, _, err := mongodb.SummarizeWrites(
+			[]*mongo.BulkWriteResult{nil},
+			[]error{errors.New("connection reset")})
+		Expect(err).Should(MatchError(ContainSubstring("connection reset")))
+	})
+})
+
+var _ = Describe("Retention", func() {
+	It("should update the expiry of the existing index", func() {
+		Expect(mongodb.RetentionCommand("recent_actions", 3600)).Should(Equal(
+			bson.D{
+				{Key: "collMod", Value: "recent_actions"},
+				{Key: "index", Value: bson.D{
+					{Key: "name", Value: "retention"},
+					{Key: "expireAfterSeconds", Value: int32(3600)},
+				}},
+			}))
+	})
+
+	It("should match the command errors by code", func() {
+		conflict := mongo.CommandError{Code: 85, Name: "IndexOptionsConflict"}
+		Expect(mongodb.HasErrorCode(conflict, 27, 85)).Should(BeTrue())
+		Expect(mongodb.HasErrorCode(conflict, 27)).Should(BeFalse())
+		Expect(mongodb.HasErrorCode(errors.New("connection reset"), 85)).
+			Should(BeFalse())
+		Expect(mongodb.HasErrorCode(nil, 85)).Should(BeFalse())
+	})
+})
+
+var _ = Describe("NewMongoStore", func() {
+	It("should give up after the configured attempts", func() {
+		// Nothing listens on the port, hence every ping fails promptly.
+		uri := "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=50" +
+			"&connectTimeoutMS=50"
+
+		start := time.Now()
+		_, err := mongodb.NewMongoStore(uri, "cfrss-test", 0,
+			mongodb.WithConnectRetries(3, 20*time.Millisecond))
+		Expect(err).Should(MatchError(ContainSubstring("after 3 attempts")))
+		Expect(time.Since(start)).Should(
+			BeNumerically(">=", 60*time.Millisecond))
+	})
+})
+
+var _ = Describe("UpsertModel", func() {
+	It("should only replace the earlier edits of an action", func() {
+		action := models.RecentAction{
+			TimeSeconds: 100,
+			BlogEntry: &models.BlogEntry{
+				Id:                      101,
+				ModificationTimeSeconds: 150,
+			},
+		}
+		model := mongodb.UpsertModel(action)
+
+		replace, ok := model.(*mongo.ReplaceOneModel)
+		Expect(ok).Should(BeTrue())
+		Expect(*replace.Upsert).Should(BeTrue())
+
+		filter, ok := replace.Filter.(bson.M)
+		Expect(ok).Should(BeTrue())
+		Expect(filter).Should(HaveKeyWithValue("blogEntry.id", 101))
+		// The blog actions have no comment, which is indexed as null.
+		Expect(filter).Should(HaveKeyWithValue("comment.id", BeNil()))
+		Expect(filter["$expr"]).Should(HaveKeyWithValue("$lt",
+			ContainElement(int64(150))))
+		// The copies with the same content are left as is.
+		Expect(filter).Should(HaveKeyWithValue("contentHash",
+			bson.M{"$ne": action.ContentHash()}))
+	})
+
+	It("should match a comment by its blog entry and comment ids", func() {
+		action := models.RecentAction{
+			TimeSeconds: 300,
+			BlogEntry: &models.BlogEntry{
+				Id:                      101,
+				ModificationTimeSeconds: 150,
+			},
+			Comment: &models.Comment{Id: 7, Text: "Edited"},
+		}
+		replace := mongodb.UpsertModel(action).(*mongo.ReplaceOneModel)
+
+		filter := replace.Filter.(bson.M)
+		Expect(filter).Should(HaveKeyWithValue("blogEntry.id", 101))
+		Expect(filter).Should(HaveKeyWithValue("comment.id", 7))
+		// The edit time of the comment is its activity time, which is later
+		// than the modification of its blog entry, and it is compared to the
+		// edit time of the stored copy.
+		Expect(filter["$expr"]).Should(Equal(bson.M{
+			"$lt": bson.A{
+				bson.M{"$max": bson.A{
+					"$timeSeconds",
+					bson.M{"$ifNull": bson.A{
+						"$blogEntry.modificationTimeSeconds", 0}},
+				}},
+				int64(300),
+			},
+		}))
+	})
+
+	It("should replace the stored copy with the whole document", func() {
+		action := models.RecentAction{
+			TimeSeconds: 300,
+			BlogEntry:   &models.BlogEntry{Id: 101},
+			Comment:     &models.Comment{Id: 7, Text: "Edited"},
+		}
+		replace := mongodb.UpsertModel(action).(*mongo.ReplaceOneModel)
+
+		raw, err := bson.Marshal(replace.Replacement)
+		Expect(err).Should(BeNil())
+		var doc bson.M
+		Expect(bson.Unmarshal(raw, &doc)).Should(Succeed())
+		Expect(doc).Should(HaveKeyWithValue("timeSeconds", int64(300)))
+		Expect(doc).Should(HaveKeyWithValue("contentHash",
+			action.ContentHash()))
+		Expect(doc).Should(HaveKey("createdAt"))
+		Expect(doc["comment"]).Should(HaveKeyWithValue("text", "Edited"))
+	})
+})
@@ -0,0 +1,225 @@
+package mongodb_test
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/mongodb"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+)
+
+func TestMongoDB(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MongoDB Suite")
+}
+
+// TestMongoStoreContract runs against the MongoDB at CFRSS_TEST_MONGO_URL,
+// whose cfrss-storetest database is emptied before each test.
+func TestMongoStoreContract(t *testing.T) {
+	mongoUrl := os.Getenv("CFRSS_TEST_MONGO_URL")
+	if mongoUrl == "" {
+		t.Skip("CFRSS_TEST_MONGO_URL is not set")
+	}
+
+	storetest.RunStoreTests(t, func() store.CodeforcesStore {
+		ctx := context.Background()
+		mongoStore, err := mongodb.NewMongoStore(mongoUrl, "cfrss-storetest", 0)
+		if err != nil {
+			t.Fatalf("could not open the store with error [%v]", err)
+		}
+		if _, err := mongoStore.DeleteActionsBefore(ctx,
+			math.MaxInt64); err != nil {
+			t.Fatalf("could not empty the store with error [%v]", err)
+		}
+		if err := mongoStore.SaveCursor(ctx, 0); err != nil {
+			t.Fatalf("could not reset the cursor with error [%v]", err)
+		}
+		return mongoStore
+	})
+}
+
+// TestMongoStoreCollections checks that the stores sharing the database of
+// CFRSS_TEST_MONGO_URL under distinct collections keep their own actions and
+// cursors.
+func TestMongoStoreCollections(t *testing.T) {
+	mongoUrl := os.Getenv("CFRSS_TEST_MONGO_URL")
+	if mongoUrl == "" {
+		t.Skip("CFRSS_TEST_MONGO_URL is not set")
+	}
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	var stores []store.CodeforcesStore
+	for _, name := range []string{"actions_a", "actions_b"} {
+		mongoStore, err := mongodb.NewMongoStore(mongoUrl, "cfrss-storetest",
+			0, mongodb.WithCollectionName(name))
+		g.Expect(err).Should(BeNil())
+		defer mongoStore.Close(ctx)
+		_, err = mongoStore.DeleteActionsBefore(ctx, math.MaxInt64)
+		g.Expect(err).Should(BeNil())
+		stores = append(stores, mongoStore)
+	}
+
+	g.Expect(stores[0].AddRecentActions(ctx, []models.RecentAction{{
+		TimeSeconds: 10,
+		BlogEntry:   &models.BlogEntry{Id: 1},
+		Comment:     &models.Comment{Id: 1},
+	}})).Error().Should(Succeed())
+	g.Expect(stores[0].SaveCursor(ctx, 10)).Should(Succeed())
+	g.Expect(stores[1].SaveCursor(ctx, 20)).Should(Succeed())
+
+	g.Expect(stores[0].CountRecentActions(ctx)).Should(Equal(int64(1)))
+	g.Expect(stores[1].CountRecentActions(ctx)).Should(BeZero())
+	g.Expect(stores[0].LoadCursor(ctx)).Should(Equal(int64(10)))
+	g.Expect(stores[1].LoadCursor(ctx)).Should(Equal(int64(20)))
+}
+
+// TestMongoStoreDuplicates checks that the store opens a collection of the
+// MongoDB at CFRSS_TEST_MONGO_URL written before the unique index existed,
+// keeping the latest edit of each duplicated action.
+func TestMongoStoreDuplicates(t *testing.T) {
+	mongoUrl := os.Getenv("CFRSS_TEST_MONGO_URL")
+	if mongoUrl == "" {
+		t.Skip("CFRSS_TEST_MONGO_URL is not set")
+	}
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoUrl))
+	g.Expect(err).Should(BeNil())
+	defer client.Disconnect(ctx)
+	collection := client.Database("cfrss-storetest").
+		Collection("duplicate_actions")
+	g.Expect(collection.Drop(ctx)).Should(Succeed())
+
+	action := func(ts int64, text string) interface{} {
+		return models.RecentAction{
+			TimeSeconds: ts,
+			BlogEntry:   &models.BlogEntry{Id: 1},
+			Comment:     &models.Comment{Id: 1, Text: text},
+		}
+	}
+	_, err = collection.InsertMany(ctx, []interface{}{
+		action(10, "Original"), action(30, "Edited"), action(20, "Stale"),
+		models.RecentAction{TimeSeconds: 5, BlogEntry: &models.BlogEntry{Id: 1}},
+	})
+	g.Expect(err).Should(BeNil())
+
+	mongoStore, err := mongodb.NewMongoStore(mongoUrl, "cfrss-storetest", 0,
+		mongodb.WithCollectionName("duplicate_actions"))
+	g.Expect(err).Should(BeNil())
+	defer mongoStore.Close(ctx)
+
+	g.Expect(collection.CountDocuments(ctx, bson.M{})).
+		Should(Equal(int64(2)))
+	res, err := mongoStore.GetRecentAction(ctx, "1-1")
+	g.Expect(err).Should(BeNil())
+	g.Expect(res.Comment.Text).Should(Equal("Edited"))
+}
+
+// TestMongoStoreRetention checks that the retention of a collection of the
+// MongoDB at CFRSS_TEST_MONGO_URL can be changed, and disabled, across
+// restarts, and that the documents inserted without a creation date get one.
+func TestMongoStoreRetention(t *testing.T) {
+	mongoUrl := os.Getenv("CFRSS_TEST_MONGO_URL")
+	if mongoUrl == "" {
+		t.Skip("CFRSS_TEST_MONGO_URL is not set")
+	}
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoUrl))
+	g.Expect(err).Should(BeNil())
+	defer client.Disconnect(ctx)
+	collection := client.Database("cfrss-storetest").
+		Collection("retained_actions")
+	g.Expect(collection.Drop(ctx)).Should(Succeed())
+	_, err = collection.InsertOne(ctx, models.RecentAction{
+		TimeSeconds: time.Now().Unix(),
+		BlogEntry:   &models.BlogEntry{Id: 1},
+	})
+	g.Expect(err).Should(BeNil())
+
+	// expiry returns the expiry of the retention index, or -1 if it is
+	// missing.
+	expiry := func() int32 {
+		cursor, err := collection.Indexes().List(ctx)
+		g.Expect(err).Should(BeNil())
+		var indexes []bson.M
+		g.Expect(cursor.All(ctx, &indexes)).Should(Succeed())
+		for _, index := range indexes {
+			if index["name"] == "retention" {
+				return index["expireAfterSeconds"].(int32)
+			}
+		}
+		return -1
+	}
+
+	for _, retention := range []time.Duration{
+		24 * time.Hour, 48 * time.Hour, 0,
+	} {
+		mongoStore, err := mongodb.NewMongoStore(mongoUrl, "cfrss-storetest",
+			retention, mongodb.WithCollectionName("retained_actions"))
+		g.Expect(err).Should(BeNil())
+		g.Expect(mongoStore.Close(ctx)).Should(Succeed())
+
+		if retention > 0 {
+			g.Expect(expiry()).Should(Equal(int32(retention.Seconds())))
+		} else {
+			g.Expect(expiry()).Should(Equal(int32(-1)))
+		}
+	}
+
+	g.Expect(collection.CountDocuments(ctx,
+		bson.M{"createdAt": bson.M{"$type": "date"}})).Should(Equal(int64(1)))
+}
+
+// TestMongoStoreExistingTextIndex checks that a collection of the MongoDB at
+// CFRSS_TEST_MONGO_URL that already has a text index of its own is searched
+// through it, rather than failing the startup.
+func TestMongoStoreExistingTextIndex(t *testing.T) {
+	mongoUrl := os.Getenv("CFRSS_TEST_MONGO_URL")
+	if mongoUrl == "" {
+		t.Skip("CFRSS_TEST_MONGO_URL is not set")
+	}
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoUrl))
+	g.Expect(err).Should(BeNil())
+	defer client.Disconnect(ctx)
+	collection := client.Database("cfrss-storetest").
+		Collection("text_actions")
+	g.Expect(collection.Drop(ctx)).Should(Succeed())
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "comment.text", Value: "text"}},
+		Options: options.Index().SetName("legacy_text"),
+	})
+	g.Expect(err).Should(BeNil())
+
+	mongoStore, err := mongodb.NewMongoStore(mongoUrl, "cfrss-storetest", 0,
+		mongodb.WithCollectionName("text_actions"))
+	g.Expect(err).Should(BeNil())
+	defer mongoStore.Close(ctx)
+
+	g.Expect(mongoStore.AddRecentActions(ctx, []models.RecentAction{{
+		TimeSeconds: 10,
+		BlogEntry:   &models.BlogEntry{Id: 1},
+		Comment:     &models.Comment{Id: 1, Text: "Nice problems"},
+	}})).Error().Should(Succeed())
+	res, err := mongoStore.SearchRecentActions(ctx, "problems", 0)
+	g.Expect(err).Should(BeNil())
+	g.Expect(res).Should(HaveLen(1))
+}
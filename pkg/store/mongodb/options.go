@@ -0,0 +1,48 @@
+package mongodb
+
+import "time"
+
+const (
+	// kDefaultInsertBatchSize keeps every insertion well within the 16MB and
+	// 100,000 documents limits of a single MongoDB command.
+	kDefaultInsertBatchSize = 1000
+
+	// By default, the store waits for about half a minute for MongoDB to
+	// come up, e.g, when both are started by docker compose.
+	kDefaultConnectAttempts  = 5
+	kDefaultConnectBaseDelay = 2 * time.Second
+
+	kDefaultRecentActionsCollectionName = "recent_actions"
+)
+
+// Option customizes the store created by NewMongoStore.
+type Option func(store *mongoStore)
+
+// WithInsertBatchSize sets the maximum number of actions inserted by a single
+// command. Larger batches are inserted sequentially in chunks of that size.
+// A non-positive size inserts every batch with a single command.
+func WithInsertBatchSize(size int) Option {
+	return func(store *mongoStore) {
+		store.insertBatchSize = size
+	}
+}
+
+// WithConnectRetries makes NewMongoStore attempt to connect to MongoDB up to
+// maxAttempts times, waiting baseDelay before the first retry and doubling
+// the delay on each subsequent one. A value of maxAttempts less than or equal
+// to one fails on the first unsuccessful attempt.
+func WithConnectRetries(maxAttempts int, baseDelay time.Duration) Option {
+	return func(store *mongoStore) {
+		store.connectAttempts = maxAttempts
+		store.connectBaseDelay = baseDelay
+	}
+}
+
+// WithCollectionName stores the recent actions, and their cursor, under the
+// given collection name instead of "recent_actions", so that several
+// instances can share a database. The users are shared by all of them.
+func WithCollectionName(name string) Option {
+	return func(store *mongoStore) {
+		store.recentActionsCollectionName = name
+	}
+}
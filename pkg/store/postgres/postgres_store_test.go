@@ -0,0 +1,37 @@
+package postgres_test
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/postgres"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+)
+
+// TestPostgresStoreContract runs against the database at
+// CFRSS_TEST_POSTGRES_URL, which is emptied before each test.
+func TestPostgresStoreContract(t *testing.T) {
+	databaseUrl := os.Getenv("CFRSS_TEST_POSTGRES_URL")
+	if databaseUrl == "" {
+		t.Skip("CFRSS_TEST_POSTGRES_URL is not set")
+	}
+
+	storetest.RunStoreTests(t, func() store.CodeforcesStore {
+		ctx := context.Background()
+		postgresStore, err := postgres.NewPostgresStore(databaseUrl)
+		if err != nil {
+			t.Fatalf("could not open the store with error [%v]", err)
+		}
+		if _, err := postgresStore.DeleteActionsBefore(ctx,
+			math.MaxInt64); err != nil {
+			t.Fatalf("could not empty the store with error [%v]", err)
+		}
+		if err := postgresStore.SaveCursor(ctx, 0); err != nil {
+			t.Fatalf("could not reset the cursor with error [%v]", err)
+		}
+		return postgresStore
+	})
+}
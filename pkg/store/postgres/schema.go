@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// kSchema is the minimal schema created on first run:
+//
+//   - recent_actions holds every action as JSONB, keyed on the pair of blog
+//     entry and comment ids. The comment id is zero for blog entries. The
+//     time and the lower-cased author handle are extracted into columns, so
+//     that the range queries can use BTREE indexes. The hash of the content,
+//     see RecentAction.ContentHash, is added to the tables created by older
+//     versions, whose actions are replaced by their next edit.
+//   - users and subscriptions hold the users of this application and the
+//     blogs they follow.
+//   - cursors holds the position of the scheduler, apart from the actions.
+const kSchema = `
+CREATE TABLE IF NOT EXISTS recent_actions (
+	blog_entry_id BIGINT NOT NULL,
+	comment_id    BIGINT NOT NULL,
+	time_seconds  BIGINT NOT NULL,
+	author_handle TEXT   NOT NULL,
+	action        JSONB  NOT NULL,
+	content_hash  TEXT,
+	PRIMARY KEY (blog_entry_id, comment_id)
+);
+
+ALTER TABLE recent_actions ADD COLUMN IF NOT EXISTS content_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS recent_actions_time_seconds
+	ON recent_actions USING BTREE (time_seconds);
+
+CREATE INDEX IF NOT EXISTS recent_actions_author_handle
+	ON recent_actions USING BTREE (author_handle, time_seconds);
+
+CREATE TABLE IF NOT EXISTS users (
+	uuid              TEXT PRIMARY KEY,
+	username          TEXT NOT NULL,
+	hashed_password   TEXT NOT NULL,
+	email             TEXT NOT NULL,
+	codeforces_handle TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+	uuid          TEXT   NOT NULL REFERENCES users (uuid),
+	blog_entry_id BIGINT NOT NULL,
+	PRIMARY KEY (uuid, blog_entry_id)
+);
+
+CREATE TABLE IF NOT EXISTS cursors (
+	name      TEXT PRIMARY KEY,
+	timestamp BIGINT NOT NULL
+);
+`
+
+// createSchema creates the tables and indexes, if they don't exist already.
+func (store *postgresStore) createSchema(ctx context.Context) error {
+	if _, err := store.pool.Exec(ctx, kSchema); err != nil {
+		return errors.Errorf("could not create the schema with error [%v]",
+			err)
+	}
+	return nil
+}
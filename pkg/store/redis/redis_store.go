@@ -0,0 +1,678 @@
+// Package redis contains a Redis implementation of CodeforcesStore, meant for
+// read heavy feed servers. The recent actions are kept in sorted sets scored
+// by their activity time, with each action serialized as JSON in the member.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+const (
+	// kDefaultKeyPrefix namespaces all the keys of a store, so that multiple
+	// feeds can share one Redis.
+	kDefaultKeyPrefix = "cfrss:"
+
+	// Suffixes of the keys holding the recent actions. The actions sorted
+	// set holds all of them, while the comments sorted set only holds the
+	// comments, just like the ones returned by QueryRecentActions. The
+	// action ids set holds "blogEntryId:commentId" of the persisted actions,
+	// and is used to skip the duplicates.
+	kActionsKey   = "actions"
+	kCommentsKey  = "comments"
+	kActionIdsKey = "action_ids"
+	kCursorKey    = "cursor"
+
+	// kActionsByIdKey is the suffix of the hash from the action ids to the
+	// JSON of the actions, which backs GetRecentAction.
+	kActionsByIdKey = "actions_by_id"
+
+	// kSearchBatchSize is the number of actions scanned at once while
+	// searching, since Redis can't filter the members by their content.
+	kSearchBatchSize = 500
+
+	// Formats of the suffixes of the per handle, per blog and per user keys.
+	kHandleKeyFmt        = "handle:%s"
+	kBlogCommentsKeyFmt  = "blog:%d:comments"
+	kUserKeyFmt          = "user:%s"
+	kSubscriptionsKeyFmt = "user:%s:subscriptions"
+)
+
+// Aliases of the store package, which the receivers of the methods shadow.
+var (
+	errNotFound    = store.ErrNotFound
+	sortDescending = store.SortDescending
+	sortAscending  = store.SortAscending
+
+	newActionStream = store.NewActionStream
+	decodeAction    = store.DecodeAction
+)
+
+// redisStore is the Redis implementation of CodeforcesStore.
+type redisStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// key returns the given suffix namespaced with the key prefix.
+func (store *redisStore) key(format string, args ...interface{}) string {
+	return store.keyPrefix + fmt.Sprintf(format, args...)
+}
+
+// actionId uniquely identifies an action, mirroring the unique index of the
+// mongo store. The comment id is zero for blog actions.
+func actionId(action models.RecentAction) string {
+	var blogEntryId, commentId int
+	if action.BlogEntry != nil {
+		blogEntryId = action.BlogEntry.Id
+	}
+	if action.Comment != nil {
+		commentId = action.Comment.Id
+	}
+	return formatActionId(blogEntryId, commentId)
+}
+
+// formatActionId formats the id of the action on the given blog entry and
+// comment.
+func formatActionId(blogEntryId, commentId int) string {
+	return fmt.Sprintf("%d:%d", blogEntryId, commentId)
+}
+
+// rangeBy returns the range of actions scored at or after startTimestamp,
+// newest first. A non-positive limit means no limit.
+func rangeBy(startTimestamp, limit, skip int64) *redis.ZRangeBy {
+	if limit <= 0 {
+		// Redis treats a negative count as no limit at all.
+		limit = -1
+	}
+	return &redis.ZRangeBy{
+		Min:    strconv.FormatInt(startTimestamp, 10),
+		Max:    "+inf",
+		Offset: skip,
+		Count:  limit,
+	}
+}
+
+// decodeActions decodes the JSON members of a sorted set.
+func decodeActions(members []string) ([]models.RecentAction, error) {
+	var actions []models.RecentAction
+	for _, member := range members {
+		action, err := decodeAction([]byte(member))
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// queryActions returns the actions of the sorted set in the given range.
+func (store *redisStore) queryActions(ctx context.Context, key string,
+	by *redis.ZRangeBy) ([]models.RecentAction, error) {
+	members, err := store.client.ZRevRangeByScore(ctx, key, by).Result()
+	if err != nil {
+		return nil, errors.Errorf("could not query %s with error [%v]",
+			key, err)
+	}
+	return decodeActions(members)
+}
+
+func (store *redisStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int64, error) {
+	if len(actions) == 0 {
+		return 0, nil
+	}
+	zap.S().Infow("Persisting a batch of actions to the store",
+		zap.Int("actions", len(actions)))
+
+	// The stored copies are compared to the actions, since the later edits
+	// with a different content replace them.
+	ids := make([]string, len(actions))
+	for ind, action := range actions {
+		ids[ind] = actionId(action)
+	}
+	stored, err := store.client.HMGet(ctx, store.key(kActionsByIdKey),
+		ids...).Result()
+	if err != nil {
+		return 0, errors.Errorf("could not query stored actions "+
+			"with error [%v]", err)
+	}
+
+	// The ids are recorded along with the actions, in a single transaction,
+	// so that neither is ever persisted without the other.
+	duplicates, edited := 0, 0
+	var inserted int64
+	_, err = store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for ind, action := range actions {
+			// The stored copy is decoded as is, without converting its
+			// links, so that its content hash compares to the one of the
+			// action.
+			if member, ok := stored[ind].(string); ok {
+				var previous models.RecentAction
+				if err := json.Unmarshal([]byte(member),
+					&previous); err != nil {
+					return errors.Errorf("could not decode action "+
+						"with error [%v]", err)
+				}
+				if action.EditTimeSeconds() <= previous.EditTimeSeconds() ||
+					action.ContentHash() == previous.ContentHash() {
+					duplicates++
+					continue
+				}
+				store.unindexAction(ctx, pipe, previous, member)
+				edited++
+			} else {
+				inserted++
+			}
+
+			doc, err := json.Marshal(action)
+			if err != nil {
+				return errors.Errorf("could not marshal action "+
+					"with error [%v]", err)
+			}
+			pipe.SAdd(ctx, store.key(kActionIdsKey), ids[ind])
+			pipe.HSet(ctx, store.key(kActionsByIdKey), ids[ind], doc)
+			store.indexAction(ctx, pipe, action, string(doc))
+
+			// A duplicate within the batch is compared to the first copy.
+			stored[ind] = string(doc)
+			for later := ind + 1; later < len(actions); later++ {
+				if ids[later] == ids[ind] {
+					stored[later] = string(doc)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Errorf("bulk insert failed with error [%v]", err)
+	}
+	if duplicates > 0 {
+		zap.S().Infow("Skipped the duplicate actions",
+			zap.Int("duplicates", duplicates), zap.Int("actions", len(actions)))
+	}
+	if edited > 0 {
+		zap.S().Infow("Updated the edited actions", zap.Int("edited", edited),
+			zap.Int("actions", len(actions)))
+	}
+
+	return inserted, nil
+}
+
+// indexAction adds the member, i.e, the JSON of the action, to the sorted
+// sets of all the actions, of its author, and of the comments if it is one.
+func (store *redisStore) indexAction(ctx context.Context,
+	pipe redis.Pipeliner, action models.RecentAction, member string) {
+	z := redis.Z{Score: float64(action.TimeSeconds), Member: member}
+	pipe.ZAdd(ctx, store.key(kActionsKey), z)
+	pipe.ZAdd(ctx, store.key(kHandleKeyFmt,
+		strings.ToLower(action.Author())), z)
+	if action.Kind() == models.ActionKindComment {
+		pipe.ZAdd(ctx, store.key(kCommentsKey), z)
+		pipe.ZAdd(ctx, store.key(kBlogCommentsKeyFmt, action.BlogEntry.Id), z)
+	}
+}
+
+// unindexAction removes the member from the sorted sets indexAction added it
+// to.
+func (store *redisStore) unindexAction(ctx context.Context,
+	pipe redis.Pipeliner, action models.RecentAction, member string) {
+	pipe.ZRem(ctx, store.key(kActionsKey), member)
+	pipe.ZRem(ctx, store.key(kHandleKeyFmt,
+		strings.ToLower(action.Author())), member)
+	if action.Kind() == models.ActionKindComment {
+		pipe.ZRem(ctx, store.key(kCommentsKey), member)
+		pipe.ZRem(ctx, store.key(kBlogCommentsKeyFmt, action.BlogEntry.Id),
+			member)
+	}
+}
+
+func (store *redisStore) QueryRecentActions(ctx context.Context,
+	startTimestamp, limit int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsPaged(ctx, startTimestamp, limit, 0)
+}
+
+func (store *redisStore) QueryRecentActionsPaged(ctx context.Context,
+	startTimestamp, limit, skip int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsSorted(ctx, startTimestamp, limit, skip,
+		sortDescending)
+}
+
+func (store *redisStore) QueryRecentActionsSorted(ctx context.Context,
+	startTimestamp, limit, skip int64, order store.SortOrder) (
+	[]models.RecentAction, error) {
+	if order != sortAscending {
+		return store.queryActions(ctx, store.key(kCommentsKey),
+			rangeBy(startTimestamp, limit, skip))
+	}
+
+	key := store.key(kCommentsKey)
+	members, err := store.client.ZRangeByScore(ctx, key,
+		rangeBy(startTimestamp, limit, skip)).Result()
+	if err != nil {
+		return nil, errors.Errorf("could not query %s with error [%v]",
+			key, err)
+	}
+	return decodeActions(members)
+}
+
+func (store *redisStore) QueryRecentActionsBefore(ctx context.Context,
+	endTimestamp, limit int64) ([]models.RecentAction, error) {
+	by := rangeBy(0, limit, 0)
+	by.Min = "-inf"
+	by.Max = strconv.FormatInt(endTimestamp, 10)
+	return store.queryActions(ctx, store.key(kCommentsKey), by)
+}
+
+func (store *redisStore) StreamRecentActions(ctx context.Context,
+	startTimestamp int64) (<-chan models.RecentAction, <-chan error) {
+	return newActionStream(ctx, func(
+		send func(models.RecentAction) error) error {
+		// The sorted set of all the actions is paged through, so that a
+		// single page is ever held in memory.
+		key := store.key(kActionsKey)
+		for skip := int64(0); ; skip += kSearchBatchSize {
+			members, err := store.client.ZRangeByScore(ctx, key,
+				rangeBy(startTimestamp, kSearchBatchSize, skip)).Result()
+			if err != nil {
+				return errors.Errorf("could not query %s with error [%v]",
+					key, err)
+			}
+			actions, err := decodeActions(members)
+			if err != nil {
+				return err
+			}
+			for _, action := range actions {
+				if err := send(action); err != nil {
+					return err
+				}
+			}
+			if len(actions) < kSearchBatchSize {
+				return nil
+			}
+		}
+	})
+}
+
+func (store *redisStore) QueryRecentActionsByHandle(ctx context.Context,
+	handle string, startTimestamp, limit int64) (
+	[]models.RecentAction, error) {
+	return store.queryActions(ctx,
+		store.key(kHandleKeyFmt, strings.ToLower(handle)),
+		rangeBy(startTimestamp, limit, 0))
+}
+
+func (store *redisStore) GetRecentAction(ctx context.Context, id string) (
+	models.RecentAction, error) {
+	blogEntryId, commentId, err := models.ParseActionId(id)
+	if err != nil {
+		return models.RecentAction{}, err
+	}
+
+	doc, err := store.client.HGet(ctx, store.key(kActionsByIdKey),
+		formatActionId(blogEntryId, commentId)).Result()
+	if err == redis.Nil {
+		return models.RecentAction{}, errNotFound
+	}
+	if err != nil {
+		return models.RecentAction{}, errors.Errorf("could not query action "+
+			"%s with error [%v]", id, err)
+	}
+
+	actions, err := decodeActions([]string{doc})
+	if err != nil {
+		return models.RecentAction{}, err
+	}
+	return actions[0], nil
+}
+
+func (store *redisStore) SearchRecentActions(ctx context.Context,
+	query string, limit int64) ([]models.RecentAction, error) {
+	var res []models.RecentAction
+	for start := int64(0); ; start += kSearchBatchSize {
+		members, err := store.client.ZRevRange(ctx, store.key(kActionsKey),
+			start, start+kSearchBatchSize-1).Result()
+		if err != nil {
+			return nil, errors.Errorf("could not scan %s with error [%v]",
+				store.key(kActionsKey), err)
+		}
+		actions, err := decodeActions(members)
+		if err != nil {
+			return nil, err
+		}
+		for _, action := range actions {
+			if !action.ContainsText(query) {
+				continue
+			}
+			res = append(res, action)
+			if limit > 0 && int64(len(res)) == limit {
+				return res, nil
+			}
+		}
+		if len(members) < kSearchBatchSize {
+			return res, nil
+		}
+	}
+}
+
+func (store *redisStore) LastRecordedTimestampForRecentActions(
+	ctx context.Context) int64 {
+	res, err := store.client.ZRevRangeWithScores(ctx,
+		store.key(kActionsKey), 0, 0).Result()
+	if err != nil {
+		zap.S().Errorw("Querying the max recorded activity timestamp failed",
+			zap.Error(err))
+		return 0
+	}
+	if len(res) == 0 {
+		return 0
+	}
+	return int64(res[0].Score)
+}
+
+func (store *redisStore) SaveCursor(ctx context.Context,
+	timestamp int64) error {
+	if err := store.client.Set(ctx, store.key(kCursorKey), timestamp,
+		0).Err(); err != nil {
+		return errors.Errorf("could not save cursor %d with error [%v]",
+			timestamp, err)
+	}
+	return nil
+}
+
+func (store *redisStore) LoadCursor(ctx context.Context) (int64, error) {
+	timestamp, err := store.client.Get(ctx, store.key(kCursorKey)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Errorf("could not load cursor with error [%v]", err)
+	}
+	return timestamp, nil
+}
+
+func (store *redisStore) CountRecentActions(ctx context.Context) (
+	int64, error) {
+	count, err := store.client.ZCard(ctx, store.key(kActionsKey)).Result()
+	if err != nil {
+		return 0, errors.Errorf("could not count recent actions "+
+			"with error [%v]", err)
+	}
+	return count, nil
+}
+
+func (store *redisStore) DeleteActionsBefore(ctx context.Context,
+	timestamp int64) (int64, error) {
+	key := store.key(kActionsKey)
+	by := &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(timestamp, 10),
+		Count: kSearchBatchSize,
+	}
+
+	// The deleted actions leave the range, hence it is always read from its
+	// start.
+	var deleted int64
+	for {
+		members, err := store.client.ZRangeByScore(ctx, key, by).Result()
+		if err != nil {
+			return deleted, errors.Errorf("could not query %s with error "+
+				"[%v]", key, err)
+		}
+		if len(members) == 0 {
+			return deleted, nil
+		}
+
+		pipe := store.client.TxPipeline()
+		for _, member := range members {
+			var action models.RecentAction
+			if err := json.Unmarshal([]byte(member), &action); err != nil {
+				return deleted, errors.Errorf("could not decode action "+
+					"with error [%v]", err)
+			}
+			id := actionId(action)
+			pipe.HDel(ctx, store.key(kActionsByIdKey), id)
+			pipe.SRem(ctx, store.key(kActionIdsKey), id)
+			store.unindexAction(ctx, pipe, action, member)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return deleted, errors.Errorf("could not delete the actions "+
+				"before %d with error [%v]", timestamp, err)
+		}
+		deleted += int64(len(members))
+	}
+}
+
+func (store *redisStore) QueryAllUniqueBlogs(ctx context.Context,
+	startTimestamp, limit int64) ([]models.BlogEntry, error) {
+	// TODO: Implement it, once the mongo store does.
+	return nil, errors.New("querying the unique blogs is not implemented " +
+		"by the redis store")
+}
+
+func (store *redisStore) QueryCommentsFromBlog(ctx context.Context, id int,
+	startTimestamp, limit int64) ([]models.Comment, error) {
+	actions, err := store.queryActions(ctx,
+		store.key(kBlogCommentsKeyFmt, id), rangeBy(startTimestamp, limit, 0))
+	if err != nil {
+		return nil, errors.Errorf("could not query comments of blog %d "+
+			"with error [%v]", id, err)
+	}
+
+	var comments []models.Comment
+	for _, action := range actions {
+		comments = append(comments, *action.Comment)
+	}
+	return comments, nil
+}
+
+func (store *redisStore) AddUser(ctx context.Context,
+	user *models.User) error {
+	zap.S().Infow("Adding the user to the store", zap.String("uuid", user.Uuid))
+
+	// The subscriptions are kept in a set of their own.
+	stored := *user
+	stored.SubscribedBlogs = nil
+	doc, err := json.Marshal(stored)
+	if err != nil {
+		return errors.Errorf("could not marshal user %s with error [%v]",
+			user.Uuid, err)
+	}
+
+	pipe := store.client.TxPipeline()
+	pipe.Set(ctx, store.key(kUserKeyFmt, user.Uuid), doc, 0)
+	for _, id := range user.SubscribedBlogs {
+		pipe.SAdd(ctx, store.key(kSubscriptionsKeyFmt, user.Uuid), id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.Errorf("could not add user %s with error [%v]",
+			user.Uuid, err)
+	}
+	return nil
+}
+
+func (store *redisStore) QueryUserByUuid(ctx context.Context, uuid string) (
+	*models.User, error) {
+	zap.S().Infow("Querying the store for the user", zap.String("uuid", uuid))
+
+	doc, err := store.client.Get(ctx, store.key(kUserKeyFmt, uuid)).Bytes()
+	if err != nil {
+		return nil, errors.Errorf("could not query user with uuid %s "+
+			"with error [%v]", uuid, err)
+	}
+	user := new(models.User)
+	if err := json.Unmarshal(doc, user); err != nil {
+		return nil, errors.Errorf("could not decode user %s with error [%v]",
+			uuid, err)
+	}
+
+	ids, err := store.client.SMembers(ctx,
+		store.key(kSubscriptionsKeyFmt, uuid)).Result()
+	if err != nil {
+		return nil, errors.Errorf("could not query subscriptions of user %s "+
+			"with error [%v]", uuid, err)
+	}
+	for _, id := range ids {
+		blogId, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, errors.Errorf("could not parse subscription %s "+
+				"with error [%v]", id, err)
+		}
+		user.SubscribedBlogs = append(user.SubscribedBlogs, blogId)
+	}
+	sort.Ints(user.SubscribedBlogs)
+
+	return user, nil
+}
+
+func (store *redisStore) QueryRecentActionsForUser(ctx context.Context,
+	uuid string, startTimestamp, limit int64) ([]models.RecentAction, error) {
+	zap.S().Infow("Retrieving the actions of the user",
+		zap.String("uuid", uuid), zap.Int64("startTimestamp", startTimestamp))
+
+	user, err := store.QueryUserByUuid(ctx, uuid)
+	if err != nil {
+		return nil, errors.Errorf("uuid to user conversion failed "+
+			"with error [%v]", err)
+	}
+
+	// Each blog contributes at most limit actions, and the merged result is
+	// trimmed once again.
+	var actions []models.RecentAction
+	for _, id := range user.SubscribedBlogs {
+		blogActions, err := store.queryActions(ctx,
+			store.key(kBlogCommentsKeyFmt, id),
+			rangeBy(startTimestamp, limit, 0))
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, blogActions...)
+	}
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].TimeSeconds > actions[j].TimeSeconds
+	})
+	if limit > 0 && int64(len(actions)) > limit {
+		actions = actions[:limit]
+	}
+	return actions, nil
+}
+
+// userExists returns an error if the user is missing from the store.
+func (store *redisStore) userExists(ctx context.Context, uuid string) error {
+	count, err := store.client.Exists(ctx,
+		store.key(kUserKeyFmt, uuid)).Result()
+	if err != nil {
+		return errors.Errorf("could not query user %s with error [%v]",
+			uuid, err)
+	}
+	if count == 0 {
+		return errors.Errorf("user %s does not exist", uuid)
+	}
+	return nil
+}
+
+func (store *redisStore) SubscribeToBlogs(ctx context.Context, uuid string,
+	ids ...int) error {
+	zap.S().Infow("User is subscribing to blogs", zap.String("uuid", uuid),
+		zap.Ints("blogEntryIds", ids))
+
+	if err := store.userExists(ctx, uuid); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	members := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, id)
+	}
+	if err := store.client.SAdd(ctx, store.key(kSubscriptionsKeyFmt, uuid),
+		members...).Err(); err != nil {
+		return errors.Errorf("user %s could not subscribe to blogs "+
+			"with error [%v]", uuid, err)
+	}
+	return nil
+}
+
+func (store *redisStore) UnsubscribeFromBlogs(ctx context.Context,
+	uuid string, ids ...int) error {
+	zap.S().Infow("User is unsubscribing from blogs",
+		zap.String("uuid", uuid), zap.Ints("blogEntryIds", ids))
+
+	if err := store.userExists(ctx, uuid); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	members := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, id)
+	}
+	if err := store.client.SRem(ctx, store.key(kSubscriptionsKeyFmt, uuid),
+		members...).Err(); err != nil {
+		return errors.Errorf("user %s could not unsubscribe from blogs "+
+			"with error [%v]", uuid, err)
+	}
+	return nil
+}
+
+func (store *redisStore) Ping(ctx context.Context) error {
+	if err := store.client.Ping(ctx).Err(); err != nil {
+		return errors.Errorf("could not ping redis with error [%v]", err)
+	}
+	return nil
+}
+
+func (store *redisStore) Close(ctx context.Context) error {
+	zap.S().Infow("Closing the redis store")
+	if err := store.client.Close(); err != nil {
+		return errors.Errorf("could not close redis client with error [%v]",
+			err)
+	}
+	return nil
+}
+
+// NewRedisStore connects to the Redis at the given URL, e.g,
+// redis://localhost:6379/0. All the keys are namespaced with the key prefix,
+// which defaults to "cfrss:" when empty.
+func NewRedisStore(redisUrl, keyPrefix string) (store.CodeforcesStore,
+	error) {
+	// For security reasons, don't log the redisUrl.
+	zap.S().Infow("Attempting to create a new redis store",
+		zap.String("keyPrefix", keyPrefix))
+
+	opt, err := redis.ParseURL(redisUrl)
+	if err != nil {
+		return nil, errors.Errorf("could not parse redis url with error [%v]",
+			err)
+	}
+
+	if keyPrefix == "" {
+		keyPrefix = kDefaultKeyPrefix
+	}
+	rStore := &redisStore{
+		client:    redis.NewClient(opt),
+		keyPrefix: keyPrefix,
+	}
+	if err := rStore.Ping(context.TODO()); err != nil {
+		rStore.client.Close()
+		return nil, err
+	}
+
+	return rStore, nil
+}
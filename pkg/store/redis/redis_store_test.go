@@ -0,0 +1,220 @@
+package redis_test
+
+import (
+	"context"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/redis"
+)
+
+var _ = Describe("RedisStore", func() {
+	newComment := func(ts int64, blogId, commentId int,
+		handle string) models.RecentAction {
+		return models.RecentAction{
+			TimeSeconds: ts,
+			BlogEntry:   &models.BlogEntry{Id: blogId},
+			Comment: &models.Comment{
+				Id:                commentId,
+				CommentatorHandle: handle,
+			},
+		}
+	}
+
+	actions := []models.RecentAction{
+		newComment(10, 1, 1, "tourist"),
+		newComment(30, 1, 2, "Petr"),
+		newComment(20, 2, 3, "TOURIST"),
+		{
+			TimeSeconds: 40,
+			BlogEntry:   &models.BlogEntry{Id: 3, AuthorHandle: "tourist"},
+		},
+	}
+
+	var server *miniredis.Miniredis
+	var redisStore store.CodeforcesStore
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		server = miniredis.RunT(GinkgoT())
+
+		var err error
+		redisStore, err = redis.NewRedisStore("redis://"+server.Addr(), "")
+		Expect(err).Should(BeNil())
+	})
+
+	It("should query comments newest first with a limit", func() {
+		Expect(redisStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(BeZero())
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(redisStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(Equal(int64(40)))
+
+		res, err := redisStore.QueryRecentActions(ctx, 15, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(2))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+		Expect(res[1].TimeSeconds).Should(Equal(int64(20)))
+
+		res, err = redisStore.QueryRecentActionsPaged(ctx, 0, 1, 1)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(20)))
+	})
+
+	It("should skip duplicate actions", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		count, err := redisStore.CountRecentActions(ctx)
+		Expect(err).Should(BeNil())
+		Expect(count).Should(Equal(int64(4)))
+	})
+
+	It("should skip the duplicates within a batch", func() {
+		Expect(redisStore.AddRecentActions(ctx,
+			append(actions, actions[0]))).Error().Should(Succeed())
+
+		count, err := redisStore.CountRecentActions(ctx)
+		Expect(err).Should(BeNil())
+		Expect(count).Should(Equal(int64(4)))
+		res, err := redisStore.QueryRecentActions(ctx, 0, 0)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+	})
+
+	It("should not pretend to query the unique blogs", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		_, err := redisStore.QueryAllUniqueBlogs(ctx, 0, 0)
+		Expect(err).Should(MatchError(ContainSubstring("not implemented")))
+	})
+
+	It("should delete the actions before a timestamp", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		deleted, err := redisStore.DeleteActionsBefore(ctx, 30)
+		Expect(err).Should(BeNil())
+		Expect(deleted).Should(Equal(int64(2)))
+
+		count, err := redisStore.CountRecentActions(ctx)
+		Expect(err).Should(BeNil())
+		Expect(count).Should(Equal(int64(2)))
+
+		res, err := redisStore.QueryRecentActions(ctx, 0, 0)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+
+		res, err = redisStore.QueryRecentActionsByHandle(ctx, "tourist", 0, 0)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(40)))
+
+		_, err = redisStore.GetRecentAction(ctx, "1-1")
+		Expect(err).Should(MatchError(store.ErrNotFound))
+
+		deleted, err = redisStore.DeleteActionsBefore(ctx, 30)
+		Expect(err).Should(BeNil())
+		Expect(deleted).Should(BeZero())
+	})
+
+	It("should stream all the actions oldest first", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		stream, errs := redisStore.StreamRecentActions(ctx, 15)
+		var timestamps []int64
+		for action := range stream {
+			timestamps = append(timestamps, action.TimeSeconds)
+		}
+		Expect(<-errs).Should(BeNil())
+		Expect(timestamps).Should(Equal([]int64{20, 30, 40}))
+	})
+
+	It("should match handles case-insensitively", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		res, err := redisStore.QueryRecentActionsByHandle(ctx, "Tourist",
+			0, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(40)))
+	})
+
+	It("should sort the comments in both orders", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		res, err := redisStore.QueryRecentActionsSorted(ctx, 0, 0, 0,
+			store.SortDescending)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+		Expect(res[2].TimeSeconds).Should(Equal(int64(10)))
+
+		res, err = redisStore.QueryRecentActionsSorted(ctx, 15, 1, 1,
+			store.SortAscending)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+	})
+
+	It("should get a single action by its id", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		action, err := redisStore.GetRecentAction(ctx, "1-2")
+		Expect(err).Should(BeNil())
+		Expect(action.Comment.CommentatorHandle).Should(Equal("Petr"))
+
+		action, err = redisStore.GetRecentAction(ctx, "3-0")
+		Expect(err).Should(BeNil())
+		Expect(action.BlogEntry.AuthorHandle).Should(Equal("tourist"))
+
+		_, err = redisStore.GetRecentAction(ctx, "1-3")
+		Expect(err).Should(MatchError(store.ErrNotFound))
+	})
+
+	It("should query the actions on the subscribed blogs", func() {
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(redisStore.AddUser(ctx, &models.User{Uuid: "uuid"})).
+			Should(Succeed())
+		Expect(redisStore.SubscribeToBlogs(ctx, "uuid", 1, 2)).
+			Should(Succeed())
+		Expect(redisStore.UnsubscribeFromBlogs(ctx, "uuid", 2)).
+			Should(Succeed())
+
+		res, err := redisStore.QueryRecentActionsForUser(ctx, "uuid", 0, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(2))
+		Expect(res[0].Comment.Id).Should(Equal(2))
+
+		Expect(redisStore.SubscribeToBlogs(ctx, "missing", 1)).
+			ShouldNot(Succeed())
+	})
+
+	It("should isolate the stores with different key prefixes", func() {
+		otherStore, err := redis.NewRedisStore("redis://"+server.Addr(),
+			"other:")
+		Expect(err).Should(BeNil())
+
+		Expect(redisStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(redisStore.SaveCursor(ctx, 40)).Should(Succeed())
+
+		Expect(otherStore.CountRecentActions(ctx)).Should(BeZero())
+		Expect(otherStore.LoadCursor(ctx)).Should(BeZero())
+		Expect(redisStore.LoadCursor(ctx)).Should(Equal(int64(40)))
+	})
+})
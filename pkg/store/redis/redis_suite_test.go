@@ -0,0 +1,30 @@
+package redis_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/redis"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+)
+
+func TestRedis(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Redis Suite")
+}
+
+func TestRedisStoreContract(t *testing.T) {
+	storetest.RunStoreTests(t, func() store.CodeforcesStore {
+		server := miniredis.RunT(t)
+		redisStore, err := redis.NewRedisStore("redis://"+server.Addr(), "")
+		if err != nil {
+			t.Fatalf("could not open the store with error [%v]", err)
+		}
+		return redisStore
+	})
+}
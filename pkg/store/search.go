@@ -0,0 +1,14 @@
+package store
+
+import "strings"
+
+// likeEscaper escapes the wildcards of LIKE patterns, along with the escape
+// character itself.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LikePattern returns a LIKE pattern matching any text containing the query,
+// with the wildcards of the query escaped by a backslash, for the SQL stores
+// to search the texts with LIKE ... ESCAPE '\'.
+func LikePattern(query string) string {
+	return "%" + likeEscaper.Replace(query) + "%"
+}
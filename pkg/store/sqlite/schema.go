@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// kSchema creates the tables and indexes on first run. Every action is stored
+// as JSON, next to the few columns needed to filter and sort them, and the
+// hash of its content, see RecentAction.ContentHash.
+// The comment id is zero for the actions on blog entries, so that the pair of
+// ids uniquely identifies an action, just like the unique index of the mongo
+// store.
+const kSchema = `
+CREATE TABLE IF NOT EXISTS recent_actions (
+	blog_entry_id INTEGER NOT NULL,
+	comment_id    INTEGER NOT NULL,
+	time_seconds  INTEGER NOT NULL,
+	author_handle TEXT    NOT NULL,
+	action        TEXT    NOT NULL,
+	content_hash  TEXT,
+	PRIMARY KEY (blog_entry_id, comment_id)
+);
+
+CREATE INDEX IF NOT EXISTS recent_actions_time_seconds
+	ON recent_actions (time_seconds);
+
+CREATE INDEX IF NOT EXISTS recent_actions_author_handle
+	ON recent_actions (author_handle, time_seconds);
+
+CREATE TABLE IF NOT EXISTS users (
+	uuid              TEXT PRIMARY KEY,
+	username          TEXT NOT NULL,
+	hashed_password   TEXT NOT NULL,
+	email             TEXT NOT NULL,
+	codeforces_handle TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+	uuid          TEXT    NOT NULL REFERENCES users (uuid),
+	blog_entry_id INTEGER NOT NULL,
+	PRIMARY KEY (uuid, blog_entry_id)
+);
+
+CREATE TABLE IF NOT EXISTS cursors (
+	name      TEXT PRIMARY KEY,
+	timestamp INTEGER NOT NULL
+);
+`
+
+// createSchema creates the tables and indexes, if they don't exist already,
+// and adds the columns missing from the tables created by older versions.
+func (store *sqliteStore) createSchema(ctx context.Context) error {
+	if _, err := store.db.ExecContext(ctx, kSchema); err != nil {
+		return errors.Errorf("could not create the schema with error [%v]",
+			err)
+	}
+
+	// SQLite can't add a column only if it doesn't exist. The actions stored
+	// without a hash are replaced by their next edit.
+	var hasContentHash bool
+	if err := store.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) > 0 FROM pragma_table_info('recent_actions')
+		WHERE name = 'content_hash'`).Scan(&hasContentHash); err != nil {
+		return errors.Errorf("could not inspect the schema with error [%v]",
+			err)
+	}
+	if !hasContentHash {
+		if _, err := store.db.ExecContext(ctx, `
+			ALTER TABLE recent_actions ADD COLUMN content_hash TEXT`); err != nil {
+			return errors.Errorf("could not add the content hash with "+
+				"error [%v]", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,571 @@
+// Package sqlite contains a SQLite implementation of CodeforcesStore, for
+// small deployments that don't want to run MongoDB. It uses a pure Go driver,
+// hence it doesn't need cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	// Register the "sqlite" driver.
+	_ "modernc.org/sqlite"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+const (
+	kDriverName = "sqlite"
+
+	// kRecentActionsCursor is the name of the cursor of the recent actions
+	// scheduler.
+	kRecentActionsCursor = "recent_actions"
+
+	// kNoLimit is the LIMIT that SQLite treats as no limit at all.
+	kNoLimit = -1
+)
+
+// Aliases of the store package, which the receivers of the methods shadow.
+var (
+	errNotFound    = store.ErrNotFound
+	sortDescending = store.SortDescending
+	sortAscending  = store.SortAscending
+
+	newActionStream = store.NewActionStream
+	likePattern     = store.LikePattern
+	sqlDirection    = store.SQLDirection
+	scanAction      = store.ScanAction
+	scanActions     = store.ScanActions
+)
+
+// sqliteStore is the SQLite implementation of CodeforcesStore.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// sqlLimit converts a non-positive limit to kNoLimit.
+func sqlLimit(limit int64) int64 {
+	if limit <= 0 {
+		return kNoLimit
+	}
+	return limit
+}
+
+func (store *sqliteStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int64, error) {
+	if len(actions) == 0 {
+		return 0, nil
+	}
+	zap.S().Infow("Persisting a batch of actions to the store",
+		zap.Int("actions", len(actions)))
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Errorf("could not begin transaction with error [%v]",
+			err)
+	}
+	defer tx.Rollback()
+
+	// Duplicates are silently ignored thanks to the primary key, unless they
+	// are a later edit of the stored action, see EditTimeSeconds, with a
+	// different content, which they replace.
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO recent_actions
+			(blog_entry_id, comment_id, time_seconds, author_handle, action,
+			content_hash)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (blog_entry_id, comment_id) DO UPDATE SET
+			time_seconds = excluded.time_seconds,
+			author_handle = excluded.author_handle,
+			action = excluded.action,
+			content_hash = excluded.content_hash
+		WHERE ? > max(recent_actions.time_seconds, ifnull(json_extract(
+			recent_actions.action, '$.blogEntry.modificationTimeSeconds'), 0))
+			AND recent_actions.content_hash IS NOT excluded.content_hash`)
+	if err != nil {
+		return 0, errors.Errorf("could not prepare insertion with error [%v]",
+			err)
+	}
+	defer stmt.Close()
+
+	// The actions already stored are looked up first, since an insertion and
+	// an update both affect a single row.
+	exists, err := tx.PrepareContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM recent_actions
+			WHERE blog_entry_id = ? AND comment_id = ?)`)
+	if err != nil {
+		return 0, errors.Errorf("could not prepare lookup with error [%v]",
+			err)
+	}
+	defer exists.Close()
+
+	var inserted int64
+	for _, action := range actions {
+		var blogEntryId, commentId int
+		if action.BlogEntry != nil {
+			blogEntryId = action.BlogEntry.Id
+		}
+		if action.Comment != nil {
+			commentId = action.Comment.Id
+		}
+
+		var stored bool
+		if err := exists.QueryRowContext(ctx, blogEntryId,
+			commentId).Scan(&stored); err != nil {
+			return 0, errors.Errorf("could not look up action with error [%v]",
+				err)
+		}
+		if !stored {
+			inserted++
+		}
+
+		doc, err := json.Marshal(action)
+		if err != nil {
+			return 0, errors.Errorf("could not marshal action with error [%v]",
+				err)
+		}
+
+		if _, err := stmt.ExecContext(ctx, blogEntryId, commentId,
+			action.TimeSeconds, strings.ToLower(action.Author()), string(doc),
+			action.ContentHash(), action.EditTimeSeconds()); err != nil {
+			return 0, errors.Errorf("could not insert action with error [%v]",
+				err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Errorf("could not commit insertion with error [%v]",
+			err)
+	}
+	return inserted, nil
+}
+
+// queryActions runs a query whose only column is the JSON of the actions, and
+// decodes them.
+func (store *sqliteStore) queryActions(ctx context.Context, query string,
+	args ...interface{}) ([]models.RecentAction, error) {
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Errorf("could not query recent actions "+
+			"with error [%v]", err)
+	}
+	defer rows.Close()
+
+	return scanActions(rows)
+}
+
+func (store *sqliteStore) QueryRecentActions(ctx context.Context,
+	startTimestamp, limit int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsPaged(ctx, startTimestamp, limit, 0)
+}
+
+func (store *sqliteStore) QueryRecentActionsPaged(ctx context.Context,
+	startTimestamp, limit, skip int64) ([]models.RecentAction, error) {
+	return store.QueryRecentActionsSorted(ctx, startTimestamp, limit, skip,
+		sortDescending)
+}
+
+func (store *sqliteStore) QueryRecentActionsSorted(ctx context.Context,
+	startTimestamp, limit, skip int64, order store.SortOrder) (
+	[]models.RecentAction, error) {
+	// Just like the mongo store, only the actions on comments are returned.
+	// The direction is one of two constants, hence safe to format.
+	return store.queryActions(ctx, fmt.Sprintf(`
+		SELECT action FROM recent_actions
+		WHERE time_seconds >= ? AND comment_id != 0
+		ORDER BY time_seconds %s
+		LIMIT ? OFFSET ?`, sqlDirection(order)),
+		startTimestamp, sqlLimit(limit), skip)
+}
+
+func (store *sqliteStore) QueryRecentActionsBefore(ctx context.Context,
+	endTimestamp, limit int64) ([]models.RecentAction, error) {
+	// Just like the mongo store, only the actions on comments are returned.
+	return store.queryActions(ctx, `
+		SELECT action FROM recent_actions
+		WHERE time_seconds <= ? AND comment_id != 0
+		ORDER BY time_seconds DESC
+		LIMIT ?`, endTimestamp, sqlLimit(limit))
+}
+
+func (store *sqliteStore) StreamRecentActions(ctx context.Context,
+	startTimestamp int64) (<-chan models.RecentAction, <-chan error) {
+	return newActionStream(ctx, func(
+		send func(models.RecentAction) error) error {
+		// The rows hold the only connection of the store until they are
+		// closed, hence the store can't be queried until the stream ends.
+		rows, err := store.db.QueryContext(ctx, `
+			SELECT action FROM recent_actions
+			WHERE time_seconds >= ?
+			ORDER BY time_seconds ASC`, startTimestamp)
+		if err != nil {
+			return errors.Errorf("could not query recent actions "+
+				"with error [%v]", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			action, err := scanAction(rows)
+			if err != nil {
+				return err
+			}
+			if err := send(action); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return errors.Errorf("could not iterate recent actions "+
+				"with error [%v]", err)
+		}
+		return nil
+	})
+}
+
+func (store *sqliteStore) QueryRecentActionsByHandle(ctx context.Context,
+	handle string, startTimestamp, limit int64) (
+	[]models.RecentAction, error) {
+	return store.queryActions(ctx, `
+		SELECT action FROM recent_actions
+		WHERE author_handle = ? AND time_seconds >= ?
+		ORDER BY time_seconds DESC
+		LIMIT ?`,
+		strings.ToLower(handle), startTimestamp, sqlLimit(limit))
+}
+
+func (store *sqliteStore) GetRecentAction(ctx context.Context, id string) (
+	models.RecentAction, error) {
+	blogEntryId, commentId, err := models.ParseActionId(id)
+	if err != nil {
+		return models.RecentAction{}, err
+	}
+
+	actions, err := store.queryActions(ctx, `
+		SELECT action FROM recent_actions
+		WHERE blog_entry_id = ? AND comment_id = ?`,
+		blogEntryId, commentId)
+	if err != nil {
+		return models.RecentAction{}, err
+	}
+	if len(actions) == 0 {
+		return models.RecentAction{}, errNotFound
+	}
+	return actions[0], nil
+}
+
+func (store *sqliteStore) SearchRecentActions(ctx context.Context,
+	query string, limit int64) ([]models.RecentAction, error) {
+	// LIKE ignores the case of ASCII letters only, which covers the
+	// English content but not the Russian one.
+	pattern := likePattern(query)
+	return store.queryActions(ctx, `
+		SELECT action FROM recent_actions
+		WHERE json_extract(action, '$.blogEntry.title') LIKE ? ESCAPE '\'
+			OR json_extract(action, '$.blogEntry.content') LIKE ? ESCAPE '\'
+			OR json_extract(action, '$.comment.text') LIKE ? ESCAPE '\'
+		ORDER BY time_seconds DESC
+		LIMIT ?`,
+		pattern, pattern, pattern, sqlLimit(limit))
+}
+
+func (store *sqliteStore) LastRecordedTimestampForRecentActions(
+	ctx context.Context) int64 {
+	var res sql.NullInt64
+	if err := store.db.QueryRowContext(ctx,
+		`SELECT MAX(time_seconds) FROM recent_actions`).Scan(&res); err != nil {
+		zap.S().Errorw("Querying the max recorded activity timestamp failed",
+			zap.Error(err))
+		return 0
+	}
+
+	// The maximum is NULL when the table is empty.
+	return res.Int64
+}
+
+func (store *sqliteStore) SaveCursor(ctx context.Context,
+	timestamp int64) error {
+	if _, err := store.db.ExecContext(ctx, `
+		INSERT INTO cursors (name, timestamp) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET timestamp = excluded.timestamp`,
+		kRecentActionsCursor, timestamp); err != nil {
+		return errors.Errorf("could not save cursor %d with error [%v]",
+			timestamp, err)
+	}
+	return nil
+}
+
+func (store *sqliteStore) LoadCursor(ctx context.Context) (int64, error) {
+	var timestamp int64
+	err := store.db.QueryRowContext(ctx,
+		`SELECT timestamp FROM cursors WHERE name = ?`,
+		kRecentActionsCursor).Scan(&timestamp)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Errorf("could not load cursor with error [%v]", err)
+	}
+	return timestamp, nil
+}
+
+func (store *sqliteStore) CountRecentActions(ctx context.Context) (
+	int64, error) {
+	var count int64
+	if err := store.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM recent_actions`).Scan(&count); err != nil {
+		return 0, errors.Errorf("could not count recent actions "+
+			"with error [%v]", err)
+	}
+	return count, nil
+}
+
+func (store *sqliteStore) DeleteActionsBefore(ctx context.Context,
+	timestamp int64) (int64, error) {
+	res, err := store.db.ExecContext(ctx,
+		`DELETE FROM recent_actions WHERE time_seconds < ?`, timestamp)
+	if err != nil {
+		return 0, errors.Errorf("could not delete the actions before %d "+
+			"with error [%v]", timestamp, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Errorf("could not count the deleted actions "+
+			"with error [%v]", err)
+	}
+	return deleted, nil
+}
+
+func (store *sqliteStore) QueryAllUniqueBlogs(ctx context.Context,
+	startTimestamp, limit int64) ([]models.BlogEntry, error) {
+	// TODO: Implement it, once the mongo store does.
+	return nil, nil
+}
+
+func (store *sqliteStore) QueryCommentsFromBlog(ctx context.Context, id int,
+	startTimestamp, limit int64) ([]models.Comment, error) {
+	actions, err := store.queryActions(ctx, `
+		SELECT action FROM recent_actions
+		WHERE blog_entry_id = ? AND comment_id != 0 AND time_seconds >= ?
+		ORDER BY time_seconds DESC
+		LIMIT ?`,
+		id, startTimestamp, sqlLimit(limit))
+	if err != nil {
+		return nil, errors.Errorf("could not query comments of blog %d "+
+			"with error [%v]", id, err)
+	}
+
+	var comments []models.Comment
+	for _, action := range actions {
+		comments = append(comments, *action.Comment)
+	}
+	return comments, nil
+}
+
+func (store *sqliteStore) AddUser(ctx context.Context,
+	user *models.User) error {
+	zap.S().Infow("Adding the user to the store", zap.String("uuid", user.Uuid))
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Errorf("could not begin transaction with error [%v]",
+			err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO users
+			(uuid, username, hashed_password, email, codeforces_handle)
+		VALUES (?, ?, ?, ?, ?)`,
+		user.Uuid, user.Username, user.HashedPassword, user.Email,
+		user.CodeforcesHandle); err != nil {
+		return errors.Errorf("could not add user %s with error [%v]",
+			user.Uuid, err)
+	}
+	if err := subscribe(ctx, tx, user.Uuid, user.SubscribedBlogs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Errorf("could not commit user %s with error [%v]",
+			user.Uuid, err)
+	}
+	return nil
+}
+
+func (store *sqliteStore) QueryUserByUuid(ctx context.Context, uuid string) (
+	*models.User, error) {
+	zap.S().Infow("Querying the store for the user", zap.String("uuid", uuid))
+
+	user := new(models.User)
+	err := store.db.QueryRowContext(ctx, `
+		SELECT uuid, username, hashed_password, email, codeforces_handle
+		FROM users WHERE uuid = ?`, uuid).Scan(&user.Uuid, &user.Username,
+		&user.HashedPassword, &user.Email, &user.CodeforcesHandle)
+	if err != nil {
+		return nil, errors.Errorf("could not query user with uuid %s "+
+			"with error [%v]", uuid, err)
+	}
+
+	rows, err := store.db.QueryContext(ctx, `
+		SELECT blog_entry_id FROM subscriptions WHERE uuid = ?
+		ORDER BY blog_entry_id`, uuid)
+	if err != nil {
+		return nil, errors.Errorf("could not query subscriptions of user %s "+
+			"with error [%v]", uuid, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Errorf("could not scan subscription "+
+				"with error [%v]", err)
+		}
+		user.SubscribedBlogs = append(user.SubscribedBlogs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("could not iterate subscriptions "+
+			"with error [%v]", err)
+	}
+
+	return user, nil
+}
+
+func (store *sqliteStore) QueryRecentActionsForUser(ctx context.Context,
+	uuid string, startTimestamp, limit int64) ([]models.RecentAction, error) {
+	zap.S().Infow("Retrieving the actions of the user",
+		zap.String("uuid", uuid), zap.Int64("startTimestamp", startTimestamp))
+
+	if _, err := store.QueryUserByUuid(ctx, uuid); err != nil {
+		return nil, errors.Errorf("uuid to user conversion failed "+
+			"with error [%v]", err)
+	}
+
+	return store.queryActions(ctx, `
+		SELECT action FROM recent_actions
+		WHERE comment_id != 0 AND time_seconds >= ? AND blog_entry_id IN (
+			SELECT blog_entry_id FROM subscriptions WHERE uuid = ?)
+		ORDER BY time_seconds DESC
+		LIMIT ?`,
+		startTimestamp, uuid, sqlLimit(limit))
+}
+
+// subscribe subscribes the user to the given blogs within the transaction.
+// Subscribing to the same blog twice is a no-op.
+func subscribe(ctx context.Context, tx *sql.Tx, uuid string,
+	ids []int) error {
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO subscriptions (uuid, blog_entry_id)
+			VALUES (?, ?)`, uuid, id); err != nil {
+			return errors.Errorf("could not subscribe user %s to blog %d "+
+				"with error [%v]", uuid, id, err)
+		}
+	}
+	return nil
+}
+
+// updateSubscriptions checks that the user exists, and applies the update to
+// the subscriptions within a transaction.
+func (store *sqliteStore) updateSubscriptions(ctx context.Context,
+	uuid string, update func(tx *sql.Tx) error) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Errorf("could not begin transaction with error [%v]",
+			err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE uuid = ?)`,
+		uuid).Scan(&exists); err != nil {
+		return errors.Errorf("could not query user %s with error [%v]",
+			uuid, err)
+	}
+	if !exists {
+		return errors.Errorf("user %s does not exist", uuid)
+	}
+
+	if err := update(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Errorf("could not commit subscriptions of user %s "+
+			"with error [%v]", uuid, err)
+	}
+	return nil
+}
+
+func (store *sqliteStore) SubscribeToBlogs(ctx context.Context, uuid string,
+	ids ...int) error {
+	zap.S().Infow("User is subscribing to blogs", zap.String("uuid", uuid),
+		zap.Ints("blogEntryIds", ids))
+
+	return store.updateSubscriptions(ctx, uuid, func(tx *sql.Tx) error {
+		return subscribe(ctx, tx, uuid, ids)
+	})
+}
+
+func (store *sqliteStore) UnsubscribeFromBlogs(ctx context.Context,
+	uuid string, ids ...int) error {
+	zap.S().Infow("User is unsubscribing from blogs",
+		zap.String("uuid", uuid), zap.Ints("blogEntryIds", ids))
+
+	return store.updateSubscriptions(ctx, uuid, func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM subscriptions
+				WHERE uuid = ? AND blog_entry_id = ?`, uuid, id); err != nil {
+				return errors.Errorf("could not unsubscribe user %s from "+
+					"blog %d with error [%v]", uuid, id, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (store *sqliteStore) Ping(ctx context.Context) error {
+	if err := store.db.PingContext(ctx); err != nil {
+		return errors.Errorf("could not ping sqlite with error [%v]", err)
+	}
+	return nil
+}
+
+func (store *sqliteStore) Close(ctx context.Context) error {
+	zap.S().Infow("Closing the sqlite store")
+	if err := store.db.Close(); err != nil {
+		return errors.Errorf("could not close sqlite with error [%v]", err)
+	}
+	return nil
+}
+
+// NewSQLiteStore opens the SQLite database at the given path, creating the
+// file, the tables and the indexes on first run. Use ":memory:" for a
+// transient database.
+func NewSQLiteStore(path string) (store.CodeforcesStore, error) {
+	zap.S().Infow("Attempting to create a new sqlite store",
+		zap.String("path", path))
+
+	db, err := sql.Open(kDriverName, path)
+	if err != nil {
+		return nil, errors.Errorf("could not open sqlite database %s "+
+			"with error [%v]", path, err)
+	}
+
+	// SQLite serializes the writers anyway, and every connection to an
+	// in-memory database would otherwise see a database of its own.
+	db.SetMaxOpenConns(1)
+
+	sStore := &sqliteStore{db: db}
+	if err := sStore.createSchema(context.TODO()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return sStore, nil
+}
@@ -0,0 +1,230 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/sqlite"
+)
+
+var _ = Describe("SQLiteStore", func() {
+	newComment := func(ts int64, blogId, commentId int,
+		handle string) models.RecentAction {
+		return models.RecentAction{
+			TimeSeconds: ts,
+			BlogEntry:   &models.BlogEntry{Id: blogId},
+			Comment: &models.Comment{
+				Id:                commentId,
+				CommentatorHandle: handle,
+			},
+		}
+	}
+
+	actions := []models.RecentAction{
+		newComment(10, 1, 1, "tourist"),
+		newComment(30, 1, 2, "Petr"),
+		newComment(20, 2, 3, "TOURIST"),
+		{
+			TimeSeconds: 40,
+			BlogEntry:   &models.BlogEntry{Id: 3, AuthorHandle: "tourist"},
+		},
+	}
+
+	var sqliteStore store.CodeforcesStore
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		var err error
+		sqliteStore, err = sqlite.NewSQLiteStore(":memory:")
+		Expect(err).Should(BeNil())
+	})
+
+	It("should query comments newest first with a limit", func() {
+		Expect(sqliteStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(BeZero())
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(sqliteStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(Equal(int64(40)))
+
+		res, err := sqliteStore.QueryRecentActions(ctx, 15, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(2))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+		Expect(res[1].TimeSeconds).Should(Equal(int64(20)))
+
+		res, err = sqliteStore.QueryRecentActionsPaged(ctx, 0, 1, 1)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(20)))
+	})
+
+	It("should skip duplicate actions", func() {
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		count, err := sqliteStore.CountRecentActions(ctx)
+		Expect(err).Should(BeNil())
+		Expect(count).Should(Equal(int64(4)))
+	})
+
+	It("should delete the actions before a timestamp", func() {
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		deleted, err := sqliteStore.DeleteActionsBefore(ctx, 30)
+		Expect(err).Should(BeNil())
+		Expect(deleted).Should(Equal(int64(2)))
+
+		count, err := sqliteStore.CountRecentActions(ctx)
+		Expect(err).Should(BeNil())
+		Expect(count).Should(Equal(int64(2)))
+
+		res, err := sqliteStore.QueryRecentActions(ctx, 0, 0)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+
+		_, err = sqliteStore.GetRecentAction(ctx, "1-1")
+		Expect(err).Should(MatchError(store.ErrNotFound))
+
+		deleted, err = sqliteStore.DeleteActionsBefore(ctx, 30)
+		Expect(err).Should(BeNil())
+		Expect(deleted).Should(BeZero())
+	})
+
+	It("should stream all the actions oldest first", func() {
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		stream, errs := sqliteStore.StreamRecentActions(ctx, 15)
+		var timestamps []int64
+		for action := range stream {
+			timestamps = append(timestamps, action.TimeSeconds)
+		}
+		Expect(<-errs).Should(BeNil())
+		Expect(timestamps).Should(Equal([]int64{20, 30, 40}))
+	})
+
+	It("should match handles case-insensitively", func() {
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		res, err := sqliteStore.QueryRecentActionsByHandle(ctx, "Tourist",
+			0, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(40)))
+	})
+
+	It("should sort the comments in both orders", func() {
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		res, err := sqliteStore.QueryRecentActionsSorted(ctx, 0, 0, 0,
+			store.SortDescending)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(3))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+		Expect(res[2].TimeSeconds).Should(Equal(int64(10)))
+
+		res, err = sqliteStore.QueryRecentActionsSorted(ctx, 15, 1, 1,
+			store.SortAscending)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(1))
+		Expect(res[0].TimeSeconds).Should(Equal(int64(30)))
+	})
+
+	It("should get a single action by its id", func() {
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+
+		action, err := sqliteStore.GetRecentAction(ctx, "1-2")
+		Expect(err).Should(BeNil())
+		Expect(action.Comment.CommentatorHandle).Should(Equal("Petr"))
+
+		action, err = sqliteStore.GetRecentAction(ctx, "3-0")
+		Expect(err).Should(BeNil())
+		Expect(action.BlogEntry.AuthorHandle).Should(Equal("tourist"))
+
+		_, err = sqliteStore.GetRecentAction(ctx, "1-3")
+		Expect(err).Should(MatchError(store.ErrNotFound))
+	})
+
+	It("should query the actions on the subscribed blogs", func() {
+		Expect(sqliteStore.AddRecentActions(ctx, actions)).Error().
+			Should(Succeed())
+		Expect(sqliteStore.AddUser(ctx, &models.User{Uuid: "uuid"})).
+			Should(Succeed())
+		Expect(sqliteStore.SubscribeToBlogs(ctx, "uuid", 1, 2)).
+			Should(Succeed())
+		Expect(sqliteStore.UnsubscribeFromBlogs(ctx, "uuid", 2)).
+			Should(Succeed())
+
+		user, err := sqliteStore.QueryUserByUuid(ctx, "uuid")
+		Expect(err).Should(BeNil())
+		Expect(user.SubscribedBlogs).Should(Equal([]int{1}))
+
+		res, err := sqliteStore.QueryRecentActionsForUser(ctx, "uuid", 0, 100)
+		Expect(err).Should(BeNil())
+		Expect(res).Should(HaveLen(2))
+		Expect(res[0].Comment.Id).Should(Equal(2))
+
+		Expect(sqliteStore.SubscribeToBlogs(ctx, "missing", 1)).
+			ShouldNot(Succeed())
+	})
+
+	It("should persist the cursor across restarts", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "cfrss.db")
+		fileStore, err := sqlite.NewSQLiteStore(path)
+		Expect(err).Should(BeNil())
+		Expect(fileStore.LoadCursor(ctx)).Should(BeZero())
+		Expect(fileStore.SaveCursor(ctx, 10)).Should(Succeed())
+		Expect(fileStore.SaveCursor(ctx, 20)).Should(Succeed())
+
+		reopenedStore, err := sqlite.NewSQLiteStore(path)
+		Expect(err).Should(BeNil())
+		Expect(reopenedStore.LoadCursor(ctx)).Should(Equal(int64(20)))
+	})
+
+	It("should add the content hash to the tables of older versions", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "cfrss.db")
+		db, err := sql.Open("sqlite", path)
+		Expect(err).Should(BeNil())
+		_, err = db.ExecContext(ctx, `
+			CREATE TABLE recent_actions (
+				blog_entry_id INTEGER NOT NULL,
+				comment_id    INTEGER NOT NULL,
+				time_seconds  INTEGER NOT NULL,
+				author_handle TEXT    NOT NULL,
+				action        TEXT    NOT NULL,
+				PRIMARY KEY (blog_entry_id, comment_id)
+			);
+			INSERT INTO recent_actions VALUES
+				(1, 2, 30, 'petr', '{"timeSeconds": 30, "blogEntry": {"id": 1},
+				"comment": {"id": 2, "commentatorHandle": "Petr"}}');`)
+		Expect(err).Should(BeNil())
+		Expect(db.Close()).Should(Succeed())
+
+		fileStore, err := sqlite.NewSQLiteStore(path)
+		Expect(err).Should(BeNil())
+		// The actions stored without a hash are replaced by their next edit.
+		edited := newComment(35, 1, 2, "Petr")
+		Expect(fileStore.AddRecentActions(ctx,
+			[]models.RecentAction{edited})).Error().Should(Succeed())
+		action, err := fileStore.GetRecentAction(ctx, "1-2")
+		Expect(err).Should(BeNil())
+		Expect(action.TimeSeconds).Should(Equal(int64(35)))
+
+		// Reopening the store doesn't add the column again.
+		_, err = sqlite.NewSQLiteStore(path)
+		Expect(err).Should(BeNil())
+	})
+})
@@ -0,0 +1,27 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/sqlite"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+)
+
+func TestSqlite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sqlite Suite")
+}
+
+func TestSQLiteStoreContract(t *testing.T) {
+	storetest.RunStoreTests(t, func() store.CodeforcesStore {
+		sqliteStore, err := sqlite.NewSQLiteStore(":memory:")
+		if err != nil {
+			t.Fatalf("could not open the store with error [%v]", err)
+		}
+		return sqliteStore
+	})
+}
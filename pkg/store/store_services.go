@@ -1,48 +1,156 @@
 package store
 
-import "github.com/variety-jones/cfrss/pkg/models"
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// ErrNotFound is returned when the requested document does not exist.
+var ErrNotFound = errors.New("not found")
+
+// SortOrder is the order in which the actions are sorted by activity time.
+type SortOrder int
+
+const (
+	// SortDescending returns the newest actions first, as the feeds expect.
+	// It is the zero value, hence the default.
+	SortDescending SortOrder = iota
+
+	// SortAscending returns the oldest actions first, e.g, for backfilling.
+	SortAscending
+)
 
 // CodeforcesStore is the interface needed to persist data from Codeforces
 // to MongoDB.
+//
+// All the methods accept a context as their first argument, which bounds the
+// time spent talking to the underlying database.
 type CodeforcesStore interface {
-	// AddRecentActions adds a batch of actions to the store.
-	AddRecentActions(actions []models.RecentAction) error
+	// AddRecentActions adds a batch of actions to the store. An action that
+	// is already stored, by RecentAction.Id, is skipped, unless it is a later
+	// edit, by RecentAction.EditTimeSeconds, whose content differs, by
+	// RecentAction.ContentHash, in which case it replaces the stored copy.
+	// Hence an action reported again with a later time but the same content
+	// keeps its stored time. It returns the number of actions that weren't
+	// stored yet, which excludes the edits.
+	AddRecentActions(ctx context.Context,
+		actions []models.RecentAction) (int64, error)
 
 	// QueryRecentActions returns the list of actions that happened at or
 	// after a fixed timestamp.
-	QueryRecentActions(startTimestamp, limit int64) ([]models.RecentAction, error)
+	QueryRecentActions(ctx context.Context, startTimestamp, limit int64) (
+		[]models.RecentAction, error)
+
+	// QueryRecentActionsPaged is like QueryRecentActions, but it skips the
+	// first few actions. The actions are sorted in decreasing order of
+	// activity time, hence skip is the number of newer actions to ignore.
+	// A non-positive limit means no limit.
+	QueryRecentActionsPaged(ctx context.Context,
+		startTimestamp, limit, skip int64) ([]models.RecentAction, error)
+
+	// QueryRecentActionsSorted is like QueryRecentActionsPaged, but sorts the
+	// actions in the given order, and skip is the number of actions to ignore
+	// in that order.
+	QueryRecentActionsSorted(ctx context.Context,
+		startTimestamp, limit, skip int64, order SortOrder) (
+		[]models.RecentAction, error)
+
+	// QueryRecentActionsBefore returns the list of actions that happened at
+	// or before a fixed timestamp, newest first, e.g, to page back in time
+	// from a cursor. A non-positive limit means no limit.
+	QueryRecentActionsBefore(ctx context.Context, endTimestamp, limit int64) (
+		[]models.RecentAction, error)
+
+	// StreamRecentActions streams all the actions that happened at or after
+	// the timestamp, i.e, the blog entries as well as the comments, in
+	// increasing order of activity time, without loading them all in memory
+	// at once, e.g, for the exports and the migrations.
+	// Both channels are closed once the actions are exhausted or the context
+	// is done, and the error channel then yields the error that ended the
+	// stream, if any. The actions must be drained, or the context cancelled,
+	// for the stream to be released.
+	StreamRecentActions(ctx context.Context, startTimestamp int64) (
+		<-chan models.RecentAction, <-chan error)
+
+	// QueryRecentActionsByHandle returns the list of actions authored by the
+	// given handle that happened at or after a fixed timestamp.
+	// Handles are matched case-insensitively, just like on Codeforces.
+	QueryRecentActionsByHandle(ctx context.Context, handle string,
+		startTimestamp, limit int64) ([]models.RecentAction, error)
+
+	// GetRecentAction returns the action with the given id, as returned by
+	// RecentAction.Id, or ErrNotFound if there is no such action.
+	GetRecentAction(ctx context.Context, id string) (models.RecentAction,
+		error)
+
+	// SearchRecentActions returns the actions whose blog title, blog content
+	// or comment text match the query, newest first. A non-positive limit
+	// means no limit. The texts contain the query, ignoring the case, except
+	// in the mongo store, which matches its whole words, with stemming,
+	// through a text index, e.g, "problem" matches "problems" but "prob"
+	// doesn't.
+	SearchRecentActions(ctx context.Context, query string, limit int64) (
+		[]models.RecentAction, error)
 
 	// LastRecordedTimestampForRecentActions returns the latest activity
 	// timestamp of any blog/comment in the store.
 	// It returns zero if no document exists.
-	LastRecordedTimestampForRecentActions() int64
+	LastRecordedTimestampForRecentActions(ctx context.Context) int64
+
+	// SaveCursor persists the timestamp till which the scheduler has
+	// ingested the recent actions. The cursor is stored apart from the
+	// actions, so that it survives their retention policy.
+	SaveCursor(ctx context.Context, timestamp int64) error
+
+	// LoadCursor returns the last saved cursor, or zero if none was saved.
+	LoadCursor(ctx context.Context) (int64, error)
+
+	// CountRecentActions returns the total number of actions in the store.
+	CountRecentActions(ctx context.Context) (int64, error)
+
+	// DeleteActionsBefore deletes the actions that happened strictly before
+	// the timestamp, and returns how many were deleted. The cursor is left
+	// as is.
+	DeleteActionsBefore(ctx context.Context, timestamp int64) (int64, error)
 
 	// QueryAllUniqueBlogs returns the metadata of all the unique blogs,
 	// filtered by the blog creation time.
-	QueryAllUniqueBlogs(startTimestamp, limit int64) ([]models.BlogEntry, error)
+	QueryAllUniqueBlogs(ctx context.Context, startTimestamp, limit int64) (
+		[]models.BlogEntry, error)
 
 	// QueryCommentsFromBlog returns all the comments from a particular blog.
 	// They are filtered by creation time and sorted in decreasing order of
 	// creation time.
-	QueryCommentsFromBlog(id int, startTimestamp, limit int64) (
-		[]models.Comment, error)
+	QueryCommentsFromBlog(ctx context.Context, id int,
+		startTimestamp, limit int64) ([]models.Comment, error)
 
 	// AddUser adds the given user to the store.
 	// TODO: Add uniqueness checks for username.
-	AddUser(user *models.User) error
+	AddUser(ctx context.Context, user *models.User) error
 
 	// QueryUserByUuid returns the store user matching the uuid.
-	QueryUserByUuid(uuid string) (*models.User, error)
+	QueryUserByUuid(ctx context.Context, uuid string) (*models.User, error)
 
 	// QueryRecentActionsForUser returns the list of all activities on the
 	// blogs that the user is subscribed to.
 	// TODO: Sort it according to activity time and implement pagination.
-	QueryRecentActionsForUser(uuid string, startTimestamp, limit int64) (
-		[]models.RecentAction, error)
+	QueryRecentActionsForUser(ctx context.Context, uuid string,
+		startTimestamp, limit int64) ([]models.RecentAction, error)
 
 	// SubscribeToBlogs subscribes a user to the given blogs.
-	SubscribeToBlogs(uuid string, ids ...int) error
+	SubscribeToBlogs(ctx context.Context, uuid string, ids ...int) error
 
 	// UnsubscribeFromBlogs unsubscribes a user from the given blogs.
-	UnsubscribeFromBlogs(uuid string, ids ...int) error
+	UnsubscribeFromBlogs(ctx context.Context, uuid string, ids ...int) error
+
+	// Ping checks that the underlying database is reachable, e.g, for the
+	// health checks, which bound it with a short timeout.
+	Ping(ctx context.Context) error
+
+	// Close releases the connections to the underlying database. The store
+	// must not be used afterwards.
+	Close(ctx context.Context) error
 }
@@ -0,0 +1,332 @@
+// Package storetest contains the contract that all the implementations of
+// CodeforcesStore abide by, so that the backends stay interchangeable.
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+// newComment returns an action on the comment of the blog entry.
+func newComment(ts int64, blogId, commentId int,
+	handle string) models.RecentAction {
+	return models.RecentAction{
+		TimeSeconds: ts,
+		BlogEntry:   &models.BlogEntry{Id: blogId, Title: "Round #1"},
+		Comment: &models.Comment{
+			Id:                commentId,
+			CommentatorHandle: handle,
+			Text:              `<a href="/profile/tourist">tourist</a>`,
+		},
+	}
+}
+
+// newActions returns three comments, one of which is on another blog entry,
+// and a blog entry, which is the newest action.
+func newActions() []models.RecentAction {
+	return []models.RecentAction{
+		newComment(10, 1, 1, "tourist"),
+		newComment(30, 1, 2, "Petr"),
+		newComment(20, 2, 3, "TOURIST"),
+		{
+			TimeSeconds: 40,
+			BlogEntry:   &models.BlogEntry{Id: 3, AuthorHandle: "tourist"},
+		},
+	}
+}
+
+// timestamps returns the activity times of the actions, in order.
+func timestamps(actions []models.RecentAction) []int64 {
+	res := make([]int64, 0, len(actions))
+	for _, action := range actions {
+		res = append(res, action.TimeSeconds)
+	}
+	return res
+}
+
+// RunStoreTests runs the contract against the stores returned by newStore,
+// each test getting an empty one. The stores are closed once their test
+// ends.
+func RunStoreTests(t *testing.T, newStore func() store.CodeforcesStore) {
+	ctx := context.Background()
+
+	run := func(name string, test func(g *WithT,
+		cfStore store.CodeforcesStore)) {
+		t.Run(name, func(t *testing.T) {
+			cfStore := newStore()
+			t.Cleanup(func() {
+				if err := cfStore.Close(ctx); err != nil {
+					t.Errorf("could not close the store with error [%v]", err)
+				}
+			})
+			test(NewWithT(t), cfStore)
+		})
+	}
+
+	run("EmptyStore", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.Ping(ctx)).Should(Succeed())
+
+		g.Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(BeZero())
+
+		count, err := cfStore.CountRecentActions(ctx)
+		g.Expect(err).Should(BeNil())
+		g.Expect(count).Should(BeZero())
+
+		res, err := cfStore.QueryRecentActions(ctx, 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(res).Should(BeEmpty())
+
+		cursor, err := cfStore.LoadCursor(ctx)
+		g.Expect(err).Should(BeNil())
+		g.Expect(cursor).Should(BeZero())
+	})
+
+	run("InsertAndQuery", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+		g.Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(Equal(int64(40)))
+
+		// Only the comments are queried, newest first.
+		res, err := cfStore.QueryRecentActions(ctx, 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{30, 20, 10}))
+		g.Expect(res[0].Comment.Text).Should(ContainSubstring(
+			`href="https://codeforces.com/profile/tourist"`))
+
+		res, err = cfStore.QueryRecentActions(ctx, 15, 1)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{30}))
+
+		res, err = cfStore.QueryRecentActionsPaged(ctx, 0, 1, 1)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{20}))
+
+		res, err = cfStore.QueryRecentActionsSorted(ctx, 15, 0, 0,
+			store.SortAscending)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{20, 30}))
+
+		res, err = cfStore.QueryRecentActionsBefore(ctx, 20, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{20, 10}))
+
+		res, err = cfStore.QueryRecentActionsBefore(ctx, 40, 1)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{30}))
+	})
+
+	run("Search", func(g *WithT, cfStore store.CodeforcesStore) {
+		searchable := []models.RecentAction{
+			{
+				TimeSeconds: 10,
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 1000"},
+			},
+			{
+				TimeSeconds: 20,
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 1000"},
+				Comment:     &models.Comment{Id: 1, Text: "Nice problems"},
+			},
+			{
+				TimeSeconds: 30,
+				BlogEntry:   &models.BlogEntry{Id: 2, Title: "Educational"},
+			},
+		}
+		g.Expect(cfStore.AddRecentActions(ctx, searchable)).Error().
+			Should(Succeed())
+
+		// The blog entries are searched too, newest first.
+		res, err := cfStore.SearchRecentActions(ctx, "round", 100)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{20, 10}))
+
+		res, err = cfStore.SearchRecentActions(ctx, "PROBLEMS", 1)
+		g.Expect(err).Should(BeNil())
+		g.Expect(res).Should(HaveLen(1))
+		g.Expect(res[0].Comment.Id).Should(Equal(1))
+
+		// The query is never a pattern.
+		res, err = cfStore.SearchRecentActions(ctx, "100%", 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(res).Should(BeEmpty())
+	})
+
+	run("Dedup", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).
+			Should(Equal(int64(4)))
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).
+			Should(BeZero())
+
+		count, err := cfStore.CountRecentActions(ctx)
+		g.Expect(err).Should(BeNil())
+		g.Expect(count).Should(Equal(int64(4)))
+
+		res, err := cfStore.QueryRecentActions(ctx, 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(res).Should(HaveLen(3))
+	})
+
+	run("Edit", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+
+		// An edit bumps the activity time of a comment.
+		edited := newComment(35, 1, 2, "Petr")
+		edited.Comment.Text = "Edited"
+		// An edit is not counted as an insertion.
+		g.Expect(cfStore.AddRecentActions(ctx,
+			[]models.RecentAction{edited})).Should(BeZero())
+		// A stale copy of the comment is ignored.
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).
+			Should(BeZero())
+
+		count, err := cfStore.CountRecentActions(ctx)
+		g.Expect(err).Should(BeNil())
+		g.Expect(count).Should(Equal(int64(4)))
+
+		res, err := cfStore.QueryRecentActions(ctx, 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{35, 20, 10}))
+		g.Expect(res[0].Comment.Text).Should(Equal("Edited"))
+
+		res, err = cfStore.QueryRecentActionsByHandle(ctx, "petr", 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{35}))
+
+		// An edit of a blog entry bumps its modification time only.
+		blogEntry := newActions()[3]
+		blogEntry.BlogEntry.Title = "Edited"
+		blogEntry.BlogEntry.ModificationTimeSeconds = 50
+		g.Expect(cfStore.AddRecentActions(ctx,
+			[]models.RecentAction{blogEntry})).Error().Should(Succeed())
+
+		action, err := cfStore.GetRecentAction(ctx, "3-0")
+		g.Expect(err).Should(BeNil())
+		g.Expect(action.BlogEntry.Title).Should(Equal("Edited"))
+		g.Expect(action.TimeSeconds).Should(Equal(int64(40)))
+
+		res, err = cfStore.QueryRecentActionsByHandle(ctx, "tourist", 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{40, 20, 10}))
+	})
+
+	run("Unchanged", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+
+		// The actions reported again with a later time, but the same content,
+		// are not replaced.
+		later := newActions()
+		later[1].TimeSeconds = 35
+		later[3].BlogEntry.ModificationTimeSeconds = 50
+		g.Expect(cfStore.AddRecentActions(ctx, later)).Error().Should(Succeed())
+
+		res, err := cfStore.QueryRecentActions(ctx, 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{30, 20, 10}))
+
+		action, err := cfStore.GetRecentAction(ctx, "3-0")
+		g.Expect(err).Should(BeNil())
+		g.Expect(action.BlogEntry.ModificationTimeSeconds).Should(BeZero())
+	})
+
+	run("QueryByHandle", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+
+		// The blog entries are matched by their author.
+		res, err := cfStore.QueryRecentActionsByHandle(ctx, "Tourist", 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{40, 20, 10}))
+
+		res, err = cfStore.QueryRecentActionsByHandle(ctx, "tourist", 15, 1)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{40}))
+	})
+
+	run("GetAction", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+
+		action, err := cfStore.GetRecentAction(ctx, "1-2")
+		g.Expect(err).Should(BeNil())
+		g.Expect(action.TimeSeconds).Should(Equal(int64(30)))
+
+		action, err = cfStore.GetRecentAction(ctx, "3-0")
+		g.Expect(err).Should(BeNil())
+		g.Expect(action.TimeSeconds).Should(Equal(int64(40)))
+
+		_, err = cfStore.GetRecentAction(ctx, "1-3")
+		g.Expect(err).Should(MatchError(store.ErrNotFound))
+	})
+
+	run("Cursor", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+		g.Expect(cfStore.SaveCursor(ctx, 25)).Should(Succeed())
+		g.Expect(cfStore.SaveCursor(ctx, 35)).Should(Succeed())
+
+		// The cursor survives the retention of the actions.
+		deleted, err := cfStore.DeleteActionsBefore(ctx, 50)
+		g.Expect(err).Should(BeNil())
+		g.Expect(deleted).Should(Equal(int64(4)))
+
+		cursor, err := cfStore.LoadCursor(ctx)
+		g.Expect(err).Should(BeNil())
+		g.Expect(cursor).Should(Equal(int64(35)))
+	})
+
+	run("DeleteBefore", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+
+		deleted, err := cfStore.DeleteActionsBefore(ctx, 30)
+		g.Expect(err).Should(BeNil())
+		g.Expect(deleted).Should(Equal(int64(2)))
+		g.Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+			Should(Equal(int64(40)))
+
+		res, err := cfStore.QueryRecentActions(ctx, 0, 0)
+		g.Expect(err).Should(BeNil())
+		g.Expect(timestamps(res)).Should(Equal([]int64{30}))
+
+		// The deleted actions can be added again.
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+		count, err := cfStore.CountRecentActions(ctx)
+		g.Expect(err).Should(BeNil())
+		g.Expect(count).Should(Equal(int64(4)))
+	})
+
+	run("Stream", func(g *WithT, cfStore store.CodeforcesStore) {
+		g.Expect(cfStore.AddRecentActions(ctx, newActions())).Error().
+			Should(Succeed())
+
+		stream, errs := cfStore.StreamRecentActions(ctx, 15)
+		var res []models.RecentAction
+		for action := range stream {
+			res = append(res, action)
+		}
+		g.Expect(<-errs).Should(BeNil())
+		// Unlike the queries, the stream carries the blog entries too.
+		g.Expect(timestamps(res)).Should(Equal([]int64{20, 30, 40}))
+		g.Expect(res[2].Kind()).Should(Equal(models.ActionKindBlogEntry))
+
+		// All the stored actions are streamed, as counted.
+		stream, errs = cfStore.StreamRecentActions(ctx, 0)
+		streamed := int64(0)
+		for range stream {
+			streamed++
+		}
+		g.Expect(<-errs).Should(BeNil())
+		count, err := cfStore.CountRecentActions(ctx)
+		g.Expect(err).Should(BeNil())
+		g.Expect(streamed).Should(Equal(count))
+	})
+}
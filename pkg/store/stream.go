@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// NewActionStream runs produce in its own goroutine, and returns the stream
+// of the actions it sends, along with the channel of its error, as expected
+// from StreamRecentActions. send returns the error of the context if it is
+// done before the action is received. Both channels are closed once produce
+// returns, the actions first, hence the error is received after all the
+// actions.
+func NewActionStream(ctx context.Context,
+	produce func(send func(models.RecentAction) error) error) (<-chan models.RecentAction,
+	<-chan error) {
+	actions := make(chan models.RecentAction)
+	errs := make(chan error, 1)
+
+	send := func(action models.RecentAction) error {
+		// A ready receiver must not win over a done context.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case actions <- action:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(actions)
+		if err := produce(send); err != nil {
+			errs <- err
+		}
+	}()
+	return actions, errs
+}
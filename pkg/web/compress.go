@@ -0,0 +1,146 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// kMinCompressedLength is the length below which the responses are sent
+	// as is, since gzip would barely shrink them, if at all.
+	kMinCompressedLength = 1024
+
+	kGzipEncoding = "gzip"
+)
+
+// gzipWriters are reused across the responses, since each of them allocates
+// a large window.
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// compress returns the middleware compressing the responses of the feeds and
+// the JSON API with gzip, for the clients accepting it. The responses shorter
+// than kMinCompressedLength are sent as is.
+func compress() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !isFeedOrAPI(c) {
+				return next(c)
+			}
+
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			if !acceptsGzip(c.Request()) {
+				return next(c)
+			}
+
+			writer := &gzipResponseWriter{ResponseWriter: res.Writer}
+			res.Writer = writer
+			defer func() {
+				writer.finish()
+				res.Writer = writer.ResponseWriter
+			}()
+			return next(c)
+		}
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of the request lists
+// gzip, with a non-zero quality.
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(
+		req.Header.Get(echo.HeaderAcceptEncoding), ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		if strings.TrimSpace(name) != kGzipEncoding {
+			continue
+		}
+		quality := 1.0
+		if _, rawQuality, ok := strings.Cut(params, "q="); ok {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(rawQuality),
+				64); err == nil {
+				quality = q
+			}
+		}
+		return quality > 0
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of the response, and compresses it
+// only once it reaches kMinCompressedLength.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	// status is the status of the response, which is only written once the
+	// encoding is known. It is zero till WriteHeader is called.
+	status int
+	buf    bytes.Buffer
+
+	// gz is nil till the response is known to be compressed.
+	gz *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+
+	w.buf.Write(b)
+	if w.buf.Len() < kMinCompressedLength ||
+		w.Header().Get(echo.HeaderContentEncoding) != "" {
+		return len(b), nil
+	}
+
+	// The compressed body differs from the original one byte for byte,
+	// hence its validator becomes weak.
+	header := w.Header()
+	header.Set(echo.HeaderContentEncoding, kGzipEncoding)
+	header.Del(echo.HeaderContentLength)
+	if etag := header.Get(kHeaderETag); etag != "" &&
+		!strings.HasPrefix(etag, "W/") {
+		header.Set(kHeaderETag, "W/"+etag)
+	}
+	w.writeStatus()
+
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf.Reset()
+	return len(b), nil
+}
+
+// writeStatus writes the status of the response, if any.
+func (w *gzipResponseWriter) writeStatus() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// finish writes the rest of the response, i.e, the buffered body of a short
+// response, or the end of the compressed stream.
+func (w *gzipResponseWriter) finish() {
+	if w.gz == nil {
+		w.writeStatus()
+		if w.buf.Len() > 0 {
+			w.ResponseWriter.Write(w.buf.Bytes())
+		}
+		return
+	}
+	w.gz.Close()
+	gzipWriters.Put(w.gz)
+}
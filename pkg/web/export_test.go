@@ -0,0 +1,9 @@
+package web
+
+import "net/http"
+
+// Handler exposes the routing of the server to tests, so that the
+// middlewares are exercised along with the handlers.
+func Handler(srv *Server) http.Handler {
+	return srv.ec
+}
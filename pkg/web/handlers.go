@@ -1,33 +1,103 @@
 package web
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/variety-jones/cfrss/pkg/feed"
 	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
 	"github.com/variety-jones/cfrss/pkg/utils"
 )
 
 const (
 	defaultPageSize = 100
+
+	// defaultFeedWindow is how far back in time the feed looks for actions,
+	// unless overridden by WithFeedWindow.
+	defaultFeedWindow = 24 * time.Hour
+
+	// kMaxFeedOverfetch bounds how many times feedMaxItems actions are
+	// queried to fill a feed whose actions are filtered, e.g, by the rating
+	// of their authors, so that a feed of a rare filter stays cheap, if short.
+	kMaxFeedOverfetch = 8
+
+	// kCORSMaxAgeSeconds is how long the browsers cache the preflight
+	// requests of the JSON API.
+	kCORSMaxAgeSeconds = 3600
+
+	kRSSContentType  = "application/rss+xml"
+	kAtomContentType = "application/atom+xml"
+	kOPMLContentType = "text/x-opml"
+
+	// The validator headers that are missing from echo.
+	kHeaderETag        = "ETag"
+	kHeaderIfNoneMatch = "If-None-Match"
 )
 
+// handleRegex matches the handles allowed by Codeforces.
+var handleRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,24}$`)
+
 func (srv *Server) HomeHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, "OK")
 }
 
+// ListenAndServe serves the requests at addr till the server is shut down,
+// in which case it returns nil.
 func (srv *Server) ListenAndServe(addr string) error {
 	zap.S().Infof("Starting the web server at %s", addr)
-	return srv.ec.Start(addr)
+	if err := srv.ec.Start(addr); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting new connections, and waits for the in-flight
+// requests to complete, e.g, a slow feed, till ctx is done.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	zap.S().Info("Shutting down the web server")
+	if err := srv.ec.Shutdown(ctx); err != nil {
+		return errors.Errorf("could not shut down the web server "+
+			"with error [%v]", err)
+	}
+	return nil
+}
+
+func (srv *Server) Stats(c echo.Context) error {
+	zap.S().Info("Executing Stats handler...")
+
+	count, err := srv.cfStore.CountRecentActions(c.Request().Context())
+	if err != nil {
+		zap.S().Errorf("Counting of recent actions failed with error [%+v]",
+			err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	return c.JSON(http.StatusOK, map[string]int64{
+		"recentActions": count,
+	})
 }
 
 func (srv *Server) UserSignup(c echo.Context) error {
 	zap.S().Info("Executing UserSignup handler...")
 
+	ctx := c.Request().Context()
+
 	username := c.FormValue("username")
 	password := c.FormValue("password")
 
@@ -37,7 +107,7 @@ func (srv *Server) UserSignup(c echo.Context) error {
 		HashedPassword: password,
 	}
 
-	if err := srv.cfStore.AddUser(user); err != nil {
+	if err := srv.cfStore.AddUser(ctx, user); err != nil {
 		zap.S().Errorf("Could not register user %s with error [%+v]",
 			username, err)
 		return c.JSON(http.StatusBadRequest,
@@ -50,6 +120,8 @@ func (srv *Server) UserSignup(c echo.Context) error {
 func (srv *Server) SubscribeToBlogs(c echo.Context) error {
 	zap.S().Info("Executing SubscribeToBlogs handler...")
 
+	ctx := c.Request().Context()
+
 	uuid := c.FormValue("uuid")
 
 	// TODO: Switch to array based methods.
@@ -61,7 +133,7 @@ func (srv *Server) SubscribeToBlogs(c echo.Context) error {
 			http.StatusText(http.StatusInternalServerError))
 	}
 
-	if err := srv.cfStore.SubscribeToBlogs(uuid, blogsIDs); err != nil {
+	if err := srv.cfStore.SubscribeToBlogs(ctx, uuid, blogsIDs); err != nil {
 		zap.S().Errorf("User %s could not subscribe to blogs %v "+
 			"with error [%+v]", uuid, blogsIDs, err)
 		return c.JSON(http.StatusInternalServerError,
@@ -74,6 +146,8 @@ func (srv *Server) SubscribeToBlogs(c echo.Context) error {
 func (srv *Server) UnsubscribeFromBlogs(c echo.Context) error {
 	zap.S().Info("Executing UnsubscribeFromBlogs handler...")
 
+	ctx := c.Request().Context()
+
 	uuid := c.FormValue("uuid")
 
 	// TODO: Switch to array based methods.
@@ -85,7 +159,7 @@ func (srv *Server) UnsubscribeFromBlogs(c echo.Context) error {
 			http.StatusText(http.StatusInternalServerError))
 	}
 
-	if err := srv.cfStore.UnsubscribeFromBlogs(uuid, blogsIDs); err != nil {
+	if err := srv.cfStore.UnsubscribeFromBlogs(ctx, uuid, blogsIDs); err != nil {
 		zap.S().Infof("User %s could not unsubscribe from blogs %v "+
 			"with error [%+v]", uuid, blogsIDs, err)
 		return c.JSON(http.StatusInternalServerError,
@@ -98,6 +172,8 @@ func (srv *Server) UnsubscribeFromBlogs(c echo.Context) error {
 func (srv *Server) QueryRecentActions(c echo.Context) error {
 	zap.S().Info("Executing QueryRecentActions handler...")
 
+	ctx := c.Request().Context()
+
 	startTimestamp, err := strconv.ParseInt(c.FormValue("startTimestamp"),
 		10, 64)
 	if err != nil {
@@ -106,7 +182,7 @@ func (srv *Server) QueryRecentActions(c echo.Context) error {
 			http.StatusText(http.StatusBadRequest))
 	}
 
-	actions, err := srv.cfStore.QueryRecentActions(startTimestamp, defaultPageSize)
+	actions, err := srv.cfStore.QueryRecentActions(ctx, startTimestamp, defaultPageSize)
 	if err != nil {
 		zap.S().Errorf("Querying of recent actions failed with error [%+v]", err)
 		return c.JSON(http.StatusInternalServerError,
@@ -119,6 +195,8 @@ func (srv *Server) QueryRecentActions(c echo.Context) error {
 func (srv *Server) QueryCommentsFromBlog(c echo.Context) error {
 	zap.S().Info("Executing QueryCommentsFromBlog handler...")
 
+	ctx := c.Request().Context()
+
 	startTimestamp, err := strconv.ParseInt(c.FormValue("startTimestamp"),
 		10, 64)
 	if err != nil {
@@ -135,7 +213,7 @@ func (srv *Server) QueryCommentsFromBlog(c echo.Context) error {
 			http.StatusText(http.StatusBadRequest))
 	}
 
-	comments, err := srv.cfStore.QueryCommentsFromBlog(id, startTimestamp, defaultPageSize)
+	comments, err := srv.cfStore.QueryCommentsFromBlog(ctx, id, startTimestamp, defaultPageSize)
 	if err != nil {
 		zap.S().Errorf("Querying of comments failed with error [%+v]", err)
 		return c.JSON(http.StatusInternalServerError,
@@ -148,6 +226,8 @@ func (srv *Server) QueryCommentsFromBlog(c echo.Context) error {
 func (srv *Server) QueryRecentActionsForUser(c echo.Context) error {
 	zap.S().Info("Executing QueryRecentActionsFromUser handler...")
 
+	ctx := c.Request().Context()
+
 	uuid := c.FormValue("uuid")
 	startTimestamp, err := strconv.ParseInt(c.FormValue("startTimestamp"),
 		10, 64)
@@ -157,8 +237,8 @@ func (srv *Server) QueryRecentActionsForUser(c echo.Context) error {
 			http.StatusText(http.StatusBadRequest))
 	}
 
-	actions, err := srv.cfStore.QueryRecentActionsForUser(uuid, startTimestamp,
-		defaultPageSize)
+	actions, err := srv.cfStore.QueryRecentActionsForUser(ctx, uuid,
+		startTimestamp, defaultPageSize)
 	if err != nil {
 		zap.S().Errorf("Querying of recent actions for user %s failed "+
 			"with error [%+v]", uuid, err)
@@ -168,3 +248,699 @@ func (srv *Server) QueryRecentActionsForUser(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, actions)
 }
+
+// Search returns the actions mentioning the q query parameter, newest first.
+// At most defaultPageSize actions are returned, fewer if limit is smaller.
+func (srv *Server) Search(c echo.Context) error {
+	zap.S().Info("Executing Search handler...")
+
+	ctx := c.Request().Context()
+
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return c.JSON(http.StatusBadRequest, "q should not be empty")
+	}
+
+	limit, err := parseLimit(c, defaultPageSize)
+	if err != nil {
+		zap.S().Errorf("Could not parse limit with error [%+v]", err)
+		return c.JSON(http.StatusBadRequest,
+			"limit should be a positive integer")
+	}
+
+	actions, err := srv.cfStore.SearchRecentActions(ctx, query, limit)
+	if err != nil {
+		zap.S().Errorf("Searching of recent actions failed with error [%+v]",
+			err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	return c.JSON(http.StatusOK, actions)
+}
+
+func (srv *Server) Feed(c echo.Context) error {
+	zap.S().Info("Executing Feed handler...")
+
+	// An optional handle scopes the feed to the activity of a single user.
+	handle := c.QueryParam("handle")
+	return srv.renderFeed(c, handle, feedPath(handle), rssFormat)
+}
+
+// HandleFeed serves the feed of a single user, so that people can subscribe
+// to a competitor with a plain URL.
+func (srv *Server) HandleFeed(c echo.Context) error {
+	zap.S().Info("Executing HandleFeed handler...")
+
+	handle := c.Param("handle")
+	if !handleRegex.MatchString(handle) {
+		return c.String(http.StatusNotFound, "unknown handle")
+	}
+	exists, err := srv.handleExists(c.Request().Context(), handle)
+	if err != nil {
+		// The feed is served rather than failing the readers of a valid
+		// handle while Codeforces is unavailable.
+		zap.S().Warnw("Serving the feed of an unverified handle",
+			zap.String("handle", handle), zap.Error(err))
+	} else if !exists {
+		return c.String(http.StatusNotFound, "unknown handle")
+	}
+	return srv.renderFeed(c, handle, feedPath(handle), rssFormat)
+}
+
+// handleExists tells whether the handle has any action in the store, or else
+// whether Codeforces knows it, through the cache of the ratings, if the
+// server can call Codeforces.
+func (srv *Server) handleExists(ctx context.Context, handle string) (bool,
+	error) {
+	actions, err := srv.cfStore.QueryRecentActionsByHandle(ctx, handle, 0, 1)
+	if err != nil {
+		return false, errors.Errorf("could not query the actions of %s "+
+			"with error [%v]", handle, err)
+	}
+	if len(actions) > 0 {
+		return true, nil
+	}
+	if srv.authorRatings == nil {
+		return false, nil
+	}
+	return srv.authorRatings.exists(ctx, handle)
+}
+
+// feedBuilder renders the actions into a feed of a given format.
+type feedBuilder func(actions []models.RecentAction, opts ...feed.Option) (
+	[]byte, error)
+
+// feedFormat is a format in which the feeds are served.
+type feedFormat struct {
+	build       feedBuilder
+	contentType string
+}
+
+var (
+	rssFormat  = feedFormat{build: feed.BuildRSS, contentType: kRSSContentType}
+	atomFormat = feedFormat{build: feed.BuildAtom,
+		contentType: kAtomContentType}
+)
+
+// renderFeed responds with the feed of the recent actions in the format,
+// scoped to the handle unless it is empty. The feed links to itself at
+// selfPath.
+func (srv *Server) renderFeed(c echo.Context, handle, selfPath string,
+	format feedFormat) error {
+	ctx := c.Request().Context()
+
+	startTimestamp, err := srv.startTimestamp(c)
+	if err != nil {
+		zap.S().Errorf("Could not parse since with error [%+v]", err)
+		return c.String(http.StatusBadRequest,
+			"since should be a unix timestamp")
+	}
+
+	// An optional after_id replaces the window and since with the activity
+	// time of the last item the reader has seen, before any edit bumped it,
+	// and serves the actions that follow it rather than the newest ones, so
+	// that the readers can resume without a gap. The actions of the same
+	// second are served again, since they may not have been seen, which
+	// readers dedup by their guid.
+	var afterId string
+	if rawAfterId := c.QueryParam("after_id"); rawAfterId != "" {
+		after, ok, err := srv.afterAction(c, rawAfterId)
+		if !ok {
+			return err
+		}
+		afterId = after.Id()
+		startTimestamp = after.OriginalTimeSeconds()
+	}
+	oldestFirst := afterId != ""
+
+	// The actions filtered out, e.g, by the rating of their authors or by the
+	// length of their content, are not counted against feedMaxItems, hence
+	// more of them are queried till the feed is full, or there are no more.
+	var actions []models.RecentAction
+	var ratingOpts []feed.Option
+	for limit := srv.feedMaxItems; ; limit *= 2 {
+		queried, err := srv.queryFeed(ctx, handle, startTimestamp, limit,
+			oldestFirst)
+		if err != nil {
+			zap.S().Errorf("Querying of recent actions failed with error [%+v]",
+				err)
+			return c.String(http.StatusInternalServerError,
+				"could not query recent actions")
+		}
+		exhausted := int64(len(queried)) < limit
+		if afterId != "" {
+			queried = excludeAction(queried, afterId)
+		}
+
+		ratingOpts = srv.ratingOptions(ctx, queried)
+		filterOpts := append([]feed.Option(nil), srv.feedOpts...)
+		actions = feed.Filter(queried, append(filterOpts, ratingOpts...)...)
+		if int64(len(actions)) >= srv.feedMaxItems || exhausted ||
+			limit >= kMaxFeedOverfetch*srv.feedMaxItems {
+			break
+		}
+	}
+	if int64(len(actions)) > srv.feedMaxItems {
+		actions = actions[:srv.feedMaxItems]
+	}
+	// The feeds list the newest actions first either way.
+	if oldestFirst {
+		reverseActions(actions)
+	}
+
+	return srv.writeFeed(c, actions, handle, selfPath, format, ratingOpts...)
+}
+
+// queryFeed returns the newest actions of the feed scoped to the handle,
+// unless it is empty, from startTimestamp, at most limit of them. If
+// oldestFirst is set, the oldest ones are returned instead, in ascending
+// order.
+func (srv *Server) queryFeed(ctx context.Context, handle string,
+	startTimestamp, limit int64, oldestFirst bool) (
+	[]models.RecentAction, error) {
+	switch {
+	case handle == "" && oldestFirst:
+		return srv.cfStore.QueryRecentActionsSorted(ctx, startTimestamp,
+			limit, 0, store.SortAscending)
+	case handle == "":
+		return srv.cfStore.QueryRecentActions(ctx, startTimestamp, limit)
+	case !oldestFirst:
+		return srv.cfStore.QueryRecentActionsByHandle(ctx, handle,
+			startTimestamp, limit)
+	}
+
+	// The actions of a handle are only queried newest first, hence all of
+	// them are, which are few after the item of a reader.
+	actions, err := srv.cfStore.QueryRecentActionsByHandle(ctx, handle,
+		startTimestamp, 0)
+	if err != nil {
+		return nil, err
+	}
+	reverseActions(actions)
+	if limit > 0 && int64(len(actions)) > limit {
+		actions = actions[:limit]
+	}
+	return actions, nil
+}
+
+// reverseActions reverses the order of the actions in place.
+func reverseActions(actions []models.RecentAction) {
+	for i, j := 0, len(actions)-1; i < j; i, j = i+1, j-1 {
+		actions[i], actions[j] = actions[j], actions[i]
+	}
+}
+
+// ratingOptions returns the feed options coloring and filtering the actions
+// by the ratings of their authors, if enabled. The feed is served unfiltered
+// if some of the ratings are unavailable, e.g, while Codeforces is down,
+// rather than dropping the actions of all the authors, or most of them.
+func (srv *Server) ratingOptions(ctx context.Context,
+	actions []models.RecentAction) []feed.Option {
+	if srv.authorRatings == nil {
+		return nil
+	}
+	var opts []feed.Option
+	ratings, err := srv.authorRatings.lookup(ctx, actions)
+	if srv.colorAuthors {
+		opts = append(opts, feed.WithAuthorRatings(ratings))
+	}
+	if srv.minRating <= 0 {
+		if err != nil {
+			zap.S().Warnw("Serving the feed without some of the ratings",
+				zap.Error(err))
+		}
+		return opts
+	}
+	if err != nil {
+		zap.S().Warnw("Serving the feed unfiltered by rating",
+			zap.Error(err))
+		return opts
+	}
+	return append(opts, feed.WithMinRating(srv.minRating, ratings,
+		srv.includeUnrated))
+}
+
+// afterAction returns the action identified by the after_id query parameter,
+// which is either the guid of a feed item, i.e, its permalink, or the id of
+// the action. If it can't be returned, the error response is written instead
+// and ok is false.
+func (srv *Server) afterAction(c echo.Context, afterId string) (
+	action models.RecentAction, ok bool, err error) {
+	id := afterId
+	if _, _, err := models.ParseActionId(id); err != nil {
+		if id, err = models.ParsePermalinkURL(afterId); err != nil {
+			return action, false, c.String(http.StatusBadRequest,
+				"after_id should be the guid of a feed item")
+		}
+	}
+
+	action, err = srv.cfStore.GetRecentAction(c.Request().Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return action, false, c.String(http.StatusBadRequest,
+			"unknown after_id")
+	}
+	if err != nil {
+		zap.S().Errorf("Querying of action %s failed with error [%+v]",
+			id, err)
+		return action, false, c.String(http.StatusInternalServerError,
+			"could not query the action")
+	}
+	return action, true, nil
+}
+
+// excludeAction returns the actions but the one of the id.
+func excludeAction(actions []models.RecentAction,
+	id string) []models.RecentAction {
+	res := make([]models.RecentAction, 0, len(actions))
+	for _, action := range actions {
+		if action.Id() != id {
+			res = append(res, action)
+		}
+	}
+	return res
+}
+
+// writeFeed renders the actions into a feed in the format, scoped to the
+// handle unless it is empty, and responds with it unless the reader already
+// has it. The options are applied after the ones of the server and of the
+// request.
+func (srv *Server) writeFeed(c echo.Context, actions []models.RecentAction,
+	handle, selfPath string, format feedFormat, opts ...feed.Option) error {
+	// The feed changes when a newer revision of an action is stored, so the
+	// readers that already have it are spared the body.
+	lastModified := newestEditTime(actions)
+	if !lastModified.IsZero() {
+		c.Response().Header().Set(echo.HeaderLastModified,
+			lastModified.Format(http.TimeFormat))
+		// If-None-Match takes precedence when both validators are sent,
+		// since only the hash tells an older action stored late.
+		if c.Request().Header.Get(kHeaderIfNoneMatch) == "" &&
+			notModifiedSince(c.Request(), lastModified) {
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
+
+	// The options of the request are applied last, so that they take
+	// precedence over the ones of the server.
+	feedOpts := append([]feed.Option(nil), srv.feedOpts...)
+	if srv.publicUrl != "" {
+		feedOpts = append(feedOpts, feed.WithSelfLink(srv.publicUrl+
+			selfPath))
+	}
+	// Collapsing is opt-in, so that the feed contains the raw actions by
+	// default.
+	if collapse, _ := strconv.ParseBool(c.QueryParam("collapse")); collapse {
+		feedOpts = append(feedOpts, feed.WithCollapseByBlog())
+	}
+	if locale := c.QueryParam("lang"); locale != "" {
+		if !feed.IsSupportedLocale(locale) {
+			return c.String(http.StatusBadRequest,
+				"lang should be one of en and ru")
+		}
+		feedOpts = append(feedOpts, feed.WithLocale(locale))
+	}
+	// Only the aggregate feed is published to the hubs.
+	if handle == "" && len(srv.webSubHubs) > 0 &&
+		format.contentType == kRSSContentType {
+		feedOpts = append(feedOpts, feed.WithWebSub(srv.webSubHubs,
+			srv.feedUrl))
+	}
+	feedOpts = append(feedOpts, opts...)
+
+	out, err := format.build(actions, feedOpts...)
+	if err != nil {
+		zap.S().Errorf("Rendering of the feed failed with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			"could not render the feed")
+	}
+
+	// The rendering is deterministic, so the hash of the feed identifies it.
+	etag := feedETag(out)
+	c.Response().Header().Set(kHeaderETag, etag)
+	if matchesETag(c.Request(), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, format.contentType, out)
+}
+
+// AtomFeed serves the feeds as Atom. The page parameter, starting from 1,
+// pages through the whole history of the aggregate feed instead of its
+// window, with links to the adjacent pages as in RFC 5005, so that archival
+// readers can walk back in time. The links point to the actions right before
+// or after a cursor rather than to an offset, so that a page doesn't shift
+// when newer actions arrive.
+func (srv *Server) AtomFeed(c echo.Context) error {
+	zap.S().Info("Executing AtomFeed handler...")
+
+	handle := c.QueryParam("handle")
+	rawPage := c.QueryParam("page")
+	rawBefore := c.QueryParam("before")
+	rawAfter := c.QueryParam("after")
+	if rawPage == "" && rawBefore == "" && rawAfter == "" {
+		selfPath := kAtomFeed
+		if handle != "" {
+			selfPath += "?handle=" + url.QueryEscape(handle)
+		}
+		return srv.renderFeed(c, handle, selfPath, atomFormat)
+	}
+	if handle != "" {
+		return c.String(http.StatusBadRequest,
+			"the pages are only available without a handle")
+	}
+
+	ctx := c.Request().Context()
+	pageSize := srv.pageSize()
+	var actions []models.RecentAction
+	var hasPrevious, hasNext bool
+	var selfPath string
+	var err error
+	switch {
+	case rawPage != "":
+		page, parseErr := strconv.ParseInt(rawPage, 10, 64)
+		// The offset of the page should not overflow either.
+		if parseErr != nil || page <= 0 ||
+			page-1 > math.MaxInt64/pageSize {
+			return c.String(http.StatusBadRequest,
+				"page should be a positive integer")
+		}
+
+		selfPath = atomPagePath(page)
+		if page == 1 {
+			// The first page is the one before the end of time, so that it
+			// sorts the ties just like the pages it links to.
+			actions, hasNext, err = srv.queryPage(ctx,
+				pageCursor{timestamp: math.MaxInt64}, true, pageSize)
+			break
+		}
+
+		// A single extra action tells whether there is a next page.
+		actions, err = srv.cfStore.QueryRecentActionsPaged(ctx, 0,
+			pageSize+1, (page-1)*pageSize)
+		hasNext = int64(len(actions)) > pageSize
+		if hasNext {
+			actions = actions[:pageSize]
+		}
+		hasPrevious = true
+	default:
+		raw, older := rawAfter, false
+		if rawBefore != "" {
+			raw, older = rawBefore, true
+		}
+		cursor, parseErr := parsePageCursor(raw)
+		if parseErr != nil || rawBefore != "" && rawAfter != "" {
+			return c.String(http.StatusBadRequest,
+				"either before or after should be a cursor")
+		}
+
+		// The cursor itself is on the other side of the page.
+		var more bool
+		actions, more, err = srv.queryPage(ctx, cursor, older, pageSize)
+		hasPrevious, hasNext = older || more, !older || more
+		selfPath = atomCursorPath(cursor, older)
+	}
+	if err != nil {
+		zap.S().Errorf("Querying of page %s failed with error [%+v]",
+			c.QueryString(), err)
+		return c.String(http.StatusInternalServerError,
+			"could not query recent actions")
+	}
+
+	var previous, next string
+	if hasPrevious && len(actions) > 0 {
+		previous = srv.publicUrl + atomCursorPath(
+			newPageCursor(actions[0]), false)
+	}
+	if hasNext && len(actions) > 0 {
+		next = srv.publicUrl + atomCursorPath(
+			newPageCursor(actions[len(actions)-1]), true)
+	}
+	opts := append(srv.ratingOptions(ctx, actions),
+		feed.WithPaging(srv.feedPageUrl(1), previous, next))
+	return srv.writeFeed(c, actions, "", selfPath, atomFormat, opts...)
+}
+
+// pageSize returns the number of actions in a page of the paged feeds.
+func (srv *Server) pageSize() int64 {
+	if srv.feedMaxItems <= 0 {
+		return defaultPageSize
+	}
+	return srv.feedMaxItems
+}
+
+// feedPageUrl returns the URL of the page of the paged Atom feed, which is
+// relative unless the public URL of the server is known.
+func (srv *Server) feedPageUrl(page int64) string {
+	return srv.publicUrl + atomPagePath(page)
+}
+
+// atomPagePath returns the path of the page of the paged Atom feed.
+func atomPagePath(page int64) string {
+	return fmt.Sprintf("%s?page=%d", kAtomFeed, page)
+}
+
+// feedPath returns the canonical path of the feed scoped to the handle, or of
+// the aggregate feed if the handle is empty.
+func feedPath(handle string) string {
+	if handle == "" {
+		return kFeed
+	}
+	return strings.Replace(kHandleFeed, ":handle", handle, 1)
+}
+
+// startTimestamp returns the timestamp from which the actions are served,
+// i.e, the start of the window. An optional since replaces the window, so
+// that clients can tail the actions incrementally, in which case only the
+// actions strictly after it are served.
+func (srv *Server) startTimestamp(c echo.Context) (int64, error) {
+	since := c.QueryParam("since")
+	if since == "" {
+		return time.Now().Add(-srv.feedWindow).Unix(), nil
+	}
+	sinceTimestamp, err := strconv.ParseInt(since, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	// The start would overflow, and serve the whole history instead.
+	if sinceTimestamp == math.MaxInt64 {
+		return 0, errors.Errorf("since should be below %d, got %d",
+			int64(math.MaxInt64), sinceTimestamp)
+	}
+	return sinceTimestamp + 1, nil
+}
+
+// parseLimit returns the optional limit query parameter, capped by maxLimit.
+// It returns maxLimit if the parameter is missing.
+func parseLimit(c echo.Context, maxLimit int64) (int64, error) {
+	rawLimit := c.QueryParam("limit")
+	if rawLimit == "" {
+		return maxLimit, nil
+	}
+	limit, err := strconv.ParseInt(rawLimit, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 {
+		return 0, errors.Errorf("limit should be positive, got %d", limit)
+	}
+	if limit > maxLimit {
+		return maxLimit, nil
+	}
+	return limit, nil
+}
+
+// newestEditTime returns the edit time of the newest revision among the
+// actions, or the zero time if there are no actions.
+func newestEditTime(actions []models.RecentAction) time.Time {
+	var newest int64
+	for _, action := range actions {
+		if editTime := action.EditTimeSeconds(); editTime > newest {
+			newest = editTime
+		}
+	}
+	if newest == 0 {
+		return time.Time{}
+	}
+	return time.Unix(newest, 0).UTC()
+}
+
+// notModifiedSince reports whether the If-Modified-Since header of the request
+// is at or after lastModified. Malformed headers are ignored.
+func notModifiedSince(req *http.Request, lastModified time.Time) bool {
+	ifModifiedSince := req.Header.Get(echo.HeaderIfModifiedSince)
+	if ifModifiedSince == "" {
+		return false
+	}
+	t, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return !t.Before(lastModified)
+}
+
+// feedETag returns the strong ETag of the rendered feed.
+func feedETag(out []byte) string {
+	sum := sha256.Sum256(out)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchesETag reports whether the If-None-Match header of the request lists
+// the etag, or is the wildcard.
+func matchesETag(req *http.Request, etag string) bool {
+	ifNoneMatch := req.Header.Get(kHeaderIfNoneMatch)
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		// Weak comparison is used, as recommended for If-None-Match.
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Actions is the JSON counterpart of the aggregate feed, for clients that
+// build their own UI. It accepts the since parameter of the feed, and a limit
+// that can only lower the number of items of the feed.
+func (srv *Server) Actions(c echo.Context) error {
+	zap.S().Info("Executing Actions handler...")
+
+	ctx := c.Request().Context()
+
+	startTimestamp, err := srv.startTimestamp(c)
+	if err != nil {
+		zap.S().Errorf("Could not parse since with error [%+v]", err)
+		return c.JSON(http.StatusBadRequest, "since should be a unix timestamp")
+	}
+
+	limit, err := parseLimit(c, srv.feedMaxItems)
+	if err != nil {
+		zap.S().Errorf("Could not parse limit with error [%+v]", err)
+		return c.JSON(http.StatusBadRequest,
+			"limit should be a positive integer")
+	}
+
+	actions, err := srv.cfStore.QueryRecentActions(ctx, startTimestamp, limit)
+	if err != nil {
+		zap.S().Errorf("Querying of recent actions failed with error [%+v]", err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	// Clients expect an array, even if there are no actions.
+	if actions == nil {
+		actions = []models.RecentAction{}
+	}
+	return c.JSON(http.StatusOK, actions)
+}
+
+// ActionPage renders a single action as an HTML page, e.g, to share a
+// permalink to it.
+func (srv *Server) ActionPage(c echo.Context) error {
+	zap.S().Info("Executing ActionPage handler...")
+
+	action, ok, err := srv.getAction(c)
+	if !ok {
+		return err
+	}
+
+	feedUrl := strings.Replace(kActionFeed, ":id", action.Id(), 1)
+	out, err := feed.BuildHTML(action, feedUrl, srv.feedOpts...)
+	if err != nil {
+		zap.S().Errorf("Rendering of html page failed with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			"could not render the action")
+	}
+
+	return c.HTMLBlob(http.StatusOK, out)
+}
+
+// ActionFeed renders a single action as a one-item RSS feed.
+func (srv *Server) ActionFeed(c echo.Context) error {
+	zap.S().Info("Executing ActionFeed handler...")
+
+	action, ok, err := srv.getAction(c)
+	if !ok {
+		return err
+	}
+
+	selfPath := strings.Replace(kActionFeed, ":id", action.Id(), 1)
+	out, err := feed.BuildRSS([]models.RecentAction{action},
+		srv.permalinkOptions(selfPath)...)
+	if err != nil {
+		zap.S().Errorf("Rendering of rss feed failed with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			"could not render the feed")
+	}
+
+	return c.Blob(http.StatusOK, kRSSContentType, out)
+}
+
+// permalinkOptions returns the options of the feeds for the one-item feed at
+// selfPath, so that the action is rendered just like in the other feeds.
+func (srv *Server) permalinkOptions(selfPath string) []feed.Option {
+	feedOpts := append([]feed.Option(nil), srv.feedOpts...)
+	if srv.publicUrl != "" {
+		feedOpts = append(feedOpts, feed.WithSelfLink(srv.publicUrl+
+			selfPath))
+	}
+	// The requested action is served even if the other feeds drop it.
+	return append(feedOpts, feed.WithMinContentLength(0))
+}
+
+// getAction returns the action identified by the id path parameter. If it
+// can't be returned, the error response is written instead and ok is false.
+func (srv *Server) getAction(c echo.Context) (
+	action models.RecentAction, ok bool, err error) {
+	id := c.Param("id")
+	if _, _, err := models.ParseActionId(id); err != nil {
+		return action, false, c.String(http.StatusNotFound, "unknown action")
+	}
+
+	action, err = srv.cfStore.GetRecentAction(c.Request().Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return action, false, c.String(http.StatusNotFound, "unknown action")
+	}
+	if err != nil {
+		zap.S().Errorf("Querying of action %s failed with error [%+v]",
+			id, err)
+		return action, false, c.String(http.StatusInternalServerError,
+			"could not query the action")
+	}
+	return action, true, nil
+}
+
+// FeedsOPML lists the aggregate feed and the feeds of the configured handles,
+// so that readers can import all of them at once.
+func (srv *Server) FeedsOPML(c echo.Context) error {
+	zap.S().Info("Executing FeedsOPML handler...")
+
+	// Readers need absolute URLs, hence they are derived from the request.
+	baseUrl := c.Scheme() + "://" + c.Request().Host
+	subscriptions := []feed.Subscription{{
+		Title: "Codeforces Recent Actions",
+		Url:   baseUrl + kFeed,
+	}}
+	for _, handle := range srv.handles {
+		if !handleRegex.MatchString(handle) {
+			zap.S().Errorf("Skipping invalid handle %s in the OPML", handle)
+			continue
+		}
+		subscriptions = append(subscriptions, feed.Subscription{
+			Title: fmt.Sprintf("Codeforces activity of %s", handle),
+			Url:   baseUrl + strings.Replace(kHandleFeed, ":handle", handle, 1),
+		})
+	}
+
+	out, err := feed.BuildOPML(subscriptions)
+	if err != nil {
+		zap.S().Errorf("Rendering of opml failed with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			"could not render the opml")
+	}
+
+	return c.Blob(http.StatusOK, kOPMLContentType, out)
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	kHealthOK = "ok"
+
+	// kPingTimeout bounds the time spent checking the store, so that the
+	// health check fails fast instead of hanging the orchestrator's probe.
+	kPingTimeout = 2 * time.Second
+)
+
+// healthResponse describes the result of each health check.
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Healthz returns 200 only if the scheduler completed a cycle recently, and
+// the store is reachable.
+func (srv *Server) Healthz(c echo.Context) error {
+	res := healthResponse{
+		Status: kHealthOK,
+		Checks: make(map[string]string),
+	}
+
+	if srv.scheduler != nil {
+		res.Checks["scheduler"] = kHealthOK
+		// The scheduler is considered to be stuck once it missed a cycle
+		// even after backing off as far as it does.
+		since := time.Since(srv.scheduler.LastSuccessfulSync())
+		if since > srv.scheduler.StaleAfter() {
+			res.Status = "unhealthy"
+			res.Checks["scheduler"] = fmt.Sprintf("no successful cycle "+
+				"in the last %v", since.Round(time.Second))
+		}
+	}
+
+	res.Checks["store"] = kHealthOK
+	ctx, cancel := context.WithTimeout(c.Request().Context(), kPingTimeout)
+	defer cancel()
+	if err := srv.cfStore.Ping(ctx); err != nil {
+		res.Status = "unhealthy"
+		res.Checks["store"] = err.Error()
+	}
+
+	if res.Status != kHealthOK {
+		zap.S().Warnf("Health check failed with checks %v", res.Checks)
+		return c.JSON(http.StatusServiceUnavailable, res)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// DebugScheduler returns the state of the scheduler as JSON.
+func (srv *Server) DebugScheduler(c echo.Context) error {
+	if srv.scheduler == nil {
+		return c.String(http.StatusNotFound, "the scheduler is disabled")
+	}
+	return c.JSON(http.StatusOK, srv.scheduler.Stats(c.Request().Context()))
+}
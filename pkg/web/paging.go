@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+// pageCursor is the position of an action in the paged Atom feed, which is
+// sorted by activity time, then by id, newest first. Unlike an offset, it
+// doesn't shift when newer actions arrive.
+type pageCursor struct {
+	timestamp int64
+	id        string
+}
+
+// newPageCursor returns the position of the action.
+func newPageCursor(action models.RecentAction) pageCursor {
+	return pageCursor{timestamp: action.TimeSeconds, id: action.Id()}
+}
+
+// parsePageCursor parses a cursor formatted by pageCursor.String, e.g,
+// "1660000000-101-7".
+func parsePageCursor(raw string) (pageCursor, error) {
+	rawTimestamp, id, ok := strings.Cut(raw, "-")
+	if !ok || id == "" {
+		return pageCursor{}, errors.Errorf("invalid cursor %s", raw)
+	}
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return pageCursor{}, errors.Errorf("invalid cursor %s with error "+
+			"[%v]", raw, err)
+	}
+	return pageCursor{timestamp: timestamp, id: id}, nil
+}
+
+func (cursor pageCursor) String() string {
+	return fmt.Sprintf("%d-%s", cursor.timestamp, cursor.id)
+}
+
+// newerThan tells whether the cursor comes before the other one in the feed.
+func (cursor pageCursor) newerThan(other pageCursor) bool {
+	if cursor.timestamp != other.timestamp {
+		return cursor.timestamp > other.timestamp
+	}
+	return cursor.id > other.id
+}
+
+// queryPage returns up to pageSize actions right after the cursor, i.e,
+// older, or right before it, i.e, newer, in the order of the feed, and
+// whether there are more of them beyond the page.
+func (srv *Server) queryPage(ctx context.Context, cursor pageCursor,
+	older bool, pageSize int64) ([]models.RecentAction, bool, error) {
+	// The stores only sort by activity time, hence the ties of the cursor
+	// are sorted here, and the actions are fetched till a whole page of
+	// them is known to be complete.
+	for limit := pageSize + 1; ; limit *= 2 {
+		var fetched []models.RecentAction
+		var err error
+		if older {
+			fetched, err = srv.cfStore.QueryRecentActionsBefore(ctx,
+				cursor.timestamp, limit)
+		} else {
+			fetched, err = srv.cfStore.QueryRecentActionsSorted(ctx,
+				cursor.timestamp, limit, 0, store.SortAscending)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		exhausted := int64(len(fetched)) < limit
+
+		var page []models.RecentAction
+		for _, action := range fetched {
+			// Some of the ties of the last action fetched may be missing.
+			if !exhausted &&
+				action.TimeSeconds == fetched[len(fetched)-1].TimeSeconds {
+				continue
+			}
+			position := newPageCursor(action)
+			if older && cursor.newerThan(position) ||
+				!older && position.newerThan(cursor) {
+				page = append(page, action)
+			}
+		}
+		if !exhausted && int64(len(page)) <= pageSize {
+			continue
+		}
+
+		// The page is sorted away from the cursor, then back to the order of
+		// the feed.
+		sort.SliceStable(page, func(i, j int) bool {
+			return newPageCursor(page[i]).newerThan(
+				newPageCursor(page[j])) == older
+		})
+		more := int64(len(page)) > pageSize
+		if more {
+			page = page[:pageSize]
+		}
+		if !older {
+			reverseActions(page)
+		}
+		return page, more, nil
+	}
+}
+
+// atomCursorPath returns the path of the page of the paged Atom feed right
+// after the cursor, or right before it.
+func atomCursorPath(cursor pageCursor, older bool) string {
+	param := "after"
+	if older {
+		param = "before"
+	}
+	return fmt.Sprintf("%s?%s=%s", kAtomFeed, param,
+		url.QueryEscape(cursor.String()))
+}
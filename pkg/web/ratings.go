@@ -0,0 +1,204 @@
+package web
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	// kAuthorRatingsTTL is how long the rating of an author is reused before
+	// it is fetched again. Ratings only change after contests, so an hour is
+	// plenty. The handles unknown to Codeforces are cached as long.
+	kAuthorRatingsTTL = time.Hour
+
+	// kAuthorRatingsRetryAfter is how long the authors whose ratings could
+	// not be fetched are served without them before the next attempt, so
+	// that an outage of Codeforces doesn't cost a call per feed request.
+	kAuthorRatingsRetryAfter = 5 * time.Minute
+
+	// kMaxAuthorRatings bounds the number of cached authors. The cache is
+	// cleared once it is full, which is simpler than an eviction policy, and
+	// only costs a few extra calls.
+	kMaxAuthorRatings = 10000
+)
+
+// authorRatings is an in-memory cache of the ratings of the authors, keyed by
+// their lower-cased handles, and filled from Codeforces on demand.
+type authorRatings struct {
+	cfClient   cfapi.CodeforcesAPI
+	ttl        time.Duration
+	retryAfter time.Duration
+
+	// The mutex guards the entries and the handles being fetched, but is
+	// never held while calling Codeforces.
+	mutex    sync.Mutex
+	entries  map[string]authorRatingsEntry
+	fetching map[string]bool
+}
+
+// authorRatingsEntry is the cached rating of an author, which is unknown if
+// the author doesn't exist, or failed if it could not be fetched. The entry is
+// valid till expiresAt.
+type authorRatingsEntry struct {
+	rating    int
+	known     bool
+	failed    bool
+	expiresAt time.Time
+}
+
+// lookup returns the ratings of the authors of the actions, fetching the
+// ones missing from the cache in a single call. It returns an error if the
+// rating of some of them is unavailable, in which case they are left out, so
+// that the feed is still served without their colors. That is the case of the
+// authors that could not be fetched, lately or now, and of the ones being
+// fetched by a concurrent lookup, rather than waiting on it. The unknown
+// authors are simply left out.
+func (cache *authorRatings) lookup(ctx context.Context,
+	actions []models.RecentAction) (map[string]int, error) {
+	handles := make([]string, 0, len(actions))
+	for _, action := range actions {
+		handles = append(handles, action.Author())
+	}
+	return cache.lookupHandles(ctx, handles)
+}
+
+// exists tells whether Codeforces knows the handle, which is looked up like
+// the ratings, see lookup.
+func (cache *authorRatings) exists(ctx context.Context, handle string) (bool,
+	error) {
+	ratings, err := cache.lookupHandles(ctx, []string{handle})
+	if err != nil {
+		return false, err
+	}
+	_, ok := ratings[strings.ToLower(handle)]
+	return ok, nil
+}
+
+// lookupHandles returns the ratings of the handles, see lookup.
+func (cache *authorRatings) lookupHandles(ctx context.Context,
+	handles []string) (map[string]int, error) {
+	ratings := make(map[string]int)
+	seen := make(map[string]bool)
+	var missing []string
+	unavailable := 0
+	now := time.Now()
+
+	cache.mutex.Lock()
+	for _, handle := range handles {
+		key := strings.ToLower(handle)
+		if handle == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		entry, ok := cache.entries[key]
+		if ok && now.Before(entry.expiresAt) {
+			if entry.known {
+				ratings[key] = entry.rating
+			} else if entry.failed {
+				unavailable++
+			}
+			continue
+		}
+		if cache.fetching[key] {
+			unavailable++
+			continue
+		}
+		cache.fetching[key] = true
+		missing = append(missing, handle)
+	}
+	cache.mutex.Unlock()
+	if len(missing) == 0 {
+		if unavailable > 0 {
+			return ratings, errors.Errorf("the ratings of %d authors are "+
+				"unavailable", unavailable)
+		}
+		return ratings, nil
+	}
+
+	users, unknown, err := cache.fetch(ctx, missing)
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, handle := range missing {
+		delete(cache.fetching, strings.ToLower(handle))
+	}
+	if len(cache.entries)+len(missing) > kMaxAuthorRatings {
+		cache.entries = make(map[string]authorRatingsEntry)
+	}
+	if err != nil {
+		for _, handle := range missing {
+			cache.entries[strings.ToLower(handle)] = authorRatingsEntry{
+				failed:    true,
+				expiresAt: now.Add(cache.retryAfter),
+			}
+		}
+		return ratings, errors.Errorf("could not fetch the ratings of %d "+
+			"authors with error [%v]", len(missing), err)
+	}
+	expiresAt := now.Add(cache.ttl)
+	for _, handle := range unknown {
+		cache.entries[strings.ToLower(handle)] = authorRatingsEntry{
+			expiresAt: expiresAt,
+		}
+	}
+	for _, user := range users {
+		key := strings.ToLower(user.Handle)
+		ratings[key] = user.Rating
+		cache.entries[key] = authorRatingsEntry{
+			rating:    user.Rating,
+			known:     true,
+			expiresAt: expiresAt,
+		}
+	}
+	if unavailable > 0 {
+		return ratings, errors.Errorf("the ratings of %d authors are "+
+			"unavailable", unavailable)
+	}
+	return ratings, nil
+}
+
+// fetch returns the profiles of the handles, along with the handles unknown
+// to Codeforces, e.g, renamed ones. Codeforces fails the whole call for a
+// single unknown handle, hence the batch is bisected till they are isolated.
+func (cache *authorRatings) fetch(ctx context.Context, handles []string) (
+	[]models.CodeforcesUser, []string, error) {
+	users, err := cache.cfClient.UserInfo(ctx, handles)
+	if !errors.Is(err, &cfapi.NotFoundError{}) {
+		return users, nil, err
+	}
+	if len(handles) == 1 {
+		zap.S().Debugw("Skipping the rating of an unknown author",
+			zap.String("handle", handles[0]))
+		return nil, handles, nil
+	}
+
+	mid := len(handles) / 2
+	users, unknown, err := cache.fetch(ctx, handles[:mid])
+	if err != nil {
+		return nil, nil, err
+	}
+	moreUsers, moreUnknown, err := cache.fetch(ctx, handles[mid:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(users, moreUsers...), append(unknown, moreUnknown...), nil
+}
+
+func newAuthorRatings(cfClient cfapi.CodeforcesAPI) *authorRatings {
+	return &authorRatings{
+		cfClient:   cfClient,
+		ttl:        kAuthorRatingsTTL,
+		retryAfter: kAuthorRatingsRetryAfter,
+		entries:    make(map[string]authorRatingsEntry),
+		fetching:   make(map[string]bool),
+	}
+}
@@ -0,0 +1,180 @@
+package web_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi/mock"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/memory"
+	"github.com/variety-jones/cfrss/pkg/web"
+)
+
+// ratingsClient scripts the failures of UserInfo, and blocks it till
+// release is closed, if set.
+type ratingsClient struct {
+	*mock.CodeforcesClient
+
+	err     error
+	release chan struct{}
+	calls   int32
+}
+
+func (client *ratingsClient) UserInfo(ctx context.Context,
+	handles []string) ([]models.CodeforcesUser, error) {
+	atomic.AddInt32(&client.calls, 1)
+	if client.release != nil {
+		<-client.release
+	}
+	if client.err != nil {
+		return nil, client.err
+	}
+	return client.CodeforcesClient.UserInfo(ctx, handles)
+}
+
+var _ = Describe("AuthorRatings", func() {
+	// newRatingStore returns a store with a comment by each handle, newest
+	// first.
+	newRatingStore := func(handles ...string) store.CodeforcesStore {
+		ratingStore := memory.NewMemoryStore()
+		var actions []models.RecentAction
+		for ind, handle := range handles {
+			actions = append(actions, models.RecentAction{
+				TimeSeconds: time.Now().Unix() - int64(ind),
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				Comment: &models.Comment{
+					Id:                ind + 1,
+					CommentatorHandle: handle,
+				},
+			})
+		}
+		Expect(ratingStore.AddRecentActions(context.TODO(), actions)).
+			Error().Should(Succeed())
+		return ratingStore
+	}
+
+	serveFeed := func(srv *web.Server) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		web.Handler(srv).ServeHTTP(rec,
+			httptest.NewRequest(http.MethodGet, "/feed.xml", nil))
+		return rec
+	}
+
+	It("should isolate the unknown handles of a batch", func() {
+		cfClient := &ratingsClient{CodeforcesClient: mock.NewCodeforcesClient()}
+		cfClient.SetUsers(
+			models.CodeforcesUser{Handle: "tourist", Rating: 3800},
+			models.CodeforcesUser{Handle: "Petr", Rating: 2200})
+		srv := web.CreateWebServer(
+			newRatingStore("tourist", "renamed", "Petr", "deleted"),
+			web.WithAuthorRatings(cfClient))
+
+		rec := serveFeed(srv)
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+		Expect(rec.Body.String()).Should(ContainSubstring("user-red"))
+		Expect(rec.Body.String()).Should(ContainSubstring("user-orange"))
+		calls := atomic.LoadInt32(&cfClient.calls)
+		Expect(calls).Should(BeNumerically(">", 1))
+
+		// The unknown handles are cached along with the known ones.
+		Expect(serveFeed(srv).Code).Should(Equal(http.StatusOK))
+		Expect(atomic.LoadInt32(&cfClient.calls)).Should(Equal(calls))
+	})
+
+	It("should not retry the failed lookups on each request", func() {
+		cfClient := &ratingsClient{
+			CodeforcesClient: mock.NewCodeforcesClient(),
+			err:              errors.New("codeforces is down"),
+		}
+		srv := web.CreateWebServer(newRatingStore("tourist"),
+			web.WithAuthorRatings(cfClient))
+
+		for i := 0; i < 3; i++ {
+			rec := serveFeed(srv)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(rec.Body.String()).Should(ContainSubstring("tourist"))
+		}
+		Expect(atomic.LoadInt32(&cfClient.calls)).Should(Equal(int32(1)))
+	})
+
+	It("should not hold up the requests while fetching", func() {
+		cfClient := &ratingsClient{
+			CodeforcesClient: mock.NewCodeforcesClient(),
+			release:          make(chan struct{}),
+		}
+		cfClient.SetUsers(models.CodeforcesUser{Handle: "tourist",
+			Rating: 3800})
+		srv := web.CreateWebServer(newRatingStore("tourist"),
+			web.WithAuthorRatings(cfClient))
+
+		blocked := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			defer GinkgoRecover()
+			blocked <- serveFeed(srv)
+		}()
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&cfClient.calls)
+		}).Should(Equal(int32(1)))
+
+		// The author being fetched is served without a color meanwhile.
+		rec := serveFeed(srv)
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+		Expect(rec.Body.String()).ShouldNot(ContainSubstring("user-red"))
+
+		close(cfClient.release)
+		Eventually(blocked).Should(Receive(WithTransform(
+			func(rec *httptest.ResponseRecorder) string {
+				return rec.Body.String()
+			}, ContainSubstring("user-red"))))
+		Expect(atomic.LoadInt32(&cfClient.calls)).Should(Equal(int32(1)))
+	})
+
+	It("should serve the feed unfiltered when the lookup fails", func() {
+		cfClient := &ratingsClient{
+			CodeforcesClient: mock.NewCodeforcesClient(),
+			err:              errors.New("codeforces is down"),
+		}
+		srv := web.CreateWebServer(newRatingStore("tourist", "newbie"),
+			web.WithMinRating(cfClient, 2100, false))
+
+		// The failure is cached, and the feed stays unfiltered meanwhile.
+		for i := 0; i < 2; i++ {
+			rec := serveFeed(srv)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(rec.Body.String()).Should(ContainSubstring("tourist"))
+			Expect(rec.Body.String()).Should(ContainSubstring("newbie"))
+		}
+	})
+
+	It("should fill the feed with the authors rated above the minimum",
+		func() {
+			cfClient := &ratingsClient{
+				CodeforcesClient: mock.NewCodeforcesClient()}
+			cfClient.SetUsers(
+				models.CodeforcesUser{Handle: "newbie1", Rating: 1000},
+				models.CodeforcesUser{Handle: "newbie2", Rating: 1000},
+				models.CodeforcesUser{Handle: "newbie3", Rating: 1000},
+				models.CodeforcesUser{Handle: "tourist", Rating: 3800},
+				models.CodeforcesUser{Handle: "Petr", Rating: 2200},
+				models.CodeforcesUser{Handle: "Errichto", Rating: 2900})
+			srv := web.CreateWebServer(newRatingStore("newbie1", "newbie2",
+				"newbie3", "tourist", "Petr", "Errichto"),
+				web.WithMinRating(cfClient, 2100, false),
+				web.WithFeedMaxItems(2))
+
+			rec := serveFeed(srv)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(rec.Body.String()).Should(ContainSubstring("tourist"))
+			Expect(rec.Body.String()).Should(ContainSubstring("Petr"))
+			Expect(rec.Body.String()).ShouldNot(ContainSubstring("Errichto"))
+			Expect(rec.Body.String()).ShouldNot(ContainSubstring("newbie"))
+		})
+})
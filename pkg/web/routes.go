@@ -1,10 +1,16 @@
 package web
 
 const (
+	// kAPIPrefix is the prefix of the paths of the JSON API.
+	kAPIPrefix = "/api/"
+
+	v1Group       = "/api/v1"
 	v1PublicGroup = "/api/v1/public"
 
 	kHome = "/"
 
+	kStats = "/stats"
+
 	kUserSignup = "/user/signup"
 
 	kRecentActions = "/activity/recent-actions"
@@ -15,4 +21,30 @@ const (
 	kUnsubscribeFromBlogs = "/user/blogs/unsubscribe"
 
 	kCommentsFromBlog = "/blogs/:id/comments"
+
+	kFeed       = "/feed.xml"
+	kAtomFeed   = "/feed.atom"
+	kHandleFeed = "/u/:handle/feed.xml"
+	kFeedsOPML  = "/feeds.opml"
+
+	kAction     = "/action/:id"
+	kActionFeed = "/action/:id/feed.xml"
+
+	kSearch  = "/search"
+	kActions = "/actions"
+
+	// kLegacySearch and kLegacyActions are the paths of the JSON endpoints
+	// before they moved under v1Group, kept for the existing consumers.
+	kLegacySearch  = "/search"
+	kLegacyActions = "/api/actions"
+
+	kVersion = "/version"
+
+	kMetrics = "/metrics"
+	kHealthz = "/healthz"
+
+	kDebugScheduler = "/debug/scheduler"
 )
+
+// FeedPath is the path of the aggregate feed, e.g, to build its public URL.
+const FeedPath = kFeed
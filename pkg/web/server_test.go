@@ -0,0 +1,248 @@
+package web_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store/memory"
+	"github.com/variety-jones/cfrss/pkg/web"
+)
+
+// freeAddr returns a local address on which nothing listens.
+func freeAddr() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).Should(BeNil())
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+var _ = Describe("Server", func() {
+	It("should time out the slow clients and shut down", func() {
+		srv := web.CreateWebServer(memory.NewMemoryStore(),
+			web.WithHTTPTimeouts(web.HTTPTimeouts{
+				ReadHeader: 50 * time.Millisecond,
+			}))
+		addr := freeAddr()
+		served := make(chan error, 1)
+		go func() {
+			served <- srv.ListenAndServe(addr)
+		}()
+
+		Eventually(func() error {
+			res, err := http.Get("http://" + addr + "/healthz")
+			if err == nil {
+				res.Body.Close()
+			}
+			return err
+		}).Should(Succeed())
+
+		// A client that never finishes its headers is disconnected.
+		conn, err := net.Dial("tcp", addr)
+		Expect(err).Should(BeNil())
+		defer conn.Close()
+		_, err = conn.Write([]byte("GET /healthz HTTP/1.1\r\n"))
+		Expect(err).Should(BeNil())
+		Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).
+			Should(Succeed())
+		_, err = io.ReadAll(conn)
+		Expect(err).Should(BeNil())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		Expect(srv.Shutdown(ctx)).Should(Succeed())
+		Eventually(served).Should(Receive(BeNil()))
+	})
+})
+
+var _ = Describe("CORS", func() {
+	const origin = "https://dashboard.example.com"
+
+	serve := func(srv *web.Server,
+		method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		web.Handler(srv).ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should let the allowed origins read the JSON API", func() {
+		srv := web.CreateWebServer(memory.NewMemoryStore(),
+			web.WithCORS([]string{origin}))
+
+		rec := serve(srv, http.MethodGet, "/api/v1/actions")
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).
+			Should(Equal(origin))
+
+		rec = serve(srv, http.MethodOptions, "/api/v1/actions")
+		Expect(rec.Code).Should(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).
+			Should(Equal(origin))
+		Expect(rec.Header().Get("Access-Control-Allow-Methods")).
+			Should(Equal("GET,HEAD"))
+
+		// The feeds are not part of the JSON API.
+		rec = serve(srv, http.MethodGet, "/feed.xml")
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).Should(BeEmpty())
+	})
+
+	It("should not allow the other origins", func() {
+		srv := web.CreateWebServer(memory.NewMemoryStore(),
+			web.WithCORS([]string{"https://other.example.com"}))
+		rec := serve(srv, http.MethodGet, "/api/v1/actions")
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).Should(BeEmpty())
+	})
+
+	It("should be disabled by default", func() {
+		rec := serve(web.CreateWebServer(memory.NewMemoryStore()),
+			http.MethodGet, "/api/v1/actions")
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).Should(BeEmpty())
+	})
+})
+
+var _ = Describe("RateLimit", func() {
+	// serveFrom serves a request coming from the address, forwarded for the
+	// client if it is not empty.
+	serveFrom := func(srv *web.Server, path, ip,
+		forwardedFor string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = net.JoinHostPort(ip, "4321")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			req.Header.Set("X-Real-IP", forwardedFor)
+		}
+		web.Handler(srv).ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should limit the requests of each client", func() {
+		srv := web.CreateWebServer(memory.NewMemoryStore(),
+			web.WithRateLimit(0.5, 2))
+
+		serve := func(path, ip string) *httptest.ResponseRecorder {
+			return serveFrom(srv, path, ip, "")
+		}
+
+		Expect(serve("/feed.xml", "10.0.0.1").Code).
+			Should(Equal(http.StatusOK))
+		Expect(serve("/api/v1/actions", "10.0.0.1").Code).
+			Should(Equal(http.StatusOK))
+		rec := serve("/feed.xml", "10.0.0.1")
+		Expect(rec.Code).Should(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).Should(Equal("2"))
+
+		// The other clients, and the other endpoints, are not limited.
+		Expect(serve("/feed.xml", "10.0.0.2").Code).
+			Should(Equal(http.StatusOK))
+		Expect(serve("/healthz", "10.0.0.1").Code).
+			ShouldNot(Equal(http.StatusTooManyRequests))
+	})
+
+	It("should ignore the forwarded clients of untrusted addresses", func() {
+		srv := web.CreateWebServer(memory.NewMemoryStore(),
+			web.WithRateLimit(0.5, 1))
+
+		Expect(serveFrom(srv, "/feed.xml", "10.0.0.1", "203.0.113.1").Code).
+			Should(Equal(http.StatusOK))
+		Expect(serveFrom(srv, "/feed.xml", "10.0.0.1", "203.0.113.2").Code).
+			Should(Equal(http.StatusTooManyRequests))
+	})
+
+	It("should limit the forwarded clients of the trusted proxies", func() {
+		_, proxies, err := net.ParseCIDR("10.0.0.0/24")
+		Expect(err).Should(BeNil())
+		srv := web.CreateWebServer(memory.NewMemoryStore(),
+			web.WithRateLimit(0.5, 1),
+			web.WithTrustedProxies([]*net.IPNet{proxies}))
+
+		Expect(serveFrom(srv, "/feed.xml", "10.0.0.1", "203.0.113.1").Code).
+			Should(Equal(http.StatusOK))
+		Expect(serveFrom(srv, "/feed.xml", "10.0.0.2", "203.0.113.2").Code).
+			Should(Equal(http.StatusOK))
+		Expect(serveFrom(srv, "/feed.xml", "10.0.0.2", "203.0.113.1").Code).
+			Should(Equal(http.StatusTooManyRequests))
+
+		// A client can't forge its address in front of the one set by the
+		// proxy.
+		Expect(serveFrom(srv, "/feed.xml", "10.0.0.1",
+			"198.51.100.1, 203.0.113.2").Code).
+			Should(Equal(http.StatusTooManyRequests))
+	})
+})
+
+var _ = Describe("Compression", func() {
+	serve := func(srv *web.Server, path,
+		acceptEncoding string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		web.Handler(srv).ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should compress the large responses", func() {
+		cfStore := memory.NewMemoryStore()
+		var actions []models.RecentAction
+		for id := 1; id <= 20; id++ {
+			actions = append(actions, models.RecentAction{
+				TimeSeconds: time.Now().Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round #1"},
+				Comment: &models.Comment{
+					Id:   id,
+					Text: strings.Repeat("Nice problems! ", 10),
+				},
+			})
+		}
+		Expect(cfStore.AddRecentActions(context.TODO(), actions)).
+			Error().Should(Succeed())
+		srv := web.CreateWebServer(cfStore)
+
+		plain := serve(srv, "/feed.xml", "")
+		Expect(plain.Code).Should(Equal(http.StatusOK))
+		Expect(plain.Header().Get("Content-Encoding")).Should(BeEmpty())
+		Expect(plain.Header().Get("Vary")).Should(ContainSubstring(
+			"Accept-Encoding"))
+
+		compressed := serve(srv, "/feed.xml", "deflate, gzip;q=0.8")
+		Expect(compressed.Code).Should(Equal(http.StatusOK))
+		Expect(compressed.Header().Get("Content-Encoding")).
+			Should(Equal("gzip"))
+		Expect(compressed.Header().Get("ETag")).Should(
+			Equal("W/" + plain.Header().Get("ETag")))
+		Expect(compressed.Body.Len()).Should(
+			BeNumerically("<", plain.Body.Len()))
+
+		reader, err := gzip.NewReader(compressed.Body)
+		Expect(err).Should(BeNil())
+		body, err := io.ReadAll(reader)
+		Expect(err).Should(BeNil())
+		Expect(body).Should(Equal(plain.Body.Bytes()))
+
+		refused := serve(srv, "/feed.xml", "gzip;q=0")
+		Expect(refused.Header().Get("Content-Encoding")).Should(BeEmpty())
+	})
+
+	It("should send the small responses as is", func() {
+		srv := web.CreateWebServer(memory.NewMemoryStore())
+		rec := serve(srv, "/api/v1/actions", "gzip")
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Encoding")).Should(BeEmpty())
+		Expect(rec.Body.String()).Should(ContainSubstring("["))
+	})
+})
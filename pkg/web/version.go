@@ -0,0 +1,20 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BuildInfo describes the build of the running binary, so that operators can
+// confirm which release is deployed.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Version serves the build of the running binary.
+func (srv *Server) Version(c echo.Context) error {
+	return c.JSON(http.StatusOK, srv.buildInfo)
+}
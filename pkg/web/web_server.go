@@ -1,28 +1,324 @@
 package web
 
 import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/scheduler"
 	"github.com/variety-jones/cfrss/pkg/store"
 )
 
 type Server struct {
 	ec      *echo.Echo
 	cfStore store.CodeforcesStore
+
+	// scheduler is nil when the scheduler is disabled.
+	scheduler scheduler.CodeforcesSchedulerInterface
+
+	// handles are the users whose feeds are listed in the OPML export.
+	handles []string
+
+	// feedWindow is how far back in time the feeds look for actions, and
+	// feedMaxItems caps the number of items in them.
+	feedWindow   time.Duration
+	feedMaxItems int64
+
+	// webSubHubs are advertised in the aggregate feed, which the hubs know by
+	// feedUrl.
+	webSubHubs []string
+	feedUrl    string
+
+	// feedOpts brand the aggregate and the user feeds, and publicUrl, if
+	// set, is the base of their self links.
+	feedOpts  []feed.Option
+	publicUrl string
+
+	// authorRatings caches the ratings of the authors, which color them if
+	// colorAuthors is set, and filter them if minRating is positive. It also
+	// tells the handles unknown to Codeforces apart. It is nil unless the
+	// server is given a client to fetch them.
+	authorRatings  *authorRatings
+	ratingsClient  cfapi.CodeforcesAPI
+	colorAuthors   bool
+	minRating      int
+	includeUnrated bool
+
+	// debug enables the endpoints exposing the internal state.
+	debug bool
+
+	// buildInfo describes the running build at /version.
+	buildInfo BuildInfo
+
+	// httpTimeouts bound the requests to the server.
+	httpTimeouts HTTPTimeouts
+
+	// corsOrigins may read the JSON API from a browser. CORS is disabled if
+	// it is empty.
+	corsOrigins []string
+
+	// rateLimit is the number of requests per second that each client may
+	// send to the feeds and the JSON API, beyond a burst of rateLimitBurst.
+	// The requests are not limited unless it is positive.
+	rateLimit      float64
+	rateLimitBurst int
+
+	// trustedProxies may set the X-Forwarded-For header identifying the
+	// clients. The clients are identified by the address of the connection
+	// if it is empty.
+	trustedProxies []*net.IPNet
+}
+
+// HTTPTimeouts bound the phases of the requests, so that slow clients can't
+// hold on to the connections of the server, e.g, in a slow-loris attack. A
+// non-positive timeout leaves its phase unbounded.
+type HTTPTimeouts struct {
+	// ReadHeader bounds the reading of the request headers, and Read of the
+	// whole request.
+	ReadHeader time.Duration
+	Read       time.Duration
+
+	// Write bounds the handling of the request, from the end of its headers
+	// to the end of the response, hence it should exceed the slowest feed.
+	Write time.Duration
+
+	// Idle bounds the wait for the next request of a kept-alive connection.
+	Idle time.Duration
+}
+
+// DefaultHTTPTimeouts returns the timeouts used unless overridden by
+// WithHTTPTimeouts.
+func DefaultHTTPTimeouts() HTTPTimeouts {
+	return HTTPTimeouts{
+		ReadHeader: 5 * time.Second,
+		Read:       10 * time.Second,
+		Write:      30 * time.Second,
+		Idle:       2 * time.Minute,
+	}
+}
+
+// Option customizes the server created by CreateWebServer.
+type Option func(srv *Server)
+
+// WithScheduler lets the server report the health of the scheduler.
+func WithScheduler(sch scheduler.CodeforcesSchedulerInterface) Option {
+	return func(srv *Server) {
+		srv.scheduler = sch
+	}
+}
+
+// WithHandles lists the feeds of the given handles in the OPML export.
+func WithHandles(handles []string) Option {
+	return func(srv *Server) {
+		srv.handles = handles
+	}
+}
+
+// WithFeedWindow overrides how far back in time the feeds look for actions.
+func WithFeedWindow(window time.Duration) Option {
+	return func(srv *Server) {
+		srv.feedWindow = window
+	}
+}
+
+// WithFeedMaxItems overrides the maximum number of items in a feed.
+func WithFeedMaxItems(maxItems int64) Option {
+	return func(srv *Server) {
+		srv.feedMaxItems = maxItems
+	}
+}
+
+// WithWebSub advertises the WebSub hubs in the aggregate feed, along with its
+// public URL.
+func WithWebSub(hubs []string, feedUrl string) Option {
+	return func(srv *Server) {
+		srv.webSubHubs = hubs
+		srv.feedUrl = feedUrl
+	}
+}
+
+// WithFeedOptions applies the options to the aggregate and the user feeds,
+// e.g, to override their title. The query parameters of the requests take
+// precedence, e.g, lang over feed.WithLocale.
+func WithFeedOptions(opts ...feed.Option) Option {
+	return func(srv *Server) {
+		srv.feedOpts = append(srv.feedOpts, opts...)
+	}
+}
+
+// WithPublicURL declares the URL at which readers reach the server, so that
+// the feeds link to themselves.
+func WithPublicURL(publicUrl string) Option {
+	return func(srv *Server) {
+		srv.publicUrl = strings.TrimSuffix(publicUrl, "/")
+	}
+}
+
+// WithAuthorRatings colors the authors in the feeds by their Codeforces
+// rating, which is fetched with the client and cached for an hour.
+func WithAuthorRatings(cfClient cfapi.CodeforcesAPI) Option {
+	return func(srv *Server) {
+		srv.ratingsClient = cfClient
+		srv.colorAuthors = true
+	}
 }
 
-func CreateWebServer(cfStore store.CodeforcesStore) *Server {
+// WithMinRating drops the actions of the authors rated below minRating from
+// the feeds, fetching the ratings like WithAuthorRatings. The unrated authors
+// are kept only if includeUnrated is set. The feeds are served unfiltered
+// while some of the ratings can't be fetched.
+func WithMinRating(cfClient cfapi.CodeforcesAPI, minRating int,
+	includeUnrated bool) Option {
+	return func(srv *Server) {
+		srv.ratingsClient = cfClient
+		srv.minRating = minRating
+		srv.includeUnrated = includeUnrated
+	}
+}
+
+// WithHandleLookup looks up the handles of the user feeds on Codeforces with
+// the client, caching them like WithAuthorRatings, so that the handles
+// without any stored action are only served if they exist. Without it, they
+// are not found.
+func WithHandleLookup(cfClient cfapi.CodeforcesAPI) Option {
+	return func(srv *Server) {
+		srv.ratingsClient = cfClient
+	}
+}
+
+// WithDebug serves the internal state of the server at /debug, which is
+// meant for development only.
+func WithDebug() Option {
+	return func(srv *Server) {
+		srv.debug = true
+	}
+}
+
+// WithBuildInfo reports the given build at /version.
+func WithBuildInfo(info BuildInfo) Option {
+	return func(srv *Server) {
+		srv.buildInfo = info
+	}
+}
+
+// WithHTTPTimeouts overrides the timeouts of the requests to the server.
+func WithHTTPTimeouts(timeouts HTTPTimeouts) Option {
+	return func(srv *Server) {
+		srv.httpTimeouts = timeouts
+	}
+}
+
+// WithCORS lets the pages of the origins, e.g, "https://example.com", read
+// the JSON API from a browser. An origin may contain wildcards, e.g,
+// "https://*.example.com".
+func WithCORS(origins []string) Option {
+	return func(srv *Server) {
+		srv.corsOrigins = origins
+	}
+}
+
+// WithRateLimit limits the requests of each client IP to the feeds and the
+// JSON API to limit per second, with a token bucket of burst requests, and
+// rejects the others with 429 Too Many Requests. The clients are identified
+// by the address of the connection, unless it is a trusted proxy, see
+// WithTrustedProxies.
+func WithRateLimit(limit float64, burst int) Option {
+	return func(srv *Server) {
+		srv.rateLimit = limit
+		srv.rateLimitBurst = burst
+	}
+}
+
+// WithTrustedProxies identifies the clients by the X-Forwarded-For header
+// when the requests come from the ranges, e.g, of a reverse proxy, instead of
+// by the address of the connection. The client is the nearest address of the
+// header outside of the ranges, so that it can't be forged by the clients.
+func WithTrustedProxies(ranges []*net.IPNet) Option {
+	return func(srv *Server) {
+		srv.trustedProxies = ranges
+	}
+}
+
+func CreateWebServer(cfStore store.CodeforcesStore, opts ...Option) *Server {
 	srv := &Server{
-		ec:      echo.New(),
-		cfStore: cfStore,
+		ec:           echo.New(),
+		cfStore:      cfStore,
+		feedWindow:   defaultFeedWindow,
+		feedMaxItems: defaultPageSize,
+		httpTimeouts: DefaultHTTPTimeouts(),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	srv.ec.Server.ReadHeaderTimeout = srv.httpTimeouts.ReadHeader
+	srv.ec.Server.ReadTimeout = srv.httpTimeouts.Read
+	srv.ec.Server.WriteTimeout = srv.httpTimeouts.Write
+	srv.ec.Server.IdleTimeout = srv.httpTimeouts.Idle
+	srv.ec.IPExtractor = srv.ipExtractor()
+
+	// The middleware also answers the preflight requests, which match no
+	// route. It must not be installed without origins, which it would take
+	// as any origin.
+	if len(srv.corsOrigins) > 0 {
+		srv.ec.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			Skipper: func(c echo.Context) bool {
+				return !isJSONAPI(c.Request().URL.Path)
+			},
+			AllowOrigins: srv.corsOrigins,
+			AllowMethods: []string{http.MethodGet, http.MethodHead},
+			MaxAge:       kCORSMaxAgeSeconds,
+		}))
+	}
+	if srv.rateLimit > 0 {
+		srv.ec.Use(srv.rateLimiter())
+	}
+	srv.ec.Use(compress())
+	if srv.ratingsClient != nil {
+		srv.authorRatings = newAuthorRatings(srv.ratingsClient)
 	}
 
 	srv.ec.Static("/", "frontend/build")
 
+	// Feeds are served from the root so that readers get a short URL.
+	srv.ec.GET(kFeed, srv.Feed)
+	srv.ec.GET(kAtomFeed, srv.AtomFeed)
+	srv.ec.GET(kHandleFeed, srv.HandleFeed)
+	srv.ec.GET(kFeedsOPML, srv.FeedsOPML)
+	srv.ec.GET(kAction, srv.ActionPage)
+	srv.ec.GET(kActionFeed, srv.ActionFeed)
+	srv.ec.GET(kLegacySearch, srv.Search)
+	srv.ec.GET(kLegacyActions, srv.Actions)
+	srv.ec.GET(kVersion, srv.Version)
+
+	// Metrics and health checks are served from the root, as prometheus and
+	// orchestrators expect by default.
+	srv.ec.GET(kMetrics, echo.WrapHandler(promhttp.Handler()))
+	srv.ec.GET(kHealthz, srv.Healthz)
+	if srv.debug {
+		srv.ec.GET(kDebugScheduler, srv.DebugScheduler)
+	}
+
+	// The JSON API is versioned, so that its consumers get a stable contract.
+	v1 := srv.ec.Group(v1Group)
+	v1.GET(kSearch, srv.Search)
+	v1.GET(kActions, srv.Actions)
+
 	v1Public := srv.ec.Group(v1PublicGroup)
 
 	// Public routes.
 	v1Public.GET(kHome, srv.HomeHandler)
+	v1Public.GET(kStats, srv.Stats)
 
 	v1Public.GET(kRecentActions, srv.QueryRecentActions)
 	v1Public.GET(kCommentsFromBlog, srv.QueryCommentsFromBlog)
@@ -38,3 +334,58 @@ func CreateWebServer(cfStore store.CodeforcesStore) *Server {
 
 	return srv
 }
+
+// isJSONAPI reports whether the path is served by the JSON API.
+func isJSONAPI(path string) bool {
+	return strings.HasPrefix(path, kAPIPrefix) || path == kLegacySearch
+}
+
+// isFeedOrAPI reports whether the request is routed to the feeds or to the
+// JSON API, which query the store and serve the largest responses.
+func isFeedOrAPI(c echo.Context) bool {
+	switch c.Path() {
+	case kFeed, kAtomFeed, kHandleFeed, kFeedsOPML, kAction, kActionFeed:
+		return true
+	default:
+		return isJSONAPI(c.Request().URL.Path)
+	}
+}
+
+// ipExtractor returns how the clients are identified, i.e, by the address of
+// the connection unless the requests come from a trusted proxy. Only the
+// trusted ranges are, unlike the private networks trusted by echo by default.
+func (srv *Server) ipExtractor() echo.IPExtractor {
+	if len(srv.trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	opts := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipRange := range srv.trustedProxies {
+		opts = append(opts, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...)
+}
+
+// rateLimiter returns the middleware enforcing the rate limit of the server.
+// The rejected clients are told to retry once their bucket holds a token.
+func (srv *Server) rateLimiter() echo.MiddlewareFunc {
+	retryAfter := strconv.Itoa(int(math.Ceil(1 / srv.rateLimit)))
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Skipper: func(c echo.Context) bool {
+			return !isFeedOrAPI(c)
+		},
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
+			middleware.RateLimiterMemoryStoreConfig{
+				Rate:  rate.Limit(srv.rateLimit),
+				Burst: srv.rateLimitBurst,
+			}),
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			zap.S().Infow("Rate limited a client", zap.String("ip", identifier))
+			c.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+			return c.String(http.StatusTooManyRequests, "too many requests")
+		},
+	})
+}
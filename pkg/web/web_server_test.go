@@ -1,8 +1,16 @@
 package web_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -11,25 +19,33 @@ import (
 	"github.com/labstack/echo/v4"
 
 	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/cfapi/mock"
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
 	"github.com/variety-jones/cfrss/pkg/scheduler"
-	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/memory"
 	"github.com/variety-jones/cfrss/pkg/web"
 )
 
 var _ = Describe("WebServer", func() {
-	inMemoryStore := store.NewInMemoryCodeforcesStore()
+	inMemoryStore := memory.NewMemoryStore()
 	dummyCfClient := cfapi.NewDummyCodeforcesClient()
 	dummyScheduler := scheduler.NewScheduler(dummyCfClient, inMemoryStore,
 		100, 1*time.Second)
 
 	for cnt := 0; cnt <= 100; cnt++ {
-		dummyScheduler.Sync()
+		dummyScheduler.Sync(context.TODO())
 	}
 
 	e := echo.New()
 	rec := httptest.NewRecorder()
 
-	webServer := web.CreateWebServer(inMemoryStore)
+	// The handles of the user feeds are looked up on Codeforces.
+	handlesClient := mock.NewCodeforcesClient()
+	handlesClient.SetUsers(models.CodeforcesUser{Handle: "tourist"})
+
+	webServer := web.CreateWebServer(inMemoryStore,
+		web.WithHandleLookup(handlesClient))
 
 	It("should successfully register a new user", func() {
 		httpReq, _ := http.NewRequest(http.MethodPost,
@@ -45,4 +61,913 @@ var _ = Describe("WebServer", func() {
 		Expect(rec.Code).Should(Equal(http.StatusOK))
 	})
 
+	It("should serve the feed of a valid handle", func() {
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/u/tourist/feed.xml",
+			nil)
+		c := e.NewContext(httpReq, feedRec)
+		c.SetParamNames("handle")
+		c.SetParamValues("tourist")
+
+		Expect(webServer.HandleFeed(c)).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(feedRec.Header().Get(echo.HeaderContentType)).
+			Should(Equal("application/rss+xml"))
+	})
+
+	It("should not find the feed of an unknown handle", func() {
+		for _, srv := range []*web.Server{
+			webServer, web.CreateWebServer(inMemoryStore),
+		} {
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet,
+				"/u/nobody_here/feed.xml", nil)
+			c := e.NewContext(httpReq, feedRec)
+			c.SetParamNames("handle")
+			c.SetParamValues("nobody_here")
+
+			Expect(srv.HandleFeed(c)).Should(BeNil())
+			Expect(feedRec.Code).Should(Equal(http.StatusNotFound))
+		}
+	})
+
+	It("should serve the feed of a handle with stored actions", func() {
+		handleStore := memory.NewMemoryStore()
+		Expect(handleStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: 100,
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment: &models.Comment{
+					Id:                1,
+					CommentatorHandle: "Petr",
+				},
+			}})).Error().Should(Succeed())
+		srv := web.CreateWebServer(handleStore)
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/u/petr/feed.xml",
+			nil)
+		c := e.NewContext(httpReq, feedRec)
+		c.SetParamNames("handle")
+		c.SetParamValues("petr")
+
+		Expect(srv.HandleFeed(c)).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should serve the feed of a handle that can't be looked up", func() {
+		srv := web.CreateWebServer(memory.NewMemoryStore(),
+			web.WithHandleLookup(&ratingsClient{
+				CodeforcesClient: mock.NewCodeforcesClient(),
+				err:              errors.New("codeforces is down"),
+			}))
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/u/tourist/feed.xml",
+			nil)
+		c := e.NewContext(httpReq, feedRec)
+		c.SetParamNames("handle")
+		c.SetParamValues("tourist")
+
+		Expect(srv.HandleFeed(c)).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should fill the feed despite the short actions", func() {
+		shortStore := memory.NewMemoryStore()
+		now := time.Now().Unix()
+		var actions []models.RecentAction
+		for ind := 1; ind <= 6; ind++ {
+			text := "+1"
+			// The long comments are the oldest ones.
+			if ind >= 5 {
+				text = fmt.Sprintf("Long comment %d", ind)
+			}
+			actions = append(actions, models.RecentAction{
+				TimeSeconds: now - int64(ind),
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment:     &models.Comment{Id: ind, Text: text},
+			})
+		}
+		Expect(shortStore.AddRecentActions(context.TODO(), actions)).Error().
+			Should(Succeed())
+		srv := web.CreateWebServer(shortStore, web.WithFeedMaxItems(2),
+			web.WithFeedOptions(feed.WithMinContentLength(5)))
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml", nil)
+		Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(strings.Count(feedRec.Body.String(), "<item>")).
+			Should(Equal(2))
+		Expect(feedRec.Body.String()).Should(ContainSubstring(
+			"Long comment 6"))
+	})
+
+	It("should brand the feeds and link them to themselves", func() {
+		srv := web.CreateWebServer(inMemoryStore,
+			web.WithFeedOptions(feed.WithTitle("My Codeforces"),
+				feed.WithLocale("en")),
+			web.WithPublicURL("https://cfrss.example.com/"),
+			web.WithHandleLookup(handlesClient))
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet,
+			"/u/tourist/feed.xml?lang=ru", nil)
+		c := e.NewContext(httpReq, feedRec)
+		c.SetParamNames("handle")
+		c.SetParamValues("tourist")
+
+		Expect(srv.HandleFeed(c)).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(feedRec.Body.String()).Should(ContainSubstring(
+			"<title>My Codeforces</title>"))
+		Expect(feedRec.Body.String()).Should(ContainSubstring(
+			"<language>ru</language>"))
+		Expect(feedRec.Body.String()).Should(ContainSubstring(
+			`href="https://cfrss.example.com/u/tourist/feed.xml" rel="self"`))
+	})
+
+	It("should reject the unsupported languages", func() {
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet,
+			"/u/tourist/feed.xml?lang=fr", nil)
+		c := e.NewContext(httpReq, feedRec)
+		c.SetParamNames("handle")
+		c.SetParamValues("tourist")
+
+		Expect(webServer.HandleFeed(c)).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusBadRequest))
+	})
+
+	It("should page through the atom feed", func() {
+		pagedStore := memory.NewMemoryStore()
+		now := time.Now()
+		var actions []models.RecentAction
+		for ind := 0; ind < 3; ind++ {
+			actions = append(actions, models.RecentAction{
+				// The window of the feeds does not bound the pages.
+				TimeSeconds: now.Add(-time.Duration(ind+1) * 24 * time.Hour).
+					Unix(),
+				BlogEntry: &models.BlogEntry{Id: 1},
+				Comment:   &models.Comment{Id: ind + 1},
+			})
+		}
+		Expect(pagedStore.AddRecentActions(context.TODO(), actions)).
+			Error().Should(Succeed())
+		srv := web.CreateWebServer(pagedStore, web.WithFeedMaxItems(2),
+			web.WithPublicURL("https://cfrss.example.com"))
+
+		getPage := func(query string) *httptest.ResponseRecorder {
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet,
+				"/feed.atom?"+query, nil)
+			Expect(srv.AtomFeed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+			return feedRec
+		}
+		// link returns the query of the link to the adjacent page.
+		link := func(rec *httptest.ResponseRecorder, rel string) string {
+			matches := regexp.MustCompile(
+				`href="https://cfrss\.example\.com/feed\.atom\?([^"]*)" rel="` +
+					rel + `"`).FindStringSubmatch(rec.Body.String())
+			if matches == nil {
+				return ""
+			}
+			return html.UnescapeString(matches[1])
+		}
+
+		first := getPage("page=1")
+		Expect(first.Code).Should(Equal(http.StatusOK))
+		Expect(first.Header().Get(echo.HeaderContentType)).
+			Should(Equal("application/atom+xml"))
+		Expect(strings.Count(first.Body.String(), "<entry>")).Should(Equal(2))
+		Expect(link(first, "next")).Should(Equal(fmt.Sprintf(
+			"before=%d-1-2", actions[1].TimeSeconds)))
+		Expect(link(first, "previous")).Should(BeEmpty())
+
+		// A newer action doesn't shift the pages.
+		Expect(pagedStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: now.Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment:     &models.Comment{Id: 4},
+			}})).Error().Should(Succeed())
+		last := getPage(link(first, "next"))
+		Expect(last.Code).Should(Equal(http.StatusOK))
+		Expect(strings.Count(last.Body.String(), "<entry>")).Should(Equal(1))
+		Expect(last.Body.String()).Should(ContainSubstring("#comment-3"))
+		Expect(last.Body.String()).Should(ContainSubstring(
+			`href="https://cfrss.example.com/feed.atom?page=1" rel="first"`))
+		Expect(link(last, "next")).Should(BeEmpty())
+
+		previous := getPage(link(last, "previous"))
+		Expect(previous.Code).Should(Equal(http.StatusOK))
+		Expect(strings.Count(previous.Body.String(), "<entry>")).
+			Should(Equal(2))
+		Expect(previous.Body.String()).Should(ContainSubstring("#comment-2"))
+		Expect(previous.Body.String()).ShouldNot(ContainSubstring(
+			"#comment-4"))
+		Expect(link(previous, "previous")).Should(Equal(fmt.Sprintf(
+			"after=%d-1-1", actions[0].TimeSeconds)))
+		Expect(link(previous, "next")).Should(Equal(link(first, "next")))
+
+		for _, query := range []string{"page=0", "page=x",
+			"page=9223372036854775807", "before=x", "before=1",
+			"page=1&handle=tourist"} {
+			Expect(getPage(query).Code).Should(Equal(http.StatusBadRequest),
+				query)
+		}
+	})
+
+	It("should page through the ties of the atom feed", func() {
+		pagedStore := memory.NewMemoryStore()
+		var actions []models.RecentAction
+		for ind := 0; ind < 5; ind++ {
+			actions = append(actions, models.RecentAction{
+				TimeSeconds: 1660000000,
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment:     &models.Comment{Id: ind + 1},
+			})
+		}
+		Expect(pagedStore.AddRecentActions(context.TODO(), actions)).
+			Error().Should(Succeed())
+		srv := web.CreateWebServer(pagedStore, web.WithFeedMaxItems(2))
+
+		seen := make(map[string]bool)
+		query := "page=1"
+		for pages := 0; query != "" && pages < 5; pages++ {
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet,
+				"/feed.atom?"+query, nil)
+			Expect(srv.AtomFeed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+			for _, id := range regexp.MustCompile(`<id>[^<]*</id>`).
+				FindAllString(feedRec.Body.String(), -1)[1:] {
+				Expect(seen).ShouldNot(HaveKey(id))
+				seen[id] = true
+			}
+
+			query = ""
+			matches := regexp.MustCompile(
+				`href="/feed\.atom\?([^"]*)" rel="next"`).
+				FindStringSubmatch(feedRec.Body.String())
+			if matches != nil {
+				query = html.UnescapeString(matches[1])
+			}
+		}
+		Expect(seen).Should(HaveLen(5))
+	})
+
+	It("should not find the feed of an invalid handle", func() {
+		for _, handle := range []string{"", "ab", "tour ist", "<script>"} {
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet, "/u/x/feed.xml", nil)
+			c := e.NewContext(httpReq, feedRec)
+			c.SetParamNames("handle")
+			c.SetParamValues(handle)
+
+			Expect(webServer.HandleFeed(c)).Should(BeNil())
+			Expect(feedRec.Code).Should(Equal(http.StatusNotFound))
+		}
+	})
+
+	It("should bound the feed by the window and the max items", func() {
+		feedStore := memory.NewMemoryStore()
+		now := time.Now()
+		var actions []models.RecentAction
+		for ind, age := range []time.Duration{
+			10 * time.Minute, 20 * time.Minute, 2 * time.Hour} {
+			actions = append(actions, models.RecentAction{
+				TimeSeconds: now.Add(-age).Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment:     &models.Comment{Id: ind + 1},
+			})
+		}
+		Expect(feedStore.AddRecentActions(context.TODO(), actions)).
+			Error().Should(Succeed())
+
+		countItems := func(maxItems int64) int {
+			srv := web.CreateWebServer(feedStore,
+				web.WithFeedWindow(time.Hour), web.WithFeedMaxItems(maxItems))
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml", nil)
+			Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+			return strings.Count(feedRec.Body.String(), "<item>")
+		}
+		Expect(countItems(10)).Should(Equal(2))
+		Expect(countItems(1)).Should(Equal(1))
+	})
+
+	It("should only return the actions after since", func() {
+		sinceStore := memory.NewMemoryStore()
+		Expect(sinceStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{
+				{
+					TimeSeconds: 100,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 1},
+				},
+				{
+					TimeSeconds: 200,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 2},
+				},
+			})).Error().Should(Succeed())
+		srv := web.CreateWebServer(sinceStore)
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml?since=100",
+			nil)
+		Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(strings.Count(feedRec.Body.String(), "<item>")).Should(Equal(1))
+		Expect(feedRec.Body.String()).Should(ContainSubstring("comment-2"))
+
+		badRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/feed.xml?since=yesterday",
+			nil)
+		Expect(srv.Feed(e.NewContext(httpReq, badRec))).Should(BeNil())
+		Expect(badRec.Code).Should(Equal(http.StatusBadRequest))
+
+		overflowRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet,
+			"/feed.xml?since=9223372036854775807", nil)
+		Expect(srv.Feed(e.NewContext(httpReq, overflowRec))).Should(BeNil())
+		Expect(overflowRec.Code).Should(Equal(http.StatusBadRequest))
+	})
+
+	It("should only return the actions after after_id", func() {
+		afterStore := memory.NewMemoryStore()
+		Expect(afterStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{
+				{
+					TimeSeconds: 100,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 1},
+				},
+				{
+					TimeSeconds: 200,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 2},
+				},
+				{
+					TimeSeconds: 200,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 3},
+				},
+				{
+					TimeSeconds: 300,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 4},
+				},
+			})).Error().Should(Succeed())
+		srv := web.CreateWebServer(afterStore)
+
+		feedItems := func(afterId string) (int, string) {
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet,
+				"/feed.xml?after_id="+url.QueryEscape(afterId), nil)
+			Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+			return feedRec.Code, feedRec.Body.String()
+		}
+
+		// The guid of an item, and the id of an action, are both accepted.
+		for _, afterId := range []string{
+			"https://codeforces.com/blog/entry/1?#comment-2", "1-2",
+		} {
+			code, body := feedItems(afterId)
+			Expect(code).Should(Equal(http.StatusOK))
+			Expect(strings.Count(body, "<item>")).Should(Equal(2))
+			Expect(body).Should(ContainSubstring("comment-3"))
+			Expect(body).Should(ContainSubstring("comment-4"))
+		}
+
+		for _, afterId := range []string{
+			"1-5", "https://codeforces.com/blog/entry/2", "yesterday",
+		} {
+			code, _ := feedItems(afterId)
+			Expect(code).Should(Equal(http.StatusBadRequest))
+		}
+	})
+
+	It("should resume after an edited after_id without a gap", func() {
+		newComment := func(ts int64, id int) models.RecentAction {
+			return models.RecentAction{
+				TimeSeconds: ts,
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment: &models.Comment{
+					Id:                  id,
+					CreationTimeSeconds: ts,
+					CommentatorHandle:   "Petr",
+				},
+			}
+		}
+		// The comment read at 200 was edited since then.
+		edited := newComment(400, 2)
+		edited.Comment.CreationTimeSeconds = 200
+		afterStore := memory.NewMemoryStore()
+		Expect(afterStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{newComment(100, 1), edited,
+				newComment(300, 3), newComment(500, 4),
+				newComment(600, 5)})).Error().Should(Succeed())
+		srv := web.CreateWebServer(afterStore, web.WithFeedMaxItems(2))
+
+		// The actions following the item are served, rather than the
+		// newest ones, newest first.
+		for _, path := range []string{
+			"/feed.xml?after_id=1-2", "/feed.xml?handle=Petr&after_id=1-2",
+		} {
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet, path, nil)
+			Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+			Expect(feedRec.Code).Should(Equal(http.StatusOK))
+			body := feedRec.Body.String()
+			Expect(strings.Count(body, "<item>")).Should(Equal(2))
+			Expect(body).Should(ContainSubstring("comment-4"))
+			Expect(strings.Index(body, "comment-4")).Should(
+				BeNumerically("<", strings.Index(body, "comment-3")))
+			Expect(body).ShouldNot(ContainSubstring("comment-5"))
+		}
+	})
+
+	It("should honor If-Modified-Since", func() {
+		modifiedStore := memory.NewMemoryStore()
+		Expect(modifiedStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{
+				{
+					TimeSeconds: 1000,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 1},
+				},
+				{
+					TimeSeconds: 2000,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 2},
+				},
+			})).Error().Should(Succeed())
+		srv := web.CreateWebServer(modifiedStore)
+		lastModified := time.Unix(2000, 0).UTC().Format(http.TimeFormat)
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		httpReq.Header.Set(echo.HeaderIfModifiedSince,
+			time.Unix(1999, 0).UTC().Format(http.TimeFormat))
+		Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(feedRec.Header().Get(echo.HeaderLastModified)).
+			Should(Equal(lastModified))
+		Expect(feedRec.Body.Len()).ShouldNot(BeZero())
+
+		notModifiedRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		httpReq.Header.Set(echo.HeaderIfModifiedSince, lastModified)
+		Expect(srv.Feed(e.NewContext(httpReq, notModifiedRec))).Should(BeNil())
+		Expect(notModifiedRec.Code).Should(Equal(http.StatusNotModified))
+		Expect(notModifiedRec.Body.Len()).Should(BeZero())
+
+		// An edit of the blog entry is a newer revision of the feed.
+		Expect(modifiedStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: 2000,
+				BlogEntry: &models.BlogEntry{Id: 1, Title: "Edited",
+					ModificationTimeSeconds: 2500},
+				Comment: &models.Comment{Id: 2},
+			}})).Error().Should(Succeed())
+		editedRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		httpReq.Header.Set(echo.HeaderIfModifiedSince, lastModified)
+		Expect(srv.Feed(e.NewContext(httpReq, editedRec))).Should(BeNil())
+		Expect(editedRec.Code).Should(Equal(http.StatusOK))
+		Expect(editedRec.Header().Get(echo.HeaderLastModified)).Should(Equal(
+			time.Unix(2500, 0).UTC().Format(http.TimeFormat)))
+	})
+
+	It("should prefer If-None-Match to If-Modified-Since", func() {
+		modifiedStore := memory.NewMemoryStore()
+		Expect(modifiedStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{
+				{
+					TimeSeconds: 1000,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 1},
+				},
+				{
+					TimeSeconds: 2000,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 2},
+				},
+			})).Error().Should(Succeed())
+		srv := web.CreateWebServer(modifiedStore)
+		lastModified := time.Unix(2000, 0).UTC().Format(http.TimeFormat)
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(feedRec.Header().Get(echo.HeaderLastModified)).
+			Should(Equal(lastModified))
+
+		// An older action stored late changes the feed, without a newer
+		// action, hence If-Modified-Since is not enough to tell.
+		Expect(modifiedStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: 1500,
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment:     &models.Comment{Id: 3},
+			}})).Error().Should(Succeed())
+		modifiedRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		httpReq.Header.Set(echo.HeaderIfModifiedSince, lastModified)
+		httpReq.Header.Set("If-None-Match", feedRec.Header().Get("ETag"))
+		Expect(srv.Feed(e.NewContext(httpReq, modifiedRec))).Should(BeNil())
+		Expect(modifiedRec.Code).Should(Equal(http.StatusOK))
+		Expect(modifiedRec.Body.String()).Should(ContainSubstring("comment-3"))
+	})
+
+	It("should honor If-None-Match", func() {
+		etagStore := memory.NewMemoryStore()
+		Expect(etagStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: 1000,
+				BlogEntry:   &models.BlogEntry{Id: 1},
+				Comment:     &models.Comment{Id: 1},
+			}})).Error().Should(Succeed())
+		srv := web.CreateWebServer(etagStore)
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		etag := feedRec.Header().Get("ETag")
+		Expect(etag).Should(HavePrefix(`"`))
+
+		sameRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		Expect(srv.Feed(e.NewContext(httpReq, sameRec))).Should(BeNil())
+		Expect(sameRec.Header().Get("ETag")).Should(Equal(etag))
+
+		notModifiedRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		httpReq.Header.Set("If-None-Match", `"stale", `+etag)
+		Expect(srv.Feed(e.NewContext(httpReq, notModifiedRec))).Should(BeNil())
+		Expect(notModifiedRec.Code).Should(Equal(http.StatusNotModified))
+		Expect(notModifiedRec.Body.Len()).Should(BeZero())
+
+		staleRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/feed.xml?since=0", nil)
+		httpReq.Header.Set("If-None-Match", `"stale"`)
+		Expect(srv.Feed(e.NewContext(httpReq, staleRec))).Should(BeNil())
+		Expect(staleRec.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should search the actions", func() {
+		searchStore := memory.NewMemoryStore()
+		Expect(searchStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{
+				{
+					TimeSeconds: 10,
+					BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				},
+				{
+					TimeSeconds: 20,
+					BlogEntry:   &models.BlogEntry{Id: 2, Title: "Round 901"},
+				},
+				{
+					TimeSeconds: 30,
+					BlogEntry:   &models.BlogEntry{Id: 3, Title: "Other"},
+				},
+			})).Error().Should(Succeed())
+		srv := web.CreateWebServer(searchStore)
+
+		searchRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/search?q=round&limit=1",
+			nil)
+		Expect(srv.Search(e.NewContext(httpReq, searchRec))).Should(BeNil())
+		Expect(searchRec.Code).Should(Equal(http.StatusOK))
+		Expect(searchRec.Body.String()).Should(ContainSubstring("Round 901"))
+		Expect(searchRec.Body.String()).ShouldNot(ContainSubstring("Round 900"))
+
+		for _, rawQuery := range []string{"q=", "q=round&limit=zero"} {
+			badRec := httptest.NewRecorder()
+			httpReq, _ = http.NewRequest(http.MethodGet, "/search?"+rawQuery,
+				nil)
+			Expect(srv.Search(e.NewContext(httpReq, badRec))).Should(BeNil())
+			Expect(badRec.Code).Should(Equal(http.StatusBadRequest))
+		}
+	})
+
+	It("should serve the actions as JSON", func() {
+		actionsStore := memory.NewMemoryStore()
+		srv := web.CreateWebServer(actionsStore)
+
+		emptyRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/api/actions", nil)
+		Expect(srv.Actions(e.NewContext(httpReq, emptyRec))).Should(BeNil())
+		Expect(emptyRec.Code).Should(Equal(http.StatusOK))
+		Expect(emptyRec.Header().Get(echo.HeaderContentType)).
+			Should(HavePrefix(echo.MIMEApplicationJSON))
+		Expect(strings.TrimSpace(emptyRec.Body.String())).Should(Equal("[]"))
+
+		Expect(actionsStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{
+				{
+					TimeSeconds: 100,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 1},
+				},
+				{
+					TimeSeconds: 200,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 2},
+				},
+			})).Error().Should(Succeed())
+
+		actionsRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet,
+			"/api/actions?since=0&limit=1", nil)
+		Expect(srv.Actions(e.NewContext(httpReq, actionsRec))).Should(BeNil())
+		Expect(actionsRec.Code).Should(Equal(http.StatusOK))
+		Expect(actionsRec.Body.String()).Should(ContainSubstring(`"timeSeconds":200`))
+		Expect(actionsRec.Body.String()).ShouldNot(ContainSubstring(`"timeSeconds":100`))
+
+		badRec := httptest.NewRecorder()
+		httpReq, _ = http.NewRequest(http.MethodGet, "/api/actions?since=now",
+			nil)
+		Expect(srv.Actions(e.NewContext(httpReq, badRec))).Should(BeNil())
+		Expect(badRec.Code).Should(Equal(http.StatusBadRequest))
+	})
+
+	It("should serve the JSON API under v1 and the legacy paths", func() {
+		routedStore := memory.NewMemoryStore()
+		Expect(routedStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: time.Now().Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 901"},
+				Comment:     &models.Comment{Id: 1, Text: "Nice round"},
+			}})).Error().Should(Succeed())
+		handler := web.Handler(web.CreateWebServer(routedStore))
+
+		for _, path := range []string{
+			"/api/v1/search?q=round", "/search?q=round",
+			"/api/v1/actions", "/api/actions",
+		} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path,
+				nil))
+			Expect(rec.Code).Should(Equal(http.StatusOK), path)
+			Expect(rec.Header().Get(echo.HeaderContentType)).
+				Should(HavePrefix(echo.MIMEApplicationJSON), path)
+			Expect(rec.Body.String()).Should(ContainSubstring("Nice round"),
+				path)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+			"/api/v1/search?q=", nil))
+		Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+	})
+
+	It("should render a single action as a page and a feed", func() {
+		actionStore := memory.NewMemoryStore()
+		Expect(actionStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: 100,
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				Comment: &models.Comment{
+					Id:                2,
+					CommentatorHandle: "tourist",
+				},
+			}})).Error().Should(Succeed())
+		srv := web.CreateWebServer(actionStore)
+
+		newContext := func(rec *httptest.ResponseRecorder,
+			id string) echo.Context {
+			httpReq, _ := http.NewRequest(http.MethodGet, "/action/"+id, nil)
+			c := e.NewContext(httpReq, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+			return c
+		}
+
+		pageRec := httptest.NewRecorder()
+		Expect(srv.ActionPage(newContext(pageRec, "1-2"))).Should(BeNil())
+		Expect(pageRec.Code).Should(Equal(http.StatusOK))
+		Expect(pageRec.Header().Get(echo.HeaderContentType)).
+			Should(HavePrefix(echo.MIMETextHTML))
+		Expect(pageRec.Body.String()).
+			Should(ContainSubstring("tourist commented on Round 900"))
+
+		feedRec := httptest.NewRecorder()
+		Expect(srv.ActionFeed(newContext(feedRec, "1-2"))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(strings.Count(feedRec.Body.String(), "<item>")).Should(Equal(1))
+
+		for _, id := range []string{"1-3", "1", "x-y"} {
+			missingRec := httptest.NewRecorder()
+			Expect(srv.ActionPage(newContext(missingRec, id))).Should(BeNil())
+			Expect(missingRec.Code).Should(Equal(http.StatusNotFound))
+		}
+	})
+
+	It("should render the permalinks with the options of the feeds", func() {
+		actionStore := memory.NewMemoryStore()
+		Expect(actionStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: 100,
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				Comment: &models.Comment{
+					Id:                2,
+					CommentatorHandle: "tourist",
+					Locale:            "en",
+					Text:              "<b>Hi</b>",
+				},
+			}})).Error().Should(Succeed())
+		srv := web.CreateWebServer(actionStore,
+			web.WithPublicURL("https://cfrss.example.com"),
+			web.WithFeedOptions(
+				feed.WithTitle("Codeforces in Russian"),
+				feed.WithLocale("ru"),
+				feed.WithSanitizePolicy(feed.StrictPolicy()),
+				feed.WithMinContentLength(1000)))
+		handler := web.Handler(srv)
+
+		feedRec := httptest.NewRecorder()
+		handler.ServeHTTP(feedRec, httptest.NewRequest(http.MethodGet,
+			"/action/1-2/feed.xml", nil))
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		body := feedRec.Body.String()
+		Expect(body).Should(ContainSubstring("Codeforces in Russian"))
+		Expect(body).Should(ContainSubstring(
+			"https://cfrss.example.com/action/1-2/feed.xml"))
+		Expect(body).Should(ContainSubstring("[en] tourist commented"))
+		Expect(body).ShouldNot(ContainSubstring("&lt;b&gt;"))
+		Expect(strings.Count(body, "<item>")).Should(Equal(1))
+
+		pageRec := httptest.NewRecorder()
+		handler.ServeHTTP(pageRec, httptest.NewRequest(http.MethodGet,
+			"/action/1-2", nil))
+		Expect(pageRec.Code).Should(Equal(http.StatusOK))
+		Expect(pageRec.Body.String()).Should(ContainSubstring(`lang="ru"`))
+		Expect(pageRec.Body.String()).Should(
+			ContainSubstring("[en] tourist commented"))
+	})
+
+	It("should color the authors by their cached rating", func() {
+		ratingStore := memory.NewMemoryStore()
+		Expect(ratingStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: time.Now().Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				Comment: &models.Comment{
+					Id:                2,
+					CommentatorHandle: "tourist",
+				},
+			}})).Error().Should(Succeed())
+		cfClient := mock.NewCodeforcesClient()
+		cfClient.SetUsers(models.CodeforcesUser{Handle: "tourist",
+			Rating: 3800})
+		srv := web.CreateWebServer(ratingStore,
+			web.WithAuthorRatings(cfClient))
+
+		for i := 0; i < 2; i++ {
+			feedRec := httptest.NewRecorder()
+			httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml", nil)
+			Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+			Expect(feedRec.Code).Should(Equal(http.StatusOK))
+			Expect(feedRec.Body.String()).Should(ContainSubstring("user-red"))
+		}
+		Expect(cfClient.Calls()).Should(Equal(1))
+	})
+
+	It("should drop the authors rated below the minimum", func() {
+		ratingStore := memory.NewMemoryStore()
+		Expect(ratingStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: time.Now().Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				Comment: &models.Comment{
+					Id:                2,
+					CommentatorHandle: "tourist",
+				},
+			}, {
+				TimeSeconds: time.Now().Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				Comment: &models.Comment{
+					Id:                3,
+					CommentatorHandle: "newbie",
+				},
+			}})).Error().Should(Succeed())
+		cfClient := mock.NewCodeforcesClient()
+		cfClient.SetUsers(
+			models.CodeforcesUser{Handle: "tourist", Rating: 3800},
+			models.CodeforcesUser{Handle: "newbie", Rating: 1000})
+		srv := web.CreateWebServer(ratingStore,
+			web.WithMinRating(cfClient, 2400, false))
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml", nil)
+		Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(feedRec.Body.String()).Should(ContainSubstring("tourist"))
+		Expect(feedRec.Body.String()).ShouldNot(ContainSubstring("newbie"))
+		Expect(feedRec.Body.String()).ShouldNot(ContainSubstring("user-"))
+	})
+
+	It("should serve the feed when the ratings are unavailable", func() {
+		ratingStore := memory.NewMemoryStore()
+		Expect(ratingStore.AddRecentActions(context.TODO(),
+			[]models.RecentAction{{
+				TimeSeconds: time.Now().Unix(),
+				BlogEntry:   &models.BlogEntry{Id: 1, Title: "Round 900"},
+				Comment: &models.Comment{
+					Id:                2,
+					CommentatorHandle: "unknown",
+				},
+			}})).Error().Should(Succeed())
+		srv := web.CreateWebServer(ratingStore,
+			web.WithAuthorRatings(mock.NewCodeforcesClient()))
+
+		feedRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/feed.xml", nil)
+		Expect(srv.Feed(e.NewContext(httpReq, feedRec))).Should(BeNil())
+		Expect(feedRec.Code).Should(Equal(http.StatusOK))
+		Expect(feedRec.Body.String()).ShouldNot(ContainSubstring("user-"))
+	})
+
+	It("should report healthy when the scheduler is fresh", func() {
+		srv := web.CreateWebServer(inMemoryStore,
+			web.WithScheduler(dummyScheduler))
+
+		healthRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+		Expect(srv.Healthz(e.NewContext(httpReq, healthRec))).Should(BeNil())
+		Expect(healthRec.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should report unhealthy when the scheduler is stale", func() {
+		staleScheduler := scheduler.NewScheduler(dummyCfClient, inMemoryStore,
+			100, time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		srv := web.CreateWebServer(inMemoryStore,
+			web.WithScheduler(staleScheduler))
+
+		healthRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+		Expect(srv.Healthz(e.NewContext(httpReq, healthRec))).Should(BeNil())
+		Expect(healthRec.Code).Should(Equal(http.StatusServiceUnavailable))
+		Expect(healthRec.Body.String()).Should(ContainSubstring("scheduler"))
+	})
+
+	It("should report unhealthy when the store can't be pinged", func() {
+		srv := web.CreateWebServer(inMemoryStore)
+
+		// The ping is bound by the context of the request.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		healthRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+			"/healthz", nil)
+		Expect(srv.Healthz(e.NewContext(httpReq, healthRec))).Should(BeNil())
+		Expect(healthRec.Code).Should(Equal(http.StatusServiceUnavailable))
+		Expect(healthRec.Body.String()).Should(ContainSubstring(
+			`"store":"context canceled"`))
+	})
+
+	It("should expose the state of the scheduler for debugging", func() {
+		srv := web.CreateWebServer(inMemoryStore,
+			web.WithScheduler(dummyScheduler), web.WithDebug())
+
+		debugRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/debug/scheduler", nil)
+		Expect(srv.DebugScheduler(e.NewContext(httpReq, debugRec))).
+			Should(BeNil())
+		Expect(debugRec.Code).Should(Equal(http.StatusOK))
+
+		var stats scheduler.Stats
+		Expect(json.Unmarshal(debugRec.Body.Bytes(), &stats)).Should(Succeed())
+		Expect(stats.Cooldown).Should(Equal(time.Second))
+		Expect(stats.StoredActions).Should(BeNumerically(">=", 0))
+
+		missingRec := httptest.NewRecorder()
+		Expect(web.CreateWebServer(inMemoryStore).DebugScheduler(
+			e.NewContext(httpReq, missingRec))).Should(BeNil())
+		Expect(missingRec.Code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("should report the build", func() {
+		info := web.BuildInfo{
+			Version:   "v1.2.3",
+			GitCommit: "abc123",
+			GoVersion: "go1.18",
+		}
+		srv := web.CreateWebServer(inMemoryStore, web.WithBuildInfo(info))
+
+		versionRec := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(http.MethodGet, "/version", nil)
+		Expect(srv.Version(e.NewContext(httpReq, versionRec))).Should(BeNil())
+		Expect(versionRec.Code).Should(Equal(http.StatusOK))
+
+		var got web.BuildInfo
+		Expect(json.Unmarshal(versionRec.Body.Bytes(), &got)).Should(Succeed())
+		Expect(got).Should(Equal(info))
+	})
 })
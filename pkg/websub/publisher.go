@@ -0,0 +1,126 @@
+// Package websub notifies WebSub (formerly PubSubHubbub) hubs when the feeds
+// change, so that subscribers get the new items without polling.
+package websub
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	kDefaultMaxAttempts = 3
+	kDefaultBaseDelay   = time.Second
+)
+
+// Publisher pings the configured hubs with the URLs of the updated feeds.
+type Publisher struct {
+	client http.Client
+	hubs   []string
+
+	// maxAttempts is the number of attempts per hub, and baseDelay is the
+	// delay before the first retry, doubled on each subsequent one.
+	maxAttempts int
+	baseDelay   time.Duration
+}
+
+// Option customizes the publisher created by NewPublisher.
+type Option func(pub *Publisher)
+
+// WithRetries overrides the number of attempts per hub and the delay before
+// the first retry.
+func WithRetries(maxAttempts int, baseDelay time.Duration) Option {
+	return func(pub *Publisher) {
+		pub.maxAttempts = maxAttempts
+		pub.baseDelay = baseDelay
+	}
+}
+
+// Publish notifies every hub that the feed at topicUrl has changed. All the
+// hubs are attempted, and the first failure is returned.
+func (pub *Publisher) Publish(ctx context.Context, topicUrl string) error {
+	var firstErr error
+	for _, hub := range pub.hubs {
+		if err := pub.publishToHub(ctx, hub, topicUrl); err != nil {
+			zap.S().Errorf("Could not publish %s to hub %s with error [%+v]",
+				topicUrl, hub, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// publishToHub sends the publish request to a single hub, retrying the
+// failures.
+func (pub *Publisher) publishToHub(ctx context.Context, hub,
+	topicUrl string) error {
+	delay := pub.baseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = pub.publishOnce(ctx, hub, topicUrl); err == nil ||
+			attempt >= pub.maxAttempts {
+			return err
+		}
+
+		zap.S().Warnf("Attempt %d to publish to hub %s failed with error "+
+			"[%v], retrying in %v", attempt, hub, err, delay)
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("publishing to hub %s was cancelled "+
+				"with error [%v]", hub, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (pub *Publisher) publishOnce(ctx context.Context, hub,
+	topicUrl string) error {
+	form := url.Values{}
+	form.Set("hub.mode", "publish")
+	form.Set("hub.url", topicUrl)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hub,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Errorf("could not create request for hub %s "+
+			"with error [%v]", hub, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := pub.client.Do(req)
+	if err != nil {
+		return errors.Errorf("http call to hub %s failed with error [%v]",
+			hub, err)
+	}
+	defer resp.Body.Close()
+
+	// Hubs acknowledge the publish request with any 2xx status.
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("hub %s responded with status %d",
+			hub, resp.StatusCode)
+	}
+	return nil
+}
+
+// NewPublisher creates a publisher that notifies the given hubs.
+func NewPublisher(hubs []string, timeOut time.Duration,
+	opts ...Option) *Publisher {
+	pub := &Publisher{
+		client:      http.Client{Timeout: timeOut},
+		hubs:        hubs,
+		maxAttempts: kDefaultMaxAttempts,
+		baseDelay:   kDefaultBaseDelay,
+	}
+	for _, opt := range opts {
+		opt(pub)
+	}
+	return pub
+}
@@ -0,0 +1,102 @@
+package websub_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/websub"
+)
+
+var _ = Describe("Publisher", func() {
+	ctx := context.Background()
+	topicUrl := "https://cfrss.example.com/feed.xml"
+
+	It("should send the publish request to every hub", func() {
+		var calls int32
+		hub := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				Expect(r.Method).Should(Equal(http.MethodPost))
+				Expect(r.FormValue("hub.mode")).Should(Equal("publish"))
+				Expect(r.FormValue("hub.url")).Should(Equal(topicUrl))
+				w.WriteHeader(http.StatusNoContent)
+			}))
+		defer hub.Close()
+
+		pub := websub.NewPublisher([]string{hub.URL, hub.URL}, time.Second)
+		Expect(pub.Publish(ctx, topicUrl)).Should(Succeed())
+		Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(2)))
+	})
+
+	It("should retry a failing hub", func() {
+		var calls int32
+		hub := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+		defer hub.Close()
+
+		pub := websub.NewPublisher([]string{hub.URL}, time.Second,
+			websub.WithRetries(3, time.Millisecond))
+		Expect(pub.Publish(ctx, topicUrl)).Should(Succeed())
+		Expect(atomic.LoadInt32(&calls)).Should(Equal(int32(2)))
+	})
+
+	It("should give up after the last attempt", func() {
+		hub := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+		defer hub.Close()
+
+		pub := websub.NewPublisher([]string{hub.URL}, time.Second,
+			websub.WithRetries(2, time.Millisecond))
+		Expect(pub.Publish(ctx, topicUrl)).ShouldNot(Succeed())
+	})
+
+	It("should publish the queued topics in the background", func() {
+		release := make(chan struct{})
+		var calls int32
+		hub := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				w.WriteHeader(http.StatusNoContent)
+			}))
+		defer hub.Close()
+		defer close(release)
+
+		queueCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		queue := websub.NewQueue(websub.NewPublisher([]string{hub.URL},
+			time.Second, websub.WithRetries(1, time.Millisecond)), 1)
+		go queue.Run(queueCtx)
+
+		// The hub holds up the first publish, so the second one fills the
+		// queue and the third one is dropped, without blocking the caller.
+		Expect(queue.Enqueue(topicUrl)).Should(BeTrue())
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&calls)
+		}).Should(Equal(int32(1)))
+		Expect(queue.Enqueue(topicUrl)).Should(BeTrue())
+		Expect(queue.Enqueue(topicUrl)).Should(BeFalse())
+
+		release <- struct{}{}
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&calls)
+		}).Should(Equal(int32(2)))
+		Consistently(func() int32 {
+			return atomic.LoadInt32(&calls)
+		}, 100*time.Millisecond).Should(Equal(int32(2)))
+	})
+})
@@ -0,0 +1,47 @@
+package websub
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Queue publishes in the background, so that slow or unreachable hubs don't
+// hold up the caller, e.g, the cycles of the scheduler. The queue is
+// bounded, and the publishes that don't fit are dropped, since hubs only
+// need to know that the feed changed since their last fetch.
+type Queue struct {
+	pub    *Publisher
+	topics chan string
+}
+
+// NewQueue creates a queue holding up to size pending publishes of pub.
+func NewQueue(pub *Publisher, size int) *Queue {
+	return &Queue{pub: pub, topics: make(chan string, size)}
+}
+
+// Enqueue schedules a publish of topicUrl without waiting for it, and
+// returns false if the queue is full.
+func (queue *Queue) Enqueue(topicUrl string) bool {
+	select {
+	case queue.topics <- topicUrl:
+		return true
+	default:
+		zap.S().Warnf("WebSub queue is full, dropping the publish of %s",
+			topicUrl)
+		return false
+	}
+}
+
+// Run publishes the queued topics one at a time until the context is
+// cancelled. The failures are logged by the publisher.
+func (queue *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case topicUrl := <-queue.topics:
+			queue.pub.Publish(ctx, topicUrl)
+		}
+	}
+}
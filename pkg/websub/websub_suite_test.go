@@ -0,0 +1,13 @@
+package websub_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWebsub(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Websub Suite")
+}